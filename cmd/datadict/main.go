@@ -0,0 +1,83 @@
+// Command datadict renders a data dictionary (Markdown or HTML) from a schema
+// bundle file, without connecting to any database.
+//
+// Usage:
+//
+//	datadict -in schema.json -format html -out dictionary.html -templates brand.tmpl
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	so "github.com/everpan/go-mdm/schema-orm"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "datadict: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("datadict", flag.ContinueOnError)
+	var (
+		in        string
+		out       string
+		format    string
+		title     string
+		templates string
+	)
+	fs.StringVar(&in, "in", "", "schema bundle file (JSON or YAML)")
+	fs.StringVar(&out, "out", "", "output file (default stdout)")
+	fs.StringVar(&format, "format", "", "md or html (default from -out extension, else md)")
+	fs.StringVar(&title, "title", "", "document title")
+	fs.StringVar(&templates, "templates", "", "file with {{define}} blocks overriding the default templates")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if in == "" {
+		return fmt.Errorf("-in is required")
+	}
+	if format == "" {
+		format = "md"
+		if ext := strings.ToLower(filepath.Ext(out)); ext == ".html" || ext == ".htm" {
+			format = "html"
+		}
+	}
+
+	bundle, err := so.LoadBundle(in)
+	if err != nil {
+		return err
+	}
+	opts := so.DictionaryOptions{Title: title, Naming: bundle.Naming}
+	if templates != "" {
+		b, err := os.ReadFile(templates)
+		if err != nil {
+			return err
+		}
+		opts.Templates = string(b)
+	}
+
+	w := stdout
+	if out != "" {
+		f, err := os.Create(out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	switch format {
+	case "md", "markdown":
+		return so.WriteMarkdownDictionary(w, bundle.Tables, opts)
+	case "html":
+		return so.WriteHTMLDictionary(w, bundle.Tables, opts)
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
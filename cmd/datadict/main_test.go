@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const bundleJSON = `{"version":"1","tables":[{"name":"customer","comment":"Golden customer record",
+"columns":[{"name":"id","sqlType":{"name":"INT"},"isPrimaryKey":true},{"name":"email","sqlType":{"name":"VARCHAR"},"length":255,"nullable":true}]}]}`
+
+func writeBundle(t *testing.T) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "schema.json")
+	if err := os.WriteFile(p, []byte(bundleJSON), 0o644); err != nil {
+		t.Fatalf("write bundle: %v", err)
+	}
+	return p
+}
+
+func TestRun_MarkdownToStdout(t *testing.T) {
+	var buf bytes.Buffer
+	if err := run([]string{"-in", writeBundle(t), "-title", "Catalogue"}, &buf); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	out := buf.String()
+	if !strings.HasPrefix(out, "# Catalogue") || !strings.Contains(out, "| email | VARCHAR(255) | YES |") {
+		t.Fatalf("unexpected markdown:\n%s", out)
+	}
+}
+
+func TestRun_HTMLFileWithTemplates(t *testing.T) {
+	dir := t.TempDir()
+	tmpl := filepath.Join(dir, "brand.tmpl")
+	if err := os.WriteFile(tmpl, []byte(`{{define "footer"}}<footer>ACME</footer>{{end}}`), 0o644); err != nil {
+		t.Fatalf("write templates: %v", err)
+	}
+	out := filepath.Join(dir, "dict.html")
+	if err := run([]string{"-in", writeBundle(t), "-out", out, "-templates", tmpl}, io.Discard); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !strings.Contains(string(b), "<footer>ACME</footer>") || !strings.Contains(string(b), "Golden customer record") {
+		t.Fatalf("unexpected html:\n%s", b)
+	}
+}
+
+func TestRun_Errors(t *testing.T) {
+	bundle := writeBundle(t)
+	cases := [][]string{
+		{},
+		{"-in", filepath.Join(t.TempDir(), "missing.json")},
+		{"-in", bundle, "-format", "pdf"},
+		{"-in", bundle, "-templates", filepath.Join(t.TempDir(), "missing.tmpl")},
+		{"-in", bundle, "-out", filepath.Join(t.TempDir(), "no", "dir.md")},
+		{"-bogus"},
+	}
+	for _, args := range cases {
+		if err := run(args, io.Discard); err == nil {
+			t.Fatalf("expected error for %v", args)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Command eventschema renders Protobuf or Avro schemas from a schema bundle
+// file, without connecting to any database. Field numbers are kept in a
+// numbering file that is updated in place, so regenerating after a schema
+// change never renumbers existing fields.
+//
+// Usage:
+//
+//	eventschema -in schema.json -numbers fields.yaml -format proto -package crm.v1 -out crm.proto
+//	eventschema -in schema.json -numbers fields.yaml -format avro -namespace com.acme.crm
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	so "github.com/everpan/go-mdm/schema-orm"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "eventschema: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("eventschema", flag.ContinueOnError)
+	var (
+		in        string
+		numbers   string
+		out       string
+		format    string
+		pkg       string
+		goPackage string
+		namespace string
+	)
+	fs.StringVar(&in, "in", "", "schema bundle file (JSON or YAML)")
+	fs.StringVar(&numbers, "numbers", "", "field numbering file, created or updated (required for proto)")
+	fs.StringVar(&out, "out", "", "output file (default stdout)")
+	fs.StringVar(&format, "format", "", "proto or avro (default from -out extension, else proto)")
+	fs.StringVar(&pkg, "package", "", "protobuf package")
+	fs.StringVar(&goPackage, "go-package", "", "protobuf go_package option")
+	fs.StringVar(&namespace, "namespace", "", "Avro namespace")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if in == "" {
+		return fmt.Errorf("-in is required")
+	}
+	if format == "" {
+		format = "proto"
+		if ext := strings.ToLower(filepath.Ext(out)); ext == ".avsc" || ext == ".json" {
+			format = "avro"
+		}
+	}
+	if format != "proto" && format != "avro" {
+		return fmt.Errorf("unknown format %q", format)
+	}
+	if format == "proto" && numbers == "" {
+		return fmt.Errorf("-numbers is required for proto")
+	}
+
+	bundle, err := so.LoadBundle(in)
+	if err != nil {
+		return err
+	}
+	var numbering so.FieldNumbering
+	if numbers != "" {
+		if numbering, err = so.LoadFieldNumbering(numbers); err != nil {
+			return err
+		}
+		if numbering.Assign(bundle.Tables) {
+			if err := numbering.WriteFile(numbers); err != nil {
+				return err
+			}
+		}
+	}
+
+	w := stdout
+	if out != "" {
+		f, err := os.Create(out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	if format == "avro" {
+		return so.WriteAvroSchemas(w, bundle.Tables, numbering, so.AvroOptions{Namespace: namespace, Naming: bundle.Naming})
+	}
+	return so.WriteProto(w, bundle.Tables, numbering, so.ProtoOptions{Package: pkg, GoPackage: goPackage, Naming: bundle.Naming})
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const bundleV1 = `{"version":"1","tables":[{"name":"customer","comment":"Golden customer record",
+"columns":[{"name":"id","sqlType":{"name":"BIGINT"},"isPrimaryKey":true},{"name":"email","sqlType":{"name":"VARCHAR"},"length":255,"nullable":true},
+{"name":"fax","sqlType":{"name":"VARCHAR"},"length":32,"nullable":true}]}]}`
+
+// v2 drops fax and adds created_at in front of email
+const bundleV2 = `{"version":"1","tables":[{"name":"customer","comment":"Golden customer record",
+"columns":[{"name":"id","sqlType":{"name":"BIGINT"},"isPrimaryKey":true},{"name":"created_at","sqlType":{"name":"DATETIME"}},
+{"name":"email","sqlType":{"name":"VARCHAR"},"length":255,"nullable":true}]}]}`
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return p
+}
+
+func TestRun_ProtoRegenerationKeepsNumbers(t *testing.T) {
+	dir := t.TempDir()
+	numbers := filepath.Join(dir, "fields.yaml")
+
+	var buf bytes.Buffer
+	if err := run([]string{"-in", writeFile(t, dir, "v1.json", bundleV1), "-numbers", numbers, "-package", "crm.v1"}, &buf); err != nil {
+		t.Fatalf("run v1: %v", err)
+	}
+	if out := buf.String(); !strings.Contains(out, "package crm.v1;") || !strings.Contains(out, "optional string fax = 3;") {
+		t.Fatalf("unexpected v1 proto:\n%s", out)
+	}
+
+	buf.Reset()
+	if err := run([]string{"-in", writeFile(t, dir, "v2.json", bundleV2), "-numbers", numbers}, &buf); err != nil {
+		t.Fatalf("run v2: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`import "google/protobuf/timestamp.proto";`,
+		"reserved 3;",
+		`reserved "fax";`,
+		"int64 id = 1;",
+		"optional string email = 2;",
+		"google.protobuf.Timestamp created_at = 4;",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("v2 proto misses %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestRun_AvroFile(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "customer.avsc")
+	if err := run([]string{"-in", writeFile(t, dir, "v1.json", bundleV1), "-namespace", "com.acme", "-out", out}, nil); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	var records []struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+		Fields    []struct {
+			Name string `json:"name"`
+			Type any    `json:"type"`
+		} `json:"fields"`
+	}
+	if err := json.Unmarshal(b, &records); err != nil {
+		t.Fatalf("decode: %v\n%s", err, b)
+	}
+	if len(records) != 1 || records[0].Name != "Customer" || records[0].Namespace != "com.acme" || len(records[0].Fields) != 3 {
+		t.Fatalf("unexpected avro: %s", b)
+	}
+	if u, ok := records[0].Fields[1].Type.([]any); !ok || len(u) != 2 || u[0] != "null" {
+		t.Fatalf("nullable email should be a null union, got %#v", records[0].Fields[1].Type)
+	}
+}
+
+func TestRun_Errors(t *testing.T) {
+	dir := t.TempDir()
+	bundle := writeFile(t, dir, "v1.json", bundleV1)
+	cases := [][]string{
+		{},
+		{"-in", bundle},
+		{"-in", bundle, "-format", "thrift"},
+		{"-in", filepath.Join(dir, "missing.json"), "-numbers", filepath.Join(dir, "n.yaml")},
+	}
+	for _, args := range cases {
+		if err := run(args, &bytes.Buffer{}); err == nil {
+			t.Fatalf("expected error for %v", args)
+		}
+	}
+}
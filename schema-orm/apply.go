@@ -0,0 +1,70 @@
+package schema_orm
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"xorm.io/xorm"
+)
+
+// CreateTableSQLs renders the DDL for the given tables in the dialect of the engine:
+// one CREATE TABLE statement per table followed by its CREATE INDEX statements.
+// Index statements are emitted in name order so the output is deterministic.
+// Tables carrying a Schema are created under their schema-qualified name.
+func CreateTableSQLs(ctx context.Context, engine *xorm.Engine, tables []*Table) ([]string, error) {
+	return CreateTableSQLsWithNaming(ctx, engine, tables, nil)
+}
+
+// CreateTableSQLsWithNaming is CreateTableSQLs with index names built by the
+// naming strategy instead of Index.XName.
+func CreateTableSQLsWithNaming(ctx context.Context, engine *xorm.Engine, tables []*Table, naming *Naming) ([]string, error) {
+	namer, err := naming.IndexNamer()
+	if err != nil {
+		return nil, err
+	}
+	dialect := engine.Dialect()
+	out := make([]string, 0, len(tables))
+	for _, tb := range tables {
+		if tb == nil || tb.Name == "" {
+			return nil, fmt.Errorf("table without name")
+		}
+		xtb := ToXormTable(tb).Table
+		s, _, err := dialect.CreateTableSQL(ctx, engine.DB(), xtb, tb.FullName())
+		if err != nil {
+			return nil, fmt.Errorf("create table %s: %w", tb.Name, err)
+		}
+		out = append(out, s)
+
+		names := make([]string, 0, len(xtb.Indexes))
+		for name := range xtb.Indexes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			out = append(out, createIndexSQL(dialect, tb.FullName(), tb.Indexes[name], namer, naming.defaultIndexNames()))
+		}
+	}
+	return out, nil
+}
+
+// ApplyTables executes the DDL produced by CreateTableSQLs against the engine.
+// Tables are created with IF NOT EXISTS, so applying an existing table is a no-op
+// for the table itself.
+func ApplyTables(ctx context.Context, engine *xorm.Engine, tables []*Table) error {
+	return ApplyTablesWithNaming(ctx, engine, tables, nil)
+}
+
+// ApplyTablesWithNaming executes the DDL produced by CreateTableSQLsWithNaming.
+func ApplyTablesWithNaming(ctx context.Context, engine *xorm.Engine, tables []*Table, naming *Naming) error {
+	sqls, err := CreateTableSQLsWithNaming(ctx, engine, tables, naming)
+	if err != nil {
+		return err
+	}
+	for _, s := range sqls {
+		if _, err := engine.Context(ctx).Exec(s); err != nil {
+			return fmt.Errorf("exec %q: %w", s, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package schema_orm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	xs "xorm.io/xorm/schemas"
+)
+
+// AvroOptions controls the Avro schema generation. Record names follow the
+// same rules as protobuf messages (see ProtoOptions).
+type AvroOptions struct {
+	Namespace string
+	Naming    *Naming
+}
+
+// AvroRecord is an Avro record schema.
+type AvroRecord struct {
+	Type      string      `json:"type"`
+	Name      string      `json:"name"`
+	Namespace string      `json:"namespace,omitempty"`
+	Doc       string      `json:"doc,omitempty"`
+	Fields    []AvroField `json:"fields"`
+}
+
+// AvroField is a field of an Avro record. Type is a type name, a logical type
+// object or, for nullable columns, a ["null", type] union with a null default.
+type AvroField struct {
+	Name    string          `json:"name"`
+	Type    any             `json:"type"`
+	Doc     string          `json:"doc,omitempty"`
+	Default json.RawMessage `json:"default,omitempty"`
+}
+
+// avroType maps a column to an Avro type. DECIMAL/NUMERIC use the decimal
+// logical type with the column's precision and scale (38,0 when unset);
+// unsigned BIGINT, which exceeds long, is a decimal of precision 20.
+func avroType(col *Column) any {
+	var t any = "string"
+	switch strings.TrimSuffix(strings.ToUpper(col.SQLType.Name), "[]") {
+	case xs.Bool, "BOOLEAN":
+		t = "boolean"
+	case xs.Bit:
+		t = "long"
+		if col.Length <= 1 {
+			t = "boolean"
+		}
+	case xs.TinyInt, xs.SmallInt, xs.MediumInt, xs.Int, xs.Integer, xs.Serial, xs.Year,
+		xs.UnsignedTinyInt, xs.UnsignedSmallInt, xs.UnsignedMediumInt:
+		t = "int"
+	case xs.BigInt, xs.BigSerial, xs.UnsignedBit, xs.UnsignedInt:
+		t = "long"
+	case xs.UnsignedBigInt:
+		t = map[string]any{"type": "bytes", "logicalType": "decimal", "precision": 20, "scale": 0}
+	case xs.Float, xs.Real:
+		t = "float"
+	case xs.Double, "DOUBLE PRECISION":
+		t = "double"
+	case xs.Decimal, xs.Numeric, xs.Money, xs.SmallMoney:
+		precision, scale := col.Length, col.Length2
+		if precision <= 0 {
+			precision, scale = 38, 0
+		}
+		t = map[string]any{"type": "bytes", "logicalType": "decimal", "precision": precision, "scale": scale}
+	case xs.Date:
+		t = map[string]any{"type": "int", "logicalType": "date"}
+	case xs.Time:
+		t = map[string]any{"type": "long", "logicalType": "time-micros"}
+	case xs.DateTime, xs.TimeStamp, xs.TimeStampz, xs.SmallDateTime:
+		t = map[string]any{"type": "long", "logicalType": "timestamp-micros"}
+	case xs.Uuid:
+		t = map[string]any{"type": "string", "logicalType": "uuid"}
+	case xs.TinyBlob, xs.Blob, xs.MediumBlob, xs.LongBlob, xs.Bytea, xs.Binary, xs.VarBinary, "IMAGE":
+		t = "bytes"
+	}
+	if col.SQLType.IsArray() {
+		t = map[string]any{"type": "array", "items": t}
+	}
+	return t
+}
+
+// NewAvroRecord builds the Avro record schema of a table. With field numbers
+// the fields are ordered by number, so new columns are appended at the end;
+// without them the column order is used.
+func NewAvroRecord(tb *Table, numbers *FieldNumbers, opts AvroOptions) (*AvroRecord, error) {
+	name, err := messageName(tb, opts.Naming)
+	if err != nil {
+		return nil, err
+	}
+	cols := tb.Columns
+	if numbers != nil {
+		var missing []string
+		if cols, _, missing = numberedColumns(tb, numbers); len(missing) > 0 {
+			return nil, fmt.Errorf("table %s: no field number for %s", tb.FullName(), strings.Join(missing, ", "))
+		}
+	}
+	idents, err := fieldIdents(tb, cols)
+	if err != nil {
+		return nil, err
+	}
+	rec := &AvroRecord{Type: "record", Name: name, Namespace: opts.Namespace, Doc: tb.Comment, Fields: make([]AvroField, 0, len(cols))}
+	for i, col := range cols {
+		f := AvroField{Name: idents[i], Type: avroType(col), Doc: col.Comment}
+		if col.Nullable {
+			f.Type = []any{"null", f.Type}
+			f.Default = json.RawMessage("null")
+		}
+		rec.Fields = append(rec.Fields, f)
+	}
+	return rec, nil
+}
+
+// WriteAvroSchemas writes the records of all tables, in name order, as an
+// indented JSON array (an Avro union of the records).
+func WriteAvroSchemas(w io.Writer, tables []*Table, numbering FieldNumbering, opts AvroOptions) error {
+	sorted := make([]*Table, 0, len(tables))
+	for _, tb := range tables {
+		if tb != nil {
+			sorted = append(sorted, tb)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].FullName() < sorted[j].FullName() })
+	records := make([]*AvroRecord, 0, len(sorted))
+	for _, tb := range sorted {
+		var numbers *FieldNumbers
+		if numbering != nil {
+			numbers = numbering[tb.FullName()]
+		}
+		rec, err := NewAvroRecord(tb, numbers, opts)
+		if err != nil {
+			return err
+		}
+		records = append(records, rec)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(records)
+}
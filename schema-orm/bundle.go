@@ -0,0 +1,135 @@
+package schema_orm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// BundleVersion is the format version written into new schema bundles.
+const BundleVersion = "1"
+
+// Bundle is a schema bundle file: a set of tables plus the facts needed to use
+// them offline. Bundles are stored as JSON or YAML; a bare JSON/YAML array of
+// tables (the plain ExportSchemaToJSON output) is accepted as a bundle too.
+// Naming records the naming strategy the tables were built with, so DDL and
+// code generated from the bundle keep the same names.
+type Bundle struct {
+	Version string   `json:"version" yaml:"version"`
+	Dialect string   `json:"dialect,omitempty" yaml:"dialect,omitempty"`
+	Naming  *Naming  `json:"naming,omitempty" yaml:"naming,omitempty"`
+	Tables  []*Table `json:"tables" yaml:"tables"`
+}
+
+func NewBundle(dialect string, tables []*Table) *Bundle {
+	return &Bundle{Version: BundleVersion, Dialect: dialect, Tables: tables}
+}
+
+// Table returns the table with the given name or schema-qualified name, or nil.
+func (b *Bundle) Table(name string) *Table {
+	for _, tb := range b.Tables {
+		if tb.Name == name || tb.FullName() == name {
+			return tb
+		}
+	}
+	return nil
+}
+
+// ParseBundle decodes a bundle from JSON or YAML content.
+func ParseBundle(data []byte) (*Bundle, error) {
+	trimmed := bytes.TrimSpace(data)
+	b := &Bundle{}
+	var err error
+	switch {
+	case len(trimmed) == 0:
+		return nil, fmt.Errorf("empty schema bundle")
+	case trimmed[0] == '[':
+		err = json.Unmarshal(trimmed, &b.Tables)
+	case trimmed[0] == '{':
+		err = json.Unmarshal(trimmed, b)
+	default:
+		var node yaml.Node
+		if err = yaml.Unmarshal(trimmed, &node); err == nil && len(node.Content) > 0 && node.Content[0].Kind == yaml.SequenceNode {
+			err = node.Decode(&b.Tables)
+		} else if err == nil {
+			err = node.Decode(b)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse schema bundle: %w", err)
+	}
+	if b.Version == "" {
+		b.Version = BundleVersion
+	}
+	if err := b.Naming.Validate(); err != nil {
+		return nil, fmt.Errorf("schema bundle naming: %w", err)
+	}
+	return b, nil
+}
+
+// LoadBundle reads a schema bundle file.
+func LoadBundle(path string) (*Bundle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseBundle(data)
+}
+
+// WriteFile stores the bundle as YAML when path ends in .yaml/.yml and as
+// indented JSON otherwise, encoding one table at a time. It writes a temporary
+// file next to path and renames it over path once complete, so a failed write
+// leaves the previous file as it was.
+func (b *Bundle) WriteFile(path string) error {
+	format := BundleJSON
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		format = BundleYAML
+	}
+	mode := os.FileMode(0o644)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	err = b.encode(w, format)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Chmod(mode)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+func (b *Bundle) encode(w io.Writer, format BundleFormat) error {
+	enc, err := NewBundleEncoder(w, format, b)
+	if err != nil {
+		return err
+	}
+	for _, tb := range b.Tables {
+		if err := enc.Encode(tb); err != nil {
+			return err
+		}
+	}
+	return enc.Close()
+}
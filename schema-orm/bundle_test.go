@@ -0,0 +1,82 @@
+package schema_orm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBundle_WriteAndLoad(t *testing.T) {
+	tb := NewTable("customer", nil)
+	tb.Schema = "sales"
+	tb.AddColumn(&Column{Name: "id", SQLType: SQLType{Name: "INT"}, IsPrimaryKey: true})
+	fk := NewForeignKey("fk_region", "region")
+	fk.AddColumn("region_id", "id")
+	tb.AddForeignKey(fk)
+	b := NewBundle("postgres", []*Table{tb})
+
+	for _, name := range []string{"bundle.json", "bundle.yaml"} {
+		path := filepath.Join(t.TempDir(), name)
+		if err := b.WriteFile(path); err != nil {
+			t.Fatalf("%s write: %v", name, err)
+		}
+		back, err := LoadBundle(path)
+		if err != nil {
+			t.Fatalf("%s load: %v", name, err)
+		}
+		if back.Version != BundleVersion || back.Dialect != "postgres" || len(back.Tables) != 1 {
+			t.Fatalf("%s: unexpected bundle %+v", name, back)
+		}
+		got := back.Table("sales.customer")
+		if got == nil || back.Table("customer") != got || len(got.ForeignKeys) != 1 || got.ForeignKeys[0].RefCols[0] != "id" {
+			t.Fatalf("%s: table lost: %+v", name, got)
+		}
+		if back.Table("missing") != nil {
+			t.Fatalf("unexpected table")
+		}
+	}
+}
+
+func TestBundle_WriteFileKeepsOldOnError(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bundle.json")
+	tb := NewTable("customer", nil)
+	tb.AddColumn(&Column{Name: "id", SQLType: SQLType{Name: "INT"}})
+	if err := NewBundle("sqlite", []*Table{tb}).WriteFile(path); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	before, _ := os.ReadFile(path)
+
+	// a fixed zone cannot be encoded, so the second table fails
+	bad := NewTable("event", nil)
+	bad.AddColumn(&Column{Name: "at", SQLType: SQLType{Name: "DATETIME"}, TimeZone: time.FixedZone("UTC+8", 8*3600)})
+	if err := NewBundle("sqlite", []*Table{tb, bad}).WriteFile(path); err == nil {
+		t.Fatal("expected encoding error")
+	}
+	after, _ := os.ReadFile(path)
+	entries, _ := os.ReadDir(dir)
+	if string(after) != string(before) || len(entries) != 1 {
+		t.Fatalf("failed write changed the directory: %d entries\n%s", len(entries), after)
+	}
+}
+
+func TestParseBundle_BareArrays(t *testing.T) {
+	b, err := ParseBundle([]byte(`[{"name":"a","columns":[{"name":"id","sqlType":{"name":"INT"}}]}]`))
+	if err != nil || len(b.Tables) != 1 || b.Version != BundleVersion {
+		t.Fatalf("json array: %v %+v", err, b)
+	}
+	b, err = ParseBundle([]byte("- name: a\n  columns:\n    - name: id\n      sqlType: {name: INT}\n"))
+	if err != nil || len(b.Tables) != 1 || b.Tables[0].GetColumn("id") == nil {
+		t.Fatalf("yaml array: %v %+v", err, b)
+	}
+	if _, err := ParseBundle([]byte("  ")); err == nil {
+		t.Fatalf("expected error for empty bundle")
+	}
+	if _, err := ParseBundle([]byte("{bad")); err == nil {
+		t.Fatalf("expected error for bad json")
+	}
+	if _, err := LoadBundle(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Fatalf("expected error for missing file")
+	}
+}
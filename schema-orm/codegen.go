@@ -0,0 +1,197 @@
+package schema_orm
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"xorm.io/xorm/names"
+	xs "xorm.io/xorm/schemas"
+)
+
+// GoStructOptions controls WriteGoStructs.
+// Package defaults to "models"; Naming supplies the mappers used to turn table
+// and column names back into Go identifiers (a nil Naming uses the xorm defaults).
+type GoStructOptions struct {
+	Package string
+	Naming  *Naming
+}
+
+// plainTagValue matches defaults that survive an xorm tag unquoted
+var plainTagValue = regexp.MustCompile("^[^\\s,()`\"]+$")
+
+// WriteGoStructs renders one Go struct with xorm tags per table. Struct and
+// field names come from Table2Obj of the naming mappers (or Column.FieldName
+// when set), and explicit names are only written where Obj2Table would not
+// reproduce the table or column name, so parsing the generated structs with
+// ParseStruct and the same naming yields the same names.
+func WriteGoStructs(w io.Writer, tables []*Table, opts GoStructOptions) error {
+	tableMapper, columnMapper, err := opts.Naming.Mappers()
+	if err != nil {
+		return err
+	}
+	pkg := opts.Package
+	if pkg == "" {
+		pkg = "models"
+	}
+
+	sorted := make([]*Table, 0, len(tables))
+	for _, tb := range tables {
+		if tb != nil {
+			sorted = append(sorted, tb)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	var body bytes.Buffer
+	usesTime := false
+	for _, tb := range sorted {
+		structName := goName(tableMapper, tb.Name)
+		if tb.Comment != "" {
+			fmt.Fprintf(&body, "// %s %s\n", structName, oneLine(tb.Comment))
+		}
+		fmt.Fprintf(&body, "type %s struct {\n", structName)
+		for _, col := range tb.Columns {
+			fieldName := col.FieldName
+			if !token.IsIdentifier(fieldName) || !token.IsExported(fieldName) {
+				fieldName = goName(columnMapper, col.Name)
+			}
+			goType := goTypeName(col)
+			if goType == "time.Time" {
+				usesTime = true
+			}
+			tag := xormTag(tb, col, columnMapper.Obj2Table(fieldName) != col.Name)
+			fmt.Fprintf(&body, "\t%s %s `xorm:%q`", fieldName, goType, tag)
+			if col.Comment != "" {
+				fmt.Fprintf(&body, " // %s", oneLine(col.Comment))
+			}
+			body.WriteByte('\n')
+		}
+		body.WriteString("}\n\n")
+		if tableMapper.Obj2Table(structName) != tb.Name {
+			fmt.Fprintf(&body, "func (%s) TableName() string { return %q }\n\n", structName, tb.Name)
+		}
+	}
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "// Code generated by schema-orm. DO NOT EDIT.\n\npackage %s\n\n", pkg)
+	if usesTime {
+		src.WriteString("import \"time\"\n\n")
+	}
+	src.Write(body.Bytes())
+	out, err := format.Source(src.Bytes())
+	if err != nil {
+		return fmt.Errorf("format generated code: %w", err)
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// xormTag renders the xorm struct tag of a column.
+func xormTag(tb *Table, col *Column, withName bool) string {
+	var parts []string
+	if withName {
+		parts = append(parts, "'"+col.Name+"'")
+	}
+	parts = append(parts, ColumnTypeString(col))
+	if col.IsPrimaryKey {
+		parts = append(parts, "pk")
+	}
+	if col.IsAutoIncrement {
+		parts = append(parts, "autoincr")
+	}
+	if col.Nullable {
+		parts = append(parts, "null")
+	} else {
+		parts = append(parts, "notnull")
+	}
+	names := make([]string, 0, len(tb.Indexes))
+	for name, idx := range tb.Indexes {
+		for _, c := range idx.Cols {
+			if strings.EqualFold(c, col.Name) {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		kind := "index"
+		if tb.Indexes[name].Type == UniqueType {
+			kind = "unique"
+		}
+		parts = append(parts, kind+"("+name+")")
+	}
+	if col.Default != "" && !col.IsVersion && plainTagValue.MatchString(col.Default) {
+		parts = append(parts, "default("+col.Default+")")
+	}
+	switch {
+	case col.IsCreated:
+		parts = append(parts, "created")
+	case col.IsUpdated:
+		parts = append(parts, "updated")
+	case col.IsDeleted:
+		parts = append(parts, "deleted")
+	case col.IsVersion:
+		parts = append(parts, "version")
+	}
+	return strings.Join(parts, " ")
+}
+
+// goTypeName returns the Go type xorm maps the column's SQL type to.
+func goTypeName(col *Column) string {
+	if col.IsJSON || col.IsJSONB {
+		return "string"
+	}
+	t := xs.SQLType2Type(ToXormSQLType(col.SQLType))
+	if t == xs.BytesType {
+		return "[]byte"
+	}
+	return t.String()
+}
+
+// goName returns the Go identifier for a table or column name. When the mapper
+// can't reproduce the name from its own Table2Obj result (e.g. a PrefixMapper
+// given a name without the prefix) the snake-cased name is used instead and the
+// caller writes the name out explicitly.
+func goName(mapper names.Mapper, name string) string {
+	if ident := goIdent(mapper.Table2Obj(name)); mapper.Obj2Table(ident) == name {
+		return ident
+	}
+	return goIdent(names.SnakeMapper{}.Table2Obj(name))
+}
+
+// goIdent turns a mapped name into an exported Go identifier.
+func goIdent(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			b.WriteRune(r)
+		}
+	}
+	s := b.String()
+	r, size := utf8.DecodeRuneInString(s)
+	switch {
+	case s == "":
+		return "X"
+	case !unicode.IsLetter(r):
+		return "X" + s
+	}
+	s = string(unicode.ToUpper(r)) + s[size:]
+	if !token.IsExported(s) {
+		// letters without case (e.g. CJK) can't start an exported name
+		return "X" + s
+	}
+	return s
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
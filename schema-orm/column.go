@@ -15,7 +15,7 @@ const (
 )
 
 // Column mirrors xorm.io/xorm/schemas.Column with JSON/YAML tags
-// and the same field names /types.
+// and the same field names /types. Metadata has no xorm counterpart.
 type Column struct {
 	Name            string         `json:"name" yaml:"name"`
 	TableName       string         `json:"tableName,omitempty" yaml:"tableName,omitempty"`
@@ -41,9 +41,10 @@ type Column struct {
 	EnumOptions     map[string]int `json:"enumOptions,omitempty" yaml:"enumOptions,omitempty"`
 	SetOptions      map[string]int `json:"setOptions,omitempty" yaml:"setOptions,omitempty"`
 	DisableTimeZone bool           `json:"disableTimeZone,omitempty" yaml:"disableTimeZone,omitempty"`
-	TimeZone        *time.Location `json:"timeZone,omitempty" yaml:"timeZone,omitempty"`
+	TimeZone        *time.Location `json:"-" yaml:"-"` // encoded by name, see MarshalJSON
 	Comment         string         `json:"comment,omitempty" yaml:"comment,omitempty"`
 	Collation       string         `json:"collation,omitempty" yaml:"collation,omitempty"`
+	Metadata        *Metadata      `json:"metadata,omitempty" yaml:"metadata,omitempty"`
 }
 
 func NewColumn(name, fieldName string, sqlType SQLType, len1, len2 int64, nullable bool) *Column {
@@ -0,0 +1,425 @@
+package schema_orm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ChangeKind names a difference between two versions of a schema.
+type ChangeKind string
+
+const (
+	ChangeTableAdded        ChangeKind = "table-added"
+	ChangeTableRemoved      ChangeKind = "table-removed"
+	ChangeColumnAdded       ChangeKind = "column-added"
+	ChangeColumnRemoved     ChangeKind = "column-removed"
+	ChangeTypeWidened       ChangeKind = "type-widened"
+	ChangeTypeNarrowed      ChangeKind = "type-narrowed"
+	ChangeTypeChanged       ChangeKind = "type-changed"
+	ChangeNullableRelaxed   ChangeKind = "nullable-relaxed"   // NOT NULL to NULL
+	ChangeNullableTightened ChangeKind = "nullable-tightened" // NULL to NOT NULL
+	ChangeDefaultChanged    ChangeKind = "default-changed"
+	ChangePrimaryKeyChanged ChangeKind = "primary-key-changed"
+)
+
+// SchemaChange is one difference between an old and a new schema version,
+// with its effect on consumers. Backward means readers of the new version
+// can still read data written with the old one; Forward means readers of
+// the old version can read data written with the new one.
+type SchemaChange struct {
+	Table    string     `json:"table" yaml:"table"`
+	Column   string     `json:"column,omitempty" yaml:"column,omitempty"`
+	Kind     ChangeKind `json:"kind" yaml:"kind"`
+	From     string     `json:"from,omitempty" yaml:"from,omitempty"`
+	To       string     `json:"to,omitempty" yaml:"to,omitempty"`
+	Backward bool       `json:"backward" yaml:"backward"`
+	Forward  bool       `json:"forward" yaml:"forward"`
+	Reason   string     `json:"reason" yaml:"reason"`
+}
+
+// Compatibility classifies a set of changes.
+type Compatibility string
+
+const (
+	CompatFull     Compatibility = "full"
+	CompatBackward Compatibility = "backward"
+	CompatForward  Compatibility = "forward"
+	CompatBreaking Compatibility = "breaking"
+)
+
+// CompatibilityMode is the compatibility a table must keep between versions,
+// as in a schema registry. CompatModeNone accepts any change.
+type CompatibilityMode string
+
+const (
+	CompatModeBackward CompatibilityMode = "backward"
+	CompatModeForward  CompatibilityMode = "forward"
+	CompatModeFull     CompatibilityMode = "full"
+	CompatModeNone     CompatibilityMode = "none"
+)
+
+// allows reports whether a change keeps the compatibility the mode asks for.
+func (m CompatibilityMode) allows(c SchemaChange) bool {
+	switch m {
+	case CompatModeNone:
+		return true
+	case CompatModeForward:
+		return c.Forward
+	case CompatModeFull:
+		return c.Backward && c.Forward
+	}
+	return c.Backward
+}
+
+// CompatibilityRule sets the mode of the tables matching Table, a path.Match
+// pattern compared with the table name and schema.name, ignoring case.
+type CompatibilityRule struct {
+	Table string            `json:"table" yaml:"table"`
+	Mode  CompatibilityMode `json:"mode" yaml:"mode"`
+}
+
+// CompatibilityPolicy assigns modes to tables: the first matching rule wins,
+// otherwise Default applies (CompatModeBackward when empty).
+type CompatibilityPolicy struct {
+	Default CompatibilityMode   `json:"default,omitempty" yaml:"default,omitempty"`
+	Tables  []CompatibilityRule `json:"tables,omitempty" yaml:"tables,omitempty"`
+}
+
+// ParseCompatibilityPolicy decodes a policy from JSON or YAML content.
+func ParseCompatibilityPolicy(data []byte) (*CompatibilityPolicy, error) {
+	trimmed := bytes.TrimSpace(data)
+	p := &CompatibilityPolicy{}
+	var err error
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		err = json.Unmarshal(trimmed, p)
+	} else {
+		err = yaml.Unmarshal(trimmed, p)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse compatibility policy: %w", err)
+	}
+	return p, p.validate()
+}
+
+// LoadCompatibilityPolicy reads a policy file.
+func LoadCompatibilityPolicy(path string) (*CompatibilityPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCompatibilityPolicy(data)
+}
+
+func (p *CompatibilityPolicy) validate() error {
+	modes := []CompatibilityMode{CompatModeBackward, CompatModeForward, CompatModeFull, CompatModeNone}
+	if p.Default != "" && !slices.Contains(modes, p.Default) {
+		return fmt.Errorf("unknown compatibility mode %q", p.Default)
+	}
+	for _, r := range p.Tables {
+		if !slices.Contains(modes, r.Mode) {
+			return fmt.Errorf("table %s: unknown compatibility mode %q", r.Table, r.Mode)
+		}
+		if _, err := path.Match(r.Table, ""); err != nil {
+			return fmt.Errorf("table pattern %q: %w", r.Table, err)
+		}
+	}
+	return nil
+}
+
+// Mode returns the mode of a table; a nil policy uses the default.
+func (p *CompatibilityPolicy) Mode(schema, name string) CompatibilityMode {
+	if p == nil {
+		return CompatModeBackward
+	}
+	names := []string{strings.ToLower(name)}
+	if schema != "" {
+		names = append(names, strings.ToLower(schema+"."+name))
+	}
+	for _, r := range p.Tables {
+		for _, n := range names {
+			if ok, _ := path.Match(strings.ToLower(r.Table), n); ok {
+				return r.Mode
+			}
+		}
+	}
+	if p.Default == "" {
+		return CompatModeBackward
+	}
+	return p.Default
+}
+
+// TableCompatibility is the verdict for one table. Violations are the
+// changes the table's mode does not allow.
+type TableCompatibility struct {
+	Table         string            `json:"table" yaml:"table"`
+	Mode          CompatibilityMode `json:"mode" yaml:"mode"`
+	Compatibility Compatibility     `json:"compatibility" yaml:"compatibility"`
+	Changes       []SchemaChange    `json:"changes,omitempty" yaml:"changes,omitempty"`
+	Violations    []SchemaChange    `json:"violations,omitempty" yaml:"violations,omitempty"`
+}
+
+// CompatibilityReport covers every table present in either version.
+// Compatibility is the weakest of all tables.
+type CompatibilityReport struct {
+	Compatibility Compatibility         `json:"compatibility" yaml:"compatibility"`
+	Tables        []*TableCompatibility `json:"tables" yaml:"tables"`
+}
+
+// Err lists the violations of all tables, or returns nil when every table
+// keeps its mode.
+func (r *CompatibilityReport) Err() error {
+	var errs []error
+	for _, t := range r.Tables {
+		for _, v := range t.Violations {
+			errs = append(errs, fmt.Errorf("%s (%s): %s", t.Table, t.Mode, v.Reason))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CheckCompatibility classifies the changes from old to new per table and
+// checks them against the policy's modes.
+func CheckCompatibility(old, new []*Table, policy *CompatibilityPolicy) *CompatibilityReport {
+	rep := &CompatibilityReport{Compatibility: CompatFull}
+	byTable := map[string]*TableCompatibility{}
+	add := func(tb *Table) {
+		key := strings.ToLower(tb.FullName())
+		if byTable[key] == nil {
+			tc := &TableCompatibility{Table: tb.FullName(), Mode: policy.Mode(tb.Schema, tb.Name), Compatibility: CompatFull}
+			byTable[key] = tc
+			rep.Tables = append(rep.Tables, tc)
+		}
+	}
+	for _, tb := range old {
+		if tb != nil {
+			add(tb)
+		}
+	}
+	for _, tb := range new {
+		if tb != nil {
+			add(tb)
+		}
+	}
+	for _, c := range DiffSchemas(old, new) {
+		tc := byTable[strings.ToLower(c.Table)]
+		tc.Changes = append(tc.Changes, c)
+		if !tc.Mode.allows(c) {
+			tc.Violations = append(tc.Violations, c)
+		}
+		tc.Compatibility = weakest(tc.Compatibility, changeCompatibility(c))
+	}
+	for _, tc := range rep.Tables {
+		rep.Compatibility = weakest(rep.Compatibility, tc.Compatibility)
+	}
+	return rep
+}
+
+func changeCompatibility(c SchemaChange) Compatibility {
+	switch {
+	case c.Backward && c.Forward:
+		return CompatFull
+	case c.Backward:
+		return CompatBackward
+	case c.Forward:
+		return CompatForward
+	}
+	return CompatBreaking
+}
+
+// weakest combines two classifications: backward and forward together leave
+// nothing compatible.
+func weakest(a, b Compatibility) Compatibility {
+	backward := (a == CompatFull || a == CompatBackward) && (b == CompatFull || b == CompatBackward)
+	forward := (a == CompatFull || a == CompatForward) && (b == CompatFull || b == CompatForward)
+	return changeCompatibility(SchemaChange{Backward: backward, Forward: forward})
+}
+
+// DiffSchemas lists the differences from old to new. Tables match on
+// FullName and columns on name, both ignoring case, so a rename shows up as
+// a removal and an addition. Changes are ordered by the new version's table
+// and column order, removals after the rest of their table.
+func DiffSchemas(old, new []*Table) []SchemaChange {
+	var out []SchemaChange
+	find := func(tables []*Table, name string) *Table {
+		for _, t := range tables {
+			if t != nil && strings.EqualFold(t.FullName(), name) {
+				return t
+			}
+		}
+		return nil
+	}
+	for _, nt := range new {
+		if nt == nil {
+			continue
+		}
+		ot := find(old, nt.FullName())
+		if ot == nil {
+			out = append(out, SchemaChange{Table: nt.FullName(), Kind: ChangeTableAdded, Backward: true, Forward: true,
+				Reason: "table added"})
+			continue
+		}
+		out = append(out, diffTable(ot, nt)...)
+	}
+	for _, ot := range old {
+		if ot != nil && find(new, ot.FullName()) == nil {
+			out = append(out, SchemaChange{Table: ot.FullName(), Kind: ChangeTableRemoved,
+				Reason: "table removed; its consumers can no longer read it"})
+		}
+	}
+	return out
+}
+
+func diffTable(ot, nt *Table) []SchemaChange {
+	var out []SchemaChange
+	table := nt.FullName()
+	for _, nc := range nt.Columns {
+		i := columnIndex(ot.Columns, nc.Name)
+		if i < 0 {
+			c := SchemaChange{Table: table, Column: nc.Name, Kind: ChangeColumnAdded, To: ColumnTypeString(nc), Forward: true}
+			if nc.Nullable || nc.Default != "" {
+				c.Backward = true
+				c.Reason = "optional column added"
+			} else {
+				c.Reason = "required column added without default; data written before has no value"
+			}
+			out = append(out, c)
+			continue
+		}
+		out = append(out, diffColumn(table, ot.Columns[i], nc)...)
+	}
+	for _, oc := range ot.Columns {
+		if columnIndex(nt.Columns, oc.Name) < 0 {
+			out = append(out, SchemaChange{Table: table, Column: oc.Name, Kind: ChangeColumnRemoved, From: ColumnTypeString(oc),
+				Backward: true, Reason: "column removed; readers of the old version still expect it"})
+		}
+	}
+	if !equalFoldSlices(ot.PrimaryKeys, nt.PrimaryKeys) {
+		out = append(out, SchemaChange{Table: table, Kind: ChangePrimaryKeyChanged,
+			From: strings.Join(ot.PrimaryKeys, ","), To: strings.Join(nt.PrimaryKeys, ","),
+			Reason: "primary key changed; records are identified differently"})
+	}
+	return out
+}
+
+func equalFoldSlices(a, b []string) bool {
+	return slices.EqualFunc(a, b, strings.EqualFold)
+}
+
+func diffColumn(table string, oc, nc *Column) []SchemaChange {
+	var out []SchemaChange
+	from, to := ColumnTypeString(oc), ColumnTypeString(nc)
+	if !strings.EqualFold(from, to) {
+		c := SchemaChange{Table: table, Column: nc.Name, From: from, To: to}
+		wider, narrower := typeWidens(oc, nc), typeWidens(nc, oc)
+		switch {
+		case wider && narrower:
+			c.Kind, c.Backward, c.Forward, c.Reason = ChangeTypeChanged, true, true, "type changed to an equivalent type"
+		case wider:
+			c.Kind, c.Backward, c.Reason = ChangeTypeWidened, true, "type widened; readers of the old version may get values they cannot hold"
+		case narrower:
+			c.Kind, c.Forward, c.Reason = ChangeTypeNarrowed, true, "type narrowed; data written before may not fit"
+		default:
+			c.Kind, c.Reason = ChangeTypeChanged, "type changed incompatibly"
+		}
+		out = append(out, c)
+	}
+	switch {
+	case oc.Nullable && !nc.Nullable:
+		out = append(out, SchemaChange{Table: table, Column: nc.Name, Kind: ChangeNullableTightened, From: "NULL", To: "NOT NULL",
+			Forward: true, Reason: "nullable to not-null; data written before may hold NULL"})
+	case !oc.Nullable && nc.Nullable:
+		out = append(out, SchemaChange{Table: table, Column: nc.Name, Kind: ChangeNullableRelaxed, From: "NOT NULL", To: "NULL",
+			Backward: true, Reason: "not-null to nullable; readers of the old version do not expect NULL"})
+	}
+	if oc.Default != nc.Default {
+		out = append(out, SchemaChange{Table: table, Column: nc.Name, Kind: ChangeDefaultChanged, From: oc.Default, To: nc.Default,
+			Backward: true, Forward: true, Reason: "default changed"})
+	}
+	return out
+}
+
+// typeRank places a type in a family with a capacity: every value of a type
+// fits a type of the same family with equal or higher capacity. Integer
+// capacities are decimal digits, text capacities characters; DATETIME and
+// TIMESTAMP share a capacity, so they count as equivalent. Other types form
+// a family of their own, ordered by length.
+type typeRank struct {
+	family string
+	cap    int64
+	scale  int64 // decimals only
+}
+
+const unbounded = math.MaxInt64
+
+func rankOf(c *Column) typeRank {
+	name := strings.ToUpper(c.SQLType.Name)
+	length := c.Length
+	if length == 0 {
+		length = c.SQLType.DefaultLength
+	}
+	switch name {
+	case "BOOL", "BOOLEAN":
+		return typeRank{family: "bool"}
+	case "TINYINT":
+		return typeRank{family: "int", cap: 3}
+	case "SMALLINT":
+		return typeRank{family: "int", cap: 5}
+	case "MEDIUMINT":
+		return typeRank{family: "int", cap: 8}
+	case "INT", "INTEGER":
+		return typeRank{family: "int", cap: 10}
+	case "BIGINT":
+		return typeRank{family: "int", cap: 19}
+	case "FLOAT", "REAL":
+		return typeRank{family: "float", cap: 7}
+	case "DOUBLE", "DOUBLE PRECISION":
+		return typeRank{family: "float", cap: 15}
+	case "DECIMAL", "NUMERIC":
+		if length == 0 {
+			return typeRank{family: "decimal", cap: unbounded, scale: unbounded}
+		}
+		return typeRank{family: "decimal", cap: length - c.Length2, scale: c.Length2}
+	case "CHAR", "VARCHAR", "NVARCHAR", "NCHAR":
+		if length == 0 {
+			length = 255
+		}
+		return typeRank{family: "text", cap: length}
+	case "TINYTEXT":
+		return typeRank{family: "text", cap: 255}
+	case "TEXT", "NTEXT", "MEDIUMTEXT", "LONGTEXT", "CLOB":
+		return typeRank{family: "text", cap: unbounded}
+	case "DATE":
+		return typeRank{family: "time", cap: 1}
+	case "DATETIME", "TIMESTAMP":
+		return typeRank{family: "time", cap: 2}
+	}
+	return typeRank{family: name, cap: length}
+}
+
+// typeWidens reports whether every value of from's type fits to's type.
+func typeWidens(from, to *Column) bool {
+	f, t := rankOf(from), rankOf(to)
+	switch {
+	case f.family == t.family && f.family == "decimal":
+		return t.cap >= f.cap && t.scale >= f.scale
+	case f.family == t.family:
+		return t.cap >= f.cap
+	case f.family == "int" && t.family == "decimal":
+		return t.cap >= f.cap
+	case f.family == "int" && t.family == "float":
+		return t.cap >= f.cap
+	case (f.family == "int" || f.family == "decimal") && t.family == "text":
+		// digits, sign and decimal point must fit
+		return f.cap != unbounded && t.cap >= f.cap+f.scale+2
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+package schema_orm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func compatTable(name string, cols ...*Column) *Table {
+	tb := NewEmptyTable()
+	tb.Name = name
+	for _, c := range cols {
+		tb.AddColumn(c)
+	}
+	return tb
+}
+
+func compatCol(name, typ string, length, length2 int64, nullable bool) *Column {
+	return &Column{Name: name, SQLType: SQLType{Name: typ}, Length: length, Length2: length2, Nullable: nullable, DefaultIsEmpty: true}
+}
+
+func TestDiffSchemas_Classification(t *testing.T) {
+	pk := compatCol("id", "INT", 0, 0, false)
+	pk.IsPrimaryKey = true
+	old := []*Table{compatTable("customer",
+		pk,
+		compatCol("name", "VARCHAR", 50, 0, false),
+		compatCol("code", "VARCHAR", 20, 0, false),
+		compatCol("score", "DECIMAL", 10, 2, true),
+		compatCol("visits", "INT", 0, 0, false),
+		compatCol("born", "DATE", 0, 0, true),
+		compatCol("fax", "VARCHAR", 20, 0, true),
+		compatCol("region", "CHAR", 2, 0, true),
+	), compatTable("legacy", compatCol("x", "INT", 0, 0, true))}
+
+	newPK := compatCol("id", "BIGINT", 0, 0, false)
+	newPK.IsPrimaryKey = true
+	region := compatCol("region", "CHAR", 2, 0, true)
+	region.Default = "'EU'"
+	newer := []*Table{compatTable("Customer",
+		newPK,
+		compatCol("name", "VARCHAR", 100, 0, true),
+		compatCol("code", "VARCHAR", 10, 0, false),
+		compatCol("score", "INT", 0, 0, false),
+		compatCol("visits", "DECIMAL", 12, 0, false),
+		compatCol("born", "TIMESTAMP", 0, 0, true),
+		region,
+		compatCol("email", "VARCHAR", 128, 0, true),
+		compatCol("tier", "SMALLINT", 0, 0, false),
+	), compatTable("audit", compatCol("at", "DATETIME", 0, 0, false))}
+
+	type verdict struct {
+		kind              ChangeKind
+		backward, forward bool
+	}
+	got := map[string]verdict{}
+	for _, c := range DiffSchemas(old, newer) {
+		got[c.Table+"."+c.Column+":"+string(c.Kind)] = verdict{c.Kind, c.Backward, c.Forward}
+		if c.Reason == "" {
+			t.Fatalf("change without reason: %+v", c)
+		}
+	}
+	want := map[string]verdict{
+		"Customer.id:type-widened":          {ChangeTypeWidened, true, false},
+		"Customer.name:type-widened":        {ChangeTypeWidened, true, false},
+		"Customer.name:nullable-relaxed":    {ChangeNullableRelaxed, true, false},
+		"Customer.code:type-narrowed":       {ChangeTypeNarrowed, false, true},
+		"Customer.score:type-changed":       {ChangeTypeChanged, false, false},
+		"Customer.score:nullable-tightened": {ChangeNullableTightened, false, true},
+		"Customer.visits:type-widened":      {ChangeTypeWidened, true, false},
+		"Customer.born:type-widened":        {ChangeTypeWidened, true, false},
+		"Customer.region:default-changed":   {ChangeDefaultChanged, true, true},
+		"Customer.email:column-added":       {ChangeColumnAdded, true, true},
+		"Customer.tier:column-added":        {ChangeColumnAdded, false, true},
+		"Customer.fax:column-removed":       {ChangeColumnRemoved, true, false},
+		"audit.:table-added":                {ChangeTableAdded, true, true},
+		"legacy.:table-removed":             {ChangeTableRemoved, false, false},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("changes:\n got %v\nwant %v", got, want)
+	}
+}
+
+func TestTypeWidens(t *testing.T) {
+	cases := []struct {
+		from, to *Column
+		want     bool
+	}{
+		{compatCol("a", "DATETIME", 0, 0, false), compatCol("a", "TIMESTAMP", 0, 0, false), true},
+		{compatCol("a", "TIMESTAMP", 0, 0, false), compatCol("a", "DATE", 0, 0, false), false},
+		{compatCol("a", "INT", 0, 0, false), compatCol("a", "DOUBLE", 0, 0, false), true},
+		{compatCol("a", "BIGINT", 0, 0, false), compatCol("a", "DOUBLE", 0, 0, false), false},
+		{compatCol("a", "INT", 0, 0, false), compatCol("a", "VARCHAR", 12, 0, false), true},
+		{compatCol("a", "DECIMAL", 10, 2, false), compatCol("a", "VARCHAR", 11, 0, false), false},
+		{compatCol("a", "DECIMAL", 10, 2, false), compatCol("a", "NUMERIC", 0, 0, false), true},
+		{compatCol("a", "VARCHAR", 0, 0, false), compatCol("a", "TEXT", 0, 0, false), true},
+		{compatCol("a", "VARBINARY", 16, 0, false), compatCol("a", "VARBINARY", 32, 0, false), true},
+		{compatCol("a", "BLOB", 0, 0, false), compatCol("a", "TEXT", 0, 0, false), false},
+	}
+	for _, c := range cases {
+		if got := typeWidens(c.from, c.to); got != c.want {
+			t.Fatalf("%s -> %s: got %v", ColumnTypeString(c.from), ColumnTypeString(c.to), got)
+		}
+	}
+}
+
+func TestCheckCompatibility_Modes(t *testing.T) {
+	policy, err := ParseCompatibilityPolicy([]byte(`
+default: full
+tables:
+  - {table: "crm.CUST*", mode: forward}
+  - {table: "staging_*", mode: none}
+  - {table: product, mode: backward}
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	cust := func(nullable bool) *Table {
+		tb := compatTable("customer", compatCol("name", "VARCHAR", 50, 0, nullable))
+		tb.Schema = "crm"
+		return tb
+	}
+	old := []*Table{cust(true), compatTable("product", compatCol("sku", "VARCHAR", 20, 0, false)),
+		compatTable("staging_x", compatCol("a", "INT", 0, 0, false)), compatTable("country", compatCol("code", "CHAR", 2, 0, false))}
+	newer := []*Table{cust(false), compatTable("product", compatCol("sku", "VARCHAR", 40, 0, false)),
+		compatTable("country", compatCol("code", "CHAR", 2, 0, false), compatCol("name", "VARCHAR", 64, 0, true))}
+
+	rep := CheckCompatibility(old, newer, policy)
+	byName := map[string]*TableCompatibility{}
+	for _, tc := range rep.Tables {
+		byName[tc.Table] = tc
+	}
+	check := func(table string, mode CompatibilityMode, compat Compatibility, violations int) {
+		t.Helper()
+		tc := byName[table]
+		if tc == nil || tc.Mode != mode || tc.Compatibility != compat || len(tc.Violations) != violations {
+			t.Fatalf("%s: %+v", table, tc)
+		}
+	}
+	check("crm.customer", CompatModeForward, CompatForward, 0)
+	check("product", CompatModeBackward, CompatBackward, 0)
+	check("staging_x", CompatModeNone, CompatBreaking, 0)
+	check("country", CompatModeFull, CompatFull, 0)
+	if rep.Compatibility != CompatBreaking || rep.Err() != nil {
+		t.Fatalf("report: %s %v", rep.Compatibility, rep.Err())
+	}
+
+	// the same narrowing under the default mode is a violation
+	policy.Tables = policy.Tables[1:]
+	rep = CheckCompatibility(old, newer, policy)
+	err = rep.Err()
+	if err == nil || !strings.Contains(err.Error(), "crm.customer (full): nullable to not-null") ||
+		strings.Contains(err.Error(), "product") {
+		t.Fatalf("violations: %v", err)
+	}
+
+	if _, err := ParseCompatibilityPolicy([]byte(`default: strict`)); err == nil {
+		t.Fatal("expected error for unknown mode")
+	}
+	if _, err := ParseCompatibilityPolicy([]byte(`{"tables":[{"table":"[","mode":"full"}]}`)); err == nil {
+		t.Fatal("expected error for bad pattern")
+	}
+	var none *CompatibilityPolicy
+	if none.Mode("", "x") != CompatModeBackward {
+		t.Fatal("nil policy defaults to backward")
+	}
+}
+
+func TestWeakest(t *testing.T) {
+	if weakest(CompatBackward, CompatForward) != CompatBreaking || weakest(CompatFull, CompatForward) != CompatForward ||
+		weakest(CompatFull, CompatFull) != CompatFull {
+		t.Fatal("weakest")
+	}
+}
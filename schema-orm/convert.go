@@ -1,9 +1,24 @@
 package schema_orm
 
 import (
+	"maps"
+	"slices"
+
 	xs "xorm.io/xorm/schemas"
 )
 
+// ConvertOptions enables the lossy rewrites of ToXormTableWith and
+// ToXormColumnWith. The zero value converts losslessly: FromXormTable and
+// FromXormColumn give back what went in.
+type ConvertOptions struct {
+	// BitAsBool turns BIT columns into BOOL with default "true", as
+	// ToXormColumn did before conversions were lossless.
+	BitAsBool bool
+	// DropExtras leaves out the fields xorm has no room for: Schema,
+	// ForeignKeys, Profile, Provenance and the table and column Metadata.
+	DropExtras bool
+}
+
 // ToXormSQLType SQLType conversions
 func ToXormSQLType(s SQLType) xs.SQLType {
 	return xs.SQLType{Name: s.Name, DefaultLength: s.DefaultLength, DefaultLength2: s.DefaultLength2}
@@ -12,8 +27,18 @@ func FromXormSQLType(s xs.SQLType) SQLType {
 	return SQLType{Name: s.Name, DefaultLength: s.DefaultLength, DefaultLength2: s.DefaultLength2}
 }
 
+// XormColumn is a column converted for xorm together with its Metadata,
+// which xorm has no room for. Pass XormColumn.Column to xorm.
+type XormColumn struct {
+	*xs.Column
+	Metadata *Metadata
+}
+
 // ToXormColumn Column conversions
-func ToXormColumn(c *Column) *xs.Column {
+func ToXormColumn(c *Column) *XormColumn { return ToXormColumnWith(c, ConvertOptions{}) }
+
+// ToXormColumnWith converts c applying the rewrites selected in opts.
+func ToXormColumnWith(c *Column, opts ConvertOptions) *XormColumn {
 	if c == nil {
 		return nil
 	}
@@ -21,7 +46,7 @@ func ToXormColumn(c *Column) *xs.Column {
 		Name:            c.Name,
 		TableName:       c.TableName,
 		FieldName:       c.FieldName,
-		FieldIndex:      c.FieldIndex,
+		FieldIndex:      slices.Clone(c.FieldIndex),
 		SQLType:         ToXormSQLType(c.SQLType),
 		IsJSON:          c.IsJSON,
 		IsJSONB:         c.IsJSONB,
@@ -29,7 +54,7 @@ func ToXormColumn(c *Column) *xs.Column {
 		Length2:         c.Length2,
 		Nullable:        c.Nullable,
 		Default:         c.Default,
-		Indexes:         c.Indexes,
+		Indexes:         maps.Clone(c.Indexes),
 		IsPrimaryKey:    c.IsPrimaryKey,
 		IsAutoIncrement: c.IsAutoIncrement,
 		MapType:         c.MapType,
@@ -39,29 +64,36 @@ func ToXormColumn(c *Column) *xs.Column {
 		IsCascade:       c.IsCascade,
 		IsVersion:       c.IsVersion,
 		DefaultIsEmpty:  c.DefaultIsEmpty,
-		EnumOptions:     c.EnumOptions,
-		SetOptions:      c.SetOptions,
+		EnumOptions:     maps.Clone(c.EnumOptions),
+		SetOptions:      maps.Clone(c.SetOptions),
 		DisableTimeZone: c.DisableTimeZone,
 		TimeZone:        c.TimeZone,
 		Comment:         c.Comment,
 		Collation:       c.Collation,
 	}
-	if xc.SQLType.Name == "BIT" {
+	if opts.BitAsBool && xc.SQLType.Name == "BIT" {
 		xc.SQLType.Name = "BOOL"
 		xc.Default = "true"
 	}
-	return xc
+	x := &XormColumn{Column: xc}
+	if !opts.DropExtras {
+		x.Metadata = c.Metadata.Clone()
+	}
+	return x
 }
 
-func FromXormColumn(c *xs.Column) *Column {
-	if c == nil {
+// FromXormColumn converts x back. The Metadata is a fresh copy; a bare
+// xorm column converts as &XormColumn{Column: c}.
+func FromXormColumn(x *XormColumn) *Column {
+	if x == nil || x.Column == nil {
 		return nil
 	}
+	c := x.Column
 	return &Column{
 		Name:            c.Name,
 		TableName:       c.TableName,
 		FieldName:       c.FieldName,
-		FieldIndex:      c.FieldIndex,
+		FieldIndex:      slices.Clone(c.FieldIndex),
 		SQLType:         FromXormSQLType(c.SQLType),
 		IsJSON:          c.IsJSON,
 		IsJSONB:         c.IsJSONB,
@@ -69,7 +101,7 @@ func FromXormColumn(c *xs.Column) *Column {
 		Length2:         c.Length2,
 		Nullable:        c.Nullable,
 		Default:         c.Default,
-		Indexes:         c.Indexes,
+		Indexes:         maps.Clone(c.Indexes),
 		IsPrimaryKey:    c.IsPrimaryKey,
 		IsAutoIncrement: c.IsAutoIncrement,
 		MapType:         c.MapType,
@@ -79,12 +111,13 @@ func FromXormColumn(c *xs.Column) *Column {
 		IsCascade:       c.IsCascade,
 		IsVersion:       c.IsVersion,
 		DefaultIsEmpty:  c.DefaultIsEmpty,
-		EnumOptions:     c.EnumOptions,
-		SetOptions:      c.SetOptions,
+		EnumOptions:     maps.Clone(c.EnumOptions),
+		SetOptions:      maps.Clone(c.SetOptions),
 		DisableTimeZone: c.DisableTimeZone,
 		TimeZone:        c.TimeZone,
 		Comment:         c.Comment,
 		Collation:       c.Collation,
+		Metadata:        x.Metadata.Clone(),
 	}
 }
 
@@ -114,13 +147,43 @@ func FromXormPK(p xs.PK) PK {
 	return out
 }
 
-// ToXormTable Table conversions (Type cannot be fully mapped via JSON, keep reflection.Type as-is)
-func ToXormTable(t *Table) *xs.Table {
+// XormTable is a table converted for xorm together with the fields of the
+// Table that xorm has no room for. Pass XormTable.Table to xorm.
+type XormTable struct {
+	*xs.Table
+	Schema      string
+	ForeignKeys []*ForeignKey
+	Profile     *TableProfile
+	Provenance  *Provenance
+	Metadata    *Metadata
+	// ColumnMetadata holds the Metadata of the columns, in column order.
+	ColumnMetadata []*Metadata
+}
+
+// ToXormTable converts t losslessly: FromXormTable restores every field.
+func ToXormTable(t *Table) *XormTable { return ToXormTableWith(t, ConvertOptions{}) }
+
+// ToXormTableWith converts t applying the rewrites selected in opts.
+func ToXormTableWith(t *Table, opts ConvertOptions) *XormTable {
 	if t == nil {
 		return nil
 	}
 	x := xs.NewTable(t.Name, t.Type)
+	var colMeta []*Metadata
+	for i, c := range t.Columns {
+		x.AddColumn(ToXormColumnWith(c, opts).Column)
+		if c.Metadata != nil && !opts.DropExtras {
+			if colMeta == nil {
+				colMeta = make([]*Metadata, len(t.Columns))
+			}
+			colMeta[i] = c.Metadata.Clone()
+		}
+	}
+	// AddColumn derives these from the column flags; the table's own values win
+	x.PrimaryKeys = append(x.PrimaryKeys[:0], t.PrimaryKeys...)
 	x.AutoIncrement = t.AutoIncrement
+	clear(x.Created)
+	maps.Copy(x.Created, t.Created)
 	x.Updated = t.Updated
 	x.Deleted = t.Deleted
 	x.Version = t.Version
@@ -128,28 +191,43 @@ func ToXormTable(t *Table) *xs.Table {
 	x.Charset = t.Charset
 	x.Comment = t.Comment
 	x.Collation = t.Collation
-	// columns
-	for _, c := range t.Columns {
-		x.AddColumn(ToXormColumn(c))
-	}
-	// the index map must be filled
 	for k, v := range t.Indexes {
 		x.Indexes[k] = ToXormIndex(v)
 	}
-	// created a map
-	for k, v := range t.Created {
-		x.Created[k] = v
+	if opts.DropExtras {
+		return &XormTable{Table: x}
+	}
+	return &XormTable{
+		Table:          x,
+		Schema:         t.Schema,
+		ForeignKeys:    cloneForeignKeys(t.ForeignKeys),
+		Profile:        t.Profile,
+		Provenance:     t.Provenance,
+		Metadata:       t.Metadata.Clone(),
+		ColumnMetadata: colMeta,
 	}
-	return x
 }
 
-func FromXormTable(t *xs.Table) *Table {
-	if t == nil {
+// FromXormTable converts x back, restoring the fields kept next to the xorm
+// table. Each call returns fresh copies of the foreign keys and metadata; a
+// bare xorm table converts as &XormTable{Table: t}.
+func FromXormTable(x *XormTable) *Table {
+	if x == nil || x.Table == nil {
 		return nil
 	}
+	t := x.Table
 	nt := NewTable(t.Name, t.Type)
+	for i, c := range t.Columns() {
+		var md *Metadata
+		if i < len(x.ColumnMetadata) {
+			md = x.ColumnMetadata[i]
+		}
+		nt.AddColumn(FromXormColumn(&XormColumn{Column: c, Metadata: md}))
+	}
+	nt.PrimaryKeys = append(nt.PrimaryKeys[:0], t.PrimaryKeys...)
 	nt.AutoIncrement = t.AutoIncrement
-	nt.PrimaryKeys = append(nt.PrimaryKeys, t.PrimaryKeys...)
+	clear(nt.Created)
+	maps.Copy(nt.Created, t.Created)
 	nt.Updated = t.Updated
 	nt.Deleted = t.Deleted
 	nt.Version = t.Version
@@ -157,14 +235,24 @@ func FromXormTable(t *xs.Table) *Table {
 	nt.Charset = t.Charset
 	nt.Comment = t.Comment
 	nt.Collation = t.Collation
-	for k, v := range t.Created {
-		nt.Created[k] = v
-	}
-	for _, c := range t.Columns() {
-		nt.AddColumn(FromXormColumn(c))
-	}
 	for k, v := range t.Indexes {
 		nt.Indexes[k] = FromXormIndex(v)
 	}
+	nt.Schema = x.Schema
+	nt.ForeignKeys = cloneForeignKeys(x.ForeignKeys)
+	nt.Profile = x.Profile
+	nt.Provenance = x.Provenance
+	nt.Metadata = x.Metadata.Clone()
 	return nt
 }
+
+func cloneForeignKeys(fks []*ForeignKey) []*ForeignKey {
+	if fks == nil {
+		return nil
+	}
+	out := make([]*ForeignKey, len(fks))
+	for i, fk := range fks {
+		out[i] = cloneForeignKey(fk)
+	}
+	return out
+}
@@ -14,7 +14,10 @@ type kb struct {
 
 func TestToXormColumn_BIT_To_BOOL_and_Default(t *testing.T) {
 	c := &Column{SQLType: SQLType{Name: "BIT"}, Default: "", Name: "A"}
-	xc := ToXormColumn(c)
+	if xc := ToXormColumn(c); xc.SQLType.Name != "BIT" || xc.Default != "" {
+		t.Fatalf("lossless conversion rewrote BIT: %s %q", xc.SQLType.Name, xc.Default)
+	}
+	xc := ToXormColumnWith(c, ConvertOptions{BitAsBool: true})
 	if xc.SQLType.Name != "BOOL" {
 		t.Fatalf("expected BOOL, got %s", xc.SQLType.Name)
 	}
@@ -0,0 +1,194 @@
+package schema_orm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"xorm.io/xorm"
+	xs "xorm.io/xorm/schemas"
+)
+
+// DataOptions controls ExportTableData and CopyTableData.
+//
+// Mask, when set, is applied to every row before it is written. BatchSize is
+// the number of rows per INSERT statement when copying; zero selects
+// DefaultCopyBatchSize. It is lowered for wide tables so that a statement
+// stays within the bind parameter limit of the destination, see maxBindParams.
+type DataOptions struct {
+	Mask      *MaskPolicy `json:"mask,omitempty" yaml:"mask,omitempty"`
+	BatchSize int         `json:"batchSize,omitempty" yaml:"batchSize,omitempty"`
+}
+
+// DefaultCopyBatchSize is the default number of rows per INSERT statement.
+const DefaultCopyBatchSize = 200
+
+// ExportTableData writes every row of the table as NDJSON: one JSON object
+// per line with the columns in table order. Binary values that are not valid
+// UTF-8 are base64 encoded, times use RFC 3339. It returns the row count.
+func ExportTableData(ctx context.Context, engine *xorm.Engine, table *Table, w io.Writer, opts DataOptions) (int64, error) {
+	names := make([][]byte, len(table.Columns))
+	for i, c := range table.Columns {
+		b, err := json.Marshal(c.Name)
+		if err != nil {
+			return 0, err
+		}
+		names[i] = b
+	}
+	bw := bufio.NewWriter(w)
+	n, err := scanTableData(ctx, engine, table, opts, func(row []any) error {
+		bw.WriteByte('{')
+		for i, v := range row {
+			if i > 0 {
+				bw.WriteByte(',')
+			}
+			bw.Write(names[i])
+			bw.WriteByte(':')
+			b, err := json.Marshal(jsonValue(v))
+			if err != nil {
+				return fmt.Errorf("column %s: %w", table.Columns[i].Name, err)
+			}
+			bw.Write(b)
+		}
+		bw.WriteString("}\n")
+		return nil
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, bw.Flush()
+}
+
+// jsonValue converts a scanned driver value for JSON encoding.
+func jsonValue(v any) any {
+	switch x := v.(type) {
+	case []byte:
+		if utf8.Valid(x) {
+			return string(x)
+		}
+	case time.Time:
+		return x.Format(time.RFC3339Nano)
+	}
+	return v
+}
+
+// CopyTableData copies every row of the table from src to dst in one
+// transaction, masking rows on the way. The table must already exist in dst
+// (see ApplyTables); tables referenced by foreign keys must be copied first.
+// It returns the number of rows copied.
+func CopyTableData(ctx context.Context, src, dst *xorm.Engine, table *Table, opts DataOptions) (int64, error) {
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultCopyBatchSize
+	}
+	if n := len(table.Columns); n > 0 {
+		batchSize = max(1, min(batchSize, maxBindParams(dst.Dialect().URI().DBType)/n))
+	}
+	quoter := dst.Dialect().Quoter()
+	cols := make([]string, len(table.Columns))
+	for i, c := range table.Columns {
+		cols[i] = quoter.Quote(c.Name)
+	}
+	insert := "INSERT INTO " + quoter.Quote(table.FullName()) + " (" + strings.Join(cols, ", ") + ") VALUES "
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(cols)), ", ") + ")"
+
+	sess := dst.NewSession().Context(ctx)
+	defer sess.Close()
+	if err := sess.Begin(); err != nil {
+		return 0, err
+	}
+	var (
+		args []any
+		rows int
+	)
+	flush := func() error {
+		if rows == 0 {
+			return nil
+		}
+		q := insert + strings.TrimSuffix(strings.Repeat(placeholders+", ", rows), ", ")
+		if _, err := sess.Exec(append([]any{q}, args...)...); err != nil {
+			return fmt.Errorf("insert into %s: %w", table.FullName(), err)
+		}
+		args, rows = args[:0], 0
+		return nil
+	}
+	n, err := scanTableData(ctx, src, table, opts, func(row []any) error {
+		args = append(args, row...)
+		if rows++; rows == batchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		sess.Rollback()
+		return 0, err
+	}
+	return n, sess.Commit()
+}
+
+// maxBindParams returns the most bind parameters a statement may have.
+func maxBindParams(dbType xs.DBType) int {
+	switch dbType {
+	case xs.SQLITE:
+		return 32766
+	case xs.MSSQL:
+		return 2100
+	}
+	// PostgreSQL and MySQL count parameters in 16 bits
+	return 65535
+}
+
+// scanTableData reads the table's columns from engine, masks each row and
+// hands it to fn. The row slice is reused between calls.
+func scanTableData(ctx context.Context, engine *xorm.Engine, table *Table, opts DataOptions, fn func(row []any) error) (int64, error) {
+	if len(table.Columns) == 0 {
+		return 0, fmt.Errorf("table %s has no columns", table.FullName())
+	}
+	masker, err := NewRowMasker(opts.Mask, table)
+	if err != nil {
+		return 0, err
+	}
+	quoter := engine.Dialect().Quoter()
+	cols := make([]string, len(table.Columns))
+	for i, c := range table.Columns {
+		cols[i] = quoter.Quote(c.Name)
+	}
+	query := "SELECT " + strings.Join(cols, ", ") + " FROM " + quoter.Quote(table.FullName())
+	if len(table.PrimaryKeys) > 0 {
+		pks := make([]string, len(table.PrimaryKeys))
+		for i, pk := range table.PrimaryKeys {
+			pks[i] = quoter.Quote(pk)
+		}
+		query += " ORDER BY " + strings.Join(pks, ", ")
+	}
+	rows, err := engine.DB().QueryContext(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("read %s: %w", table.FullName(), err)
+	}
+	defer rows.Close()
+	raw := make([]any, len(cols))
+	ptrs := make([]any, len(cols))
+	for i := range raw {
+		ptrs[i] = &raw[i]
+	}
+	var n int64
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return n, err
+		}
+		masker.Mask(raw)
+		if err := fn(raw); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rows.Err()
+}
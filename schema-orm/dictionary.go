@@ -0,0 +1,322 @@
+package schema_orm
+
+import (
+	htmltemplate "html/template"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// DictionaryOptions customises a generated data dictionary.
+//
+// Templates is parsed after the built-in templates, so {{define}} blocks in it
+// replace the defaults. Both formats are assembled from the blocks "header",
+// "toc", "table" and "footer"; the HTML page also has a "style" block. Funcs are
+// made available to all templates and Data is exposed as .Data on the page.
+// Naming decides the index names shown (Index.XName when nil).
+type DictionaryOptions struct {
+	Title     string
+	Templates string
+	Funcs     map[string]any
+	Data      map[string]any
+	Naming    *Naming
+}
+
+// dictPage is the root value the dictionary templates are executed with.
+type dictPage struct {
+	Title  string
+	Data   map[string]any
+	Tables []*dictTable
+}
+
+type dictTable struct {
+	*Table
+	Anchor       string
+	Columns      []dictColumn
+	Indexes      []dictIndex
+	References   []dictRef
+	ReferencedBy []dictRef
+}
+
+type dictColumn struct {
+	*Column
+	Type string
+	Key  string
+}
+
+type dictIndex struct {
+	Name   string
+	Unique bool
+	Cols   []string
+}
+
+// dictRef is one side of a relationship: Table/Anchor point at the other table.
+type dictRef struct {
+	Name    string
+	Cols    []string
+	Table   string
+	Anchor  string
+	RefCols []string
+}
+
+var anchorRe = regexp.MustCompile(`[^a-z0-9]+`)
+
+func dictAnchor(name string) string {
+	return "t-" + strings.Trim(anchorRe.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// ColumnTypeString renders the SQL type of a column with its lengths, e.g. "DECIMAL(10,2)".
+func ColumnTypeString(col *Column) string {
+	switch {
+	case col.Length > 0 && col.Length2 > 0:
+		return col.SQLType.Name + "(" + strconv.FormatInt(col.Length, 10) + "," + strconv.FormatInt(col.Length2, 10) + ")"
+	case col.Length > 0:
+		return col.SQLType.Name + "(" + strconv.FormatInt(col.Length, 10) + ")"
+	}
+	return col.SQLType.Name
+}
+
+// newDictPage sorts the tables by name and resolves relationships in both directions.
+func newDictPage(tables []*Table, opts DictionaryOptions) (*dictPage, error) {
+	namer, err := opts.Naming.IndexNamer()
+	if err != nil {
+		return nil, err
+	}
+	page := &dictPage{Title: opts.Title, Data: opts.Data}
+	if page.Title == "" {
+		page.Title = "Data Dictionary"
+	}
+	byName := map[string]*dictTable{}
+	for _, tb := range tables {
+		if tb == nil {
+			continue
+		}
+		dt := &dictTable{Table: tb, Anchor: dictAnchor(tb.FullName())}
+		page.Tables = append(page.Tables, dt)
+		byName[tb.FullName()] = dt
+	}
+	sort.Slice(page.Tables, func(i, j int) bool { return page.Tables[i].FullName() < page.Tables[j].FullName() })
+
+	for _, dt := range page.Tables {
+		fkCols := map[string]bool{}
+		for _, fk := range dt.ForeignKeys {
+			for _, c := range fk.Cols {
+				fkCols[strings.ToLower(c)] = true
+			}
+			target := fk.RefFullName()
+			if fk.RefSchema == "" && dt.Schema != "" {
+				target = dt.Schema + "." + fk.RefTable
+			}
+			ref := dictRef{Name: fk.Name, Cols: fk.Cols, Table: target, RefCols: fk.RefCols}
+			if other, ok := byName[target]; ok {
+				ref.Anchor = other.Anchor
+				other.ReferencedBy = append(other.ReferencedBy, dictRef{
+					Name: fk.Name, Cols: fk.RefCols, Table: dt.FullName(), Anchor: dt.Anchor, RefCols: fk.Cols,
+				})
+			}
+			dt.References = append(dt.References, ref)
+		}
+
+		unique := map[string]bool{}
+		names := make([]string, 0, len(dt.Table.Indexes))
+		for name := range dt.Table.Indexes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			idx := dt.Table.Indexes[name]
+			dt.Indexes = append(dt.Indexes, dictIndex{Name: namer(dt.Name, idx), Unique: idx.Type == UniqueType, Cols: idx.Cols})
+			if idx.Type == UniqueType {
+				for _, c := range idx.Cols {
+					unique[strings.ToLower(c)] = true
+				}
+			}
+		}
+
+		for _, col := range dt.Table.Columns {
+			var keys []string
+			if col.IsPrimaryKey {
+				keys = append(keys, "PK")
+			}
+			if unique[strings.ToLower(col.Name)] {
+				keys = append(keys, "UQ")
+			}
+			if fkCols[strings.ToLower(col.Name)] {
+				keys = append(keys, "FK")
+			}
+			dt.Columns = append(dt.Columns, dictColumn{Column: col, Type: ColumnTypeString(col), Key: strings.Join(keys, ", ")})
+		}
+	}
+	return page, nil
+}
+
+// markdownCell escapes text for use inside a Markdown table cell.
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	s = strings.ReplaceAll(s, "\r\n", "<br>")
+	return strings.ReplaceAll(s, "\n", "<br>")
+}
+
+const markdownDictionaryTemplate = `{{define "header"}}# {{.Title}}
+{{end}}
+{{- define "toc"}}
+## Contents
+
+{{range .Tables}}- [{{.FullName}}](#{{.Anchor}}){{with .Comment}} — {{md .}}{{end}}
+{{end}}{{end}}
+{{- define "table"}}
+<a id="{{.Anchor}}"></a>
+## {{.FullName}}
+{{with .Comment}}
+{{md .}}
+{{end}}
+| Column | Type | Nullable | Default | Key | Comment |
+| --- | --- | --- | --- | --- | --- |
+{{range .Columns}}| {{md .Name}} | {{md .Type}} | {{if .Nullable}}YES{{else}}NO{{end}} | {{md .Default}} | {{.Key}} | {{md .Comment}} |
+{{end}}
+{{- if .Indexes}}
+**Indexes**
+
+| Name | Unique | Columns |
+| --- | --- | --- |
+{{range .Indexes}}| {{md .Name}} | {{if .Unique}}YES{{else}}NO{{end}} | {{md (join .Cols ", ")}} |
+{{end}}{{end}}
+{{- if .References}}
+**References**
+
+{{range .References}}- ({{join .Cols ", "}}) → {{if .Anchor}}[{{.Table}}](#{{.Anchor}}){{else}}{{.Table}}{{end}} ({{join .RefCols ", "}})
+{{end}}{{end}}
+{{- if .ReferencedBy}}
+**Referenced by**
+
+{{range .ReferencedBy}}- [{{.Table}}](#{{.Anchor}}) ({{join .RefCols ", "}}) → ({{join .Cols ", "}})
+{{end}}{{end}}
+{{- end}}
+{{- define "footer"}}{{end}}
+{{- define "dictionary"}}{{template "header" .}}{{template "toc" .}}{{range .Tables}}{{template "table" .}}{{end}}{{template "footer" .}}{{end}}`
+
+const htmlDictionaryTemplate = `{{define "style"}}
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 0; display: flex; color: #222; }
+nav { width: 18rem; height: 100vh; overflow-y: auto; position: sticky; top: 0; padding: 1rem; background: #f6f8fa; box-sizing: border-box; }
+nav ul { list-style: none; padding: 0; }
+nav li { margin: .2rem 0; }
+main { flex: 1; padding: 1rem 2rem; }
+#search { width: 100%; padding: .4rem; box-sizing: border-box; }
+table { border-collapse: collapse; margin: .5rem 0 1rem; }
+th, td { border: 1px solid #d0d7de; padding: .3rem .6rem; text-align: left; vertical-align: top; }
+th { background: #f6f8fa; }
+.comment { color: #555; }
+.hidden { display: none; }
+{{end}}
+{{- define "header"}}<h1>{{.Title}}</h1>{{end}}
+{{- define "toc"}}<input id="search" type="search" placeholder="Search tables and columns">
+<ul id="toc">
+{{range .Tables}}<li data-target="{{.Anchor}}"><a href="#{{.Anchor}}">{{.FullName}}</a></li>
+{{end}}</ul>{{end}}
+{{- define "table"}}<section class="dict-table" id="{{.Anchor}}">
+<h2>{{.FullName}}</h2>
+{{with .Comment}}<p class="comment">{{.}}</p>
+{{end}}<table>
+<thead><tr><th>Column</th><th>Type</th><th>Nullable</th><th>Default</th><th>Key</th><th>Comment</th></tr></thead>
+<tbody>
+{{range .Columns}}<tr><td>{{.Name}}</td><td>{{.Type}}</td><td>{{if .Nullable}}YES{{else}}NO{{end}}</td><td>{{.Default}}</td><td>{{.Key}}</td><td>{{.Comment}}</td></tr>
+{{end}}</tbody>
+</table>
+{{if .Indexes}}<h3>Indexes</h3>
+<table>
+<thead><tr><th>Name</th><th>Unique</th><th>Columns</th></tr></thead>
+<tbody>
+{{range .Indexes}}<tr><td>{{.Name}}</td><td>{{if .Unique}}YES{{else}}NO{{end}}</td><td>{{join .Cols ", "}}</td></tr>
+{{end}}</tbody>
+</table>
+{{end}}{{if .References}}<h3>References</h3>
+<ul>
+{{range .References}}<li>({{join .Cols ", "}}) → {{if .Anchor}}<a href="#{{.Anchor}}">{{.Table}}</a>{{else}}{{.Table}}{{end}} ({{join .RefCols ", "}})</li>
+{{end}}</ul>
+{{end}}{{if .ReferencedBy}}<h3>Referenced by</h3>
+<ul>
+{{range .ReferencedBy}}<li><a href="#{{.Anchor}}">{{.Table}}</a> ({{join .RefCols ", "}}) → ({{join .Cols ", "}})</li>
+{{end}}</ul>
+{{end}}</section>
+{{end}}
+{{- define "footer"}}{{end}}
+{{- define "script"}}
+(function () {
+  var input = document.getElementById('search');
+  input.addEventListener('input', function () {
+    var q = input.value.trim().toLowerCase();
+    document.querySelectorAll('section.dict-table').forEach(function (s) {
+      var hit = q === '' || s.textContent.toLowerCase().indexOf(q) >= 0;
+      s.classList.toggle('hidden', !hit);
+      var li = document.querySelector('#toc li[data-target="' + s.id + '"]');
+      if (li) { li.classList.toggle('hidden', !hit); }
+    });
+  });
+})();
+{{end}}
+{{- define "dictionary"}}<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>{{template "style" .}}</style>
+</head>
+<body>
+<nav>{{template "toc" .}}</nav>
+<main>
+{{template "header" .}}
+{{range .Tables}}{{template "table" .}}{{end}}
+{{template "footer" .}}
+</main>
+<script>{{template "script" .}}</script>
+</body>
+</html>
+{{end}}`
+
+// WriteMarkdownDictionary renders the tables as a Markdown data dictionary.
+func WriteMarkdownDictionary(w io.Writer, tables []*Table, opts DictionaryOptions) error {
+	funcs := template.FuncMap{"md": markdownCell, "join": strings.Join}
+	for k, v := range opts.Funcs {
+		funcs[k] = v
+	}
+	t, err := template.New("dictionary").Funcs(funcs).Parse(markdownDictionaryTemplate)
+	if err != nil {
+		return err
+	}
+	if opts.Templates != "" {
+		if t, err = t.Parse(opts.Templates); err != nil {
+			return err
+		}
+	}
+	page, err := newDictPage(tables, opts)
+	if err != nil {
+		return err
+	}
+	return t.ExecuteTemplate(w, "dictionary", page)
+}
+
+// WriteHTMLDictionary renders the tables as a self-contained HTML page with a
+// table of contents and a client-side search box. Values are HTML-escaped.
+func WriteHTMLDictionary(w io.Writer, tables []*Table, opts DictionaryOptions) error {
+	funcs := htmltemplate.FuncMap{"join": strings.Join}
+	for k, v := range opts.Funcs {
+		funcs[k] = v
+	}
+	t, err := htmltemplate.New("dictionary").Funcs(funcs).Parse(htmlDictionaryTemplate)
+	if err != nil {
+		return err
+	}
+	if opts.Templates != "" {
+		if t, err = t.Parse(opts.Templates); err != nil {
+			return err
+		}
+	}
+	page, err := newDictPage(tables, opts)
+	if err != nil {
+		return err
+	}
+	return t.ExecuteTemplate(w, "dictionary", page)
+}
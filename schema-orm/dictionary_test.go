@@ -0,0 +1,162 @@
+package schema_orm
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const sqliteRelationsDDL = `
+CREATE TABLE country (
+  code CHAR(2) PRIMARY KEY,
+  name VARCHAR(64) NOT NULL
+);
+CREATE TABLE supplier (
+  id INTEGER PRIMARY KEY,
+  name VARCHAR(128) NOT NULL,
+  country_code CHAR(2) REFERENCES country (code) ON DELETE SET NULL,
+  parent_id INTEGER,
+  FOREIGN KEY (parent_id) REFERENCES supplier (id)
+);
+CREATE INDEX IDX_supplier_name ON supplier (name);
+`
+
+func dictionaryFixture(t *testing.T) []*Table {
+	t.Helper()
+	eng, err := NewSQLiteEngine(BuildSQLiteDSN(filepath.Join(t.TempDir(), "dict.db")))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer eng.Close()
+	if _, err := eng.Import(strings.NewReader(sqliteRelationsDDL)); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	tables, err := ExportEngineSchema(context.Background(), eng, ExportOptions{})
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	for _, tb := range tables {
+		if tb.Name == "supplier" {
+			tb.Comment = "Approved | preferred suppliers"
+			tb.GetColumn("name").Comment = "Legal name\nas registered"
+		}
+	}
+	return tables
+}
+
+func TestExportSQLite_ForeignKeys(t *testing.T) {
+	tables := dictionaryFixture(t)
+	var sup *Table
+	for _, tb := range tables {
+		if tb.Name == "supplier" {
+			sup = tb
+		}
+	}
+	if sup == nil || len(sup.ForeignKeys) != 2 {
+		t.Fatalf("expected 2 foreign keys: %+v", sup)
+	}
+	fk := sup.ForeignKeys[0]
+	if fk.RefTable != "country" || fk.Cols[0] != "country_code" || fk.RefCols[0] != "code" || fk.OnDelete != "SET NULL" {
+		t.Fatalf("unexpected first fk: %+v", fk)
+	}
+	if sup.ForeignKeys[1].RefTable != "supplier" || sup.ForeignKeys[1].RefFullName() != "supplier" {
+		t.Fatalf("unexpected self reference: %+v", sup.ForeignKeys[1])
+	}
+}
+
+func TestExportSQLite_ForeignKeyToPrimaryKey(t *testing.T) {
+	eng, err := NewSQLiteEngine(BuildSQLiteDSN(filepath.Join(t.TempDir(), "fk.db")))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer eng.Close()
+	// no target columns: the key of period, declared out of column order
+	if _, err := eng.Import(strings.NewReader(`
+CREATE TABLE period (month INTEGER, year INTEGER, PRIMARY KEY (year, month));
+CREATE TABLE booking (id INTEGER PRIMARY KEY, y INTEGER, m INTEGER, FOREIGN KEY (y, m) REFERENCES period);
+`)); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	tables, err := ExportEngineSchema(context.Background(), eng, ExportOptions{})
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	for _, tb := range tables {
+		if tb.Name != "booking" {
+			continue
+		}
+		if len(tb.ForeignKeys) != 1 || strings.Join(tb.ForeignKeys[0].RefCols, ",") != "year,month" {
+			t.Fatalf("unexpected fk: %+v", tb.ForeignKeys)
+		}
+		return
+	}
+	t.Fatal("booking not exported")
+}
+
+func TestWriteMarkdownDictionary(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteMarkdownDictionary(&buf, dictionaryFixture(t), DictionaryOptions{Title: "MDM"}); err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"# MDM\n",
+		"- [country](#t-country)",
+		"- [supplier](#t-supplier) — Approved \\| preferred suppliers",
+		"| name | VARCHAR(128) | NO |  |  | Legal name<br>as registered |",
+		"| code | CHAR(2) | NO |  | PK |  |",
+		"| country_code | CHAR(2) | YES |  | FK |  |",
+		"| IDX_supplier_name | NO | name |",
+		"- (country_code) → [country](#t-country) (code)",
+		"**Referenced by**\n\n- [supplier](#t-supplier) (country_code) → (code)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("markdown missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestWriteHTMLDictionary(t *testing.T) {
+	tables := dictionaryFixture(t)
+	tables[0].Comment = "<script>alert(1)</script>"
+	var buf bytes.Buffer
+	opts := DictionaryOptions{
+		Templates: `{{define "header"}}<h1 class="brand">{{brand}} – {{.Title}}</h1>{{end}}{{define "footer"}}<footer>{{.Data.owner}}</footer>{{end}}`,
+		Funcs:     map[string]any{"brand": func() string { return "ACME" }},
+		Data:      map[string]any{"owner": "MDM team"},
+	}
+	if err := WriteHTMLDictionary(&buf, tables, opts); err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"<!DOCTYPE html>",
+		`<input id="search"`,
+		`<li data-target="t-supplier"><a href="#t-supplier">supplier</a></li>`,
+		`<h1 class="brand">ACME – Data Dictionary</h1>`,
+		"<footer>MDM team</footer>",
+		"&lt;script&gt;alert(1)&lt;/script&gt;",
+		`<a href="#t-country">country</a>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("html missing %q:\n%s", want, out)
+		}
+	}
+	if err := WriteHTMLDictionary(&buf, tables, DictionaryOptions{Templates: "{{define"}); err == nil {
+		t.Fatalf("expected template parse error")
+	}
+	if err := WriteMarkdownDictionary(&buf, tables, DictionaryOptions{Templates: "{{end}}"}); err == nil {
+		t.Fatalf("expected template parse error")
+	}
+}
+
+func TestColumnTypeString(t *testing.T) {
+	if s := ColumnTypeString(&Column{SQLType: SQLType{Name: "DECIMAL"}, Length: 10, Length2: 2}); s != "DECIMAL(10,2)" {
+		t.Fatalf("unexpected %s", s)
+	}
+	if s := ColumnTypeString(&Column{SQLType: SQLType{Name: "TEXT"}}); s != "TEXT" {
+		t.Fatalf("unexpected %s", s)
+	}
+}
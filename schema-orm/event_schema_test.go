@@ -0,0 +1,196 @@
+package schema_orm
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// eventTable builds an "orders" table with the given columns, in order.
+func eventTable(cols ...*Column) *Table {
+	tb := NewEmptyTable()
+	tb.Name = "orders"
+	tb.Comment = "Sales orders"
+	for _, c := range cols {
+		tb.AddColumn(c)
+	}
+	return tb
+}
+
+var (
+	evID     = &Column{Name: "id", SQLType: SQLType{Name: "BIGINT"}, IsPrimaryKey: true}
+	evAmount = &Column{Name: "amount", SQLType: SQLType{Name: "DECIMAL"}, Length: 12, Length2: 2}
+	evNote   = &Column{Name: "note", SQLType: SQLType{Name: "TEXT"}, Nullable: true, Comment: "free text"}
+	evPaid   = &Column{Name: "paid_at", SQLType: SQLType{Name: "DATETIME"}, Nullable: true}
+	evTags   = &Column{Name: "tags", SQLType: SQLType{Name: "VARCHAR[]"}}
+)
+
+func TestFieldNumbering_Assign(t *testing.T) {
+	n := FieldNumbering{}
+	if !n.Assign([]*Table{eventTable(evID, evAmount, evNote)}) {
+		t.Fatal("first assignment should report a change")
+	}
+	if n.Assign([]*Table{eventTable(evID, evAmount, evNote)}) {
+		t.Fatal("unchanged schema should not report a change")
+	}
+
+	// new column in the middle, note dropped: nothing is renumbered
+	n.Assign([]*Table{eventTable(evID, evPaid, evAmount)})
+	fn := n["orders"]
+	if fn.Fields["id"] != 1 || fn.Fields["amount"] != 2 || fn.Fields["paid_at"] != 4 {
+		t.Fatalf("unexpected numbers: %+v", fn.Fields)
+	}
+	if len(fn.Reserved) != 1 || fn.Reserved[0] != 3 || len(fn.ReservedNames) != 1 || fn.ReservedNames[0] != "note" {
+		t.Fatalf("note should be reserved: %+v", fn)
+	}
+
+	// re-adding note hands out a fresh number and keeps 3 reserved
+	n.Assign([]*Table{eventTable(evID, evPaid, evAmount, evNote)})
+	if fn.Fields["note"] != 5 || len(fn.ReservedNames) != 0 || fn.Reserved[0] != 3 {
+		t.Fatalf("re-added column: %+v", fn)
+	}
+
+	// the protobuf implementation range is skipped
+	fn.Reserved = append(fn.Reserved, firstReservedNumber-1)
+	n.Assign([]*Table{eventTable(evID, evPaid, evAmount, evNote, evTags)})
+	if fn.Fields["tags"] != lastReservedNumber+1 {
+		t.Fatalf("tags = %d, want %d", fn.Fields["tags"], lastReservedNumber+1)
+	}
+}
+
+func TestFieldNumbering_FileRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	missing, err := LoadFieldNumbering(filepath.Join(dir, "absent.yaml"))
+	if err != nil || len(missing) != 0 {
+		t.Fatalf("missing file: %v %v", missing, err)
+	}
+	n := FieldNumbering{}
+	n.Assign([]*Table{eventTable(evID, evAmount, evNote)})
+	n.Assign([]*Table{eventTable(evID, evAmount)})
+	for _, name := range []string{"fields.yaml", "fields.json"} {
+		p := filepath.Join(dir, name)
+		if err := n.WriteFile(p); err != nil {
+			t.Fatalf("%s: write: %v", name, err)
+		}
+		got, err := LoadFieldNumbering(p)
+		if err != nil {
+			t.Fatalf("%s: load: %v", name, err)
+		}
+		if fn := got["orders"]; fn == nil || fn.Fields["amount"] != 2 || fn.ReservedNames[0] != "note" {
+			t.Fatalf("%s: unexpected numbering %+v", name, fn)
+		}
+	}
+}
+
+func TestWriteProto(t *testing.T) {
+	tables := []*Table{eventTable(evID, evAmount, evNote, evPaid, evTags)}
+	var buf bytes.Buffer
+	if err := WriteProto(&buf, tables, FieldNumbering{}, ProtoOptions{}); err == nil || !strings.Contains(err.Error(), "no field number") {
+		t.Fatalf("expected missing number error, got %v", err)
+	}
+
+	n := FieldNumbering{}
+	n.Assign([]*Table{eventTable(evID, evAmount, evNote, &Column{Name: "legacy", SQLType: SQLType{Name: "INT"}})})
+	n.Assign(tables)
+	buf.Reset()
+	if err := WriteProto(&buf, tables, n, ProtoOptions{GoPackage: "example.com/mdm"}); err != nil {
+		t.Fatalf("WriteProto: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"package mdm;",
+		`import "google/protobuf/timestamp.proto";`,
+		`option go_package = "example.com/mdm";`,
+		"// Sales orders\nmessage Orders {",
+		"  reserved 4;\n  reserved \"legacy\";",
+		"  int64 id = 1;",
+		"  string amount = 2;",
+		"  // free text\n  optional string note = 3;",
+		"  optional google.protobuf.Timestamp paid_at = 5;",
+		"  repeated string tags = 6;",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("proto misses %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestNewAvroRecord(t *testing.T) {
+	tb := eventTable(evID, evAmount, evNote, evPaid, evTags)
+	rec, err := NewAvroRecord(tb, nil, AvroOptions{Namespace: "com.acme"})
+	if err != nil {
+		t.Fatalf("NewAvroRecord: %v", err)
+	}
+	b, _ := json.Marshal(rec)
+	out := string(b)
+	for _, want := range []string{
+		`"name":"Orders","namespace":"com.acme","doc":"Sales orders"`,
+		`{"name":"id","type":"long"}`,
+		`{"name":"amount","type":{"logicalType":"decimal","precision":12,"scale":2,"type":"bytes"}}`,
+		`{"name":"note","type":["null","string"],"doc":"free text","default":null}`,
+		`{"name":"paid_at","type":["null",{"logicalType":"timestamp-micros","type":"long"}],"default":null}`,
+		`{"name":"tags","type":{"items":"string","type":"array"}}`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("avro misses %s:\n%s", want, out)
+		}
+	}
+
+	// with numbers, a column added in the middle goes last
+	n := FieldNumbering{}
+	n.Assign([]*Table{eventTable(evID, evAmount)})
+	n.Assign([]*Table{eventTable(evID, evNote, evAmount)})
+	rec, err = NewAvroRecord(eventTable(evID, evNote, evAmount), n["orders"], AvroOptions{})
+	if err != nil {
+		t.Fatalf("numbered: %v", err)
+	}
+	if got := rec.Fields[2].Name; got != "note" {
+		t.Fatalf("last field = %q, want note", got)
+	}
+	if _, err := NewAvroRecord(tb, n["orders"], AvroOptions{}); err == nil {
+		t.Fatal("expected missing number error")
+	}
+}
+
+func TestEventSchemas_FieldNameCollision(t *testing.T) {
+	tables := []*Table{eventTable(evID, &Column{Name: "a-b", SQLType: SQLType{Name: "INT"}}, &Column{Name: "a_b", SQLType: SQLType{Name: "INT"}})}
+	n := FieldNumbering{}
+	n.Assign(tables)
+	want := "columns a-b and a_b both map to field a_b"
+	if err := WriteProto(&bytes.Buffer{}, tables, n, ProtoOptions{}); err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("proto: %v", err)
+	}
+	if _, err := NewAvroRecord(tables[0], nil, AvroOptions{}); err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("avro: %v", err)
+	}
+}
+
+func TestEventSchemas_SQLiteBundle(t *testing.T) {
+	tables := dictionaryFixture(t)
+	p := filepath.Join(t.TempDir(), "schema.yaml")
+	if err := NewBundle("sqlite3", tables).WriteFile(p); err != nil {
+		t.Fatalf("write bundle: %v", err)
+	}
+	bundle, err := LoadBundle(p)
+	if err != nil {
+		t.Fatalf("load bundle: %v", err)
+	}
+	n := FieldNumbering{}
+	n.Assign(bundle.Tables)
+	var proto, avro bytes.Buffer
+	if err := WriteProto(&proto, bundle.Tables, n, ProtoOptions{Package: "dict"}); err != nil {
+		t.Fatalf("proto: %v", err)
+	}
+	if err := WriteAvroSchemas(&avro, bundle.Tables, n, AvroOptions{}); err != nil {
+		t.Fatalf("avro: %v", err)
+	}
+	if !strings.Contains(proto.String(), "message Supplier {") || !strings.Contains(proto.String(), "optional int32 parent_id") {
+		t.Fatalf("unexpected proto:\n%s", proto.String())
+	}
+	var records []AvroRecord
+	if err := json.Unmarshal(avro.Bytes(), &records); err != nil || len(records) != len(bundle.Tables) {
+		t.Fatalf("avro: %v\n%s", err, avro.String())
+	}
+}
@@ -1,9 +1,310 @@
 package schema_orm
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	"xorm.io/xorm"
+	"xorm.io/xorm/dialects"
+	xs "xorm.io/xorm/schemas"
 )
 
+// ExportOptions narrows and bounds a schema export.
+//
+// Include and Exclude hold path.Match globs that are matched against both the bare
+// table name and the schema-qualified name ("sales.customer"). An empty Include
+// selects every table; Exclude wins over Include.
+//
+// Schemas lists the PostgreSQL namespaces to introspect; their tables record
+// the namespace in Table.Schema. When empty, the connection's default namespace
+// is introspected and Table.Schema is left empty, so the tables stay portable
+// to other dialects; the filters still match it by name ("public" unless the
+// DSN says otherwise). Other dialects ignore Schemas. The engine itself is not
+// reconfigured, so it may be shared with concurrent users.
+//
+// Timeout bounds the whole export, including connecting; zero means no limit
+// beyond the caller's context.
+//
+// Profile, when set, profiles the data of every exported table and attaches the
+// result as Table.Profile.
+//
+// Workers bounds how many tables are introspected at the same time; zero
+// selects DefaultExportWorkers and 1 reads the tables one after another.
+// Progress, when set, is called once per exported table, in table order and
+// never concurrently.
+type ExportOptions struct {
+	Include  []string
+	Exclude  []string
+	Schemas  []string
+	Timeout  time.Duration
+	Profile  *ProfileOptions
+	Workers  int
+	Progress func(ExportProgress)
+}
+
+// Match reports whether a table passes the Include/Exclude filters.
+func (o *ExportOptions) Match(schema, name string) bool {
+	names := []string{name}
+	if schema != "" {
+		names = append(names, schema+"."+name)
+	}
+	matchAny := func(patterns []string) bool {
+		for _, p := range patterns {
+			for _, n := range names {
+				if ok, _ := path.Match(p, n); ok {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	if matchAny(o.Exclude) {
+		return false
+	}
+	return len(o.Include) == 0 || matchAny(o.Include)
+}
+
+func (o *ExportOptions) validate() error {
+	for _, p := range append(append([]string(nil), o.Include...), o.Exclude...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid table pattern %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// OpenEngine creates an xorm Engine for the driver and DSN.
+// SQLite engines are opened through NewSQLiteEngine so in-memory databases keep a single connection.
+func OpenEngine(driver, dsn string) (*xorm.Engine, error) {
+	if driver == SQLiteDriver || driver == "sqlite3" {
+		return NewSQLiteEngine(dsn)
+	}
+	return xorm.NewEngine(driver, dsn)
+}
+
+// ExportSchema connects with the given driver and DSN, introspects the database schema
+// and converts it to schema-orm structures, filtered by opts.
+//
+// driver example: "mysql", "postgres", "sqlite"
+func ExportSchema(ctx context.Context, driver, dsn string, opts ExportOptions) ([]*Table, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	engine, err := OpenEngine(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	defer engine.Close()
+	return ExportEngineSchema(ctx, engine, opts)
+}
+
+// ExportSchemaToJSON does the same as ExportSchema and returns the tables as a JSON array.
+func ExportSchemaToJSON(ctx context.Context, driver, dsn string, opts ExportOptions) (string, error) {
+	out, err := ExportSchema(ctx, driver, dsn, opts)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(out)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// ExportEngineSchema introspects the database behind an existing engine, filtered by opts.
+// It collects the tables of StreamEngineSchema; profiling, when requested,
+// runs after the structure has been read.
+func ExportEngineSchema(ctx context.Context, engine *xorm.Engine, opts ExportOptions) ([]*Table, error) {
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	structure := opts
+	structure.Timeout, structure.Profile = 0, nil
+	var out []*Table
+	if err := StreamEngineSchema(ctx, engine, structure, func(tb *Table) error {
+		out = append(out, tb)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if opts.Profile != nil {
+		if err := ProfileTables(ctx, engine, out, *opts.Profile); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// exportGroup is the tables selected in one PostgreSQL namespace, or in the
+// whole database for other dialects.
+type exportGroup struct {
+	tables []exportTable
+}
+
+// exportTable is a selected table and the function that introspects it.
+type exportTable struct {
+	name string
+	load func(ctx context.Context) (*Table, error)
+}
+
+// listExportTables lists the tables passing the filters without reading their
+// columns. SQLite databases are introspected through PRAGMA queries, other
+// dialects through xorm. For PostgreSQL every requested schema is listed in
+// turn, through a dialect of its own, and recorded on Table.Schema.
+func listExportTables(ctx context.Context, engine *xorm.Engine, opts ExportOptions) ([]exportGroup, error) {
+	uri := engine.Dialect().URI()
+	switch uri.DBType {
+	case xs.SQLITE:
+		masters, err := listSQLiteTables(ctx, engine)
+		if err != nil {
+			return nil, err
+		}
+		g := exportGroup{}
+		for _, m := range masters {
+			if opts.Match("", m.name) {
+				g.tables = append(g.tables, exportTable{name: m.name, load: func(ctx context.Context) (*Table, error) {
+					tb, err := sqliteTable(ctx, engine, m.name, m.sql)
+					if err != nil {
+						return nil, fmt.Errorf("introspect %s: %w", m.name, err)
+					}
+					return tb, nil
+				}})
+			}
+		}
+		return []exportGroup{g}, nil
+	case xs.POSTGRES:
+		if len(opts.Schemas) == 0 {
+			ns := uri.Schema
+			if ns == "" {
+				ns = dialects.DefaultPostgresSchema
+			}
+			g, err := listXormTables(ctx, engine, engine.Dialect(), ns, "", opts)
+			if err != nil {
+				return nil, err
+			}
+			return []exportGroup{g}, nil
+		}
+		var out []exportGroup
+		for _, ns := range opts.Schemas {
+			dialect, err := schemaDialect(engine, ns)
+			if err != nil {
+				return nil, err
+			}
+			g, err := listXormTables(ctx, engine, dialect, ns, ns, opts)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, g)
+		}
+		return out, nil
+	default:
+		g, err := listXormTables(ctx, engine, engine.Dialect(), "", "", opts)
+		if err != nil {
+			return nil, err
+		}
+		return []exportGroup{g}, nil
+	}
+}
+
+// schemaDialect returns a dialect like the engine's that introspects the
+// PostgreSQL namespace ns. The engine's own dialect keeps its schema.
+func schemaDialect(engine *xorm.Engine, ns string) (dialects.Dialect, error) {
+	uri := *engine.Dialect().URI()
+	uri.Schema = ns
+	dialect := dialects.QueryDialect(uri.DBType)
+	if dialect == nil {
+		return nil, fmt.Errorf("unsupported dialect %q", uri.DBType)
+	}
+	if err := dialect.Init(&uri); err != nil {
+		return nil, err
+	}
+	return dialect, nil
+}
+
+// listXormTables mirrors xorm's DBMetas, but honours ctx and skips filtered
+// tables before their columns and indexes are loaded. Tables are read with
+// dialect, matched against the filters in namespace ns and record schema.
+func listXormTables(ctx context.Context, engine *xorm.Engine, dialect dialects.Dialect, ns, schema string, opts ExportOptions) (exportGroup, error) {
+	metas, err := dialect.GetTables(engine.DB(), ctx)
+	if err != nil {
+		return exportGroup{}, err
+	}
+	var g exportGroup
+	for _, xt := range metas {
+		if !opts.Match(ns, xt.Name) {
+			continue
+		}
+		g.tables = append(g.tables, exportTable{name: xt.Name, load: func(ctx context.Context) (*Table, error) {
+			if err := loadXormTableInfo(ctx, engine, dialect, xt); err != nil {
+				return nil, err
+			}
+			tb := FromXormTable(&XormTable{Table: xt})
+			tb.Schema = schema
+			if err := loadForeignKeys(ctx, engine, tb); err != nil {
+				return nil, fmt.Errorf("foreign keys of %s: %w", tb.FullName(), err)
+			}
+			return tb, nil
+		}})
+	}
+	return g, nil
+}
+
+// loadXormTableInfo fills columns and indexes like xorm's Engine.loadTableInfo.
+func loadXormTableInfo(ctx context.Context, engine *xorm.Engine, dialect dialects.Dialect, table *xs.Table) error {
+	colSeq, cols, err := dialect.GetColumns(engine.DB(), ctx, table.Name)
+	if err != nil {
+		return err
+	}
+	for _, name := range colSeq {
+		table.AddColumn(cols[name])
+	}
+	indexes, err := dialect.GetIndexes(engine.DB(), ctx, table.Name)
+	if err != nil {
+		return err
+	}
+	table.Indexes = indexes
+	for _, index := range indexes {
+		for _, name := range index.Cols {
+			parts := strings.Split(strings.TrimSpace(name), " ")
+			colName := strings.Trim(parts[0], `"`)
+			if col := table.GetColumn(colName); col != nil {
+				col.Indexes[index.Name] = index.Type
+			} else {
+				return fmt.Errorf("unknown col %s in index %v of table %v", name, index.Name, table.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// ExportMySQLToJSON connects to MySQL, introspects the database schema,
+// converts to schema-orm structures, and returns the JSON string.
+//
+// host example: "localhost" or "localhost:3306"
+// user example: "root"
+// password may be empty if not needed
+// db example: "wiz_hr2"
+func ExportMySQLToJSON(host, user, password, db string) (string, error) {
+	return ExportSchemaToJSON(context.Background(), "mysql", BuildMySQLDSN(host, user, password, db), ExportOptions{})
+}
+
+// ExportPostgresToJSON connects to PostgreSQL, introspects the "public" schema,
+// converts to schema-orm structures, and returns the JSON string.
+// host example: "localhost" or "localhost:5432"
+// user example: "ever"
+// db example: "postgres"
+func ExportPostgresToJSON(host, user, password, db string) (string, error) {
+	return ExportSchemaToJSON(context.Background(), "postgres", BuildPostgresDSN(host, user, password, db), ExportOptions{})
+}
+
 // BuildMySQLDSN builds a standard MySQL DSN for xorm/mysql driver.
 // Example: root:pass@tcp(localhost:3306)/wiz_hr2?charset=utf8mb4&parseTime=True&loc=Local
 func BuildMySQLDSN(host, user, password, db string) string {
@@ -0,0 +1,149 @@
+package schema_orm
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	yaml "gopkg.in/yaml.v3"
+	xs "xorm.io/xorm/schemas"
+)
+
+func TestExportOptions_Match(t *testing.T) {
+	cases := []struct {
+		opts   ExportOptions
+		schema string
+		name   string
+		want   bool
+	}{
+		{ExportOptions{}, "", "customer", true},
+		{ExportOptions{Include: []string{"cust*"}}, "", "customer", true},
+		{ExportOptions{Include: []string{"cust*"}}, "", "address", false},
+		{ExportOptions{Exclude: []string{"tmp_*"}}, "", "tmp_load", false},
+		{ExportOptions{Include: []string{"*"}, Exclude: []string{"customer"}}, "", "customer", false},
+		{ExportOptions{Include: []string{"sales.*"}}, "sales", "customer", true},
+		{ExportOptions{Include: []string{"sales.*"}}, "hr", "customer", false},
+		{ExportOptions{Exclude: []string{"hr.*"}}, "hr", "customer", false},
+	}
+	for i, c := range cases {
+		if got := c.opts.Match(c.schema, c.name); got != c.want {
+			t.Fatalf("case %d: Match(%q, %q) = %v", i, c.schema, c.name, got)
+		}
+	}
+}
+
+func TestExportSchema_SQLiteFilters(t *testing.T) {
+	dsn := newSQLiteFixture(t, filepath.Join(t.TempDir(), "filter.db"))
+	ctx := context.Background()
+
+	tables, err := ExportSchema(ctx, SQLiteDriver, dsn, ExportOptions{Include: []string{"cust*"}})
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if len(tables) != 1 || tables[0].Name != "customer" {
+		t.Fatalf("include filter failed: %v", tables)
+	}
+
+	tables, err = ExportSchema(ctx, SQLiteDriver, dsn, ExportOptions{Exclude: []string{"customer"}})
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if len(tables) != 1 || tables[0].Name != "address" {
+		t.Fatalf("exclude filter failed: %v", tables)
+	}
+	if tables[0].Schema != "" {
+		t.Fatalf("sqlite tables carry no schema: %q", tables[0].Schema)
+	}
+
+	if _, err := ExportSchema(ctx, SQLiteDriver, dsn, ExportOptions{Include: []string{"["}}); err == nil {
+		t.Fatalf("expected error for malformed glob")
+	}
+}
+
+func TestExportSchema_ContextCancelled(t *testing.T) {
+	dsn := newSQLiteFixture(t, filepath.Join(t.TempDir(), "ctx.db"))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ExportSchema(ctx, SQLiteDriver, dsn, ExportOptions{}); err == nil {
+		t.Fatalf("expected error for cancelled context")
+	}
+}
+
+func TestTable_SchemaRoundTrip(t *testing.T) {
+	tb := NewTable("customer", nil)
+	tb.Schema = "sales"
+	tb.AddColumn(&Column{Name: "id", SQLType: SQLType{Name: "INT"}})
+	if tb.FullName() != "sales.customer" {
+		t.Fatalf("unexpected full name %s", tb.FullName())
+	}
+	b, err := json.Marshal(tb)
+	if err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	var fromJSON Table
+	if err := json.Unmarshal(b, &fromJSON); err != nil || fromJSON.Schema != "sales" {
+		t.Fatalf("json schema lost: %v %q", err, fromJSON.Schema)
+	}
+	y, err := yaml.Marshal(tb)
+	if err != nil {
+		t.Fatalf("yaml: %v", err)
+	}
+	var fromYAML Table
+	if err := yaml.Unmarshal(y, &fromYAML); err != nil || fromYAML.Schema != "sales" {
+		t.Fatalf("yaml schema lost: %v %q", err, fromYAML.Schema)
+	}
+	if NewTable("plain", nil).FullName() != "plain" {
+		t.Fatalf("unqualified full name")
+	}
+}
+
+func TestIndex_QualifiedXName(t *testing.T) {
+	i := NewIndex("code", UniqueType)
+	if got := i.QualifiedXName("sales.customer"); got != "sales.UQE_customer_code" {
+		t.Fatalf("unexpected %s", got)
+	}
+	if got := i.QualifiedXName(`"hr"."customer"`); got != "hr.UQE_customer_code" {
+		t.Fatalf("unexpected quoted %s", got)
+	}
+	if got := i.QualifiedXName("customer"); got != "UQE_customer_code" {
+		t.Fatalf("unexpected unqualified %s", got)
+	}
+}
+
+func TestDropIndexSQL_PostgresSchema(t *testing.T) {
+	dialect, err := offlineDialect(xs.POSTGRES, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := NewIndex("code", IndexType)
+	for tbl, want := range map[string]string{
+		"hr.customer":    `DROP INDEX "hr"."IDX_customer_code"`,
+		"sales.customer": `DROP INDEX "sales"."IDX_customer_code"`,
+		"customer":       `DROP INDEX "public"."IDX_customer_code"`,
+	} {
+		if got := dropIndexSQL(dialect, tbl, i, nil, true); got != want {
+			t.Errorf("%s: %s, want %s", tbl, got, want)
+		}
+	}
+	namer, _ := ParseIndexNamer("{table}_{cols}_idx")
+	i.Cols = []string{"code"}
+	if got := dropIndexSQL(dialect, "hr.customer", i, namer, false); got != `DROP INDEX "hr"."customer_code_idx"` {
+		t.Errorf("namer: %s", got)
+	}
+}
+
+func TestSchemaDialect_LeavesEngineAlone(t *testing.T) {
+	engine, err := OpenEngine("postgres", "postgres://u@localhost:1/db?sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close()
+	dialect, err := schemaDialect(engine, "hr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dialect.URI().Schema != "hr" || engine.Dialect().URI().Schema != "" {
+		t.Fatalf("schemas: dialect %q, engine %q", dialect.URI().Schema, engine.Dialect().URI().Schema)
+	}
+}
@@ -0,0 +1,244 @@
+package schema_orm
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"strconv"
+	"strings"
+
+	_ "modernc.org/sqlite"
+	"xorm.io/xorm"
+)
+
+// SQLiteDriver is the database/sql driver name registered by the pure-Go
+// modernc.org/sqlite driver; xorm maps it onto its sqlite3 dialect.
+const SQLiteDriver = "sqlite"
+
+// BuildSQLiteDSN builds a DSN for the pure-Go SQLite driver.
+// An empty path (or ":memory:") selects an in-memory database.
+// Example: ./data/mdm.db -> file:./data/mdm.db?_pragma=foreign_keys(1)
+func BuildSQLiteDSN(path string) string {
+	if path == "" || path == ":memory:" {
+		return ":memory:"
+	}
+	return "file:" + path + "?_pragma=foreign_keys(1)"
+}
+
+// IsSQLiteMemoryDSN reports whether the DSN points at an in-memory SQLite database.
+func IsSQLiteMemoryDSN(dsn string) bool {
+	return dsn == "" || strings.Contains(dsn, ":memory:") || strings.Contains(dsn, "mode=memory")
+}
+
+// NewSQLiteEngine opens an xorm Engine backed by the pure-Go SQLite driver.
+// An in-memory database only lives as long as its connection, so the pool is
+// pinned to a single connection to keep every call on the same database.
+func NewSQLiteEngine(dsn string) (*xorm.Engine, error) {
+	if dsn == "" {
+		dsn = BuildSQLiteDSN("")
+	}
+	engine, err := xorm.NewEngine(SQLiteDriver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if IsSQLiteMemoryDSN(dsn) {
+		engine.SetMaxOpenConns(1)
+		engine.SetMaxIdleConns(1)
+		engine.SetConnMaxLifetime(0)
+	}
+	return engine, nil
+}
+
+// ExportSQLiteToJSON opens the SQLite database file at path, introspects its schema,
+// converts to schema-orm structures, and returns the JSON string.
+// path example: "./data/mdm.db"
+func ExportSQLiteToJSON(path string) (string, error) {
+	return ExportSchemaToJSON(context.Background(), SQLiteDriver, BuildSQLiteDSN(path), ExportOptions{})
+}
+
+// sqliteTypeRe splits a declared SQLite column type such as "DECIMAL(10, 2)"
+// into its name and optional lengths.
+var sqliteTypeRe = regexp.MustCompile(`^\s*([^(]+?)\s*(?:\(\s*(\d+)\s*(?:,\s*(\d+)\s*)?\))?\s*$`)
+
+// parseSQLiteType converts a declared column type into an SQLType and lengths.
+func parseSQLiteType(decl string) (SQLType, int64, int64) {
+	m := sqliteTypeRe.FindStringSubmatch(decl)
+	if m == nil {
+		return SQLType{Name: SQLTypeName(strings.TrimSpace(decl))}, 0, 0
+	}
+	var l1, l2 int64
+	if m[2] != "" {
+		l1, _ = strconv.ParseInt(m[2], 10, 64)
+	}
+	if m[3] != "" {
+		l2, _ = strconv.ParseInt(m[3], 10, 64)
+	}
+	return SQLType{Name: SQLTypeName(m[1])}, l1, l2
+}
+
+// sqliteMaster is a table entry of sqlite_master.
+type sqliteMaster struct{ name, sql string }
+
+// listSQLiteTables lists the user tables of a SQLite database in name order.
+// The tables are introspected through the PRAGMA interface by sqliteTable:
+// xorm's sqlite3 dialect re-parses the stored CREATE statements, which breaks
+// on multi-line DDL and typed lengths such as VARCHAR(32).
+func listSQLiteTables(ctx context.Context, engine *xorm.Engine) ([]sqliteMaster, error) {
+	rows, err := engine.DB().QueryContext(ctx, "SELECT name, sql FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var masters []sqliteMaster
+	for rows.Next() {
+		var name string
+		var ddl sql.NullString
+		if err := rows.Scan(&name, &ddl); err != nil {
+			return nil, err
+		}
+		masters = append(masters, sqliteMaster{name: name, sql: ddl.String})
+	}
+	return masters, rows.Err()
+}
+
+func sqliteTable(ctx context.Context, engine *xorm.Engine, name, ddl string) (*Table, error) {
+	db := engine.DB()
+	quoted := engine.Dialect().Quoter().Quote(name)
+	rows, err := db.QueryContext(ctx, "PRAGMA table_info("+quoted+")")
+	if err != nil {
+		return nil, err
+	}
+	tb := NewTable(name, nil)
+	var cols []*Column
+	// PRAGMA pk positions carry the declared key order, which may differ from column order.
+	pkOrder := map[int]string{}
+	for rows.Next() {
+		var (
+			cid     int
+			colName string
+			decl    string
+			notNull int
+			dflt    sql.NullString
+			pk      int
+		)
+		if err := rows.Scan(&cid, &colName, &decl, &notNull, &dflt, &pk); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		st, l1, l2 := parseSQLiteType(decl)
+		col := NewColumn(colName, "", st, l1, l2, notNull == 0)
+		if dflt.Valid {
+			col.Default = dflt.String
+			col.DefaultIsEmpty = false
+		}
+		if pk > 0 {
+			col.IsPrimaryKey = true
+			col.Nullable = false
+			pkOrder[pk] = colName
+		}
+		cols = append(cols, col)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// AUTOINCREMENT can only be declared on a single INTEGER PRIMARY KEY (the rowid alias).
+	autoIncr := len(pkOrder) == 1 && strings.Contains(strings.ToUpper(ddl), "AUTOINCREMENT")
+	for _, c := range cols {
+		c.IsAutoIncrement = autoIncr && c.IsPrimaryKey
+		tb.AddColumn(c)
+	}
+	tb.PrimaryKeys = make([]string, 0, len(pkOrder))
+	for i := 1; i <= len(pkOrder); i++ {
+		tb.PrimaryKeys = append(tb.PrimaryKeys, pkOrder[i])
+	}
+
+	idxRows, err := db.QueryContext(ctx, "PRAGMA index_list("+quoted+")")
+	if err != nil {
+		return nil, err
+	}
+	type idxMeta struct {
+		name   string
+		unique bool
+		origin string
+	}
+	var metas []idxMeta
+	for idxRows.Next() {
+		var (
+			seq     int
+			idxName string
+			unique  int
+			origin  string
+			partial int
+		)
+		if err := idxRows.Scan(&seq, &idxName, &unique, &origin, &partial); err != nil {
+			idxRows.Close()
+			return nil, err
+		}
+		metas = append(metas, idxMeta{name: idxName, unique: unique == 1, origin: origin})
+	}
+	idxRows.Close()
+	if err := idxRows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, im := range metas {
+		// the primary key is already described by the columns
+		if im.origin == "pk" {
+			continue
+		}
+		idxCols, err := sqliteIndexColumns(ctx, engine, im.name)
+		if err != nil {
+			return nil, err
+		}
+		idxType := IndexType
+		if im.unique {
+			idxType = UniqueType
+		}
+		index := NewIndex(im.name, idxType)
+		index.IsRegular = false
+		switch {
+		case strings.HasPrefix(im.name, "IDX_"+name+"_"), strings.HasPrefix(im.name, "UQE_"+name+"_"):
+			// same convention as xorm: strip the generated prefix, XName adds it back
+			index.Name = im.name[5+len(name):]
+			index.IsRegular = true
+		case im.origin == "u":
+			// inline UNIQUE constraints get reserved sqlite_autoindex_* names
+			index.Name = strings.Join(idxCols, "_")
+			index.IsRegular = true
+		}
+		index.AddColumn(idxCols...)
+		tb.AddIndex(index)
+		for _, c := range idxCols {
+			if col := tb.GetColumn(c); col != nil {
+				col.Indexes[index.Name] = idxType
+			}
+		}
+	}
+	if err := loadSQLiteForeignKeys(ctx, engine, tb); err != nil {
+		return nil, err
+	}
+	return tb, nil
+}
+
+func sqliteIndexColumns(ctx context.Context, engine *xorm.Engine, index string) ([]string, error) {
+	rows, err := engine.DB().QueryContext(ctx, "PRAGMA index_info("+engine.Dialect().Quoter().Quote(index)+")")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var cols []string
+	for rows.Next() {
+		var (
+			seqno int
+			cid   int
+			name  sql.NullString
+		)
+		if err := rows.Scan(&seqno, &cid, &name); err != nil {
+			return nil, err
+		}
+		cols = append(cols, name.String)
+	}
+	return cols, rows.Err()
+}
@@ -0,0 +1,220 @@
+package schema_orm
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+const sqliteFixtureDDL = `
+CREATE TABLE customer (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  code VARCHAR(32) NOT NULL,
+  name TEXT,
+  score REAL DEFAULT 0
+);
+CREATE UNIQUE INDEX UQE_customer_code ON customer (code);
+CREATE INDEX IDX_customer_name ON customer (name);
+CREATE TABLE address (
+  seq INTEGER NOT NULL,
+  customer_id INTEGER NOT NULL,
+  city VARCHAR(64),
+  PRIMARY KEY (customer_id, seq)
+);
+`
+
+func newSQLiteFixture(t *testing.T, path string) string {
+	t.Helper()
+	dsn := BuildSQLiteDSN(path)
+	eng, err := NewSQLiteEngine(dsn)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	defer eng.Close()
+	if _, err := eng.Import(strings.NewReader(sqliteFixtureDDL)); err != nil {
+		t.Fatalf("import fixture: %v", err)
+	}
+	return dsn
+}
+
+func TestBuildSQLiteDSN(t *testing.T) {
+	if d := BuildSQLiteDSN(""); d != ":memory:" {
+		t.Fatalf("unexpected memory dsn: %s", d)
+	}
+	if d := BuildSQLiteDSN(":memory:"); !IsSQLiteMemoryDSN(d) {
+		t.Fatalf("expected memory dsn: %s", d)
+	}
+	d := BuildSQLiteDSN("/tmp/x.db")
+	if d != "file:/tmp/x.db?_pragma=foreign_keys(1)" || IsSQLiteMemoryDSN(d) {
+		t.Fatalf("unexpected file dsn: %s", d)
+	}
+	if !IsSQLiteMemoryDSN("file:demo?mode=memory&cache=shared") {
+		t.Fatalf("expected mode=memory to be detected")
+	}
+}
+
+func TestExportSQLiteToJSON_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mdm.db")
+	newSQLiteFixture(t, path)
+
+	jsonStr, err := ExportSQLiteToJSON(path)
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	tables, err := ImportTablesFromJSON(jsonStr)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if len(tables) != 2 {
+		t.Fatalf("expected 2 tables, got %d", len(tables))
+	}
+	byName := map[string]*Table{}
+	for _, tb := range tables {
+		byName[tb.Name] = tb
+	}
+	cust := byName["customer"]
+	if cust == nil {
+		t.Fatalf("customer missing: %s", jsonStr)
+	}
+	if c := cust.GetColumn("id"); c == nil || !c.IsPrimaryKey || !c.IsAutoIncrement {
+		t.Fatalf("id should be auto-increment pk: %+v", c)
+	}
+	if c := cust.GetColumn("code"); c == nil || c.Nullable || c.Length != 32 {
+		t.Fatalf("code column mismatch: %+v", c)
+	}
+	if len(cust.Indexes) != 2 {
+		t.Fatalf("expected 2 indexes, got %v", cust.Indexes)
+	}
+	if byName["address"] == nil {
+		t.Fatalf("address missing: %s", jsonStr)
+	}
+}
+
+func TestExportEngineSchema_SQLiteCompositePK(t *testing.T) {
+	eng, err := NewSQLiteEngine(newSQLiteFixture(t, filepath.Join(t.TempDir(), "pk.db")))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer eng.Close()
+	tables, err := ExportEngineSchema(context.Background(), eng, ExportOptions{})
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	var addr *Table
+	for _, tb := range tables {
+		if tb.Name == "address" {
+			addr = tb
+		}
+	}
+	if addr == nil || len(addr.PrimaryKeys) != 2 || addr.PrimaryKeys[0] != "customer_id" || addr.PrimaryKeys[1] != "seq" {
+		t.Fatalf("address composite pk should keep declared order: %+v", addr)
+	}
+	if addr.AutoIncrement != "" {
+		t.Fatalf("composite pk cannot be auto-increment: %s", addr.AutoIncrement)
+	}
+}
+
+func TestExportSQLite_Error(t *testing.T) {
+	if _, err := ExportSQLiteToJSON(filepath.Join(t.TempDir(), "missing", "x.db")); err == nil {
+		t.Fatalf("expected error for unreachable sqlite path")
+	}
+}
+
+func TestApplyTables_SQLiteRoundTrip(t *testing.T) {
+	src := newSQLiteFixture(t, filepath.Join(t.TempDir(), "src.db"))
+	jsonStr, err := ExportSchemaToJSON(context.Background(), SQLiteDriver, src, ExportOptions{})
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	tables, err := ImportTablesFromJSON(jsonStr)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	// go through YAML as well to make sure the bundle survives both encodings
+	y, err := yaml.Marshal(tables)
+	if err != nil {
+		t.Fatalf("yaml marshal: %v", err)
+	}
+	var fromYAML []*Table
+	if err := yaml.Unmarshal(y, &fromYAML); err != nil {
+		t.Fatalf("yaml unmarshal: %v", err)
+	}
+
+	dst, err := NewSQLiteEngine(BuildSQLiteDSN(""))
+	if err != nil {
+		t.Fatalf("open memory: %v", err)
+	}
+	defer dst.Close()
+	ctx := context.Background()
+	sqls, err := CreateTableSQLs(ctx, dst, fromYAML)
+	if err != nil {
+		t.Fatalf("ddl: %v", err)
+	}
+	if len(sqls) != 4 {
+		t.Fatalf("expected 2 tables + 2 indexes, got %d: %v", len(sqls), sqls)
+	}
+	if err := ApplyTables(ctx, dst, fromYAML); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	back, err := ExportEngineSchema(ctx, dst, ExportOptions{})
+	if err != nil {
+		t.Fatalf("re-export: %v", err)
+	}
+	b1, _ := json.Marshal(tables)
+	b2, _ := json.Marshal(back)
+	if len(back) != 2 {
+		t.Fatalf("expected 2 tables after apply: %s", b2)
+	}
+	if _, err := dst.Exec("INSERT INTO customer (code, name) VALUES (?, ?)", "C1", "Acme"); err != nil {
+		t.Fatalf("insert into applied table: %v (src %s)", err, b1)
+	}
+	if _, err := dst.Exec("INSERT INTO customer (code, name) VALUES (?, ?)", "C1", "Dup"); err == nil {
+		t.Fatalf("unique index should have been applied")
+	}
+}
+
+func TestCreateTableSQLs_Errors(t *testing.T) {
+	eng, err := NewSQLiteEngine("")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer eng.Close()
+	if _, err := CreateTableSQLs(context.Background(), eng, []*Table{NewEmptyTable()}); err == nil {
+		t.Fatalf("expected error for unnamed table")
+	}
+	if err := ApplyTables(context.Background(), eng, []*Table{nil}); err == nil {
+		t.Fatalf("expected error for nil table")
+	}
+	bad := NewTable("bad", nil)
+	bad.AddColumn(&Column{Name: "a", SQLType: SQLType{Name: "INT"}})
+	idx := NewIndex("a_idx", IndexType)
+	idx.AddColumn("missing")
+	bad.AddIndex(idx)
+	if err := ApplyTables(context.Background(), eng, []*Table{bad}); err == nil {
+		t.Fatalf("expected exec error for index on unknown column")
+	}
+}
+
+func TestParseSQLiteType(t *testing.T) {
+	cases := []struct {
+		decl   string
+		name   string
+		l1, l2 int64
+	}{
+		{"varchar(32)", "VARCHAR", 32, 0},
+		{"DECIMAL(10, 2)", "DECIMAL", 10, 2},
+		{"INTEGER", "INTEGER", 0, 0},
+		{"", "", 0, 0},
+		{"NUMERIC(a)", "NUMERIC(A)", 0, 0},
+	}
+	for _, c := range cases {
+		st, l1, l2 := parseSQLiteType(c.decl)
+		if st.Name != c.name || l1 != c.l1 || l2 != c.l2 {
+			t.Fatalf("%q: got %s %d %d", c.decl, st.Name, l1, l2)
+		}
+	}
+}
@@ -3,6 +3,7 @@
 package schema_orm
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"strings"
@@ -31,7 +32,7 @@ func TestBuildMySQLDSN(t *testing.T) {
 func TestExportMySQLToJSON_EnvOrLocal(t *testing.T) {
 	// Allow overriding full DSN
 	if dsn := os.Getenv("WIZ_HR2_DSN"); dsn != "" {
-		jsonStr, err := ExportMySQLSchemaToJSONWithDSN(dsn)
+		jsonStr, err := ExportSchemaToJSON(context.Background(), "mysql", dsn, ExportOptions{})
 		if err != nil {
 			t.Skipf("skip: cannot connect using WIZ_HR2_DSN: %v", err)
 		}
@@ -0,0 +1,168 @@
+package schema_orm
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// protobuf field number limits
+const (
+	maxFieldNumber      = 1<<29 - 1
+	firstReservedNumber = 19000 // 19000-19999 are reserved by the protobuf implementation
+	lastReservedNumber  = 19999
+)
+
+// FieldNumbers are the message field numbers of one table's columns.
+// Numbers of dropped columns move to Reserved (and their names to
+// ReservedNames) so they are never handed out again.
+type FieldNumbers struct {
+	Fields        map[string]int `json:"fields" yaml:"fields"`
+	Reserved      []int          `json:"reserved,omitempty" yaml:"reserved,omitempty"`
+	ReservedNames []string       `json:"reservedNames,omitempty" yaml:"reservedNames,omitempty"`
+}
+
+// FieldNumbering maps schema-qualified table names to their field numbers.
+// It is kept in its own file next to the bundle, since bundles are usually
+// re-exported from the database while the numbering must survive.
+type FieldNumbering map[string]*FieldNumbers
+
+// LoadFieldNumbering reads a numbering file. A missing file yields an empty
+// numbering, so the first generation can start from scratch.
+func LoadFieldNumbering(path string) (FieldNumbering, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return FieldNumbering{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	n := FieldNumbering{}
+	if err := yaml.Unmarshal(data, &n); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// WriteFile stores the numbering as YAML when path ends in .yaml/.yml and as indented JSON otherwise.
+func (n FieldNumbering) WriteFile(path string) error {
+	var (
+		data []byte
+		err  error
+	)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		data, err = yaml.Marshal(n)
+	default:
+		data, err = json.MarshalIndent(n, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// Assign gives every column of the tables a field number. Existing columns
+// keep their number, new columns get numbers above everything used or
+// reserved so far, and columns no longer present are reserved. A dropped
+// column that is added again gets a new number, as its type may have
+// changed. Tables missing from the list keep their entry. It reports whether
+// anything changed.
+func (n FieldNumbering) Assign(tables []*Table) bool {
+	changed := false
+	for _, tb := range tables {
+		if tb == nil {
+			continue
+		}
+		fn := n[tb.FullName()]
+		if fn == nil {
+			fn = &FieldNumbers{Fields: map[string]int{}}
+			n[tb.FullName()] = fn
+			changed = true
+		}
+		if fn.Fields == nil {
+			fn.Fields = map[string]int{}
+		}
+
+		present := make(map[string]bool, len(tb.Columns))
+		for _, c := range tb.Columns {
+			present[c.Name] = true
+		}
+		names := make([]string, 0, len(fn.Fields))
+		for name := range fn.Fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if !present[name] {
+				fn.Reserved = append(fn.Reserved, fn.Fields[name])
+				fn.ReservedNames = append(fn.ReservedNames, name)
+				delete(fn.Fields, name)
+				changed = true
+			}
+		}
+
+		next := fn.maxUsed() + 1
+		for _, c := range tb.Columns {
+			if _, ok := fn.Fields[c.Name]; ok {
+				continue
+			}
+			if next >= firstReservedNumber && next <= lastReservedNumber {
+				next = lastReservedNumber + 1
+			}
+			fn.Fields[c.Name] = next
+			next++
+			changed = true
+			// a column that comes back gets a fresh number; its old one stays reserved
+			for i, name := range fn.ReservedNames {
+				if name == c.Name {
+					fn.ReservedNames = append(fn.ReservedNames[:i], fn.ReservedNames[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+	return changed
+}
+
+func (fn *FieldNumbers) maxUsed() int {
+	highest := 0
+	for _, v := range fn.Fields {
+		highest = max(highest, v)
+	}
+	for _, v := range fn.Reserved {
+		highest = max(highest, v)
+	}
+	return highest
+}
+
+// numberedColumns returns the columns ordered by field number, with their numbers.
+// Columns without a number are returned in missing.
+func numberedColumns(tb *Table, fn *FieldNumbers) (cols []*Column, nums []int, missing []string) {
+	type numbered struct {
+		col *Column
+		num int
+	}
+	list := make([]numbered, 0, len(tb.Columns))
+	for _, c := range tb.Columns {
+		num, ok := 0, false
+		if fn != nil {
+			num, ok = fn.Fields[c.Name]
+		}
+		if !ok || num <= 0 || num > maxFieldNumber {
+			missing = append(missing, c.Name)
+			continue
+		}
+		list = append(list, numbered{c, num})
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].num < list[j].num })
+	for _, x := range list {
+		cols = append(cols, x.col)
+		nums = append(nums, x.num)
+	}
+	return cols, nums, missing
+}
@@ -0,0 +1,231 @@
+package schema_orm
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"xorm.io/xorm"
+	xs "xorm.io/xorm/schemas"
+)
+
+// ForeignKey describes a foreign key constraint. xorm has no equivalent, so it is
+// filled by ExportSchema from the database catalog or declared by hand.
+// Cols and RefCols are positional: Cols[i] references RefCols[i].
+type ForeignKey struct {
+	Name      string   `json:"name,omitempty" yaml:"name,omitempty"`
+	Cols      []string `json:"cols" yaml:"cols"`
+	RefSchema string   `json:"refSchema,omitempty" yaml:"refSchema,omitempty"`
+	RefTable  string   `json:"refTable" yaml:"refTable"`
+	RefCols   []string `json:"refCols" yaml:"refCols"`
+	OnUpdate  string   `json:"onUpdate,omitempty" yaml:"onUpdate,omitempty"`
+	OnDelete  string   `json:"onDelete,omitempty" yaml:"onDelete,omitempty"`
+}
+
+func NewForeignKey(name, refTable string) *ForeignKey {
+	return &ForeignKey{Name: name, RefTable: refTable, Cols: make([]string, 0), RefCols: make([]string, 0)}
+}
+
+// AddColumn adds a referencing column and the column it points to.
+func (fk *ForeignKey) AddColumn(col, refCol string) {
+	fk.Cols = append(fk.Cols, col)
+	fk.RefCols = append(fk.RefCols, refCol)
+}
+
+// RefFullName returns the schema-qualified name of the referenced table.
+func (fk *ForeignKey) RefFullName() string {
+	if fk.RefSchema == "" {
+		return fk.RefTable
+	}
+	return fk.RefSchema + "." + fk.RefTable
+}
+
+// AddForeignKey appends a foreign key to the table.
+func (table *Table) AddForeignKey(fk *ForeignKey) {
+	table.ForeignKeys = append(table.ForeignKeys, fk)
+}
+
+// fkRow is one referencing/referenced column pair read from a catalog.
+type fkRow struct {
+	name, col, refSchema, refTable, refCol, onUpdate, onDelete string
+}
+
+// groupForeignKeys folds catalog rows (ordered by constraint and position) into constraints.
+func groupForeignKeys(rows []fkRow) []*ForeignKey {
+	var out []*ForeignKey
+	var cur *ForeignKey
+	for _, r := range rows {
+		if cur == nil || cur.Name != r.name || cur.RefTable != r.refTable {
+			cur = NewForeignKey(r.name, r.refTable)
+			cur.RefSchema = r.refSchema
+			cur.OnUpdate = r.onUpdate
+			cur.OnDelete = r.onDelete
+			out = append(out, cur)
+		}
+		cur.AddColumn(r.col, r.refCol)
+	}
+	return out
+}
+
+// loadForeignKeys reads the foreign keys of a table from the database catalog.
+// Dialects without catalog support return no foreign keys.
+func loadForeignKeys(ctx context.Context, engine *xorm.Engine, table *Table) error {
+	var (
+		query string
+		args  []any
+		// namespace the table lives in; references into it stay unqualified
+		current = table.Schema
+	)
+	uri := engine.Dialect().URI()
+	switch uri.DBType {
+	case xs.SQLITE:
+		return loadSQLiteForeignKeys(ctx, engine, table)
+	case xs.MYSQL:
+		query = `SELECT k.CONSTRAINT_NAME, k.COLUMN_NAME, k.REFERENCED_TABLE_SCHEMA, k.REFERENCED_TABLE_NAME,
+  k.REFERENCED_COLUMN_NAME, r.UPDATE_RULE, r.DELETE_RULE
+FROM information_schema.KEY_COLUMN_USAGE k
+JOIN information_schema.REFERENTIAL_CONSTRAINTS r
+  ON r.CONSTRAINT_SCHEMA = k.CONSTRAINT_SCHEMA AND r.CONSTRAINT_NAME = k.CONSTRAINT_NAME
+WHERE k.TABLE_SCHEMA = DATABASE() AND k.TABLE_NAME = ? AND k.REFERENCED_TABLE_NAME IS NOT NULL
+ORDER BY k.CONSTRAINT_NAME, k.ORDINAL_POSITION`
+		args = []any{table.Name}
+		current = uri.DBName
+	case xs.POSTGRES:
+		if current == "" {
+			// the connection's default namespace, see ExportOptions.Schemas
+			if current = uri.Schema; current == "" {
+				current = "public"
+			}
+		}
+		query = `SELECT con.conname, a.attname, nr.nspname, cr.relname, af.attname,
+  CASE con.confupdtype WHEN 'c' THEN 'CASCADE' WHEN 'n' THEN 'SET NULL' WHEN 'd' THEN 'SET DEFAULT' WHEN 'r' THEN 'RESTRICT' ELSE 'NO ACTION' END,
+  CASE con.confdeltype WHEN 'c' THEN 'CASCADE' WHEN 'n' THEN 'SET NULL' WHEN 'd' THEN 'SET DEFAULT' WHEN 'r' THEN 'RESTRICT' ELSE 'NO ACTION' END
+FROM pg_constraint con
+JOIN pg_class c ON c.oid = con.conrelid
+JOIN pg_namespace n ON n.oid = c.relnamespace
+JOIN pg_class cr ON cr.oid = con.confrelid
+JOIN pg_namespace nr ON nr.oid = cr.relnamespace
+CROSS JOIN LATERAL unnest(con.conkey, con.confkey) WITH ORDINALITY AS k(attnum, refattnum, ord)
+JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.attnum
+JOIN pg_attribute af ON af.attrelid = con.confrelid AND af.attnum = k.refattnum
+WHERE con.contype = 'f' AND n.nspname = $1 AND c.relname = $2
+ORDER BY con.conname, k.ord`
+		args = []any{current, table.Name}
+	default:
+		return nil
+	}
+
+	rows, err := engine.DB().QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var fkRows []fkRow
+	for rows.Next() {
+		var r fkRow
+		var refSchema sql.NullString
+		if err := rows.Scan(&r.name, &r.col, &refSchema, &r.refTable, &r.refCol, &r.onUpdate, &r.onDelete); err != nil {
+			return err
+		}
+		if refSchema.String != current {
+			r.refSchema = refSchema.String
+		}
+		fkRows = append(fkRows, r)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	table.ForeignKeys = groupForeignKeys(fkRows)
+	return nil
+}
+
+func loadSQLiteForeignKeys(ctx context.Context, engine *xorm.Engine, table *Table) error {
+	rows, err := engine.DB().QueryContext(ctx, "PRAGMA foreign_key_list("+engine.Dialect().Quoter().Quote(table.Name)+")")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	type sqliteFK struct {
+		id, seq int
+		fkRow
+	}
+	var list []sqliteFK
+	for rows.Next() {
+		var (
+			r     sqliteFK
+			to    sql.NullString
+			match string
+		)
+		if err := rows.Scan(&r.id, &r.seq, &r.refTable, &r.col, &to, &r.onUpdate, &r.onDelete, &match); err != nil {
+			return err
+		}
+		// SQLite constraints are anonymous; the id groups the columns of one constraint.
+		// A NULL target column means the referenced table's primary key,
+		// resolved below.
+		r.name = fmt.Sprintf("fk_%s_%d", table.Name, r.id)
+		r.refCol = to.String
+		list = append(list, r)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	pks := make(map[string][]string)
+	for i, r := range list {
+		if r.refCol != "" {
+			continue
+		}
+		pk, ok := pks[r.refTable]
+		if !ok {
+			if pk, err = loadSQLitePrimaryKey(ctx, engine, r.refTable); err != nil {
+				return err
+			}
+			pks[r.refTable] = pk
+		}
+		if r.seq < len(pk) {
+			list[i].refCol = pk[r.seq]
+		}
+	}
+	// PRAGMA lists the newest constraint first; keep declaration order
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].id != list[j].id {
+			return list[i].id > list[j].id
+		}
+		return list[i].seq < list[j].seq
+	})
+	fkRows := make([]fkRow, len(list))
+	for i, r := range list {
+		fkRows[i] = r.fkRow
+	}
+	table.ForeignKeys = groupForeignKeys(fkRows)
+	return nil
+}
+
+// loadSQLitePrimaryKey returns the primary key columns of a SQLite table in
+// key order.
+func loadSQLitePrimaryKey(ctx context.Context, engine *xorm.Engine, table string) ([]string, error) {
+	rows, err := engine.DB().QueryContext(ctx, "PRAGMA table_info("+engine.Dialect().Quoter().Quote(table)+")")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	pos := make(map[string]int)
+	var pk []string
+	for rows.Next() {
+		var (
+			cid, notNull, n int
+			name, typ       string
+			dflt            sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &n); err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			pos[name] = n
+			pk = append(pk, name)
+		}
+	}
+	sort.Slice(pk, func(i, j int) bool { return pos[pk[i]] < pos[pk[j]] })
+	return pk, rows.Err()
+}
@@ -0,0 +1,423 @@
+package schema_orm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	xs "xorm.io/xorm/schemas"
+)
+
+// GraphQL scalars used by the generated schema. Int, Float, Boolean and String
+// are built in; the others are declared as custom scalars when used.
+// Long carries 64-bit integers as JSON numbers, Decimal keeps the precision of
+// DECIMAL/NUMERIC as a string, DateTime is RFC 3339, Date is YYYY-MM-DD and
+// Bytes is standard base64.
+const (
+	GraphQLInt      = "Int"
+	GraphQLFloat    = "Float"
+	GraphQLBoolean  = "Boolean"
+	GraphQLString   = "String"
+	GraphQLLong     = "Long"
+	GraphQLDecimal  = "Decimal"
+	GraphQLDateTime = "DateTime"
+	GraphQLDate     = "Date"
+	GraphQLBytes    = "Bytes"
+)
+
+// paging defaults of the generated list queries
+const (
+	DefaultGraphQLPageSize    = 20
+	DefaultGraphQLMaxPageSize = 100
+)
+
+// GraphQLOptions controls the generated GraphQL schema. Type names follow the
+// same rules as protobuf messages (see ProtoOptions); field names are the
+// column names. DefaultPageSize and MaxPageSize bound the "first" argument of
+// list queries and of the lists of referencing rows (per parent row); zero
+// values select the defaults above.
+type GraphQLOptions struct {
+	Naming          *Naming
+	DefaultPageSize int
+	MaxPageSize     int
+}
+
+func (o GraphQLOptions) withDefaults() GraphQLOptions {
+	if o.DefaultPageSize <= 0 {
+		o.DefaultPageSize = DefaultGraphQLPageSize
+	}
+	if o.MaxPageSize <= 0 {
+		o.MaxPageSize = DefaultGraphQLMaxPageSize
+	}
+	if o.DefaultPageSize > o.MaxPageSize {
+		o.DefaultPageSize = o.MaxPageSize
+	}
+	return o
+}
+
+// gqlModel is the GraphQL view of a set of tables, shared by the SDL writer
+// and the executor so both always describe the same schema.
+type gqlModel struct {
+	types   []*gqlType
+	scalars map[string]bool // scalars used by columns
+}
+
+// gqlType is the object type of one table.
+type gqlType struct {
+	table     *Table
+	name      string
+	fields    []*gqlField
+	byName    map[string]*gqlField
+	pk        []*gqlField
+	rels      []*gqlRelation
+	getField  string // root field fetching one row by primary key; empty without a key
+	listField string // root field returning a connection
+}
+
+// gqlField is a column of a table.
+type gqlField struct {
+	name   string
+	col    *Column
+	scalar string
+}
+
+// gqlRelation is a field following a foreign key. Forward relations (many is
+// false) point from the referencing row to the referenced one; reverse
+// relations page through the rows referencing the owner, as a connection like
+// the root lists. cols are columns of the owner,
+// refCols the matching columns of target.
+type gqlRelation struct {
+	name    string
+	target  *gqlType
+	many    bool
+	cols    []string
+	refCols []string
+}
+
+// graphQLScalar maps a column to a GraphQL scalar. Array columns are passed
+// through as their driver representation in a String.
+func graphQLScalar(col *Column) string {
+	if col.SQLType.IsArray() {
+		return GraphQLString
+	}
+	switch strings.ToUpper(col.SQLType.Name) {
+	case xs.Bool, "BOOLEAN":
+		return GraphQLBoolean
+	case xs.Bit:
+		if col.Length <= 1 {
+			return GraphQLBoolean
+		}
+		return GraphQLLong
+	case xs.TinyInt, xs.SmallInt, xs.MediumInt, xs.Int, xs.Integer, xs.Serial, xs.Year,
+		xs.UnsignedTinyInt, xs.UnsignedSmallInt, xs.UnsignedMediumInt:
+		return GraphQLInt
+	case xs.BigInt, xs.BigSerial, xs.UnsignedBit, xs.UnsignedInt:
+		return GraphQLLong
+	case xs.UnsignedBigInt, xs.Decimal, xs.Numeric, xs.Money, xs.SmallMoney:
+		return GraphQLDecimal
+	case xs.Float, xs.Real, xs.Double, "DOUBLE PRECISION":
+		return GraphQLFloat
+	case xs.DateTime, xs.TimeStamp, xs.TimeStampz, xs.SmallDateTime:
+		return GraphQLDateTime
+	case xs.Date:
+		return GraphQLDate
+	case xs.TinyBlob, xs.Blob, xs.MediumBlob, xs.LongBlob, xs.Bytea, xs.Binary, xs.VarBinary, "IMAGE":
+		return GraphQLBytes
+	}
+	return GraphQLString
+}
+
+// gqlIdent turns a column name into a GraphQL name. Names reserved for
+// introspection ("__") and the enum-forbidden true/false/null are altered.
+func gqlIdent(name string) string {
+	s := schemaIdent(name)
+	switch {
+	case strings.HasPrefix(s, "__"):
+		s = "f" + s
+	case s == "true" || s == "false" || s == "null":
+		s += "_"
+	}
+	return s
+}
+
+func lowerFirst(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToLower(r)) + s[n:]
+}
+
+// buildGraphQLModel derives the GraphQL types of the tables. Foreign keys whose
+// referenced table is not in the list are ignored.
+func buildGraphQLModel(tables []*Table, opts GraphQLOptions) (*gqlModel, error) {
+	sorted := make([]*Table, 0, len(tables))
+	for _, tb := range tables {
+		if tb != nil {
+			sorted = append(sorted, tb)
+		}
+	}
+	if len(sorted) == 0 {
+		return nil, fmt.Errorf("no tables to expose over GraphQL")
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].FullName() < sorted[j].FullName() })
+
+	m := &gqlModel{scalars: map[string]bool{}}
+	byTable := make(map[string]*gqlType, len(sorted))
+	names := map[string]string{}
+	for _, tb := range sorted {
+		name, err := messageName(tb, opts.Naming)
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := names[name]; ok {
+			return nil, fmt.Errorf("tables %s and %s both map to GraphQL type %s", other, tb.FullName(), name)
+		}
+		names[name] = tb.FullName()
+		t := &gqlType{
+			table:     tb,
+			name:      name,
+			byName:    make(map[string]*gqlField, len(tb.Columns)),
+			listField: lowerFirst(name) + "List",
+		}
+		for _, col := range tb.Columns {
+			f := &gqlField{name: gqlIdent(col.Name), col: col, scalar: graphQLScalar(col)}
+			if _, dup := t.byName[f.name]; dup {
+				return nil, fmt.Errorf("table %s: columns map to the same GraphQL field %s", tb.FullName(), f.name)
+			}
+			t.fields = append(t.fields, f)
+			t.byName[f.name] = f
+			m.scalars[f.scalar] = true
+		}
+		for _, pk := range tb.PrimaryKeys {
+			for _, f := range t.fields {
+				if f.col.Name == pk {
+					t.pk = append(t.pk, f)
+				}
+			}
+		}
+		if len(t.pk) > 0 && len(t.pk) == len(tb.PrimaryKeys) {
+			t.getField = lowerFirst(name)
+		} else {
+			t.pk = nil
+		}
+		m.types = append(m.types, t)
+		byTable[tb.FullName()] = t
+	}
+	sort.Slice(m.types, func(i, j int) bool { return m.types[i].name < m.types[j].name })
+
+	for _, t := range m.types {
+		fkCount := map[*gqlType]int{}
+		var fks []*ForeignKey
+		var targets []*gqlType
+		for _, fk := range t.table.ForeignKeys {
+			target := byTable[fk.RefFullName()]
+			if target == nil && fk.RefSchema == "" && t.table.Schema != "" {
+				target = byTable[t.table.Schema+"."+fk.RefTable]
+			}
+			if target == nil || len(fk.Cols) == 0 || len(fk.Cols) != len(fk.RefCols) ||
+				!t.hasColumns(fk.Cols) || !target.hasColumns(fk.RefCols) {
+				continue
+			}
+			fks = append(fks, fk)
+			targets = append(targets, target)
+			fkCount[target]++
+		}
+		for i, fk := range fks {
+			target := targets[i]
+			by := "_by_" + gqlIdent(strings.Join(fk.Cols, "_"))
+
+			forward := lowerFirst(target.name) + by
+			if len(fk.Cols) == 1 {
+				if col := fk.Cols[0]; len(col) > 3 && strings.EqualFold(col[len(col)-3:], "_id") {
+					forward = gqlIdent(col[:len(col)-3])
+				} else if fkCount[target] == 1 {
+					forward = lowerFirst(target.name)
+				}
+			}
+			t.addRelation(&gqlRelation{name: forward, target: target, cols: fk.Cols, refCols: fk.RefCols})
+
+			reverse := t.listField
+			if fkCount[target] > 1 {
+				reverse += by
+			}
+			target.addRelation(&gqlRelation{name: reverse, target: t, many: true, cols: fk.RefCols, refCols: fk.Cols})
+		}
+	}
+	return m, nil
+}
+
+func (t *gqlType) hasColumns(cols []string) bool {
+	for _, c := range cols {
+		if t.table.GetColumn(c) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// addRelation adds a relation field, suffixing "_ref" while the name is taken.
+func (t *gqlType) addRelation(rel *gqlRelation) {
+	for t.fieldTaken(rel.name) {
+		rel.name += "_ref"
+	}
+	t.rels = append(t.rels, rel)
+}
+
+func (t *gqlType) fieldTaken(name string) bool {
+	if _, ok := t.byName[name]; ok {
+		return true
+	}
+	for _, r := range t.rels {
+		if r.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// filterScalars returns the scalars that get a <Scalar>Filter input, in name order.
+func (m *gqlModel) filterScalars() []string {
+	var out []string
+	for s := range m.scalars {
+		if s != GraphQLBytes {
+			out = append(out, s)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// customScalars returns the non built-in scalars in use, in name order.
+func (m *gqlModel) customScalars() []string {
+	var out []string
+	for s := range m.scalars {
+		switch s {
+		case GraphQLInt, GraphQLFloat, GraphQLBoolean, GraphQLString:
+		default:
+			out = append(out, s)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// filterOps returns the operators of a scalar filter input. Booleans are only
+// compared for equality and only strings support like.
+func filterOps(scalar string) []string {
+	ops := []string{"eq", "ne"}
+	if scalar != GraphQLBoolean {
+		ops = append(ops, "lt", "lte", "gt", "gte", "in")
+	}
+	if scalar == GraphQLString {
+		ops = append(ops, "like")
+	}
+	return append(ops, "isNull")
+}
+
+// gqlDescription quotes s as a GraphQL string literal.
+func gqlDescription(s string) string {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// WriteGraphQLSDL renders the GraphQL schema of the tables: an object type per
+// table with its columns and foreign key relations, a filter input, an order
+// input, edge and connection types, and the root Query with a lookup by
+// primary key and a paginated list per table.
+func WriteGraphQLSDL(w io.Writer, tables []*Table, opts GraphQLOptions) error {
+	m, err := buildGraphQLModel(tables, opts.withDefaults())
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, m.sdl())
+	return err
+}
+
+func (m *gqlModel) sdl() string {
+	var b strings.Builder
+	b.WriteString("# Code generated by schema-orm. DO NOT EDIT.\n")
+	for _, s := range m.customScalars() {
+		fmt.Fprintf(&b, "\nscalar %s\n", s)
+	}
+	b.WriteString("\nenum SortDirection {\n  ASC\n  DESC\n}\n")
+	b.WriteString("\ntype PageInfo {\n  hasNextPage: Boolean!\n  hasPreviousPage: Boolean!\n  startCursor: String\n  endCursor: String\n}\n")
+	for _, s := range m.filterScalars() {
+		fmt.Fprintf(&b, "\ninput %sFilter {\n", s)
+		for _, op := range filterOps(s) {
+			switch op {
+			case "in":
+				fmt.Fprintf(&b, "  in: [%s!]\n", s)
+			case "like":
+				b.WriteString("  like: String\n")
+			case "isNull":
+				b.WriteString("  isNull: Boolean\n")
+			default:
+				fmt.Fprintf(&b, "  %s: %s\n", op, s)
+			}
+		}
+		b.WriteString("}\n")
+	}
+
+	for _, t := range m.types {
+		b.WriteByte('\n')
+		if t.table.Comment != "" {
+			fmt.Fprintf(&b, "%s\n", gqlDescription(t.table.Comment))
+		}
+		fmt.Fprintf(&b, "type %s {\n", t.name)
+		for _, f := range t.fields {
+			if f.col.Comment != "" {
+				fmt.Fprintf(&b, "  %s\n", gqlDescription(f.col.Comment))
+			}
+			nonNull := ""
+			if !f.col.Nullable {
+				nonNull = "!"
+			}
+			fmt.Fprintf(&b, "  %s: %s%s\n", f.name, f.scalar, nonNull)
+		}
+		for _, r := range t.rels {
+			if r.many {
+				fmt.Fprintf(&b, "  %s(filter: %[2]sFilter, orderBy: [%[2]sOrder!], first: Int, after: String): %[2]sConnection!\n", r.name, r.target.name)
+			} else {
+				fmt.Fprintf(&b, "  %s: %s\n", r.name, r.target.name)
+			}
+		}
+		b.WriteString("}\n")
+
+		fmt.Fprintf(&b, "\ninput %sFilter {\n", t.name)
+		for _, f := range t.fields {
+			if f.scalar != GraphQLBytes {
+				fmt.Fprintf(&b, "  %s: %sFilter\n", f.name, f.scalar)
+			}
+		}
+		fmt.Fprintf(&b, "  _and: [%[1]sFilter!]\n  _or: [%[1]sFilter!]\n  _not: %[1]sFilter\n}\n", t.name)
+
+		fmt.Fprintf(&b, "\nenum %sField {\n", t.name)
+		for _, f := range t.fields {
+			fmt.Fprintf(&b, "  %s\n", f.name)
+		}
+		b.WriteString("}\n")
+		fmt.Fprintf(&b, "\ninput %[1]sOrder {\n  field: %[1]sField!\n  direction: SortDirection = ASC\n}\n", t.name)
+		fmt.Fprintf(&b, "\ntype %[1]sEdge {\n  cursor: String!\n  node: %[1]s!\n}\n", t.name)
+		fmt.Fprintf(&b, "\ntype %[1]sConnection {\n  edges: [%[1]sEdge!]!\n  nodes: [%[1]s!]!\n  pageInfo: PageInfo!\n  totalCount: Int!\n}\n", t.name)
+	}
+
+	b.WriteString("\ntype Query {\n")
+	for _, t := range m.types {
+		if t.getField != "" {
+			args := make([]string, len(t.pk))
+			for i, f := range t.pk {
+				args[i] = f.name + ": " + f.scalar + "!"
+			}
+			fmt.Fprintf(&b, "  %s(%s): %s\n", t.getField, strings.Join(args, ", "), t.name)
+		}
+		fmt.Fprintf(&b, "  %s(filter: %[2]sFilter, orderBy: [%[2]sOrder!], first: Int, after: String): %[2]sConnection!\n", t.listField, t.name)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
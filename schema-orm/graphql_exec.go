@@ -0,0 +1,915 @@
+package schema_orm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"xorm.io/builder"
+	"xorm.io/xorm"
+)
+
+// gqlBatchSize caps the keys fetched by one batched query.
+const gqlBatchSize = 500
+
+// GraphQLRequest is a GraphQL request as posted by clients.
+type GraphQLRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
+
+// GraphQLExecutor resolves queries of the schema produced by WriteGraphQLSDL
+// against the tables of an engine. Relations and lookups by primary key are
+// batched per request: all rows requested at one depth of the query are
+// loaded with a single IN query per relation, so a list of N rows with a
+// relation costs two queries instead of N+1.
+//
+// Lists are paginated with LIMIT/OFFSET; the cursors are opaque offsets. The
+// lists of referencing rows are paged per parent row, all parents of a batch
+// in one query numbering the rows with ROW_NUMBER, which MySQL supports from
+// version 8.
+type GraphQLExecutor struct {
+	engine *xorm.Engine
+	model  *gqlModel
+	opts   GraphQLOptions
+	schema graphql.Schema
+}
+
+// NewGraphQLExecutor builds the executable schema of the tables.
+func NewGraphQLExecutor(engine *xorm.Engine, tables []*Table, opts GraphQLOptions) (*GraphQLExecutor, error) {
+	opts = opts.withDefaults()
+	m, err := buildGraphQLModel(tables, opts)
+	if err != nil {
+		return nil, err
+	}
+	e := &GraphQLExecutor{engine: engine, model: m, opts: opts}
+	if e.schema, err = e.buildSchema(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// SDL returns the schema in GraphQL schema definition language.
+func (e *GraphQLExecutor) SDL() string { return e.model.sdl() }
+
+// Execute runs a request. Errors are reported in the result, as GraphQL does.
+func (e *GraphQLExecutor) Execute(ctx context.Context, req GraphQLRequest) *graphql.Result {
+	ctx = context.WithValue(ctx, gqlBatchKey{}, &gqlBatch{loaders: map[string]*gqlLoader{}})
+	return graphql.Do(graphql.Params{
+		Schema:         e.schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        ctx,
+	})
+}
+
+// gqlRow is a table row keyed by column name.
+type gqlRow map[string]any
+
+// gqlConnection is the result of a list query.
+type gqlConnection struct {
+	t       *gqlType
+	cond    builder.Cond
+	rows    []gqlRow
+	offset  int
+	hasNext bool
+}
+
+type gqlEdge struct {
+	cursor string
+	row    gqlRow
+}
+
+func encodeCursor(offset int) string {
+	return base64.StdEncoding.EncodeToString([]byte("offset:" + strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	b, err := base64.StdEncoding.DecodeString(cursor)
+	if err == nil {
+		if n, err := strconv.Atoi(strings.TrimPrefix(string(b), "offset:")); err == nil && n >= 0 && strings.HasPrefix(string(b), "offset:") {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid cursor %q", cursor)
+}
+
+// scalar types shared by all executors
+var (
+	gqlLongScalar = graphql.NewScalar(graphql.ScalarConfig{
+		Name:        GraphQLLong,
+		Description: "64-bit integer",
+		Serialize:   func(v any) any { return gqlValue(GraphQLLong, v) },
+		ParseValue:  func(v any) any { return gqlValue(GraphQLLong, v) },
+		ParseLiteral: func(v ast.Value) any {
+			switch x := v.(type) {
+			case *ast.IntValue:
+				return gqlValue(GraphQLLong, x.Value)
+			case *ast.StringValue:
+				return gqlValue(GraphQLLong, x.Value)
+			}
+			return nil
+		},
+	})
+	gqlDecimalScalar  = newStringScalar(GraphQLDecimal, "exact decimal number as a string")
+	gqlDateTimeScalar = newStringScalar(GraphQLDateTime, "RFC 3339 date and time")
+	gqlDateScalar     = newStringScalar(GraphQLDate, "calendar date, YYYY-MM-DD")
+	gqlBytesScalar    = graphql.NewScalar(graphql.ScalarConfig{
+		Name:        GraphQLBytes,
+		Description: "base64 encoded binary data",
+		Serialize: func(v any) any {
+			if s, ok := v.(string); ok { // already encoded by the column resolver
+				return s
+			}
+			return gqlValue(GraphQLBytes, v)
+		},
+		ParseValue: func(v any) any {
+			if s, ok := v.(string); ok {
+				if b, err := base64.StdEncoding.DecodeString(s); err == nil {
+					return b
+				}
+			}
+			return nil
+		},
+		ParseLiteral: func(v ast.Value) any {
+			if s, ok := v.(*ast.StringValue); ok {
+				if b, err := base64.StdEncoding.DecodeString(s.Value); err == nil {
+					return b
+				}
+			}
+			return nil
+		},
+	})
+)
+
+// newStringScalar returns a scalar carried as a string that also accepts numeric literals.
+func newStringScalar(name, description string) *graphql.Scalar {
+	return graphql.NewScalar(graphql.ScalarConfig{
+		Name:        name,
+		Description: description,
+		Serialize:   func(v any) any { return gqlValue(name, v) },
+		ParseValue:  func(v any) any { return gqlValue(name, v) },
+		ParseLiteral: func(v ast.Value) any {
+			switch x := v.(type) {
+			case *ast.StringValue:
+				return x.Value
+			case *ast.IntValue:
+				return x.Value
+			case *ast.FloatValue:
+				return x.Value
+			}
+			return nil
+		},
+	})
+}
+
+// gqlValue converts a driver value (or an input value) to the representation of a scalar.
+// Values that cannot be converted yield nil.
+func gqlValue(scalar string, v any) any {
+	if v == nil {
+		return nil
+	}
+	if b, ok := v.([]byte); ok && scalar != GraphQLBytes {
+		v = string(b)
+	}
+	switch scalar {
+	case GraphQLInt, GraphQLLong:
+		switch x := v.(type) {
+		case int64:
+			return x
+		case int:
+			return int64(x)
+		case int32:
+			return int64(x)
+		case uint64:
+			if x <= math.MaxInt64 {
+				return int64(x)
+			}
+		case float64:
+			if x == math.Trunc(x) && math.Abs(x) <= 1<<53 {
+				return int64(x)
+			}
+		case json.Number:
+			if n, err := x.Int64(); err == nil {
+				return n
+			}
+		case bool:
+			if x {
+				return int64(1)
+			}
+			return int64(0)
+		case string:
+			if n, err := strconv.ParseInt(strings.TrimSpace(x), 10, 64); err == nil {
+				return n
+			}
+		}
+		return nil
+	case GraphQLFloat:
+		switch x := v.(type) {
+		case float64:
+			return x
+		case float32:
+			return float64(x)
+		case int64:
+			return float64(x)
+		case string:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(x), 64); err == nil {
+				return f
+			}
+		}
+		return nil
+	case GraphQLBoolean:
+		switch x := v.(type) {
+		case bool:
+			return x
+		case int64:
+			return x != 0
+		case string:
+			if b, err := strconv.ParseBool(x); err == nil {
+				return b
+			}
+		}
+		return nil
+	case GraphQLDateTime:
+		if t, ok := v.(time.Time); ok {
+			return t.Format(time.RFC3339Nano)
+		}
+	case GraphQLDate:
+		if t, ok := v.(time.Time); ok {
+			return t.Format(time.DateOnly)
+		}
+	case GraphQLBytes:
+		switch x := v.(type) {
+		case []byte:
+			return base64.StdEncoding.EncodeToString(x)
+		case string:
+			return base64.StdEncoding.EncodeToString([]byte(x))
+		}
+		return nil
+	}
+	return profileString(v)
+}
+
+func (e *GraphQLExecutor) buildSchema() (graphql.Schema, error) {
+	scalars := map[string]*graphql.Scalar{
+		GraphQLInt:      graphql.Int,
+		GraphQLFloat:    graphql.Float,
+		GraphQLBoolean:  graphql.Boolean,
+		GraphQLString:   graphql.String,
+		GraphQLLong:     gqlLongScalar,
+		GraphQLDecimal:  gqlDecimalScalar,
+		GraphQLDateTime: gqlDateTimeScalar,
+		GraphQLDate:     gqlDateScalar,
+		GraphQLBytes:    gqlBytesScalar,
+	}
+	sortDirection := graphql.NewEnum(graphql.EnumConfig{
+		Name:   "SortDirection",
+		Values: graphql.EnumValueConfigMap{"ASC": {Value: "ASC"}, "DESC": {Value: "DESC"}},
+	})
+	pageInfo := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PageInfo",
+		Fields: graphql.Fields{
+			"hasNextPage": {Type: graphql.NewNonNull(graphql.Boolean), Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(*gqlConnection).hasNext, nil
+			}},
+			"hasPreviousPage": {Type: graphql.NewNonNull(graphql.Boolean), Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(*gqlConnection).offset > 0, nil
+			}},
+			"startCursor": {Type: graphql.String, Resolve: func(p graphql.ResolveParams) (any, error) {
+				if c := p.Source.(*gqlConnection); len(c.rows) > 0 {
+					return encodeCursor(c.offset), nil
+				}
+				return nil, nil
+			}},
+			"endCursor": {Type: graphql.String, Resolve: func(p graphql.ResolveParams) (any, error) {
+				if c := p.Source.(*gqlConnection); len(c.rows) > 0 {
+					return encodeCursor(c.offset + len(c.rows) - 1), nil
+				}
+				return nil, nil
+			}},
+		},
+	})
+	scalarFilters := map[string]*graphql.InputObject{}
+	for _, s := range e.model.filterScalars() {
+		fields := graphql.InputObjectConfigFieldMap{}
+		for _, op := range filterOps(s) {
+			switch op {
+			case "in":
+				fields[op] = &graphql.InputObjectFieldConfig{Type: graphql.NewList(graphql.NewNonNull(scalars[s]))}
+			case "like":
+				fields[op] = &graphql.InputObjectFieldConfig{Type: graphql.String}
+			case "isNull":
+				fields[op] = &graphql.InputObjectFieldConfig{Type: graphql.Boolean}
+			default:
+				fields[op] = &graphql.InputObjectFieldConfig{Type: scalars[s]}
+			}
+		}
+		scalarFilters[s] = graphql.NewInputObject(graphql.InputObjectConfig{Name: s + "Filter", Fields: fields})
+	}
+
+	type typeObjects struct {
+		object *graphql.Object
+		filter *graphql.InputObject
+		order  *graphql.InputObject
+		conn   *graphql.Object
+	}
+	objects := make(map[*gqlType]*typeObjects, len(e.model.types))
+	for _, t := range e.model.types {
+		t := t
+		o := &typeObjects{}
+		objects[t] = o
+		o.object = graphql.NewObject(graphql.ObjectConfig{
+			Name:        t.name,
+			Description: t.table.Comment,
+			Fields: graphql.FieldsThunk(func() graphql.Fields {
+				fields := graphql.Fields{}
+				for _, f := range t.fields {
+					var typ graphql.Output = scalars[f.scalar]
+					if !f.col.Nullable {
+						typ = graphql.NewNonNull(typ)
+					}
+					fields[f.name] = &graphql.Field{Type: typ, Description: f.col.Comment, Resolve: columnResolver(f)}
+				}
+				for _, r := range t.rels {
+					target := objects[r.target]
+					if r.many {
+						fields[r.name] = &graphql.Field{
+							Type: graphql.NewNonNull(target.conn),
+							Args: graphql.FieldConfigArgument{
+								"filter":  {Type: target.filter},
+								"orderBy": {Type: graphql.NewList(graphql.NewNonNull(target.order))},
+								"first":   {Type: graphql.Int},
+								"after":   {Type: graphql.String},
+							},
+							Resolve: e.relationResolver(r),
+						}
+					} else {
+						fields[r.name] = &graphql.Field{Type: target.object, Resolve: e.relationResolver(r)}
+					}
+				}
+				return fields
+			}),
+		})
+		o.filter = graphql.NewInputObject(graphql.InputObjectConfig{
+			Name: t.name + "Filter",
+			Fields: graphql.InputObjectConfigFieldMapThunk(func() graphql.InputObjectConfigFieldMap {
+				fields := graphql.InputObjectConfigFieldMap{
+					"_and": {Type: graphql.NewList(graphql.NewNonNull(o.filter))},
+					"_or":  {Type: graphql.NewList(graphql.NewNonNull(o.filter))},
+					"_not": {Type: o.filter},
+				}
+				for _, f := range t.fields {
+					if f.scalar != GraphQLBytes {
+						fields[f.name] = &graphql.InputObjectFieldConfig{Type: scalarFilters[f.scalar]}
+					}
+				}
+				return fields
+			}),
+		})
+		values := graphql.EnumValueConfigMap{}
+		for _, f := range t.fields {
+			values[f.name] = &graphql.EnumValueConfig{Value: f.name}
+		}
+		o.order = graphql.NewInputObject(graphql.InputObjectConfig{
+			Name: t.name + "Order",
+			Fields: graphql.InputObjectConfigFieldMap{
+				"field":     {Type: graphql.NewNonNull(graphql.NewEnum(graphql.EnumConfig{Name: t.name + "Field", Values: values}))},
+				"direction": {Type: sortDirection, DefaultValue: "ASC"},
+			},
+		})
+		edge := graphql.NewObject(graphql.ObjectConfig{
+			Name: t.name + "Edge",
+			Fields: graphql.Fields{
+				"cursor": {Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (any, error) {
+					return p.Source.(gqlEdge).cursor, nil
+				}},
+				"node": {Type: graphql.NewNonNull(o.object), Resolve: func(p graphql.ResolveParams) (any, error) {
+					return p.Source.(gqlEdge).row, nil
+				}},
+			},
+		})
+		o.conn = graphql.NewObject(graphql.ObjectConfig{
+			Name: t.name + "Connection",
+			Fields: graphql.Fields{
+				"edges": {Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(edge))), Resolve: func(p graphql.ResolveParams) (any, error) {
+					c := p.Source.(*gqlConnection)
+					edges := make([]gqlEdge, len(c.rows))
+					for i, r := range c.rows {
+						edges[i] = gqlEdge{cursor: encodeCursor(c.offset + i), row: r}
+					}
+					return edges, nil
+				}},
+				"nodes": {Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(o.object))), Resolve: func(p graphql.ResolveParams) (any, error) {
+					return p.Source.(*gqlConnection).rows, nil
+				}},
+				"pageInfo": {Type: graphql.NewNonNull(pageInfo), Resolve: func(p graphql.ResolveParams) (any, error) {
+					return p.Source, nil
+				}},
+				"totalCount": {Type: graphql.NewNonNull(graphql.Int), Resolve: func(p graphql.ResolveParams) (any, error) {
+					return e.count(p.Context, p.Source.(*gqlConnection))
+				}},
+			},
+		})
+	}
+
+	query := graphql.Fields{}
+	for _, t := range e.model.types {
+		o := objects[t]
+		if t.getField != "" {
+			args := graphql.FieldConfigArgument{}
+			for _, f := range t.pk {
+				args[f.name] = &graphql.ArgumentConfig{Type: graphql.NewNonNull(scalars[f.scalar])}
+			}
+			query[t.getField] = &graphql.Field{Type: o.object, Args: args, Resolve: e.getResolver(t)}
+		}
+		query[t.listField] = &graphql.Field{
+			Type: graphql.NewNonNull(o.conn),
+			Args: graphql.FieldConfigArgument{
+				"filter":  {Type: o.filter},
+				"orderBy": {Type: graphql.NewList(graphql.NewNonNull(o.order))},
+				"first":   {Type: graphql.Int},
+				"after":   {Type: graphql.String},
+			},
+			Resolve: e.listResolver(t),
+		}
+	}
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{Name: "Query", Fields: query}),
+	})
+}
+
+func columnResolver(f *gqlField) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		return gqlValue(f.scalar, p.Source.(gqlRow)[f.col.Name]), nil
+	}
+}
+
+func (e *GraphQLExecutor) getResolver(t *gqlType) graphql.FieldResolveFn {
+	cols := make([]string, len(t.pk))
+	for i, f := range t.pk {
+		cols[i] = f.col.Name
+	}
+	return func(p graphql.ResolveParams) (any, error) {
+		key := make([]any, len(t.pk))
+		for i, f := range t.pk {
+			key[i] = p.Args[f.name]
+		}
+		load, err := e.loader(p.Context, t, cols, nil, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		return firstRow(load.load(key)), nil
+	}
+}
+
+func (e *GraphQLExecutor) relationResolver(r *gqlRelation) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		row := p.Source.(gqlRow)
+		key := make([]any, len(r.cols))
+		for i, c := range r.cols {
+			if key[i] = row[c]; key[i] == nil {
+				if r.many {
+					return &gqlConnection{t: r.target, cond: builder.Expr("1=0")}, nil
+				}
+				return nil, nil
+			}
+		}
+		if !r.many {
+			load, err := e.loader(p.Context, r.target, r.refCols, nil, 0, 0)
+			if err != nil {
+				return nil, err
+			}
+			return firstRow(load.load(key)), nil
+		}
+
+		first, offset, err := e.pageArgs(p.Args)
+		if err != nil {
+			return nil, err
+		}
+		load, err := e.loader(p.Context, r.target, r.refCols, p.Args, first+1, offset)
+		if err != nil {
+			return nil, err
+		}
+		keyCond := builder.Eq{}
+		for i, c := range r.refCols {
+			keyCond[e.engine.Dialect().Quoter().Quote(c)] = key[i]
+		}
+		c := &gqlConnection{t: r.target, cond: builder.And(keyCond, load.cond), offset: offset}
+		if first == 0 {
+			return c, nil
+		}
+		thunk := load.load(key)
+		return func() (any, error) {
+			rows, err := thunk()
+			if err != nil {
+				return nil, err
+			}
+			c.rows = rows
+			if len(c.rows) > first {
+				c.rows, c.hasNext = c.rows[:first], true
+			}
+			return c, nil
+		}, nil
+	}
+}
+
+func firstRow(thunk func() ([]gqlRow, error)) func() (any, error) {
+	return func() (any, error) {
+		rows, err := thunk()
+		if err != nil || len(rows) == 0 {
+			return nil, err
+		}
+		return rows[0], nil
+	}
+}
+
+func (e *GraphQLExecutor) listResolver(t *gqlType) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		cond, order, err := e.queryArgs(t, p.Args)
+		if err != nil {
+			return nil, err
+		}
+		first, offset, err := e.pageArgs(p.Args)
+		if err != nil {
+			return nil, err
+		}
+		c := &gqlConnection{t: t, cond: cond, offset: offset}
+		if first == 0 {
+			return c, nil
+		}
+		if c.rows, err = e.queryRows(p.Context, t, cond, order, first+1, offset); err != nil {
+			return nil, err
+		}
+		if len(c.rows) > first {
+			c.rows, c.hasNext = c.rows[:first], true
+		}
+		return c, nil
+	}
+}
+
+// pageArgs returns the page size and the offset of the first row that the
+// first and after arguments select.
+func (e *GraphQLExecutor) pageArgs(args map[string]any) (first, offset int, err error) {
+	first = e.opts.DefaultPageSize
+	if n, ok := args["first"].(int); ok {
+		if n < 0 {
+			return 0, 0, fmt.Errorf("first must not be negative")
+		}
+		first = min(n, e.opts.MaxPageSize)
+	}
+	if after, ok := args["after"].(string); ok {
+		if offset, err = decodeCursor(after); err != nil {
+			return 0, 0, err
+		}
+		offset++
+	}
+	return first, offset, nil
+}
+
+// queryArgs turns the filter and orderBy arguments into a condition and an
+// ORDER BY list. Without orderBy the primary key is used, to keep pages stable.
+func (e *GraphQLExecutor) queryArgs(t *gqlType, args map[string]any) (builder.Cond, []string, error) {
+	cond := builder.NewCond()
+	if filter, ok := args["filter"].(map[string]any); ok {
+		var err error
+		if cond, err = e.filterCond(t, filter); err != nil {
+			return nil, nil, err
+		}
+	}
+	quoter := e.engine.Dialect().Quoter()
+	var order []string
+	if list, ok := args["orderBy"].([]any); ok {
+		for _, item := range list {
+			o, _ := item.(map[string]any)
+			name, _ := o["field"].(string)
+			f := t.byName[name]
+			if f == nil {
+				return nil, nil, fmt.Errorf("unknown field %q", name)
+			}
+			dir := "ASC"
+			if o["direction"] == "DESC" {
+				dir = "DESC"
+			}
+			order = append(order, quoter.Quote(f.col.Name)+" "+dir)
+		}
+	}
+	if len(order) == 0 {
+		for _, pk := range t.table.PrimaryKeys {
+			order = append(order, quoter.Quote(pk)+" ASC")
+		}
+	}
+	return cond, order, nil
+}
+
+// filterCond converts a <Type>Filter argument. Fields and operators are ANDed.
+func (e *GraphQLExecutor) filterCond(t *gqlType, filter map[string]any) (builder.Cond, error) {
+	quoter := e.engine.Dialect().Quoter()
+	keys := make([]string, 0, len(filter))
+	for k := range filter {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	conds := make([]builder.Cond, 0, len(keys))
+	for _, k := range keys {
+		switch v := filter[k].(type) {
+		case nil:
+		case []any:
+			sub := make([]builder.Cond, 0, len(v))
+			for _, item := range v {
+				m, _ := item.(map[string]any)
+				c, err := e.filterCond(t, m)
+				if err != nil {
+					return nil, err
+				}
+				sub = append(sub, c)
+			}
+			if k == "_or" {
+				if len(sub) == 0 {
+					sub = append(sub, builder.Expr("1=0"))
+				}
+				conds = append(conds, builder.Or(sub...))
+			} else {
+				conds = append(conds, builder.And(sub...))
+			}
+		case map[string]any:
+			if k == "_not" {
+				c, err := e.filterCond(t, v)
+				if err != nil {
+					return nil, err
+				}
+				if c.IsValid() {
+					conds = append(conds, builder.Not{c})
+				}
+				continue
+			}
+			f := t.byName[k]
+			if f == nil {
+				return nil, fmt.Errorf("unknown filter field %q", k)
+			}
+			col := quoter.Quote(f.col.Name)
+			for _, op := range filterOps(f.scalar) {
+				arg, ok := v[op]
+				if !ok || arg == nil {
+					continue
+				}
+				switch op {
+				case "eq":
+					conds = append(conds, builder.Eq{col: arg})
+				case "ne":
+					conds = append(conds, builder.Neq{col: arg})
+				case "lt":
+					conds = append(conds, builder.Lt{col: arg})
+				case "lte":
+					conds = append(conds, builder.Lte{col: arg})
+				case "gt":
+					conds = append(conds, builder.Gt{col: arg})
+				case "gte":
+					conds = append(conds, builder.Gte{col: arg})
+				case "in":
+					list, _ := arg.([]any)
+					if len(list) == 0 {
+						conds = append(conds, builder.Expr("1=0"))
+					} else {
+						conds = append(conds, builder.In(col, list...))
+					}
+				case "like":
+					if s, _ := arg.(string); s != "" {
+						conds = append(conds, builder.Like{col, s})
+					}
+				case "isNull":
+					if arg == true {
+						conds = append(conds, builder.IsNull{col})
+					} else {
+						conds = append(conds, builder.NotNull{col})
+					}
+				}
+			}
+		}
+	}
+	return builder.And(conds...), nil
+}
+
+// queryRows selects all columns of t matching cond. limit <= 0 means no limit.
+func (e *GraphQLExecutor) queryRows(ctx context.Context, t *gqlType, cond builder.Cond, order []string, limit, offset int) ([]gqlRow, error) {
+	quoter := e.engine.Dialect().Quoter()
+	cols := make([]string, len(t.table.Columns))
+	for i, c := range t.table.Columns {
+		cols[i] = quoter.Quote(c.Name)
+	}
+	query := "SELECT " + strings.Join(cols, ", ") + " FROM " + quoter.Quote(t.table.FullName())
+	where, args, err := whereClause(cond)
+	if err != nil {
+		return nil, err
+	}
+	query += where
+	if len(order) > 0 {
+		query += " ORDER BY " + strings.Join(order, ", ")
+	}
+	if limit > 0 {
+		query += " LIMIT " + strconv.Itoa(limit)
+		if offset > 0 {
+			query += " OFFSET " + strconv.Itoa(offset)
+		}
+	}
+	res, err := e.engine.Context(ctx).SQL(query, args...).QueryInterface()
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]gqlRow, len(res))
+	for i, r := range res {
+		rows[i] = r
+	}
+	return rows, nil
+}
+
+// queryRowsPerKey is queryRows for each value of keyCols at once: of the rows
+// sharing a key it returns limit rows, skipping the first offset ones.
+func (e *GraphQLExecutor) queryRowsPerKey(ctx context.Context, t *gqlType, keyCols []string, cond builder.Cond, order []string, limit, offset int) ([]gqlRow, error) {
+	quoter := e.engine.Dialect().Quoter()
+	cols := make([]string, len(t.table.Columns))
+	for i, c := range t.table.Columns {
+		cols[i] = quoter.Quote(c.Name)
+	}
+	keys := make([]string, len(keyCols))
+	for i, c := range keyCols {
+		keys[i] = quoter.Quote(c)
+	}
+	window := "PARTITION BY " + strings.Join(keys, ", ")
+	if len(order) > 0 {
+		window += " ORDER BY " + strings.Join(order, ", ")
+	}
+	where, args, err := whereClause(cond)
+	if err != nil {
+		return nil, err
+	}
+	query := "SELECT " + strings.Join(cols, ", ") + " FROM (SELECT " + strings.Join(cols, ", ") +
+		", ROW_NUMBER() OVER (" + window + ") AS gql_rn FROM " + quoter.Quote(t.table.FullName()) + where +
+		") gql_page WHERE gql_rn > " + strconv.Itoa(offset) + " AND gql_rn <= " + strconv.Itoa(offset+limit) + " ORDER BY gql_rn"
+	res, err := e.engine.Context(ctx).SQL(query, args...).QueryInterface()
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]gqlRow, len(res))
+	for i, r := range res {
+		rows[i] = r
+	}
+	return rows, nil
+}
+
+func (e *GraphQLExecutor) count(ctx context.Context, c *gqlConnection) (int64, error) {
+	where, args, err := whereClause(c.cond)
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	_, err = e.engine.Context(ctx).SQL("SELECT COUNT(*) FROM "+e.engine.Dialect().Quoter().Quote(c.t.table.FullName())+where, args...).Get(&n)
+	return n, err
+}
+
+func whereClause(cond builder.Cond) (string, []any, error) {
+	if cond == nil || !cond.IsValid() {
+		return "", nil, nil
+	}
+	where, args, err := builder.ToSQL(cond)
+	if err != nil {
+		return "", nil, err
+	}
+	return " WHERE " + where, args, nil
+}
+
+// gqlBatch holds the loaders of one request. graphql-go resolves a request on
+// a single goroutine, so it needs no locking.
+type gqlBatch struct {
+	loaders map[string]*gqlLoader
+}
+
+type gqlBatchKey struct{}
+
+// gqlLoader collects the keys requested for one table, key columns and
+// argument set, and fetches them together when the first result is needed.
+// graphql-go completes the thunks returned by resolvers breadth first, so by
+// then every row of the current depth has registered its key.
+type gqlLoader struct {
+	ctx     context.Context
+	e       *GraphQLExecutor
+	t       *gqlType
+	cols    []string
+	cond    builder.Cond
+	order   []string
+	limit   int // rows per key, 0 for all
+	offset  int
+	pending [][]any
+	queued  map[string]bool
+	rows    map[string][]gqlRow
+	err     error
+}
+
+// loader returns the loader of the request for rows of t matched on cols,
+// restricted by the filter and orderBy in args, and to limit rows per key
+// after offset when limit is positive. The page is part of args.
+func (e *GraphQLExecutor) loader(ctx context.Context, t *gqlType, cols []string, args map[string]any, limit, offset int) (*gqlLoader, error) {
+	batch, _ := ctx.Value(gqlBatchKey{}).(*gqlBatch)
+	if batch == nil {
+		batch = &gqlBatch{loaders: map[string]*gqlLoader{}}
+	}
+	argKey, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+	key := t.name + "|" + strings.Join(cols, ",") + "|" + string(argKey)
+	if l := batch.loaders[key]; l != nil {
+		return l, nil
+	}
+	cond, order, err := e.queryArgs(t, args)
+	if err != nil {
+		return nil, err
+	}
+	l := &gqlLoader{ctx: ctx, e: e, t: t, cols: cols, cond: cond, order: order, limit: limit, offset: offset,
+		queued: map[string]bool{}, rows: map[string][]gqlRow{}}
+	batch.loaders[key] = l
+	return l, nil
+}
+
+func gqlKey(values []any) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = profileString(v)
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// load queues a key and returns a thunk yielding its rows.
+func (l *gqlLoader) load(values []any) func() ([]gqlRow, error) {
+	k := gqlKey(values)
+	if !l.queued[k] {
+		l.queued[k] = true
+		l.pending = append(l.pending, values)
+	}
+	return func() ([]gqlRow, error) {
+		if err := l.flush(); err != nil {
+			return nil, err
+		}
+		return l.rows[k], nil
+	}
+}
+
+// flush fetches all pending keys, gqlBatchSize keys per query.
+func (l *gqlLoader) flush() error {
+	if l.err != nil || len(l.pending) == 0 {
+		return l.err
+	}
+	pending := l.pending
+	l.pending = nil
+	quoter := l.e.engine.Dialect().Quoter()
+	for start := 0; start < len(pending); start += gqlBatchSize {
+		chunk := pending[start:min(start+gqlBatchSize, len(pending))]
+		var keyCond builder.Cond
+		if len(l.cols) == 1 {
+			values := make([]any, len(chunk))
+			for i, key := range chunk {
+				values[i] = key[0]
+			}
+			keyCond = builder.In(quoter.Quote(l.cols[0]), values...)
+		} else {
+			ors := make([]builder.Cond, len(chunk))
+			for i, key := range chunk {
+				eq := builder.Eq{}
+				for j, c := range l.cols {
+					eq[quoter.Quote(c)] = key[j]
+				}
+				ors[i] = eq
+			}
+			keyCond = builder.Or(ors...)
+		}
+		var rows []gqlRow
+		var err error
+		if l.limit > 0 {
+			rows, err = l.e.queryRowsPerKey(l.ctx, l.t, l.cols, builder.And(keyCond, l.cond), l.order, l.limit, l.offset)
+		} else {
+			rows, err = l.e.queryRows(l.ctx, l.t, builder.And(keyCond, l.cond), l.order, 0, 0)
+		}
+		if err != nil {
+			l.err = err
+			return err
+		}
+		for _, r := range rows {
+			values := make([]any, len(l.cols))
+			for i, c := range l.cols {
+				values[i] = r[c]
+			}
+			k := gqlKey(values)
+			l.rows[k] = append(l.rows[k], r)
+		}
+	}
+	return nil
+}
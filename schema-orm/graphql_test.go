@@ -0,0 +1,280 @@
+package schema_orm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/graphql-go/graphql/language/parser"
+	"xorm.io/xorm/contexts"
+)
+
+const sqliteRelationsData = `
+INSERT INTO country (code, name) VALUES ('DE', 'Germany'), ('FR', 'France'), ('IT', 'Italy');
+INSERT INTO supplier (id, name, country_code, parent_id) VALUES
+  (1, 'Acme Holding', 'DE', NULL),
+  (2, 'Acme Berlin', 'DE', 1),
+  (3, 'Acme Paris', 'FR', 1),
+  (4, 'Bolt SARL', 'FR', NULL),
+  (5, 'Nomad', NULL, 4);
+`
+
+// queryCounter counts the statements run by an engine.
+type queryCounter struct{ n atomic.Int64 }
+
+func (c *queryCounter) BeforeProcess(h *contexts.ContextHook) (context.Context, error) {
+	c.n.Add(1)
+	return h.Ctx, nil
+}
+
+func (c *queryCounter) AfterProcess(*contexts.ContextHook) error { return nil }
+
+func graphQLFixture(t *testing.T) (*GraphQLExecutor, *queryCounter) {
+	t.Helper()
+	eng, err := NewSQLiteEngine(BuildSQLiteDSN(filepath.Join(t.TempDir(), "gql.db")))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { eng.Close() })
+	if _, err := eng.Import(strings.NewReader(sqliteRelationsDDL + sqliteRelationsData)); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	tables, err := ExportEngineSchema(context.Background(), eng, ExportOptions{})
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	exec, err := NewGraphQLExecutor(eng, tables, GraphQLOptions{DefaultPageSize: 2})
+	if err != nil {
+		t.Fatalf("executor: %v", err)
+	}
+	counter := &queryCounter{}
+	eng.AddHook(counter)
+	return exec, counter
+}
+
+// runGraphQL executes a query and returns the JSON encoded data.
+func runGraphQL(t *testing.T, exec *GraphQLExecutor, query string, vars map[string]any) string {
+	t.Helper()
+	res := exec.Execute(context.Background(), GraphQLRequest{Query: query, Variables: vars})
+	if res.HasErrors() {
+		t.Fatalf("query errors: %v", res.Errors)
+	}
+	b, err := json.Marshal(res.Data)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return string(b)
+}
+
+func TestWriteGraphQLSDL(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteGraphQLSDL(&buf, dictionaryFixture(t), GraphQLOptions{}); err != nil {
+		t.Fatalf("WriteGraphQLSDL: %v", err)
+	}
+	sdl := buf.String()
+	if _, err := parser.Parse(parser.ParseParams{Source: sdl}); err != nil {
+		t.Fatalf("invalid SDL: %v\n%s", err, sdl)
+	}
+	for _, want := range []string{
+		"\"Approved | preferred suppliers\"\ntype Supplier {",
+		"  \"Legal name\\nas registered\"\n  name: String!",
+		"  country_code: String\n",
+		"  country: Country\n  parent: Supplier\n  supplierList(filter: SupplierFilter, orderBy: [SupplierOrder!], first: Int, after: String): SupplierConnection!\n}",
+		"type Country {\n  code: String!\n  name: String!\n  supplierList(filter: SupplierFilter, orderBy: [SupplierOrder!], first: Int, after: String): SupplierConnection!\n}",
+		"input SupplierFilter {\n  id: IntFilter\n",
+		"  _and: [SupplierFilter!]\n  _or: [SupplierFilter!]\n  _not: SupplierFilter\n}",
+		"input StringFilter {\n  eq: String\n  ne: String\n  lt: String\n  lte: String\n  gt: String\n  gte: String\n  in: [String!]\n  like: String\n  isNull: Boolean\n}",
+		"type SupplierConnection {\n  edges: [SupplierEdge!]!\n  nodes: [Supplier!]!\n  pageInfo: PageInfo!\n  totalCount: Int!\n}",
+		"  country(code: String!): Country\n",
+		"  supplierList(filter: SupplierFilter, orderBy: [SupplierOrder!], first: Int, after: String): SupplierConnection!\n",
+	} {
+		if !strings.Contains(sdl, want) {
+			t.Fatalf("SDL misses %q:\n%s", want, sdl)
+		}
+	}
+	if strings.Contains(sdl, "scalar ") {
+		t.Fatalf("no custom scalar is used:\n%s", sdl)
+	}
+
+	if err := WriteGraphQLSDL(&buf, nil, GraphQLOptions{}); err == nil {
+		t.Fatal("expected error without tables")
+	}
+}
+
+func TestGraphQLSDL_ScalarsAndNames(t *testing.T) {
+	tb := NewEmptyTable()
+	tb.Name = "ledger"
+	tb.Schema = "fin"
+	tb.AddColumn(&Column{Name: "id", SQLType: SQLType{Name: "BIGINT"}, IsPrimaryKey: true})
+	tb.AddColumn(&Column{Name: "amount", SQLType: SQLType{Name: "DECIMAL"}, Length: 12, Length2: 2})
+	tb.AddColumn(&Column{Name: "booked_at", SQLType: SQLType{Name: "DATETIME"}, Nullable: true})
+	tb.AddColumn(&Column{Name: "value_date", SQLType: SQLType{Name: "DATE"}})
+	tb.AddColumn(&Column{Name: "scan", SQLType: SQLType{Name: "BLOB"}, Nullable: true})
+	tb.AddColumn(&Column{Name: "__meta", SQLType: SQLType{Name: "TEXT"}, Nullable: true})
+	tb.AddColumn(&Column{Name: "null", SQLType: SQLType{Name: "BOOL"}})
+	tb.PrimaryKeys = []string{"id"}
+
+	var buf bytes.Buffer
+	if err := WriteGraphQLSDL(&buf, []*Table{tb}, GraphQLOptions{}); err != nil {
+		t.Fatalf("WriteGraphQLSDL: %v", err)
+	}
+	sdl := buf.String()
+	if _, err := parser.Parse(parser.ParseParams{Source: sdl}); err != nil {
+		t.Fatalf("invalid SDL: %v\n%s", err, sdl)
+	}
+	for _, want := range []string{
+		"scalar Bytes\n\nscalar Date\n\nscalar DateTime\n\nscalar Decimal\n\nscalar Long\n",
+		"type FinLedger {\n  id: Long!\n  amount: Decimal!\n  booked_at: DateTime\n  value_date: Date!\n  scan: Bytes\n  f__meta: String\n  null_: Boolean!\n}",
+		"input BooleanFilter {\n  eq: Boolean\n  ne: Boolean\n  isNull: Boolean\n}",
+		"  finLedger(id: Long!): FinLedger\n",
+	} {
+		if !strings.Contains(sdl, want) {
+			t.Fatalf("SDL misses %q:\n%s", want, sdl)
+		}
+	}
+	if strings.Contains(sdl, "scan: BytesFilter") {
+		t.Fatalf("binary columns are not filterable:\n%s", sdl)
+	}
+
+	// executable schema agrees with the SDL
+	if _, err := NewGraphQLExecutor(nil, []*Table{tb}, GraphQLOptions{}); err != nil {
+		t.Fatalf("executor: %v", err)
+	}
+}
+
+func TestGraphQLExecutor_BatchesRelations(t *testing.T) {
+	exec, counter := graphQLFixture(t)
+
+	got := runGraphQL(t, exec, `{
+	  supplierList(first: 10) {
+	    nodes { name country { name } parent { name } }
+	  }
+	}`, nil)
+	want := `{"supplierList":{"nodes":[` +
+		`{"country":{"name":"Germany"},"name":"Acme Holding","parent":null},` +
+		`{"country":{"name":"Germany"},"name":"Acme Berlin","parent":{"name":"Acme Holding"}},` +
+		`{"country":{"name":"France"},"name":"Acme Paris","parent":{"name":"Acme Holding"}},` +
+		`{"country":{"name":"France"},"name":"Bolt SARL","parent":null},` +
+		`{"country":null,"name":"Nomad","parent":{"name":"Bolt SARL"}}]}}`
+	if got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+	// list + one batch per relation, instead of 1 + 5 + 5
+	if n := counter.n.Load(); n != 3 {
+		t.Fatalf("expected 3 queries, got %d", n)
+	}
+
+	counter.n.Store(0)
+	got = runGraphQL(t, exec, `{
+	  countryList(orderBy: [{field: code, direction: DESC}]) {
+	    nodes { code supplierList(orderBy: [{field: name}], filter: {name: {like: "Acme"}}) { nodes { name } } }
+	  }
+	}`, nil)
+	want = `{"countryList":{"nodes":[{"code":"IT","supplierList":{"nodes":[]}},{"code":"FR","supplierList":{"nodes":[{"name":"Acme Paris"}]}}]}}`
+	if got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+	if n := counter.n.Load(); n != 2 {
+		t.Fatalf("expected 2 queries, got %d", n)
+	}
+
+	counter.n.Store(0)
+	got = runGraphQL(t, exec, `{ a: supplier(id: 2) { name } b: supplier(id: 5) { name } c: supplier(id: 9) { name } }`, nil)
+	if got != `{"a":{"name":"Acme Berlin"},"b":{"name":"Nomad"},"c":null}` {
+		t.Fatalf("lookup by key: %s", got)
+	}
+	if n := counter.n.Load(); n != 1 {
+		t.Fatalf("expected 1 query, got %d", n)
+	}
+}
+
+func TestGraphQLExecutor_RelationPaging(t *testing.T) {
+	exec, counter := graphQLFixture(t)
+	query := `query($after: String) {
+	  countryList(first: 3, orderBy: [{field: code}]) {
+	    nodes { code supplierList(first: 1, after: $after, orderBy: [{field: id}]) {
+	      totalCount pageInfo { hasNextPage hasPreviousPage } nodes { id } } }
+	  }
+	}`
+	got := runGraphQL(t, exec, query, nil)
+	want := `{"countryList":{"nodes":[` +
+		`{"code":"DE","supplierList":{"nodes":[{"id":1}],"pageInfo":{"hasNextPage":true,"hasPreviousPage":false},"totalCount":2}},` +
+		`{"code":"FR","supplierList":{"nodes":[{"id":3}],"pageInfo":{"hasNextPage":true,"hasPreviousPage":false},"totalCount":2}},` +
+		`{"code":"IT","supplierList":{"nodes":[],"pageInfo":{"hasNextPage":false,"hasPreviousPage":false},"totalCount":0}}]}}`
+	if got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+	// list, one page query for all countries, a count per country
+	if n := counter.n.Load(); n != 5 {
+		t.Fatalf("expected 5 queries, got %d", n)
+	}
+
+	got = runGraphQL(t, exec, query, map[string]any{"after": encodeCursor(0)})
+	want = `{"countryList":{"nodes":[` +
+		`{"code":"DE","supplierList":{"nodes":[{"id":2}],"pageInfo":{"hasNextPage":false,"hasPreviousPage":true},"totalCount":2}},` +
+		`{"code":"FR","supplierList":{"nodes":[{"id":4}],"pageInfo":{"hasNextPage":false,"hasPreviousPage":true},"totalCount":2}},` +
+		`{"code":"IT","supplierList":{"nodes":[],"pageInfo":{"hasNextPage":false,"hasPreviousPage":true},"totalCount":0}}]}}`
+	if got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+
+	// the default page size applies per parent
+	got = runGraphQL(t, exec, `{ country(code: "DE") { supplierList { nodes { id } } } supplier(id: 5) { supplierList { totalCount } } }`, nil)
+	if got != `{"country":{"supplierList":{"nodes":[{"id":1},{"id":2}]}},"supplier":{"supplierList":{"totalCount":0}}}` {
+		t.Fatalf("default page: %s", got)
+	}
+}
+
+func TestGraphQLExecutor_FilterAndPaging(t *testing.T) {
+	exec, _ := graphQLFixture(t)
+	query := `query($after: String) {
+	  supplierList(after: $after, filter: {_or: [{country_code: {eq: "FR"}}, {parent_id: {isNull: true}}], _not: {id: {in: [4]}}}) {
+	    totalCount
+	    pageInfo { hasNextPage hasPreviousPage endCursor }
+	    edges { node { id } }
+	  }
+	}`
+	got := runGraphQL(t, exec, query, nil)
+	want := `{"supplierList":{"edges":[{"node":{"id":1}},{"node":{"id":3}}],"pageInfo":{"endCursor":"b2Zmc2V0OjE=","hasNextPage":false,"hasPreviousPage":false},"totalCount":2}}`
+	if got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+
+	query = `query($after: String) { supplierList(first: 2, after: $after, orderBy: [{field: id}]) {
+	  totalCount pageInfo { hasNextPage hasPreviousPage endCursor } nodes { id } } }`
+	got = runGraphQL(t, exec, query, map[string]any{"after": encodeCursor(1)})
+	want = `{"supplierList":{"nodes":[{"id":3},{"id":4}],"pageInfo":{"endCursor":"b2Zmc2V0OjM=","hasNextPage":true,"hasPreviousPage":true},"totalCount":5}}`
+	if got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+
+	got = runGraphQL(t, exec, `{ supplierList(filter: {id: {gte: 2, lt: 4}, country_code: {in: []}}) { nodes { id } } }`, nil)
+	if got != `{"supplierList":{"nodes":[]}}` {
+		t.Fatalf("empty in: %s", got)
+	}
+
+	for _, q := range []string{
+		`{ supplierList(after: "bogus") { totalCount } }`,
+		`{ supplierList(first: -1) { totalCount } }`,
+		`{ supplierList { nodes { unknown } } }`,
+	} {
+		if res := exec.Execute(context.Background(), GraphQLRequest{Query: q}); !res.HasErrors() {
+			t.Fatalf("expected error for %s", q)
+		}
+	}
+}
+
+func TestGraphQLExecutor_QueryError(t *testing.T) {
+	exec, _ := graphQLFixture(t)
+	if _, err := exec.engine.Exec("DROP TABLE supplier"); err != nil {
+		t.Fatalf("drop: %v", err)
+	}
+	res := exec.Execute(context.Background(), GraphQLRequest{Query: `{ country(code: "DE") { supplierList { id } } }`})
+	if !res.HasErrors() {
+		t.Fatalf("expected error, got %v", res.Data)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	_ "github.com/lib/pq"
 	"xorm.io/xorm"
@@ -43,7 +44,7 @@ func TestImportTablesFromJSON_File(t *testing.T) {
 		if tb == nil || tb.Name == "" {
 			t.Fatalf("table %d has empty name", i)
 		}
-		xtb := ToXormTable(tb)
+		xtb := ToXormTable(tb).Table
 		sql, b2, err := eng.Dialect().CreateTableSQL(ctx, eng.DB(), xtb, tb.Name)
 		if err != nil {
 			t.Fatalf("CreateTableSQL failed: %v", err)
@@ -75,7 +76,7 @@ func TestBuildPostgresDSN(t *testing.T) {
 // It skips if no local DB available. Defaults: host localhost, user ever, db postgres, password from PG_PASSWORD.
 func TestExportPostgresToJSON_EnvOrLocal(t *testing.T) {
 	if dsn := os.Getenv("WIZ_PG_DSN"); dsn != "" {
-		jsonStr, err := ExportPostgresSchemaToJSONWithDSN(dsn)
+		jsonStr, err := ExportSchemaToJSON(context.Background(), "postgres", dsn, ExportOptions{})
 		if err != nil {
 			t.Skipf("skip: cannot connect using WIZ_PG_DSN: %v", err)
 		}
@@ -106,3 +107,39 @@ func TestExportPostgresToJSON_EnvOrLocal(t *testing.T) {
 		}
 	}
 }
+
+// TestExportSchema_PostgresNamespaces exports two schemas holding a table with the same name.
+func TestExportSchema_PostgresNamespaces(t *testing.T) {
+	dsn := os.Getenv("WIZ_PG_DSN")
+	if dsn == "" {
+		t.Skip("skip: set WIZ_PG_DSN to run")
+	}
+	eng, err := xorm.NewEngine("postgres", dsn)
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	defer eng.Close()
+	for _, ns := range []string{"mdm_a", "mdm_b"} {
+		if _, err := eng.Exec("CREATE SCHEMA IF NOT EXISTS " + ns); err != nil {
+			t.Skipf("skip: cannot create schema: %v", err)
+		}
+		if _, err := eng.Exec("CREATE TABLE IF NOT EXISTS " + ns + ".dup (id INT PRIMARY KEY)"); err != nil {
+			t.Fatalf("create table: %v", err)
+		}
+	}
+	tables, err := ExportSchema(context.Background(), "postgres", dsn, ExportOptions{
+		Schemas: []string{"mdm_a", "mdm_b"},
+		Include: []string{"dup"},
+		Timeout: 10 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("ExportSchema failed: %v", err)
+	}
+	seen := map[string]bool{}
+	for _, tb := range tables {
+		seen[tb.FullName()] = true
+	}
+	if !seen["mdm_a.dup"] || !seen["mdm_b.dup"] {
+		t.Fatalf("expected both namespaces, got %v", seen)
+	}
+}
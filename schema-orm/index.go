@@ -38,6 +38,22 @@ func (index *Index) XName(tableName string) string {
 	return index.Name
 }
 
+// QualifiedXName returns XName prefixed with the schema of a schema-qualified
+// table name ("sales.customer" -> "sales.IDX_customer_code"). Index names are
+// scoped per schema, so this keeps same-named tables in different schemas apart.
+func (index *Index) QualifiedXName(tableName string) string {
+	return qualifyIndexName(tableName, index.XName(tableName))
+}
+
+// qualifyIndexName prefixes name with the schema of tableName, if it has one.
+func qualifyIndexName(tableName, name string) string {
+	tableParts := strings.Split(strings.ReplaceAll(tableName, "\"", ""), ".")
+	if len(tableParts) < 2 || strings.Contains(name, ".") {
+		return name
+	}
+	return tableParts[len(tableParts)-2] + "." + name
+}
+
 // AddColumn add columns which will be composite index
 func (index *Index) AddColumn(cols ...string) {
 	index.Cols = append(index.Cols, cols...)
@@ -66,3 +82,23 @@ func (index *Index) Equal(dst *Index) bool {
 	}
 	return true
 }
+
+// EqualOrdered is like Equal but also requires the columns in the same order,
+// which is what matters for lookups on composite indexes. Column names compare
+// case-insensitively.
+func (index *Index) EqualOrdered(dst *Index) bool {
+	return index.Type == dst.Type && len(index.Cols) == len(dst.Cols) && index.HasLeftPrefix(dst.Cols)
+}
+
+// HasLeftPrefix reports whether cols are the leading columns of the index, in order.
+func (index *Index) HasLeftPrefix(cols []string) bool {
+	if len(cols) > len(index.Cols) {
+		return false
+	}
+	for i, c := range cols {
+		if !strings.EqualFold(index.Cols[i], c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,228 @@
+package schema_orm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"xorm.io/xorm/dialects"
+	xs "xorm.io/xorm/schemas"
+)
+
+// IndexFindingKind classifies a finding of AnalyzeIndexes.
+type IndexFindingKind string
+
+// index finding kinds
+const (
+	// IndexDuplicate: another index (or the PK) has the same columns in the same order.
+	IndexDuplicate IndexFindingKind = "duplicate"
+	// IndexLeftPrefix: a non-unique index whose columns lead a longer index.
+	IndexLeftPrefix IndexFindingKind = "left-prefix"
+	// IndexPKShadowed: a unique index over exactly the PK columns; the PK already enforces it.
+	IndexPKShadowed IndexFindingKind = "pk-shadowed"
+	// IndexFKUnindexed: a foreign key whose columns don't lead any index.
+	IndexFKUnindexed IndexFindingKind = "fk-unindexed"
+)
+
+// PrimaryIndexName is the name used for the primary key when it covers another index.
+const PrimaryIndexName = "PRIMARY"
+
+// IndexFinding is one problem reported by AnalyzeIndexes.
+// Index is the name of the offending index, or of the foreign key for
+// IndexFKUnindexed. CoveredBy names the index that makes it redundant.
+// Drop and Create are the suggested changes (either may be nil) and SQL the
+// matching statements in the requested dialect.
+type IndexFinding struct {
+	Kind      IndexFindingKind `json:"kind" yaml:"kind"`
+	Table     string           `json:"table" yaml:"table"`
+	Index     string           `json:"index" yaml:"index"`
+	Cols      []string         `json:"cols" yaml:"cols"`
+	CoveredBy string           `json:"coveredBy,omitempty" yaml:"coveredBy,omitempty"`
+	Message   string           `json:"message" yaml:"message"`
+	Drop      *Index           `json:"drop,omitempty" yaml:"drop,omitempty"`
+	Create    *Index           `json:"create,omitempty" yaml:"create,omitempty"`
+	SQL       []string         `json:"sql,omitempty" yaml:"sql,omitempty"`
+}
+
+// AnalyzeIndexes reports redundant indexes and foreign keys without a supporting
+// index. Unlike Index.Equal the analysis is order-aware: (a, b) and (b, a) serve
+// different lookups and are not duplicates.
+//
+//   - duplicate: same columns in the same order as a stronger or earlier index;
+//     a unique index wins over a plain one, otherwise the first name is kept.
+//   - left-prefix: a plain index whose columns are the leading columns of another
+//     index. Unique prefixes are kept since they enforce a stronger constraint.
+//   - pk-shadowed: a unique index over the PK columns. If its column order differs
+//     from the PK a plain index with that order is suggested in its place.
+//   - fk-unindexed: no index (or PK) starts with the FK columns, in any order.
+//
+// When dbType is set, each finding carries DROP/CREATE statements for that dialect.
+func AnalyzeIndexes(table *Table, dbType xs.DBType) ([]*IndexFinding, error) {
+	return AnalyzeIndexesWithNaming(table, dbType, nil)
+}
+
+// AnalyzeIndexesWithNaming is AnalyzeIndexes with index names (in findings and
+// statements) built by the naming strategy instead of Index.XName.
+func AnalyzeIndexesWithNaming(table *Table, dbType xs.DBType, naming *Naming) ([]*IndexFinding, error) {
+	namer, err := naming.IndexNamer()
+	if err != nil {
+		return nil, err
+	}
+	var dialect dialects.Dialect
+	if dbType != "" {
+		if dialect, err = offlineDialect(dbType, table.Schema); err != nil {
+			return nil, err
+		}
+	}
+	findings := analyzeIndexes(table, namer)
+	if dialect != nil {
+		xormNames := naming.defaultIndexNames()
+		for _, f := range findings {
+			if f.Drop != nil {
+				f.SQL = append(f.SQL, dropIndexSQL(dialect, table.FullName(), f.Drop, namer, xormNames))
+			}
+			if f.Create != nil {
+				f.SQL = append(f.SQL, createIndexSQL(dialect, table.FullName(), f.Create, namer, xormNames))
+			}
+		}
+	}
+	return findings, nil
+}
+
+func analyzeIndexes(table *Table, namer IndexNamer) []*IndexFinding {
+	var findings []*IndexFinding
+	add := func(kind IndexFindingKind, name string, cols []string, coveredBy, msg string) *IndexFinding {
+		f := &IndexFinding{Kind: kind, Table: table.FullName(), Index: name, Cols: cols, CoveredBy: coveredBy, Message: msg}
+		findings = append(findings, f)
+		return f
+	}
+
+	// unique indexes first so duplicates keep the stronger one, then by name
+	ordered := make([]*Index, 0, len(table.Indexes))
+	for _, idx := range table.Indexes {
+		ordered = append(ordered, idx)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		if ordered[i].Type != ordered[j].Type {
+			return ordered[i].Type == UniqueType
+		}
+		return ordered[i].Name < ordered[j].Name
+	})
+
+	var pk *Index
+	kept := make([]*Index, 0, len(ordered)+1)
+	if len(table.PrimaryKeys) > 0 {
+		pk = &Index{Name: PrimaryIndexName, Type: UniqueType, Cols: table.PrimaryKeys}
+		kept = append(kept, pk)
+	}
+
+	for _, idx := range ordered {
+		name := namer(table.Name, idx)
+		if idx.Type == UniqueType && pk != nil && sameColumnSet(idx.Cols, pk.Cols) {
+			f := add(IndexPKShadowed, name, idx.Cols, PrimaryIndexName,
+				fmt.Sprintf("unique index %s (%s) is enforced by the primary key", name, strings.Join(idx.Cols, ", ")))
+			f.Drop = idx
+			if !pk.HasLeftPrefix(idx.Cols) {
+				plain := NewIndex(idx.Name, IndexType)
+				plain.IsRegular = idx.IsRegular
+				plain.AddColumn(idx.Cols...)
+				f.Create = plain
+				f.Message += "; keep a plain index for its column order"
+				kept = append(kept, plain)
+			}
+			continue
+		}
+		if other := findOrderedDuplicate(kept, idx); other != nil {
+			otherName := namer(table.Name, other)
+			if other == pk {
+				otherName = PrimaryIndexName
+			}
+			f := add(IndexDuplicate, name, idx.Cols, otherName,
+				fmt.Sprintf("index %s (%s) duplicates %s", name, strings.Join(idx.Cols, ", "), otherName))
+			f.Drop = idx
+			continue
+		}
+		kept = append(kept, idx)
+	}
+
+	remaining := kept[:0:0]
+	for _, idx := range kept {
+		if idx.Type == IndexType {
+			if longer := findLongerPrefix(kept, idx); longer != nil {
+				name, longerName := namer(table.Name, idx), namer(table.Name, longer)
+				if longer == pk {
+					longerName = PrimaryIndexName
+				}
+				f := add(IndexLeftPrefix, name, idx.Cols, longerName,
+					fmt.Sprintf("index %s (%s) is a left prefix of %s (%s)", name, strings.Join(idx.Cols, ", "), longerName, strings.Join(longer.Cols, ", ")))
+				f.Drop = idx
+				continue
+			}
+		}
+		remaining = append(remaining, idx)
+	}
+
+	for _, fk := range table.ForeignKeys {
+		if len(fk.Cols) == 0 || fkSupported(remaining, fk.Cols) {
+			continue
+		}
+		name := fk.Name
+		if name == "" {
+			name = fk.RefFullName()
+		}
+		f := add(IndexFKUnindexed, name, fk.Cols, "",
+			fmt.Sprintf("foreign key %s (%s) -> %s has no supporting index", name, strings.Join(fk.Cols, ", "), fk.RefFullName()))
+		f.Create = NewIndex(strings.Join(fk.Cols, "_"), IndexType)
+		f.Create.AddColumn(fk.Cols...)
+	}
+	return findings
+}
+
+// findOrderedDuplicate returns the first index with the same columns in the same order.
+func findOrderedDuplicate(indexes []*Index, idx *Index) *Index {
+	for _, other := range indexes {
+		if len(other.Cols) == len(idx.Cols) && other.HasLeftPrefix(idx.Cols) {
+			return other
+		}
+	}
+	return nil
+}
+
+// findLongerPrefix returns an index that starts with all columns of idx and has more.
+func findLongerPrefix(indexes []*Index, idx *Index) *Index {
+	for _, other := range indexes {
+		if len(other.Cols) > len(idx.Cols) && other.HasLeftPrefix(idx.Cols) {
+			return other
+		}
+	}
+	return nil
+}
+
+// fkSupported reports whether some index starts with the FK columns in any order.
+func fkSupported(indexes []*Index, cols []string) bool {
+	for _, idx := range indexes {
+		if len(idx.Cols) >= len(cols) && sameColumnSet(idx.Cols[:len(cols)], cols) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameColumnSet compares column lists as case-insensitive sets.
+func sameColumnSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := make(map[string]int, len(a))
+	for _, c := range a {
+		seen[strings.ToLower(c)]++
+	}
+	for _, c := range b {
+		k := strings.ToLower(c)
+		if seen[k] == 0 {
+			return false
+		}
+		seen[k]--
+	}
+	return true
+}
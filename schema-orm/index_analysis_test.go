@@ -0,0 +1,193 @@
+package schema_orm
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	xs "xorm.io/xorm/schemas"
+)
+
+func TestIndex_EqualOrdered(t *testing.T) {
+	ab := NewIndex("ab", IndexType)
+	ab.AddColumn("a", "b")
+	ba := NewIndex("ba", IndexType)
+	ba.AddColumn("b", "a")
+	if !ab.Equal(ba) || ab.EqualOrdered(ba) {
+		t.Fatalf("Equal ignores order, EqualOrdered must not")
+	}
+	ab2 := NewIndex("ab2", IndexType)
+	ab2.AddColumn("A", "B")
+	if !ab.EqualOrdered(ab2) {
+		t.Fatalf("column names compare case-insensitively")
+	}
+	if !ab.HasLeftPrefix([]string{"a"}) || ab.HasLeftPrefix([]string{"b"}) || ab.HasLeftPrefix([]string{"a", "b", "c"}) {
+		t.Fatalf("HasLeftPrefix mismatch")
+	}
+}
+
+func indexAnalysisTable() *Table {
+	tb := NewEmptyTable()
+	tb.Name = "orders"
+	for _, name := range []string{"id", "tenant", "customer_id", "status", "created"} {
+		tb.AddColumn(&Column{Name: name, SQLType: SQLType{Name: "INT"}})
+	}
+	tb.GetColumn("id").IsPrimaryKey = true
+	tb.GetColumn("tenant").IsPrimaryKey = true
+	tb.PrimaryKeys = []string{"id", "tenant"}
+	idx := func(name string, typ int, cols ...string) {
+		i := NewIndex(name, typ)
+		i.AddColumn(cols...)
+		tb.AddIndex(i)
+	}
+	idx("pk_copy", UniqueType, "id", "tenant")   // pk-shadowed
+	idx("tenant_id", UniqueType, "tenant", "id") // pk-shadowed, other order
+	idx("by_id", IndexType, "id")                // left prefix of the PK
+	idx("cust_status", IndexType, "customer_id", "status")
+	idx("cust_status_2", IndexType, "customer_id", "status") // duplicate
+	idx("status_cust", IndexType, "status", "customer_id")   // same set, other order: kept
+	idx("cust", IndexType, "customer_id")                    // left prefix
+	idx("created_u", UniqueType, "created")
+	idx("created", IndexType, "created") // duplicate of the unique one
+	fk := NewForeignKey("fk_orders_customer", "customer")
+	fk.AddColumn("customer_id", "id")
+	tb.AddForeignKey(fk) // supported by cust_status
+	fk2 := NewForeignKey("fk_orders_parent", "orders")
+	fk2.AddColumn("tenant", "tenant")
+	tb.AddForeignKey(fk2) // supported by tenant_id once replaced by a plain index
+	fk3 := NewForeignKey("", "status_codes")
+	fk3.AddColumn("status", "code")
+	fk3.RefSchema = "ref"
+	tb.AddForeignKey(fk3) // supported by status_cust
+	fk4 := NewForeignKey("fk_orders_created", "calendar")
+	fk4.AddColumn("created", "day")
+	tb.AddForeignKey(fk4) // supported by created_u
+	return tb
+}
+
+func TestAnalyzeIndexes_Findings(t *testing.T) {
+	findings, err := AnalyzeIndexes(indexAnalysisTable(), "")
+	if err != nil {
+		t.Fatalf("analyze: %v", err)
+	}
+	got := map[string]*IndexFinding{}
+	for _, f := range findings {
+		if len(f.SQL) != 0 {
+			t.Fatalf("no dialect, no SQL: %v", f.SQL)
+		}
+		got[f.Index] = f
+	}
+	want := map[string]struct {
+		kind      IndexFindingKind
+		coveredBy string
+	}{
+		"UQE_orders_pk_copy":       {IndexPKShadowed, PrimaryIndexName},
+		"UQE_orders_tenant_id":     {IndexPKShadowed, PrimaryIndexName},
+		"IDX_orders_by_id":         {IndexLeftPrefix, PrimaryIndexName},
+		"IDX_orders_cust_status_2": {IndexDuplicate, "IDX_orders_cust_status"},
+		"IDX_orders_cust":          {IndexLeftPrefix, "IDX_orders_cust_status"},
+		"IDX_orders_created":       {IndexDuplicate, "UQE_orders_created_u"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("findings = %d, want %d: %+v", len(got), len(want), findings)
+	}
+	for name, w := range want {
+		f := got[name]
+		if f == nil || f.Kind != w.kind || f.CoveredBy != w.coveredBy || f.Drop == nil {
+			t.Fatalf("%s: got %+v, want %+v", name, f, w)
+		}
+	}
+	if got["UQE_orders_pk_copy"].Create != nil {
+		t.Fatalf("same order as PK needs no replacement")
+	}
+	if c := got["UQE_orders_tenant_id"].Create; c == nil || c.Type != IndexType || strings.Join(c.Cols, ",") != "tenant,id" {
+		t.Fatalf("expected plain (tenant, id) replacement, got %+v", c)
+	}
+}
+
+func TestAnalyzeIndexes_UnindexedForeignKeySQL(t *testing.T) {
+	tb := indexAnalysisTable()
+	tb.Indexes = map[string]*Index{}
+	findings, err := AnalyzeIndexes(tb, xs.MYSQL)
+	if err != nil {
+		t.Fatalf("analyze: %v", err)
+	}
+	var fks []*IndexFinding
+	for _, f := range findings {
+		if f.Kind == IndexFKUnindexed {
+			fks = append(fks, f)
+		}
+	}
+	// tenant is not the leading PK column, the others have no index at all
+	if len(fks) != 4 {
+		t.Fatalf("expected 4 unindexed FKs, got %+v", findings)
+	}
+	if fks[2].Index != "ref.status_codes" {
+		t.Fatalf("anonymous FK should be named by its target, got %q", fks[2].Index)
+	}
+	if len(fks[0].SQL) != 1 || fks[0].SQL[0] != "CREATE INDEX `IDX_orders_customer_id` ON `orders` (`customer_id`)" {
+		t.Fatalf("unexpected SQL: %v", fks[0].SQL)
+	}
+
+	if _, err := AnalyzeIndexes(tb, "nosuchdb"); err == nil {
+		t.Fatalf("expected unsupported dialect error")
+	}
+}
+
+func TestAnalyzeIndexes_SQLiteApply(t *testing.T) {
+	ctx := context.Background()
+	eng, err := NewSQLiteEngine(BuildSQLiteDSN(filepath.Join(t.TempDir(), "idx.db")))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer eng.Close()
+	if err := ApplyTables(ctx, eng, []*Table{indexAnalysisTable()}); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	tables, err := ExportEngineSchema(ctx, eng, ExportOptions{})
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	findings, err := AnalyzeIndexes(tables[0], xs.SQLITE)
+	if err != nil {
+		t.Fatalf("analyze: %v", err)
+	}
+	if len(findings) != 6 {
+		t.Fatalf("expected 6 findings on the exported table, got %d: %+v", len(findings), findings)
+	}
+	// running the suggestions leaves nothing to report
+	for _, f := range findings {
+		for _, s := range f.SQL {
+			if _, err := eng.Exec(s); err != nil {
+				t.Fatalf("exec %q: %v", s, err)
+			}
+		}
+	}
+	tables, err = ExportEngineSchema(ctx, eng, ExportOptions{})
+	if err != nil {
+		t.Fatalf("re-export: %v", err)
+	}
+	if findings, _ := AnalyzeIndexes(tables[0], xs.SQLITE); len(findings) != 0 {
+		t.Fatalf("expected no findings after applying suggestions, got %+v", findings)
+	}
+}
+
+func TestAnalyzeIndexes_ExportedForeignKeys(t *testing.T) {
+	var supplier *Table
+	for _, tb := range dictionaryFixture(t) {
+		if tb.Name == "supplier" {
+			supplier = tb
+		}
+	}
+	findings, err := AnalyzeIndexes(supplier, xs.SQLITE)
+	if err != nil {
+		t.Fatalf("analyze: %v", err)
+	}
+	if len(findings) != 2 || findings[0].Kind != IndexFKUnindexed || findings[1].Kind != IndexFKUnindexed {
+		t.Fatalf("expected two unindexed FKs, got %+v", findings)
+	}
+	if findings[0].SQL[0] != "CREATE INDEX `IDX_supplier_country_code` ON `supplier` (`country_code`)" {
+		t.Fatalf("unexpected SQL: %v", findings[0].SQL)
+	}
+}
@@ -0,0 +1,528 @@
+package schema_orm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Inferred column kinds, from the most to the least specific.
+const (
+	InferBool      = "bool"
+	InferInt       = "int"
+	InferDecimal   = "decimal"
+	InferDate      = "date"
+	InferTimestamp = "timestamp"
+	InferUUID      = "uuid"
+	InferJSON      = "json" // nested NDJSON objects and arrays
+	InferText      = "text"
+)
+
+// inferKinds are tried in order; the first kind that enough values match wins.
+var inferKinds = []string{InferBool, InferInt, InferDecimal, InferDate, InferTimestamp, InferUUID}
+
+// Input formats of InferTable.
+const (
+	InferCSV    = "csv"
+	InferNDJSON = "ndjson"
+)
+
+// InferOptions controls InferTable.
+//
+// Format is InferCSV or InferNDJSON; empty detects NDJSON when the input
+// starts with "{". CSV input needs a header row; Comma defaults to ','.
+// SampleSize caps the rows read. A column gets a kind when at least
+// MinMatchRatio of its non-null values parse as that kind, otherwise it is
+// text. NullValues are the (case-sensitive) strings read as NULL. Zero
+// values select the defaults below.
+type InferOptions struct {
+	Name          string   `json:"name,omitempty" yaml:"name,omitempty"`
+	Format        string   `json:"format,omitempty" yaml:"format,omitempty"`
+	Comma         rune     `json:"comma,omitempty" yaml:"comma,omitempty"`
+	SampleSize    int      `json:"sampleSize,omitempty" yaml:"sampleSize,omitempty"`
+	MinMatchRatio float64  `json:"minMatchRatio,omitempty" yaml:"minMatchRatio,omitempty"`
+	NullValues    []string `json:"nullValues,omitempty" yaml:"nullValues,omitempty"`
+}
+
+// inference defaults
+const (
+	DefaultInferSampleSize    = 10000
+	DefaultInferMinMatchRatio = 0.95
+	// inferFewRows is the sample size below which the report warns that types
+	// and keys are guesses
+	inferFewRows = 10
+	// inferMaxInvalid is the number of non-matching values kept per column
+	inferMaxInvalid = 5
+	// inferMaxVarchar is the longest value stored as VARCHAR; longer ones become TEXT
+	inferMaxVarchar = 4000
+)
+
+// DefaultInferNullValues are read as NULL unless InferOptions.NullValues is set.
+var DefaultInferNullValues = []string{"", "NULL", "null", `\N`}
+
+func (o InferOptions) withDefaults() InferOptions {
+	if o.Name == "" {
+		o.Name = "inferred"
+	}
+	if o.Comma == 0 {
+		o.Comma = ','
+	}
+	if o.SampleSize <= 0 {
+		o.SampleSize = DefaultInferSampleSize
+	}
+	if o.MinMatchRatio <= 0 {
+		o.MinMatchRatio = DefaultInferMinMatchRatio
+	}
+	if o.NullValues == nil {
+		o.NullValues = DefaultInferNullValues
+	}
+	return o
+}
+
+// InferReport explains how InferTable arrived at the table. Sampled is set
+// when the input had more rows than were read. CandidateKeys are the columns
+// whose sampled values are all present and distinct; the first of them
+// (preferring one named "id") became the primary key.
+type InferReport struct {
+	Format        string             `json:"format" yaml:"format"`
+	Rows          int                `json:"rows" yaml:"rows"`
+	Sampled       bool               `json:"sampled,omitempty" yaml:"sampled,omitempty"`
+	Columns       []*ColumnInference `json:"columns" yaml:"columns"`
+	CandidateKeys []string           `json:"candidateKeys,omitempty" yaml:"candidateKeys,omitempty"`
+	Notes         []string           `json:"notes,omitempty" yaml:"notes,omitempty"`
+}
+
+// ColumnInference is the evidence for one column. Confidence is the share of
+// non-null values that parse as Kind (1 for text, 0 for columns without
+// values). Invalid holds up to five values that did not parse as Kind.
+type ColumnInference struct {
+	Name          string   `json:"name" yaml:"name"`
+	Kind          string   `json:"kind" yaml:"kind"`
+	Confidence    float64  `json:"confidence" yaml:"confidence"`
+	NullCount     int      `json:"nullCount" yaml:"nullCount"`
+	DistinctCount int      `json:"distinctCount" yaml:"distinctCount"`
+	MinLength     int      `json:"minLength" yaml:"minLength"`
+	MaxLength     int      `json:"maxLength" yaml:"maxLength"`
+	Invalid       []string `json:"invalid,omitempty" yaml:"invalid,omitempty"`
+	Notes         []string `json:"notes,omitempty" yaml:"notes,omitempty"`
+}
+
+// InferTable reads CSV or NDJSON samples and proposes a table: column kinds
+// mapped to SQL types, lengths, nullability and a primary key taken from the
+// candidate keys. The table is an ordinary *Table to edit, bundle or apply;
+// the report says how sure each decision is.
+func InferTable(r io.Reader, opts InferOptions) (*Table, *InferReport, error) {
+	opts = opts.withDefaults()
+	br := bufio.NewReader(r)
+	if b, _ := br.Peek(3); bytes.Equal(b, utf8BOM) {
+		br.Discard(3)
+	}
+	if opts.Format == "" {
+		opts.Format = sniffFormat(br)
+	}
+	rep := &InferReport{Format: opts.Format}
+	s := &inferSample{opts: opts, nulls: make(map[string]bool, len(opts.NullValues))}
+	for _, v := range opts.NullValues {
+		s.nulls[v] = true
+	}
+
+	var err error
+	switch opts.Format {
+	case InferCSV:
+		err = s.readCSV(br, rep)
+	case InferNDJSON:
+		err = s.readNDJSON(br, rep)
+	default:
+		err = fmt.Errorf("unknown format %q", opts.Format)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(s.cols) == 0 {
+		return nil, nil, errors.New("infer: no columns found")
+	}
+	return s.table(rep), rep, nil
+}
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// sniffFormat peeks at the first non-space byte.
+func sniffFormat(br *bufio.Reader) string {
+	b, _ := br.Peek(512)
+	if t := bytes.TrimSpace(b); len(t) > 0 && t[0] == '{' {
+		return InferNDJSON
+	}
+	return InferCSV
+}
+
+// inferSample accumulates the sampled values per column.
+type inferSample struct {
+	opts  InferOptions
+	nulls map[string]bool
+	cols  []*inferColumn
+	index map[string]int
+	rows  int
+}
+
+type inferColumn struct {
+	*ColumnInference
+	values  map[string]int
+	matches map[string]int
+	invalid map[string][]string // first non-matching values per kind
+	nonNull int
+	json    bool
+	// for DECIMAL(p,s) and INT/BIGINT
+	intDigits, scale int
+	big              bool
+}
+
+func (s *inferSample) column(name string) *inferColumn {
+	if i, ok := s.index[name]; ok {
+		return s.cols[i]
+	}
+	c := &inferColumn{
+		ColumnInference: &ColumnInference{Name: name},
+		values:          make(map[string]int),
+		matches:         make(map[string]int),
+		invalid:         make(map[string][]string),
+	}
+	// a column first seen in a later NDJSON row was missing in the rows before
+	c.NullCount = s.rows
+	if s.index == nil {
+		s.index = make(map[string]int)
+	}
+	s.index[name] = len(s.cols)
+	s.cols = append(s.cols, c)
+	return c
+}
+
+func (s *inferSample) readCSV(br *bufio.Reader, rep *InferReport) error {
+	cr := csv.NewReader(br)
+	cr.Comma = s.opts.Comma
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("infer: read header: %w", err)
+	}
+	cols := make([]*inferColumn, len(header))
+	for i, h := range header {
+		cols[i] = s.column(s.uniqueName(strings.TrimSpace(h), i))
+	}
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("infer: %w", err)
+		}
+		if s.rows == s.opts.SampleSize {
+			rep.Sampled = true
+			return nil
+		}
+		s.rows++
+		for i, c := range cols {
+			if i < len(rec) && !s.nulls[rec[i]] {
+				c.observe(rec[i])
+			} else {
+				c.NullCount++
+			}
+		}
+	}
+}
+
+// uniqueName names empty headers column_<n> and suffixes duplicates.
+func (s *inferSample) uniqueName(name string, i int) string {
+	if name == "" {
+		name = fmt.Sprintf("column_%d", i+1)
+	}
+	base := name
+	for n := 2; ; n++ {
+		if _, taken := s.index[name]; !taken {
+			return name
+		}
+		name = fmt.Sprintf("%s_%d", base, n)
+	}
+}
+
+func (s *inferSample) readNDJSON(br *bufio.Reader, rep *InferReport) error {
+	line := 0
+	for {
+		raw, err := br.ReadBytes('\n')
+		if len(raw) > 0 {
+			line++
+			if t := bytes.TrimSpace(raw); len(t) > 0 {
+				if s.rows == s.opts.SampleSize {
+					rep.Sampled = true
+					return nil
+				}
+				if err := s.observeObject(t); err != nil {
+					return fmt.Errorf("infer: line %d: %w", line, err)
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("infer: %w", err)
+		}
+	}
+}
+
+// observeObject reads one NDJSON object, keeping the key order so columns
+// appear in the order they were first seen.
+func (s *inferSample) observeObject(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return errors.New("expected a JSON object")
+	}
+	seen := make(map[*inferColumn]bool)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		var v any
+		if err := dec.Decode(&v); err != nil {
+			return err
+		}
+		c := s.column(tok.(string))
+		if seen[c] {
+			continue
+		}
+		seen[c] = true
+		switch x := v.(type) {
+		case nil:
+		case string:
+			if !s.nulls[x] {
+				c.observe(x)
+				continue
+			}
+		case map[string]any, []any:
+			b, _ := json.Marshal(x)
+			c.json = true
+			c.observe(string(b))
+			continue
+		default:
+			c.observe(fmt.Sprint(x))
+			continue
+		}
+		c.NullCount++
+	}
+	for _, c := range s.cols {
+		if !seen[c] {
+			c.NullCount++
+		}
+	}
+	s.rows++
+	return nil
+}
+
+var (
+	inferIntPattern     = regexp.MustCompile(`^[+-]?(0|[1-9][0-9]*)$`)
+	inferDecimalPattern = regexp.MustCompile(`^[+-]?(0|[1-9][0-9]*)?\.([0-9]+)$`)
+	inferUUIDPattern    = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	inferDateLayouts    = []string{"2006-01-02", "2006/01/02"}
+	inferTimeLayouts    = []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02 15:04"}
+)
+
+func (c *inferColumn) observe(v string) {
+	c.nonNull++
+	c.values[v]++
+	l := utf8.RuneCountInString(v)
+	if c.nonNull == 1 || l < c.MinLength {
+		c.MinLength = l
+	}
+	if l > c.MaxLength {
+		c.MaxLength = l
+	}
+	for _, kind := range inferKinds {
+		if c.parses(kind, v) {
+			c.matches[kind]++
+		} else if len(c.invalid[kind]) < inferMaxInvalid {
+			c.invalid[kind] = append(c.invalid[kind], v)
+		}
+	}
+}
+
+// parses reports whether v is a value of kind, tracking the digits needed
+// for numeric types.
+func (c *inferColumn) parses(kind, v string) bool {
+	switch kind {
+	case InferBool:
+		switch strings.ToLower(v) {
+		case "true", "false", "yes", "no", "t", "f", "y", "n":
+			return true
+		}
+	case InferInt:
+		if !inferIntPattern.MatchString(v) {
+			return false
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return false
+		}
+		if n > 1<<31-1 || n < -1<<31 {
+			c.big = true
+		}
+		c.intDigits = max(c.intDigits, len(strings.TrimLeft(v, "+-")))
+		return true
+	case InferDecimal:
+		if inferIntPattern.MatchString(v) {
+			// InferInt skips integers beyond int64, count their digits here
+			c.intDigits = max(c.intDigits, len(strings.TrimLeft(v, "+-")))
+			return true
+		}
+		m := inferDecimalPattern.FindStringSubmatch(v)
+		if m == nil {
+			return false
+		}
+		c.intDigits = max(c.intDigits, len(m[1]))
+		c.scale = max(c.scale, len(m[2]))
+		return true
+	case InferDate:
+		return parsesAny(inferDateLayouts, v)
+	case InferTimestamp:
+		return parsesAny(inferTimeLayouts, v) || parsesAny(inferDateLayouts, v)
+	case InferUUID:
+		return inferUUIDPattern.MatchString(v)
+	}
+	return false
+}
+
+func parsesAny(layouts []string, v string) bool {
+	for _, l := range layouts {
+		if _, err := time.Parse(l, v); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// decide picks the column kind and fills in the report entry.
+func (c *inferColumn) decide(minRatio float64) {
+	c.DistinctCount = len(c.values)
+	switch {
+	case c.nonNull == 0:
+		c.Kind = InferText
+		c.Notes = append(c.Notes, "no values in the sample; type is a guess")
+		return
+	case c.json:
+		c.Kind, c.Confidence = InferJSON, 1
+		return
+	}
+	best, bestRatio := "", 0.0
+	for _, kind := range inferKinds {
+		ratio := float64(c.matches[kind]) / float64(c.nonNull)
+		if ratio >= minRatio {
+			c.Kind, c.Confidence = kind, round2(ratio)
+			if ratio < 1 {
+				c.Invalid = c.invalid[kind]
+			}
+			return
+		}
+		if ratio > bestRatio {
+			best, bestRatio = kind, ratio
+		}
+	}
+	c.Kind, c.Confidence = InferText, 1
+	if bestRatio >= 0.5 {
+		c.Notes = append(c.Notes, fmt.Sprintf("%.0f%% of values parse as %s; kept as text", bestRatio*100, best))
+		c.Invalid = c.invalid[best]
+	}
+}
+
+func round2(f float64) float64 {
+	return float64(int(f*100+0.5)) / 100
+}
+
+// sqlColumn maps the decided kind to a column definition.
+func (c *inferColumn) sqlColumn() *Column {
+	col := &Column{Name: c.Name, Nullable: c.NullCount > 0}
+	switch c.Kind {
+	case InferBool:
+		col.SQLType = SQLType{Name: "BOOL"}
+	case InferInt:
+		col.SQLType = SQLType{Name: "INT"}
+		if c.big {
+			col.SQLType.Name = "BIGINT"
+		}
+	case InferDecimal:
+		col.SQLType = SQLType{Name: "DECIMAL"}
+		col.Length, col.Length2 = int64(c.intDigits+c.scale), int64(c.scale)
+	case InferDate:
+		col.SQLType = SQLType{Name: "DATE"}
+	case InferTimestamp:
+		col.SQLType = SQLType{Name: "DATETIME"}
+	case InferUUID:
+		col.SQLType, col.Length = SQLType{Name: "CHAR"}, 36
+	case InferJSON:
+		col.SQLType, col.IsJSON = SQLType{Name: "TEXT"}, true
+	default:
+		switch {
+		case c.MaxLength > inferMaxVarchar:
+			col.SQLType = SQLType{Name: "TEXT"}
+		case c.nonNull > 1 && c.MinLength == c.MaxLength && c.MaxLength <= 16:
+			col.SQLType, col.Length = SQLType{Name: "CHAR"}, int64(c.MaxLength)
+		default:
+			col.SQLType, col.Length = SQLType{Name: "VARCHAR"}, varcharLength(c.MaxLength)
+		}
+	}
+	return col
+}
+
+// varcharLength leaves headroom above the longest sampled value: the next
+// power of two, at least 16 and at most inferMaxVarchar.
+func varcharLength(n int) int64 {
+	l := 16
+	for l < n {
+		l *= 2
+	}
+	return int64(min(l, inferMaxVarchar))
+}
+
+func (s *inferSample) table(rep *InferReport) *Table {
+	tb := NewEmptyTable()
+	tb.Name = s.opts.Name
+	rep.Rows = s.rows
+	pk := ""
+	for _, c := range s.cols {
+		c.decide(s.opts.MinMatchRatio)
+		rep.Columns = append(rep.Columns, c.ColumnInference)
+		col := c.sqlColumn()
+		tb.AddColumn(col)
+
+		keyKind := c.Kind == InferInt || c.Kind == InferUUID || c.Kind == InferText
+		if keyKind && s.rows > 0 && c.NullCount == 0 && c.DistinctCount == s.rows {
+			rep.CandidateKeys = append(rep.CandidateKeys, c.Name)
+			if pk == "" || strings.EqualFold(c.Name, "id") && !strings.EqualFold(pk, "id") {
+				pk = c.Name
+			}
+		}
+	}
+	if pk != "" {
+		tb.GetColumn(pk).IsPrimaryKey = true
+		tb.PrimaryKeys = []string{pk}
+	}
+	if s.rows < inferFewRows {
+		rep.Notes = append(rep.Notes, fmt.Sprintf("only %d rows sampled; types, nullability and keys are guesses", s.rows))
+	}
+	if rep.Sampled {
+		rep.Notes = append(rep.Notes, fmt.Sprintf("read the first %d rows; later rows may not fit", s.rows))
+	}
+	return tb
+}
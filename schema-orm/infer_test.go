@@ -0,0 +1,172 @@
+package schema_orm
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const inferCSVSample = "\xEF\xBB\xBFsku,code,price,qty,active,launched,updated_at,ref,name,,name\n" +
+	"1,007,9.99,10,yes,2024-01-31,2024-01-31T10:00:00Z,0c6f2a3e-5a8e-4f6b-9d7e-2b1c1a3e4f50,Widget,x,a\n" +
+	"2,008,19.5,3000000000,no,2024-02-01,2024-02-01 08:30:00,6b1f0f8e-3c2d-4b7a-8e9f-1a2b3c4d5e6f,Gizmo,,b\n" +
+	"3,009,120,,NULL,2024-02-02,2024-02-02,1d2c3b4a-5e6f-4a7b-8c9d-0e1f2a3b4c5d,Widget,y,c\n"
+
+func TestInferTable_CSV(t *testing.T) {
+	tb, rep, err := InferTable(strings.NewReader(inferCSVSample), InferOptions{Name: "product"})
+	if err != nil {
+		t.Fatalf("InferTable: %v", err)
+	}
+	if rep.Format != InferCSV || rep.Rows != 3 || tb.Name != "product" {
+		t.Fatalf("report: %+v", rep)
+	}
+	type def struct {
+		typ      string
+		len1     int64
+		len2     int64
+		nullable bool
+	}
+	want := map[string]def{
+		"sku":        {"INT", 0, 0, false},
+		"code":       {"CHAR", 3, 0, false}, // leading zeros keep it text
+		"price":      {"DECIMAL", 5, 2, false},
+		"qty":        {"BIGINT", 0, 0, true},
+		"active":     {"BOOL", 0, 0, true},
+		"launched":   {"DATE", 0, 0, false},
+		"updated_at": {"DATETIME", 0, 0, false},
+		"ref":        {"CHAR", 36, 0, false},
+		"name":       {"VARCHAR", 16, 0, false},
+		"column_10":  {"CHAR", 1, 0, true},
+		"name_2":     {"CHAR", 1, 0, false},
+	}
+	if len(tb.Columns) != len(want) {
+		t.Fatalf("columns: %v", tb.ColumnsSeq)
+	}
+	for _, c := range tb.Columns {
+		w, ok := want[c.Name]
+		if !ok || c.SQLType.Name != w.typ || c.Length != w.len1 || c.Length2 != w.len2 || c.Nullable != w.nullable {
+			t.Fatalf("%s: %s(%d,%d) nullable=%v", c.Name, c.SQLType.Name, c.Length, c.Length2, c.Nullable)
+		}
+	}
+	if !reflect.DeepEqual(rep.CandidateKeys, []string{"sku", "code", "ref", "name_2"}) || !reflect.DeepEqual(tb.PrimaryKeys, []string{"sku"}) {
+		t.Fatalf("keys: %v pk %v", rep.CandidateKeys, tb.PrimaryKeys)
+	}
+	if !tb.GetColumn("sku").IsPrimaryKey {
+		t.Fatal("sku is the primary key")
+	}
+	code := rep.Columns[1]
+	if code.Kind != InferText || len(code.Notes) != 0 {
+		t.Fatalf("code: %+v", code)
+	}
+	if updated := rep.Columns[6]; updated.Kind != InferTimestamp || updated.Confidence != 1 {
+		t.Fatalf("updated_at: %+v", updated)
+	}
+	if len(rep.Notes) != 1 || !strings.Contains(rep.Notes[0], "only 3 rows") {
+		t.Fatalf("notes: %v", rep.Notes)
+	}
+
+	// the proposal can be applied as is
+	eng, err := NewSQLiteEngine(BuildSQLiteDSN(""))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer eng.Close()
+	if err := ApplyTables(context.Background(), eng, []*Table{tb}); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+}
+
+func TestInferTable_BeyondInt64(t *testing.T) {
+	tb, _, err := InferTable(strings.NewReader("n\n12345678901234567890\n"), InferOptions{})
+	if err != nil {
+		t.Fatalf("InferTable: %v", err)
+	}
+	if c := tb.GetColumn("n"); c.SQLType.Name != "DECIMAL" || c.Length != 20 || c.Length2 != 0 {
+		t.Fatalf("n: %s(%d,%d)", c.SQLType.Name, c.Length, c.Length2)
+	}
+}
+
+func TestInferTable_MatchRatioAndSampling(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("id;amount\n")
+	for i := 0; i < 30; i++ {
+		if i == 7 {
+			b.WriteString("7;n/a\n")
+			continue
+		}
+		b.WriteString(strings.Repeat("1", i%3+1) + ";" + "12\n")
+	}
+	opts := InferOptions{Comma: ';', SampleSize: 20}
+	tb, rep, err := InferTable(strings.NewReader(b.String()), opts)
+	if err != nil {
+		t.Fatalf("InferTable: %v", err)
+	}
+	if !rep.Sampled || rep.Rows != 20 || len(rep.Notes) != 1 {
+		t.Fatalf("sampling: %+v", rep)
+	}
+	// 19 of 20 amounts are integers: enough at the default ratio
+	amount := rep.Columns[1]
+	if amount.Kind != InferInt || amount.Confidence != 0.95 || !reflect.DeepEqual(amount.Invalid, []string{"n/a"}) {
+		t.Fatalf("amount: %+v", amount)
+	}
+	if len(rep.CandidateKeys) != 0 || len(tb.PrimaryKeys) != 0 {
+		t.Fatalf("ids repeat, no key expected: %v", rep.CandidateKeys)
+	}
+
+	opts.MinMatchRatio = 1
+	_, rep, _ = InferTable(strings.NewReader(b.String()), opts)
+	if amount := rep.Columns[1]; amount.Kind != InferText || len(amount.Notes) != 1 || !strings.Contains(amount.Notes[0], "95% of values parse as int") {
+		t.Fatalf("strict amount: %+v", amount)
+	}
+}
+
+func TestInferTable_NDJSON(t *testing.T) {
+	in := `{"id": "a1", "score": 1.5, "tags": ["x"], "active": true}
+
+{"id": "a2", "score": 2, "active": false, "seen": "2024-03-01T12:00:00+01:00"}
+{"active": null, "id": "a3", "score": 10.25}
+`
+	tb, rep, err := InferTable(strings.NewReader(in), InferOptions{})
+	if err != nil {
+		t.Fatalf("InferTable: %v", err)
+	}
+	if rep.Format != InferNDJSON || rep.Rows != 3 || tb.Name != "inferred" {
+		t.Fatalf("report: %+v", rep)
+	}
+	if got := tb.ColumnsSeq; !reflect.DeepEqual(got, []string{"id", "score", "tags", "active", "seen"}) {
+		t.Fatalf("column order: %v", got)
+	}
+	check := func(name, typ string, nullable bool) {
+		t.Helper()
+		c := tb.GetColumn(name)
+		if c.SQLType.Name != typ || c.Nullable != nullable {
+			t.Fatalf("%s: %s nullable=%v", name, c.SQLType.Name, c.Nullable)
+		}
+	}
+	check("id", "CHAR", false)
+	check("score", "DECIMAL", false)
+	check("tags", "TEXT", true)
+	check("active", "BOOL", true)
+	check("seen", "DATETIME", true)
+	if c := tb.GetColumn("score"); c.Length != 4 || c.Length2 != 2 {
+		t.Fatalf("score: DECIMAL(%d,%d)", c.Length, c.Length2)
+	}
+	if !tb.GetColumn("tags").IsJSON || rep.Columns[2].Kind != InferJSON || rep.Columns[4].NullCount != 2 {
+		t.Fatalf("report columns: %+v %+v", rep.Columns[2], rep.Columns[4])
+	}
+	if !reflect.DeepEqual(tb.PrimaryKeys, []string{"id"}) {
+		t.Fatalf("pk: %v", tb.PrimaryKeys)
+	}
+
+	for _, bad := range []string{`{"id": 1`, `[1, 2]`} {
+		if _, _, err := InferTable(strings.NewReader(bad), InferOptions{Format: InferNDJSON}); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+	if _, _, err := InferTable(strings.NewReader(""), InferOptions{}); err == nil {
+		t.Fatal("expected error for empty input")
+	}
+	if _, _, err := InferTable(strings.NewReader("a"), InferOptions{Format: "xml"}); err == nil {
+		t.Fatal("expected error for unknown format")
+	}
+}
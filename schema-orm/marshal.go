@@ -2,6 +2,10 @@ package schema_orm
 
 import (
 	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -36,23 +40,93 @@ func (s *SQLType) UnmarshalYAML(value *yaml.Node) error {
 	return nil
 }
 
-// Column JSON/YAML
-func (col *Column) MarshalJSON() ([]byte, error) { return json.Marshal(columnAlias(*col)) }
+// Column JSON/YAML. TimeZone is written as the location name and loaded
+// back with time.LoadLocation, so only loadable locations (IANA names, "UTC",
+// "Local") can be encoded; fixed zones return an error instead of a document
+// that would decode to something else.
+type columnDoc struct {
+	columnAlias `yaml:",inline"`
+	TimeZone    zoneName `json:"timeZone,omitempty" yaml:"timeZone,omitempty"`
+}
+
+// zoneName is the encoded Column.TimeZone. Documents written before zones
+// were encoded by name hold an empty object there, as *time.Location has no
+// exported fields; it decodes as no zone, which is all those documents kept.
+type zoneName string
+
+func (z *zoneName) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '{' {
+		var legacy struct{}
+		if err := json.Unmarshal(b, &legacy); err != nil {
+			return err
+		}
+		*z = ""
+		return nil
+	}
+	return json.Unmarshal(b, (*string)(z))
+}
+
+func (z *zoneName) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.MappingNode && len(value.Content) == 0 {
+		*z = ""
+		return nil
+	}
+	return value.Decode((*string)(z))
+}
+
+func newColumnDoc(col *Column) (columnDoc, error) {
+	d := columnDoc{columnAlias: columnAlias(*col)}
+	if col.TimeZone != nil {
+		d.TimeZone = zoneName(col.TimeZone.String())
+		if _, err := time.LoadLocation(string(d.TimeZone)); err != nil {
+			return d, fmt.Errorf("column %s: time zone %q cannot be loaded by name", col.Name, d.TimeZone)
+		}
+	}
+	return d, nil
+}
+
+func (d columnDoc) column() (Column, error) {
+	col := Column(d.columnAlias)
+	if d.TimeZone != "" {
+		loc, err := time.LoadLocation(string(d.TimeZone))
+		if err != nil {
+			return col, fmt.Errorf("column %s: %w", col.Name, err)
+		}
+		col.TimeZone = loc
+	}
+	return col, nil
+}
+
+func (col *Column) MarshalJSON() ([]byte, error) {
+	d, err := newColumnDoc(col)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(d)
+}
 func (col *Column) UnmarshalJSON(b []byte) error {
-	var a columnAlias
-	if err := json.Unmarshal(b, &a); err != nil {
+	var d columnDoc
+	if err := json.Unmarshal(b, &d); err != nil {
+		return err
+	}
+	c, err := d.column()
+	if err != nil {
 		return err
 	}
-	*col = Column(a)
+	*col = c
 	return nil
 }
-func (col *Column) MarshalYAML() (interface{}, error) { return columnAlias(*col), nil }
+func (col *Column) MarshalYAML() (interface{}, error) { return newColumnDoc(col) }
 func (col *Column) UnmarshalYAML(value *yaml.Node) error {
-	var a columnAlias
-	if err := value.Decode(&a); err != nil {
+	var d columnDoc
+	if err := value.Decode(&d); err != nil {
 		return err
 	}
-	*col = Column(a)
+	c, err := d.column()
+	if err != nil {
+		return err
+	}
+	*col = c
 	return nil
 }
 
@@ -76,14 +150,20 @@ func (index *Index) UnmarshalYAML(value *yaml.Node) error {
 	return nil
 }
 
-// Table JSON/YAML uses a DTO to include unexported fields
+// Table JSON/YAML uses a DTO to include unexported fields. Decoding rebuilds
+// the table with AddColumn, so columnsSeq is derived from columns; the stored
+// primaryKeys keep their declared order. GoType names the struct type of
+// Table.Type, which is restored when it was registered with RegisterTableType.
 
 type tableDTO struct {
 	Name          string            `json:"name" yaml:"name"`
+	Schema        string            `json:"schema,omitempty" yaml:"schema,omitempty"`
+	GoType        string            `json:"goType,omitempty" yaml:"goType,omitempty"`
 	ColumnsSeq    []string          `json:"columnsSeq" yaml:"columnsSeq"`
 	Columns       []*Column         `json:"columns" yaml:"columns"`
 	Indexes       map[string]*Index `json:"indexes" yaml:"indexes"`
 	PrimaryKeys   []string          `json:"primaryKeys" yaml:"primaryKeys"`
+	ForeignKeys   []*ForeignKey     `json:"foreignKeys,omitempty" yaml:"foreignKeys,omitempty"`
 	AutoIncrement string            `json:"autoIncrement" yaml:"autoIncrement"`
 	Created       map[string]bool   `json:"created" yaml:"created"`
 	Updated       string            `json:"updated" yaml:"updated"`
@@ -93,15 +173,21 @@ type tableDTO struct {
 	Charset       string            `json:"charset" yaml:"charset"`
 	Comment       string            `json:"comment" yaml:"comment"`
 	Collation     string            `json:"collation" yaml:"collation"`
+	Profile       *TableProfile     `json:"profile,omitempty" yaml:"profile,omitempty"`
+	Provenance    *Provenance       `json:"provenance,omitempty" yaml:"provenance,omitempty"`
+	Metadata      *Metadata         `json:"metadata,omitempty" yaml:"metadata,omitempty"`
 }
 
-func (table *Table) MarshalJSON() ([]byte, error) {
-	d := tableDTO{
+func newTableDTO(table *Table) tableDTO {
+	return tableDTO{
 		Name:          table.Name,
+		Schema:        table.Schema,
+		GoType:        tableTypeName(table.Type),
 		ColumnsSeq:    append([]string(nil), table.ColumnsSeq...),
 		Columns:       append([]*Column(nil), table.Columns...),
 		Indexes:       table.Indexes,
 		PrimaryKeys:   append([]string(nil), table.PrimaryKeys...),
+		ForeignKeys:   table.ForeignKeys,
 		AutoIncrement: table.AutoIncrement,
 		Created:       table.Created,
 		Updated:       table.Updated,
@@ -111,22 +197,23 @@ func (table *Table) MarshalJSON() ([]byte, error) {
 		Charset:       table.Charset,
 		Comment:       table.Comment,
 		Collation:     table.Collation,
+		Profile:       table.Profile,
+		Provenance:    table.Provenance,
+		Metadata:      table.Metadata,
 	}
-	return json.Marshal(d)
 }
 
-func (table *Table) UnmarshalJSON(b []byte) error {
-	var d tableDTO
-	if err := json.Unmarshal(b, &d); err != nil {
-		return err
-	}
-	nt := NewTable(d.Name, nil)
-	nt.ColumnsSeq = append(nt.ColumnsSeq, d.ColumnsSeq...)
+func (d *tableDTO) table() *Table {
+	nt := NewTable(d.Name, lookupTableType(d.GoType))
+	nt.Schema = d.Schema
 	for _, c := range d.Columns {
 		nt.AddColumn(c)
 	}
+	if d.PrimaryKeys != nil {
+		nt.PrimaryKeys = d.PrimaryKeys
+	}
 	nt.Indexes = d.Indexes
-	nt.PrimaryKeys = append(nt.PrimaryKeys, d.PrimaryKeys...)
+	nt.ForeignKeys = d.ForeignKeys
 	nt.AutoIncrement = d.AutoIncrement
 	nt.Created = d.Created
 	nt.Updated = d.Updated
@@ -136,52 +223,66 @@ func (table *Table) UnmarshalJSON(b []byte) error {
 	nt.Charset = d.Charset
 	nt.Comment = d.Comment
 	nt.Collation = d.Collation
-	*table = *nt
-	return nil
+	nt.Profile = d.Profile
+	nt.Provenance = d.Provenance
+	nt.Metadata = d.Metadata
+	return nt
 }
 
-func (table *Table) MarshalYAML() (interface{}, error) {
-	d := tableDTO{
-		Name:          table.Name,
-		ColumnsSeq:    append([]string(nil), table.ColumnsSeq...),
-		Columns:       append([]*Column(nil), table.Columns...),
-		Indexes:       table.Indexes,
-		PrimaryKeys:   append([]string(nil), table.PrimaryKeys...),
-		AutoIncrement: table.AutoIncrement,
-		Created:       table.Created,
-		Updated:       table.Updated,
-		Deleted:       table.Deleted,
-		Version:       table.Version,
-		StoreEngine:   table.StoreEngine,
-		Charset:       table.Charset,
-		Comment:       table.Comment,
-		Collation:     table.Collation,
+func (table *Table) MarshalJSON() ([]byte, error) { return json.Marshal(newTableDTO(table)) }
+
+func (table *Table) UnmarshalJSON(b []byte) error {
+	var d tableDTO
+	if err := json.Unmarshal(b, &d); err != nil {
+		return err
 	}
-	return d, nil
+	*table = *d.table()
+	return nil
 }
 
+func (table *Table) MarshalYAML() (interface{}, error) { return newTableDTO(table), nil }
+
 func (table *Table) UnmarshalYAML(value *yaml.Node) error {
 	var d tableDTO
 	if err := value.Decode(&d); err != nil {
 		return err
 	}
-	nt := NewTable(d.Name, nil)
-	nt.ColumnsSeq = append(nt.ColumnsSeq, d.ColumnsSeq...)
-	for _, c := range d.Columns {
-		nt.AddColumn(c)
+	*table = *d.table()
+	return nil
+}
+
+// tableTypes maps the names written as goType to registered struct types.
+var tableTypes sync.Map
+
+// RegisterTableType makes the struct type of bean (a struct or a pointer to
+// one) known to the table decoders, so a table whose Type is that struct
+// decodes with Type set again. Tables of unregistered types decode with a nil
+// Type.
+func RegisterTableType(bean any) {
+	t := reflect.TypeOf(bean)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	tableTypes.Store(tableTypeName(t), t)
+}
+
+// tableTypeName is the package path qualified name of t, or "" for nil.
+func tableTypeName(t reflect.Type) string {
+	switch {
+	case t == nil:
+		return ""
+	case t.Name() == "":
+		return t.String()
+	case t.PkgPath() == "":
+		return t.Name()
+	}
+	return t.PkgPath() + "." + t.Name()
+}
+
+func lookupTableType(name string) reflect.Type {
+	if t, ok := tableTypes.Load(name); ok {
+		return t.(reflect.Type)
 	}
-	nt.Indexes = d.Indexes
-	nt.PrimaryKeys = append(nt.PrimaryKeys, d.PrimaryKeys...)
-	nt.AutoIncrement = d.AutoIncrement
-	nt.Created = d.Created
-	nt.Updated = d.Updated
-	nt.Deleted = d.Deleted
-	nt.Version = d.Version
-	nt.StoreEngine = d.StoreEngine
-	nt.Charset = d.Charset
-	nt.Comment = d.Comment
-	nt.Collation = d.Collation
-	*table = *nt
 	return nil
 }
 
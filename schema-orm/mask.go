@@ -0,0 +1,294 @@
+package schema_orm
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MaskMethod is how a column's values are replaced when data leaves the
+// production database.
+type MaskMethod string
+
+const (
+	// MaskKeep copies values unchanged.
+	MaskKeep MaskMethod = "keep"
+	// MaskHash replaces values with the hex HMAC-SHA256 of the value.
+	MaskHash MaskMethod = "hash"
+	// MaskTokenize replaces values with a short "tok_" token.
+	MaskTokenize MaskMethod = "tokenize"
+	// MaskFake replaces letters and digits with others of the same class,
+	// keeping the format; emails keep their shape under example.com and IBANs
+	// get valid check digits.
+	MaskFake MaskMethod = "fake"
+	// MaskNull replaces values with NULL; the column must be nullable.
+	MaskNull MaskMethod = "null"
+)
+
+// MaskRule sets the method of one column. An empty Table matches the column
+// in every table; table and column names are compared ignoring case.
+type MaskRule struct {
+	Table  string     `json:"table,omitempty" yaml:"table,omitempty"`
+	Column string     `json:"column" yaml:"column"`
+	Method MaskMethod `json:"method" yaml:"method"`
+}
+
+// MaskPolicy decides how every column is masked. A column's method is the
+// first matching Rule; otherwise, for columns with a PII classification
+// (other than PIINone), the method for its kind in Kinds, then Default;
+// otherwise MaskKeep.
+//
+// All methods are deterministic for a given Secret: the same value is masked
+// the same way in every table and run, so joins on masked columns still
+// match. Secret keys the HMAC used by hash, tokenize and fake and is
+// required when any of them is used, because unkeyed hashes of emails or
+// phone numbers are easily reversed by brute force.
+type MaskPolicy struct {
+	Secret  string                 `json:"secret,omitempty" yaml:"secret,omitempty"`
+	Default MaskMethod             `json:"default,omitempty" yaml:"default,omitempty"`
+	Kinds   map[PIIKind]MaskMethod `json:"kinds,omitempty" yaml:"kinds,omitempty"`
+	Rules   []MaskRule             `json:"rules,omitempty" yaml:"rules,omitempty"`
+}
+
+// ParseMaskPolicy decodes a policy from JSON or YAML content.
+func ParseMaskPolicy(data []byte) (*MaskPolicy, error) {
+	trimmed := bytes.TrimSpace(data)
+	p := &MaskPolicy{}
+	var err error
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		err = json.Unmarshal(trimmed, p)
+	} else {
+		err = yaml.Unmarshal(trimmed, p)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse mask policy: %w", err)
+	}
+	return p, nil
+}
+
+// LoadMaskPolicy reads a policy file.
+func LoadMaskPolicy(path string) (*MaskPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseMaskPolicy(data)
+}
+
+// Method returns the method for a column of tb. A nil policy keeps everything.
+func (p *MaskPolicy) Method(tb *Table, col *Column) MaskMethod {
+	if p == nil {
+		return MaskKeep
+	}
+	for _, r := range p.Rules {
+		if strings.EqualFold(r.Column, col.Name) &&
+			(r.Table == "" || strings.EqualFold(r.Table, tb.FullName()) || strings.EqualFold(r.Table, tb.Name)) {
+			return r.Method
+		}
+	}
+	if col.Metadata != nil && col.Metadata.PII != nil && col.Metadata.PII.Kind != PIINone {
+		if m, ok := p.Kinds[col.Metadata.PII.Kind]; ok {
+			return m
+		}
+		if p.Default != "" {
+			return p.Default
+		}
+	}
+	return MaskKeep
+}
+
+// RowMasker masks rows of one table whose values are in Table.Columns order.
+type RowMasker struct {
+	masks []func(v any) any
+}
+
+// NewRowMasker resolves the policy for every column of tb. It fails for
+// unknown methods, for MaskNull on NOT NULL columns, for hash and tokenize on
+// numeric columns and when a keyed method is used without a Secret.
+func NewRowMasker(policy *MaskPolicy, tb *Table) (*RowMasker, error) {
+	rm := &RowMasker{masks: make([]func(any) any, len(tb.Columns))}
+	for i, c := range tb.Columns {
+		method := policy.Method(tb, c)
+		var kind PIIKind
+		if c.Metadata != nil && c.Metadata.PII != nil {
+			kind = c.Metadata.PII.Kind
+		}
+		switch method {
+		case "", MaskKeep:
+			continue
+		case MaskNull:
+			if !c.Nullable || c.IsPrimaryKey {
+				return nil, fmt.Errorf("mask %s.%s: cannot null out NOT NULL column", tb.FullName(), c.Name)
+			}
+			rm.masks[i] = func(any) any { return nil }
+			continue
+		case MaskHash, MaskTokenize:
+			if c.SQLType.IsNumeric() {
+				return nil, fmt.Errorf("mask %s.%s: %s needs a text column, use fake", tb.FullName(), c.Name, method)
+			}
+		case MaskFake:
+		default:
+			return nil, fmt.Errorf("mask %s.%s: unknown method %q", tb.FullName(), c.Name, method)
+		}
+		if policy.Secret == "" {
+			return nil, fmt.Errorf("mask %s.%s: %s needs a policy secret", tb.FullName(), c.Name, method)
+		}
+		m := &masker{key: []byte(policy.Secret), method: method, kind: kind, length: int(c.Length)}
+		rm.masks[i] = m.mask
+	}
+	return rm, nil
+}
+
+// Mask replaces the values of masked columns in place. NULLs stay NULL.
+func (rm *RowMasker) Mask(row []any) {
+	for i, f := range rm.masks {
+		if f != nil && i < len(row) && row[i] != nil {
+			row[i] = f(row[i])
+		}
+	}
+}
+
+// Masks reports whether any column is masked.
+func (rm *RowMasker) Masks() bool {
+	for _, f := range rm.masks {
+		if f != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// masker masks the values of one column.
+type masker struct {
+	key    []byte
+	method MaskMethod
+	kind   PIIKind
+	length int
+}
+
+func (m *masker) mask(v any) any {
+	s := profileString(v)
+	switch m.method {
+	case MaskHash:
+		return m.truncate(hex.EncodeToString(m.mac(s)))
+	case MaskTokenize:
+		return m.truncate("tok_" + strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(m.mac("token:" + s)[:10])))
+	}
+	out := m.fake(s)
+	if _, ok := v.(int64); ok {
+		if n, err := strconv.ParseInt(out, 10, 64); err == nil {
+			return n
+		}
+	}
+	return out
+}
+
+func (m *masker) mac(s string) []byte {
+	h := hmac.New(sha256.New, m.key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
+
+// truncate cuts a masked value to the column length, if there is one.
+func (m *masker) truncate(s string) string {
+	if m.length > 0 && len(s) > m.length {
+		return s[:m.length]
+	}
+	return s
+}
+
+func (m *masker) fake(s string) string {
+	r := &maskStream{key: m.key, seed: s}
+	switch m.kind {
+	case PIIEmail:
+		if at := strings.LastIndexByte(s, '@'); at > 0 {
+			return fakeChars(s[:at], r) + "@example.com"
+		}
+	case PIIIBAN:
+		if isIBAN(s) {
+			return fakeIBAN(s, r)
+		}
+	}
+	return fakeChars(s, r)
+}
+
+// fakeChars replaces digits with digits and letters with ASCII letters of the
+// same case; everything else is kept. A leading "+" and the first digit of a
+// number stay non-zero where they were.
+func fakeChars(s string, r *maskStream) string {
+	var b strings.Builder
+	first := true
+	for _, c := range s {
+		switch {
+		case unicode.IsDigit(c):
+			d := r.next() % 10
+			if first && c != '0' && d == 0 {
+				d = 1 + r.next()%9
+			}
+			b.WriteByte('0' + d)
+		case unicode.IsUpper(c):
+			b.WriteByte('A' + r.next()%26)
+		case unicode.IsLetter(c):
+			b.WriteByte('a' + r.next()%26)
+		default:
+			b.WriteRune(c)
+			continue
+		}
+		first = false
+	}
+	return b.String()
+}
+
+// fakeIBAN keeps the country code and the spacing, fakes the account part
+// and recomputes the check digits so the result is a valid IBAN.
+func fakeIBAN(s string, r *maskStream) string {
+	compact := strings.ToUpper(strings.ReplaceAll(s, " ", ""))
+	bban := fakeChars(compact[4:], r)
+	check := 98 - ibanRemainder(bban+compact[:2]+"00")
+	out := []byte(fmt.Sprintf("%s%02d%s", compact[:2], check, bban))
+	var b strings.Builder
+	i := 0
+	for _, c := range s {
+		if c == ' ' {
+			b.WriteByte(' ')
+			continue
+		}
+		b.WriteByte(out[i])
+		i++
+	}
+	return b.String()
+}
+
+// maskStream is a deterministic byte stream derived from the key and a seed.
+type maskStream struct {
+	key  []byte
+	seed string
+	buf  []byte
+	n    uint64
+}
+
+func (r *maskStream) next() byte {
+	if len(r.buf) == 0 {
+		h := hmac.New(sha256.New, r.key)
+		var ctr [8]byte
+		binary.BigEndian.PutUint64(ctr[:], r.n)
+		h.Write(ctr[:])
+		h.Write([]byte(r.seed))
+		r.buf = h.Sum(nil)
+		r.n++
+	}
+	b := r.buf[0]
+	r.buf = r.buf[1:]
+	return b
+}
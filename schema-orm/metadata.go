@@ -0,0 +1,234 @@
+package schema_orm
+
+import (
+	"slices"
+	"strings"
+)
+
+// Sensitivity classifies the data of a table or column. The constants are
+// the levels used across MDM; other values are kept as-is.
+type Sensitivity string
+
+const (
+	SensitivityPublic       Sensitivity = "public"
+	SensitivityInternal     Sensitivity = "internal"
+	SensitivityConfidential Sensitivity = "confidential"
+	SensitivityRestricted   Sensitivity = "restricted"
+)
+
+// Metadata is business metadata of a table or column that the database and
+// xorm do not store. Labels and Descriptions map language tags ("en",
+// "zh-CN") to text; Unit is the unit of measure of a column's values. PII is
+// the personal data classification set by DetectPII or by hand. Extra holds
+// any further attributes and must be JSON/YAML encodable.
+type Metadata struct {
+	Labels       map[string]string  `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Descriptions map[string]string  `json:"descriptions,omitempty" yaml:"descriptions,omitempty"`
+	Owner        string             `json:"owner,omitempty" yaml:"owner,omitempty"`
+	Steward      string             `json:"steward,omitempty" yaml:"steward,omitempty"`
+	Sensitivity  Sensitivity        `json:"sensitivity,omitempty" yaml:"sensitivity,omitempty"`
+	Tags         []string           `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Unit         string             `json:"unit,omitempty" yaml:"unit,omitempty"`
+	PII          *PIIClassification `json:"pii,omitempty" yaml:"pii,omitempty"`
+	Extra        map[string]any     `json:"extra,omitempty" yaml:"extra,omitempty"`
+}
+
+// Label returns the label in lang, falling back to its base language
+// ("zh" for "zh-CN") and then to the label with an empty tag.
+func (m *Metadata) Label(lang string) string {
+	if m == nil {
+		return ""
+	}
+	return localized(m.Labels, lang)
+}
+
+// Description returns the description in lang, with the fallbacks of Label.
+func (m *Metadata) Description(lang string) string {
+	if m == nil {
+		return ""
+	}
+	return localized(m.Descriptions, lang)
+}
+
+func localized(texts map[string]string, lang string) string {
+	for _, l := range []string{lang, strings.SplitN(lang, "-", 2)[0], ""} {
+		for k, v := range texts {
+			if strings.EqualFold(k, l) {
+				return v
+			}
+		}
+	}
+	return ""
+}
+
+// HasTag reports whether the metadata carries tag, ignoring case.
+func (m *Metadata) HasTag(tag string) bool {
+	if m == nil {
+		return false
+	}
+	return slices.ContainsFunc(m.Tags, func(t string) bool { return strings.EqualFold(t, tag) })
+}
+
+// IsEmpty reports whether no attribute is set.
+func (m *Metadata) IsEmpty() bool {
+	return m == nil || len(m.Labels) == 0 && len(m.Descriptions) == 0 && m.Owner == "" && m.Steward == "" &&
+		m.Sensitivity == "" && len(m.Tags) == 0 && m.Unit == "" && m.PII == nil && len(m.Extra) == 0
+}
+
+// Clone returns a deep copy; nil stays nil.
+func (m *Metadata) Clone() *Metadata {
+	if m == nil {
+		return nil
+	}
+	c := *m
+	c.Labels = cloneStrings(m.Labels)
+	c.Descriptions = cloneStrings(m.Descriptions)
+	c.Tags = slices.Clone(m.Tags)
+	if m.PII != nil {
+		pii := *m.PII
+		pii.Signals = slices.Clone(m.PII.Signals)
+		c.PII = &pii
+	}
+	if m.Extra != nil {
+		c.Extra = cloneValue(m.Extra).(map[string]any)
+	}
+	return &c
+}
+
+func cloneStrings(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// cloneValue deep copies the maps and slices decoded from JSON or YAML.
+func cloneValue(v any) any {
+	switch x := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(x))
+		for k, e := range x {
+			out[k] = cloneValue(e)
+		}
+		return out
+	case []any:
+		out := make([]any, len(x))
+		for i, e := range x {
+			out[i] = cloneValue(e)
+		}
+		return out
+	}
+	return v
+}
+
+// Merge copies the attributes of src into m. Tags are united; labels,
+// descriptions and extra attributes are merged per key. Values already set in
+// m are kept unless overwrite is true.
+func (m *Metadata) Merge(src *Metadata, overwrite bool) {
+	if src == nil {
+		return
+	}
+	src = src.Clone()
+	setString := func(dst *string, v string) {
+		if v != "" && (overwrite || *dst == "") {
+			*dst = v
+		}
+	}
+	setString(&m.Owner, src.Owner)
+	setString(&m.Steward, src.Steward)
+	setString(&m.Unit, src.Unit)
+	if src.Sensitivity != "" && (overwrite || m.Sensitivity == "") {
+		m.Sensitivity = src.Sensitivity
+	}
+	if src.PII != nil && (overwrite || m.PII == nil) {
+		m.PII = src.PII
+	}
+	m.Labels = mergeMap(m.Labels, src.Labels, overwrite)
+	m.Descriptions = mergeMap(m.Descriptions, src.Descriptions, overwrite)
+	m.Extra = mergeMap(m.Extra, src.Extra, overwrite)
+	for _, t := range src.Tags {
+		if !m.HasTag(t) {
+			m.Tags = append(m.Tags, t)
+		}
+	}
+}
+
+func mergeMap[V any](dst, src map[string]V, overwrite bool) map[string]V {
+	for k, v := range src {
+		if dst == nil {
+			dst = make(map[string]V, len(src))
+		}
+		if _, ok := dst[k]; overwrite || !ok {
+			dst[k] = v
+		}
+	}
+	return dst
+}
+
+// MetadataOrphan is curated metadata that MergeMetadata could not place
+// because its table or column (empty Column for the table itself) no longer
+// exists, usually after a rename.
+type MetadataOrphan struct {
+	Table  string `json:"table" yaml:"table"`
+	Column string `json:"column,omitempty" yaml:"column,omitempty"`
+}
+
+// MergeMetadata copies the metadata of curated tables (e.g. a maintained
+// bundle) onto the matching tables of dst (e.g. freshly exported from the
+// database). Tables match on FullName and columns on name, both ignoring
+// case. Metadata already present in dst is kept unless overwrite is true.
+// Metadata whose table or column is missing in dst is returned as orphans.
+func MergeMetadata(dst, curated []*Table, overwrite bool) []MetadataOrphan {
+	var orphans []MetadataOrphan
+	for _, src := range curated {
+		if src == nil {
+			continue
+		}
+		var tb *Table
+		for _, t := range dst {
+			if t != nil && strings.EqualFold(t.FullName(), src.FullName()) {
+				tb = t
+				break
+			}
+		}
+		if tb == nil {
+			if !src.Metadata.IsEmpty() {
+				orphans = append(orphans, MetadataOrphan{Table: src.FullName()})
+			}
+			for _, c := range src.Columns {
+				if !c.Metadata.IsEmpty() {
+					orphans = append(orphans, MetadataOrphan{Table: src.FullName(), Column: c.Name})
+				}
+			}
+			continue
+		}
+		tb.Metadata = mergeMetadata(tb.Metadata, src.Metadata, overwrite)
+		for _, c := range src.Columns {
+			if c.Metadata.IsEmpty() {
+				continue
+			}
+			i := columnIndex(tb.Columns, c.Name)
+			if i < 0 {
+				orphans = append(orphans, MetadataOrphan{Table: src.FullName(), Column: c.Name})
+				continue
+			}
+			tb.Columns[i].Metadata = mergeMetadata(tb.Columns[i].Metadata, c.Metadata, overwrite)
+		}
+	}
+	return orphans
+}
+
+func mergeMetadata(dst, src *Metadata, overwrite bool) *Metadata {
+	if src.IsEmpty() {
+		return dst
+	}
+	if dst == nil {
+		return src.Clone()
+	}
+	dst.Merge(src, overwrite)
+	return dst
+}
@@ -0,0 +1,204 @@
+package schema_orm
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func metadataTable() *Table {
+	tb := NewEmptyTable()
+	tb.Name = "customer"
+	tb.Metadata = &Metadata{
+		Labels:       map[string]string{"en": "Customer", "zh-CN": "客户"},
+		Descriptions: map[string]string{"": "Golden customer record"},
+		Owner:        "sales",
+		Steward:      "jane.doe",
+		Sensitivity:  SensitivityInternal,
+		Tags:         []string{"golden", "crm"},
+		Extra:        map[string]any{"retention": map[string]any{"years": 7}},
+	}
+	tb.AddColumn(&Column{Name: "id", SQLType: SQLType{Name: "BIGINT"}, IsPrimaryKey: true})
+	tb.AddColumn(&Column{Name: "credit_limit", SQLType: SQLType{Name: "DECIMAL"}, Length: 12, Length2: 2,
+		Metadata: &Metadata{Labels: map[string]string{"en": "Credit limit"}, Unit: "EUR", Sensitivity: SensitivityConfidential}})
+	tb.PrimaryKeys = []string{"id"}
+	return tb
+}
+
+func TestMetadata_Label(t *testing.T) {
+	md := metadataTable().Metadata
+	cases := map[string]string{"en": "Customer", "EN": "Customer", "zh-CN": "客户", "en-GB": "Customer", "fr": ""}
+	for lang, want := range cases {
+		if got := md.Label(lang); got != want {
+			t.Fatalf("Label(%q) = %q, want %q", lang, got, want)
+		}
+	}
+	if got := md.Description("de"); got != "Golden customer record" {
+		t.Fatalf("Description fallback = %q", got)
+	}
+	var none *Metadata
+	if none.Label("en") != "" || none.HasTag("x") || !none.IsEmpty() || none.Clone() != nil {
+		t.Fatal("nil metadata should be empty")
+	}
+	if !md.HasTag("CRM") || md.HasTag("pii") {
+		t.Fatal("HasTag")
+	}
+}
+
+func TestMetadata_Merge(t *testing.T) {
+	dst := &Metadata{Owner: "ops", Labels: map[string]string{"en": "Client"}, Tags: []string{"crm"}}
+	src := metadataTable().Metadata
+	dst.Merge(src, false)
+	if dst.Owner != "ops" || dst.Steward != "jane.doe" || dst.Label("en") != "Client" || dst.Label("zh-CN") != "客户" {
+		t.Fatalf("merge keeping values: %+v", dst)
+	}
+	if !reflect.DeepEqual(dst.Tags, []string{"crm", "golden"}) {
+		t.Fatalf("tags = %v", dst.Tags)
+	}
+	dst.Merge(src, true)
+	if dst.Owner != "sales" || dst.Label("en") != "Customer" {
+		t.Fatalf("merge overwriting: %+v", dst)
+	}
+	// merged values are copies
+	dst.Extra["retention"].(map[string]any)["years"] = 1
+	if src.Extra["retention"].(map[string]any)["years"] != 7 {
+		t.Fatal("merge must not share nested values")
+	}
+}
+
+func TestMetadata_SerializationRoundTrip(t *testing.T) {
+	tb := metadataTable()
+	b, err := json.Marshal(tb)
+	if err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	var fromJSON Table
+	if err := json.Unmarshal(b, &fromJSON); err != nil {
+		t.Fatalf("json decode: %v", err)
+	}
+	y, err := yaml.Marshal(tb)
+	if err != nil {
+		t.Fatalf("yaml: %v", err)
+	}
+	var fromYAML Table
+	if err := yaml.Unmarshal(y, &fromYAML); err != nil {
+		t.Fatalf("yaml decode: %v", err)
+	}
+	for name, got := range map[string]*Table{"json": &fromJSON, "yaml": &fromYAML} {
+		if got.Metadata.Owner != "sales" || got.Metadata.Label("zh-CN") != "客户" || got.Metadata.Sensitivity != SensitivityInternal {
+			t.Fatalf("%s: table metadata %+v", name, got.Metadata)
+		}
+		if years := got.Metadata.Extra["retention"].(map[string]any)["years"]; years != 7 && years != float64(7) {
+			t.Fatalf("%s: extra %v", name, got.Metadata.Extra)
+		}
+		if md := got.GetColumn("credit_limit").Metadata; md.Unit != "EUR" || md.Label("en") != "Credit limit" {
+			t.Fatalf("%s: column metadata %+v", name, md)
+		}
+	}
+}
+
+func TestMetadata_XormRoundTrip(t *testing.T) {
+	tb := metadataTable()
+	x := ToXormTable(tb)
+	tb.Metadata.Owner = "changed after conversion"
+
+	back := FromXormTable(x)
+	if !reflect.DeepEqual(back.Metadata, metadataTable().Metadata) {
+		t.Fatalf("table metadata = %+v", back.Metadata)
+	}
+	if md := back.GetColumn("credit_limit").Metadata; md == nil || md.Unit != "EUR" {
+		t.Fatalf("column metadata = %+v", md)
+	}
+	if back.GetColumn("id").Metadata != nil {
+		t.Fatal("id has no metadata")
+	}
+	// restored metadata is not shared between conversions
+	back.Metadata.Tags[0] = "x"
+	if FromXormTable(x).Metadata.Tags[0] != "golden" {
+		t.Fatal("restored metadata must be a copy")
+	}
+	if c := FromXormColumn(ToXormColumn(tb.GetColumn("credit_limit"))); c.Metadata.Unit != "EUR" {
+		t.Fatalf("column round trip: %+v", c.Metadata)
+	}
+	// dropping what xorm has no room for is opt-in
+	lossy := FromXormTable(ToXormTableWith(metadataTable(), ConvertOptions{DropExtras: true}))
+	if lossy.Metadata != nil || lossy.GetColumn("credit_limit").Metadata != nil {
+		t.Fatalf("DropExtras kept metadata: %+v", lossy.Metadata)
+	}
+	if c := FromXormColumn(ToXormColumnWith(tb.GetColumn("credit_limit"), ConvertOptions{DropExtras: true})); c.Metadata != nil {
+		t.Fatalf("DropExtras kept column metadata: %+v", c.Metadata)
+	}
+}
+
+func TestMergeMetadata_Introspected(t *testing.T) {
+	introspected := dictionaryFixture(t)
+	for _, tb := range introspected {
+		tb.Metadata = nil
+		for _, c := range tb.Columns {
+			c.Metadata = nil
+		}
+	}
+	sup := NewEmptyTable()
+	sup.Name = "SUPPLIER"
+	sup.Metadata = &Metadata{Owner: "procurement"}
+	sup.AddColumn(&Column{Name: "Name", Metadata: &Metadata{Labels: map[string]string{"en": "Supplier name"}}})
+	sup.AddColumn(&Column{Name: "vat_no", Metadata: &Metadata{Sensitivity: SensitivityConfidential}})
+	sup.AddColumn(&Column{Name: "parent_id"})
+	gone := NewEmptyTable()
+	gone.Name = "vendor"
+	gone.Metadata = &Metadata{Owner: "legacy"}
+
+	orphans := MergeMetadata(introspected, []*Table{sup, gone}, false)
+	want := []MetadataOrphan{{Table: "SUPPLIER", Column: "vat_no"}, {Table: "vendor"}}
+	if !reflect.DeepEqual(orphans, want) {
+		t.Fatalf("orphans = %+v", orphans)
+	}
+	for _, tb := range introspected {
+		if tb.Name != "supplier" {
+			continue
+		}
+		if tb.Metadata.Owner != "procurement" || tb.GetColumn("name").Metadata.Label("en") != "Supplier name" {
+			t.Fatalf("merged supplier: %+v %+v", tb.Metadata, tb.GetColumn("name").Metadata)
+		}
+		if tb.GetColumn("parent_id").Metadata != nil {
+			t.Fatal("columns without curated metadata stay bare")
+		}
+		tb.Metadata.Owner = "it"
+	}
+	MergeMetadata(introspected, []*Table{sup}, false)
+	for _, tb := range introspected {
+		if tb.Name == "supplier" && tb.Metadata.Owner != "it" {
+			t.Fatal("existing metadata must win without overwrite")
+		}
+	}
+}
+
+func TestMergeOverlays_Metadata(t *testing.T) {
+	layer := &Layer{Name: "stewardship", Tables: []*TableOverlay{{
+		Name: "customer",
+		Override: &Table{
+			Metadata: &Metadata{Steward: "john.roe", Tags: []string{"pii"}},
+			Columns:  []*Column{{Name: "credit_limit", Metadata: &Metadata{Unit: "USD"}}},
+		},
+	}}}
+	base := []*Table{metadataTable()}
+	res := MergeOverlays(base, layer)
+	if err := res.Err(); err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	got := res.Tables[0]
+	if got.Metadata.Steward != "john.roe" || got.Metadata.Owner != "sales" || !got.Metadata.HasTag("pii") {
+		t.Fatalf("table metadata: %+v", got.Metadata)
+	}
+	if md := got.GetColumn("credit_limit").Metadata; md.Unit != "USD" || md.Label("en") != "Credit limit" {
+		t.Fatalf("column metadata: %+v", md)
+	}
+	if got.Provenance.Attributes["metadata"] != "stewardship" {
+		t.Fatalf("provenance: %+v", got.Provenance.Attributes)
+	}
+	if base[0].Metadata.Steward != "jane.doe" || base[0].GetColumn("credit_limit").Metadata.Unit != "EUR" {
+		t.Fatal("base tables must not change")
+	}
+}
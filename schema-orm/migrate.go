@@ -0,0 +1,208 @@
+package schema_orm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"xorm.io/xorm"
+	"xorm.io/xorm/dialects"
+	xs "xorm.io/xorm/schemas"
+)
+
+// MigrationStep is one DDL statement of a migration. Destructive steps drop
+// data or may fail on rows that no longer fit.
+type MigrationStep struct {
+	SQL         string `json:"sql" yaml:"sql"`
+	Destructive bool   `json:"destructive,omitempty" yaml:"destructive,omitempty"`
+}
+
+// MigrationPlan is the DDL that turns one schema version into another.
+// Manual lists the differences no statement is generated for, such as a
+// changed primary key or a column change SQLite cannot express; a plan with
+// manual work is not applied.
+type MigrationPlan struct {
+	Steps   []MigrationStep `json:"steps" yaml:"steps"`
+	Manual  []string        `json:"manual,omitempty" yaml:"manual,omitempty"`
+	Changes []SchemaChange  `json:"changes" yaml:"changes"`
+}
+
+// SQL returns the statements of the plan in order.
+func (p *MigrationPlan) SQL() []string {
+	out := make([]string, len(p.Steps))
+	for i, s := range p.Steps {
+		out[i] = s.SQL
+	}
+	return out
+}
+
+// Destructive reports whether any step drops data or may fail on existing rows.
+func (p *MigrationPlan) Destructive() bool {
+	return slices.ContainsFunc(p.Steps, func(s MigrationStep) bool { return s.Destructive })
+}
+
+// PlanMigration renders the DDL that migrates the from tables to the to
+// tables in the dialect of the engine, based on DiffSchemas plus a
+// comparison of the indexes. New tables are created with their indexes;
+// per existing table, changed and removed indexes are dropped first, then
+// columns are added, altered and dropped, and new indexes created; removed
+// tables are dropped last. Foreign keys are not migrated.
+func PlanMigration(ctx context.Context, engine *xorm.Engine, from, to []*Table, naming *Naming) (*MigrationPlan, error) {
+	namer, err := naming.IndexNamer()
+	if err != nil {
+		return nil, err
+	}
+	plan := &MigrationPlan{Changes: DiffSchemas(from, to)}
+	dialect := engine.Dialect()
+	xormNames := naming.defaultIndexNames()
+
+	find := func(tables []*Table, name string) *Table {
+		for _, t := range tables {
+			if t != nil && strings.EqualFold(t.FullName(), name) {
+				return t
+			}
+		}
+		return nil
+	}
+	for _, nt := range to {
+		if nt == nil {
+			continue
+		}
+		ot := find(from, nt.FullName())
+		if ot == nil {
+			sqls, err := CreateTableSQLsWithNaming(ctx, engine, []*Table{nt}, naming)
+			if err != nil {
+				return nil, err
+			}
+			for _, s := range sqls {
+				plan.Steps = append(plan.Steps, MigrationStep{SQL: s})
+			}
+			continue
+		}
+		plan.alterTable(dialect, ot, nt, namer, xormNames)
+	}
+	for _, ot := range from {
+		if ot != nil && find(to, ot.FullName()) == nil {
+			s, _ := dialect.DropTableSQL(ot.FullName())
+			plan.Steps = append(plan.Steps, MigrationStep{SQL: s, Destructive: true})
+		}
+	}
+	return plan, nil
+}
+
+func (p *MigrationPlan) alterTable(dialect dialects.Dialect, ot, nt *Table, namer IndexNamer, xormNames bool) {
+	table := nt.FullName()
+	quote := dialect.Quoter().Quote
+	sqlite := dialect.URI().DBType == xs.SQLITE
+
+	var created []*Index
+	for _, key := range slices.Sorted(maps.Keys(ot.Indexes)) {
+		oi := ot.Indexes[key]
+		ni := nt.Indexes[indexKey(nt, oi.Name)]
+		if ni != nil && ni.Type == oi.Type && equalFoldSlices(ni.Cols, oi.Cols) {
+			continue
+		}
+		p.Steps = append(p.Steps, MigrationStep{SQL: dropIndexSQL(dialect, table, oi, namer, xormNames)})
+	}
+	for _, key := range slices.Sorted(maps.Keys(nt.Indexes)) {
+		ni := nt.Indexes[key]
+		oi := ot.Indexes[indexKey(ot, ni.Name)]
+		if oi == nil || oi.Type != ni.Type || !equalFoldSlices(ni.Cols, oi.Cols) {
+			created = append(created, ni)
+		}
+	}
+
+	for _, nc := range nt.Columns {
+		i := columnIndex(ot.Columns, nc.Name)
+		if i < 0 {
+			// a new key column is added as a plain column; the key change is manual
+			xc := ToXormColumn(nc).Column
+			xc.IsPrimaryKey = false
+			p.Steps = append(p.Steps, MigrationStep{SQL: dialect.AddColumnSQL(table, xc)})
+			continue
+		}
+		changes := diffColumn(table, ot.Columns[i], nc)
+		if len(changes) == 0 {
+			continue
+		}
+		if sqlite {
+			p.Manual = append(p.Manual, fmt.Sprintf("%s.%s: SQLite cannot alter a column; rebuild the table", table, nc.Name))
+			continue
+		}
+		destructive := slices.ContainsFunc(changes, func(c SchemaChange) bool { return !c.Backward })
+		for _, s := range alterColumnSQLs(dialect, table, ot.Columns[i], nc) {
+			p.Steps = append(p.Steps, MigrationStep{SQL: s, Destructive: destructive})
+		}
+	}
+	for _, oc := range ot.Columns {
+		if columnIndex(nt.Columns, oc.Name) < 0 {
+			p.Steps = append(p.Steps, MigrationStep{
+				SQL:         fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", quote(table), quote(oc.Name)),
+				Destructive: true,
+			})
+		}
+	}
+	for _, idx := range created {
+		p.Steps = append(p.Steps, MigrationStep{SQL: createIndexSQL(dialect, table, idx, namer, xormNames)})
+	}
+	if !equalFoldSlices(ot.PrimaryKeys, nt.PrimaryKeys) {
+		p.Manual = append(p.Manual, fmt.Sprintf("%s: primary key changes from (%s) to (%s)",
+			table, strings.Join(ot.PrimaryKeys, ","), strings.Join(nt.PrimaryKeys, ",")))
+	}
+}
+
+// alterColumnSQLs renders the statements that change oc into nc. The
+// postgres dialect's ModifyColumnSQL only changes the type, so nullability
+// and default get statements of their own there.
+func alterColumnSQLs(dialect dialects.Dialect, table string, oc, nc *Column) []string {
+	if dialect.URI().DBType != xs.POSTGRES {
+		return []string{dialect.ModifyColumnSQL(table, ToXormColumn(nc).Column)}
+	}
+	quote := dialect.Quoter().Quote
+	if !strings.Contains(table, ".") {
+		// qualify like ModifyColumnSQL does
+		schema := dialect.URI().Schema
+		if schema == "" {
+			schema = dialects.DefaultPostgresSchema
+		}
+		table = schema + "." + table
+	}
+	alter := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s ", quote(table), quote(nc.Name))
+	var out []string
+	if !strings.EqualFold(ColumnTypeString(oc), ColumnTypeString(nc)) {
+		out = append(out, dialect.ModifyColumnSQL(table, ToXormColumn(nc).Column))
+	}
+	if oc.Nullable != nc.Nullable {
+		if nc.Nullable {
+			out = append(out, alter+"DROP NOT NULL")
+		} else {
+			out = append(out, alter+"SET NOT NULL")
+		}
+	}
+	if oc.Default != nc.Default {
+		if nc.Default == "" {
+			out = append(out, alter+"DROP DEFAULT")
+		} else {
+			out = append(out, alter+"SET DEFAULT "+nc.Default)
+		}
+	}
+	return out
+}
+
+// ApplyMigration executes the steps of the plan in order and stops at the
+// first failure. Plans with manual work are refused, since applying only the
+// generated part would leave the database between the two versions.
+func ApplyMigration(ctx context.Context, engine *xorm.Engine, plan *MigrationPlan) error {
+	if len(plan.Manual) > 0 {
+		return errors.New("migration needs manual work: " + strings.Join(plan.Manual, "; "))
+	}
+	for _, s := range plan.Steps {
+		if _, err := engine.Context(ctx).Exec(s.SQL); err != nil {
+			return fmt.Errorf("exec %q: %w", s.SQL, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package schema_orm
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"xorm.io/xorm"
+)
+
+func TestValidateTables(t *testing.T) {
+	pk := compatCol("id", "INT", 0, 0, true)
+	pk.IsPrimaryKey = true
+	tb := compatTable("customer", pk, compatCol("score", "DECIMAL", 4, 6, false), compatCol("score", "", 0, 0, true))
+	tb.PrimaryKeys = append(tb.PrimaryKeys, "code")
+	idx := NewIndex("name", IndexType)
+	idx.AddColumn("name")
+	tb.AddIndex(idx)
+	fk := NewForeignKey("fk_region", "region")
+	fk.AddColumn("region_id", "id")
+	tb.AddForeignKey(fk)
+
+	var got []string
+	for _, i := range ValidateTables([]*Table{tb, compatTable("Customer", compatCol("a", "INT", 0, 0, false)), nil}) {
+		got = append(got, i.String())
+	}
+	want := []string{
+		"customer.score: scale 6 exceeds precision 4",
+		"customer.score: duplicate column",
+		"customer.score: column without type",
+		"customer.id: primary key column is nullable",
+		"customer.code: primary key column does not exist",
+		"customer.name: index name refers to a missing column",
+		"customer.region_id: foreign key fk_region refers to a missing column",
+		"Customer: duplicate table",
+		"#2: table without name",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("issues:\n got %q\nwant %q", got, want)
+	}
+	if issues := ValidateTables([]*Table{compatTable("ok", compatCol("a", "INT", 0, 0, false))}); len(issues) != 0 {
+		t.Fatalf("valid table: %v", issues)
+	}
+}
+
+func TestPlanMigration_SQLite(t *testing.T) {
+	ctx := context.Background()
+	eng, err := NewSQLiteEngine(BuildSQLiteDSN(filepath.Join(t.TempDir(), "migrate.db")))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer eng.Close()
+	ddl := `CREATE TABLE customer (id INTEGER PRIMARY KEY, name VARCHAR(64) NOT NULL, fax VARCHAR(20));
+CREATE INDEX IDX_customer_name ON customer (name);
+CREATE TABLE legacy (x INTEGER);
+INSERT INTO customer (id, name) VALUES (1, 'Ada');`
+	if _, err := eng.Import(strings.NewReader(ddl)); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	live, err := ExportEngineSchema(ctx, eng, ExportOptions{})
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	target := []*Table{cloneTable(live[0]), compatTable("audit", compatCol("at", "DATETIME", 0, 0, false))}
+	cust := target[0]
+	resetColumns(cust, []*Column{cust.Columns[0], cust.Columns[1], compatCol("email", "VARCHAR", 128, 0, true)})
+	delete(cust.Indexes, "name")
+	email := NewIndex("email", UniqueType)
+	email.AddColumn("email")
+	cust.AddIndex(email)
+
+	plan, err := PlanMigration(ctx, eng, live, target, nil)
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	if len(plan.Manual) != 0 || !plan.Destructive() {
+		t.Fatalf("plan: %+v", plan)
+	}
+	want := []string{
+		"DROP INDEX `IDX_customer_name`",
+		"ALTER TABLE `customer` ADD `email` TEXT NULL",
+		"ALTER TABLE `customer` DROP COLUMN `fax`",
+		"CREATE UNIQUE INDEX `UQE_customer_email` ON `customer` (`email`)",
+		"CREATE TABLE IF NOT EXISTS `audit` (`at` DATETIME NOT NULL)",
+		"DROP TABLE IF EXISTS `legacy`",
+	}
+	if got := plan.SQL(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("sql:\n got %q\nwant %q", got, want)
+	}
+	if err := ApplyMigration(ctx, eng, plan); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	after, err := ExportEngineSchema(ctx, eng, ExportOptions{})
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	again, err := PlanMigration(ctx, eng, after, target, nil)
+	if err != nil || len(again.Steps) != 0 {
+		t.Fatalf("second plan: %v %q", err, again.SQL())
+	}
+
+	// SQLite cannot alter columns in place
+	cust = cloneTable(after[1])
+	cust.GetColumn("name").Length = 128
+	plan, _ = PlanMigration(ctx, eng, after, []*Table{after[0], cust}, nil)
+	if len(plan.Manual) != 1 || !strings.Contains(plan.Manual[0], "customer.name") {
+		t.Fatalf("manual: %v", plan.Manual)
+	}
+	if err := ApplyMigration(ctx, eng, plan); err == nil || !strings.Contains(err.Error(), "manual") {
+		t.Fatalf("apply with manual work: %v", err)
+	}
+}
+
+func TestPlanMigration_PostgresAlter(t *testing.T) {
+	// rendering needs no connection
+	eng, err := xorm.NewEngine("postgres", "postgres://u@localhost:1/db?sslmode=disable")
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	defer eng.Close()
+	pk := compatCol("id", "INT", 0, 0, false)
+	pk.IsPrimaryKey = true
+	old := compatTable("customer", pk, compatCol("name", "VARCHAR", 64, 0, true), compatCol("tier", "INT", 0, 0, false))
+	npk := compatCol("code", "VARCHAR", 8, 0, false)
+	npk.IsPrimaryKey = true
+	tier := compatCol("tier", "INT", 0, 0, false)
+	tier.Default, tier.DefaultIsEmpty = "1", false
+	newer := compatTable("customer", pk, npk, compatCol("name", "VARCHAR", 32, 0, false), tier)
+
+	plan, err := PlanMigration(context.Background(), eng, []*Table{old}, []*Table{newer}, nil)
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	want := []MigrationStep{
+		{SQL: `ALTER TABLE "public"."customer" ADD "code" VARCHAR(8) NOT NULL; COMMENT ON COLUMN "public"."customer"."code" IS ''`},
+		{SQL: `ALTER TABLE "public"."customer" ALTER COLUMN "name" TYPE VARCHAR(32); COMMENT ON COLUMN "public"."customer"."name" IS ''`, Destructive: true},
+		{SQL: `ALTER TABLE "public"."customer" ALTER COLUMN "name" SET NOT NULL`, Destructive: true},
+		{SQL: `ALTER TABLE "public"."customer" ALTER COLUMN "tier" SET DEFAULT 1`},
+	}
+	if !reflect.DeepEqual(plan.Steps, want) {
+		t.Fatalf("steps:\n got %+v\nwant %+v", plan.Steps, want)
+	}
+	if len(plan.Manual) != 1 || !strings.Contains(plan.Manual[0], "primary key changes from (id) to (id,code)") {
+		t.Fatalf("manual: %v", plan.Manual)
+	}
+}
@@ -0,0 +1,242 @@
+package schema_orm
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"xorm.io/xorm/dialects"
+	"xorm.io/xorm/names"
+	xs "xorm.io/xorm/schemas"
+)
+
+// Naming is a naming strategy: how Go identifiers map to table and column names
+// and how physical index names are built. The fields are spec strings rather
+// than mapper values so a strategy can be stored in a Bundle and restored later.
+//
+// Table and Column accept:
+//
+//	"" or "snake"        names.SnakeMapper (the xorm default)
+//	"same"               names.SameMapper
+//	"gonic"              names.LintGonicMapper, keeps initialisms such as ID and URL
+//	"prefix:<p>:<spec>"  names.PrefixMapper around another spec, e.g. "prefix:t_:snake"
+//	"suffix:<s>:<spec>"  names.SuffixMapper around another spec
+//	any name registered with RegisterMapper
+//
+// Index accepts "" or "xorm" (Index.XName: UQE_/IDX_<table>_<name>), "verbatim"
+// (the declared name), a pattern with the placeholders {table}, {name}, {cols}
+// and {kind} ("uqe" or "idx"), e.g. "{kind}_{table}_{cols}", or a name registered
+// with RegisterIndexNamer. Indexes that are not regular (IsRegular false) already
+// carry their physical name and keep it under every strategy but "xorm".
+type Naming struct {
+	Table  string `json:"table,omitempty" yaml:"table,omitempty"`
+	Column string `json:"column,omitempty" yaml:"column,omitempty"`
+	Index  string `json:"index,omitempty" yaml:"index,omitempty"`
+}
+
+// IndexNamer returns the physical name of an index on a table.
+type IndexNamer func(tableName string, index *Index) string
+
+// FuncMapper adapts a pair of functions to names.Mapper.
+type FuncMapper struct {
+	ToTable func(string) string
+	ToObj   func(string) string
+}
+
+// Obj2Table implements names.Mapper
+func (m FuncMapper) Obj2Table(name string) string { return m.ToTable(name) }
+
+// Table2Obj implements names.Mapper
+func (m FuncMapper) Table2Obj(name string) string { return m.ToObj(name) }
+
+var (
+	namingMu     sync.RWMutex
+	namedMappers = map[string]names.Mapper{
+		"snake": names.SnakeMapper{},
+		"same":  names.SameMapper{},
+		"gonic": names.LintGonicMapper,
+	}
+	namedIndexNamers = map[string]IndexNamer{
+		"xorm":     func(tableName string, index *Index) string { return index.XName(tableName) },
+		"verbatim": func(_ string, index *Index) string { return index.Name },
+	}
+)
+
+// RegisterMapper makes a mapper available to Naming specs under name. Bundles
+// only record the name, so the same mapper must be registered wherever the
+// bundle is read.
+func RegisterMapper(name string, mapper names.Mapper) {
+	namingMu.Lock()
+	defer namingMu.Unlock()
+	namedMappers[name] = mapper
+}
+
+// RegisterIndexNamer makes an index naming function available to Naming.Index under name.
+func RegisterIndexNamer(name string, namer IndexNamer) {
+	namingMu.Lock()
+	defer namingMu.Unlock()
+	namedIndexNamers[name] = namer
+}
+
+// ParseMapper resolves a mapper spec (see Naming).
+func ParseMapper(spec string) (names.Mapper, error) {
+	if spec == "" {
+		return names.SnakeMapper{}, nil
+	}
+	for _, kind := range []string{"prefix:", "suffix:"} {
+		if !strings.HasPrefix(spec, kind) {
+			continue
+		}
+		affix, inner, ok := strings.Cut(strings.TrimPrefix(spec, kind), ":")
+		if !ok {
+			return nil, fmt.Errorf("mapper %q: expected %s<affix>:<mapper>", spec, kind)
+		}
+		m, err := ParseMapper(inner)
+		if err != nil {
+			return nil, err
+		}
+		if kind == "prefix:" {
+			return names.NewPrefixMapper(m, affix), nil
+		}
+		return names.NewSuffixMapper(m, affix), nil
+	}
+	namingMu.RLock()
+	m, ok := namedMappers[spec]
+	namingMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown mapper %q", spec)
+	}
+	return m, nil
+}
+
+// ParseIndexNamer resolves an index naming spec (see Naming).
+func ParseIndexNamer(spec string) (IndexNamer, error) {
+	if spec == "" {
+		spec = "xorm"
+	}
+	if strings.Contains(spec, "{") {
+		return func(tableName string, index *Index) string {
+			if !index.IsRegular {
+				return index.Name
+			}
+			tableParts := strings.Split(strings.ReplaceAll(tableName, "\"", ""), ".")
+			kind := "idx"
+			if index.Type == UniqueType {
+				kind = "uqe"
+			}
+			return strings.NewReplacer(
+				"{table}", tableParts[len(tableParts)-1],
+				"{name}", index.Name,
+				"{cols}", strings.Join(index.Cols, "_"),
+				"{kind}", kind,
+			).Replace(spec)
+		}, nil
+	}
+	namingMu.RLock()
+	namer, ok := namedIndexNamers[spec]
+	namingMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown index namer %q", spec)
+	}
+	if spec == "xorm" {
+		return namer, nil
+	}
+	return func(tableName string, index *Index) string {
+		if !index.IsRegular {
+			return index.Name
+		}
+		return namer(tableName, index)
+	}, nil
+}
+
+// Validate checks that every spec of the strategy resolves.
+func (n *Naming) Validate() error {
+	_, _, err := n.Mappers()
+	if err == nil {
+		_, err = n.IndexNamer()
+	}
+	return err
+}
+
+// Mappers returns the table and column mappers. A nil Naming yields the xorm defaults.
+func (n *Naming) Mappers() (table, column names.Mapper, err error) {
+	if n == nil {
+		return names.SnakeMapper{}, names.SnakeMapper{}, nil
+	}
+	if table, err = ParseMapper(n.Table); err != nil {
+		return nil, nil, err
+	}
+	if column, err = ParseMapper(n.Column); err != nil {
+		return nil, nil, err
+	}
+	return table, column, nil
+}
+
+// IndexNamer returns the index naming function. A nil Naming yields Index.XName.
+func (n *Naming) IndexNamer() (IndexNamer, error) {
+	if n == nil {
+		return ParseIndexNamer("")
+	}
+	return ParseIndexNamer(n.Index)
+}
+
+// defaultIndexNames reports whether index names follow Index.XName, which the
+// xorm dialects apply on their own.
+func (n *Naming) defaultIndexNames() bool {
+	return n == nil || n.Index == "" || n.Index == "xorm"
+}
+
+// createIndexSQL renders CREATE INDEX using the physical index name chosen by namer.
+func createIndexSQL(dialect dialects.Dialect, tableName string, index *Index, namer IndexNamer, xormNames bool) string {
+	if xormNames {
+		return dialect.CreateIndexSQL(tableName, ToXormIndex(index))
+	}
+	quoter := dialect.Quoter()
+	var unique string
+	if index.Type == UniqueType {
+		unique = " UNIQUE"
+	}
+	return fmt.Sprintf("CREATE%s INDEX %v ON %v (%v)", unique,
+		quoter.Quote(namer(tableName, index)), quoter.Quote(tableName), quoter.Join(index.Cols, ","))
+}
+
+// dropIndexSQL renders DROP INDEX using the physical index name chosen by namer.
+// PostgreSQL keeps an index in its table's schema, so for a schema-qualified
+// table the name is qualified with that schema (see Index.QualifiedXName)
+// rather than the dialect's, which would reach a same-named index elsewhere.
+func dropIndexSQL(dialect dialects.Dialect, tableName string, index *Index, namer IndexNamer, xormNames bool) string {
+	if dialect.URI().DBType == xs.POSTGRES && strings.Contains(tableName, ".") {
+		var name string
+		switch {
+		case !xormNames:
+			name = qualifyIndexName(tableName, namer(tableName, index))
+		case index.IsRegular:
+			name = index.QualifiedXName(tableName)
+		default:
+			name = qualifyIndexName(tableName, index.Name)
+		}
+		return "DROP INDEX " + dialect.Quoter().Quote(name)
+	}
+	xi := ToXormIndex(index)
+	if xormNames {
+		return dialect.DropIndexSQL(tableName, xi)
+	}
+	xi.Name, xi.IsRegular = namer(tableName, index), false
+	if dialect.URI().DBType == xs.SQLITE {
+		// the sqlite3 dialect re-prefixes names that don't start with UQE_/IDX_
+		return "DROP INDEX " + dialect.Quoter().Quote(xi.Name)
+	}
+	return dialect.DropIndexSQL(tableName, xi)
+}
+
+// offlineDialect returns an initialised xorm dialect that renders SQL without a connection.
+func offlineDialect(dbType xs.DBType, schema string) (dialects.Dialect, error) {
+	dialect := dialects.QueryDialect(dbType)
+	if dialect == nil {
+		return nil, fmt.Errorf("unsupported dialect %q", dbType)
+	}
+	if err := dialect.Init(&dialects.URI{DBType: dbType, Schema: schema}); err != nil {
+		return nil, err
+	}
+	return dialect, nil
+}
@@ -0,0 +1,306 @@
+package schema_orm
+
+import (
+	"bytes"
+	"context"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"xorm.io/xorm/names"
+	xs "xorm.io/xorm/schemas"
+)
+
+type UserAccount struct {
+	ID        int64
+	UserURL   string    `xorm:"varchar(255) unique"`
+	Nickname  string    `xorm:"index(nick_email)"`
+	Email     string    `xorm:"'mail' index(nick_email) comment('contact')"`
+	CreatedAt time.Time `xorm:"created"`
+}
+
+func TestParseMapper(t *testing.T) {
+	cases := map[string]string{
+		"":                          "user_url",
+		"snake":                     "user_u_r_l",
+		"same":                      "UserURL",
+		"gonic":                     "user_url",
+		"prefix:t_:gonic":           "t_user_url",
+		"suffix:_v2:snake":          "user_u_r_l_v2",
+		"prefix:a_:suffix:_z:gonic": "a_user_url_z",
+	}
+	for spec, want := range cases {
+		m, err := ParseMapper(spec)
+		if err != nil {
+			t.Fatalf("%q: %v", spec, err)
+		}
+		if spec == "" {
+			want = names.SnakeMapper{}.Obj2Table("UserURL")
+		}
+		if got := m.Obj2Table("UserURL"); got != want {
+			t.Fatalf("%q: Obj2Table = %q, want %q", spec, got, want)
+		}
+	}
+	for _, spec := range []string{"nope", "prefix:t_", "suffix:_x:nope"} {
+		if _, err := ParseMapper(spec); err == nil {
+			t.Fatalf("expected error for %q", spec)
+		}
+	}
+
+	RegisterMapper("upper", FuncMapper{ToTable: strings.ToUpper, ToObj: strings.ToLower})
+	m, err := ParseMapper("prefix:X_:upper")
+	if err != nil {
+		t.Fatalf("custom: %v", err)
+	}
+	if m.Obj2Table("order") != "X_ORDER" || m.Table2Obj("X_ORDER") != "order" {
+		t.Fatalf("custom mapper mismatch")
+	}
+}
+
+func TestParseIndexNamer(t *testing.T) {
+	idx := NewIndex("code", UniqueType)
+	idx.AddColumn("tenant", "code")
+	raw := &Index{Name: "legacy_ix", Type: IndexType, Cols: []string{"a"}}
+	RegisterIndexNamer("short", func(_ string, index *Index) string { return "ix_" + index.Name })
+
+	cases := []struct {
+		spec, want, wantRaw string
+	}{
+		{"", "UQE_customer_code", "IDX_customer_legacy_ix"},
+		{"xorm", "UQE_customer_code", "IDX_customer_legacy_ix"},
+		{"verbatim", "code", "legacy_ix"},
+		{"{kind}_{table}_{cols}", "uqe_customer_tenant_code", "legacy_ix"},
+		{"short", "ix_code", "legacy_ix"},
+	}
+	for _, c := range cases {
+		namer, err := ParseIndexNamer(c.spec)
+		if err != nil {
+			t.Fatalf("%q: %v", c.spec, err)
+		}
+		if got := namer("sales.customer", idx); got != c.want {
+			t.Fatalf("%q: got %q, want %q", c.spec, got, c.want)
+		}
+		if got := namer("customer", raw); got != c.wantRaw {
+			t.Fatalf("%q raw: got %q, want %q", c.spec, got, c.wantRaw)
+		}
+	}
+	if _, err := ParseIndexNamer("nope"); err == nil {
+		t.Fatalf("expected unknown index namer error")
+	}
+	if err := (&Naming{Index: "nope"}).Validate(); err == nil {
+		t.Fatalf("expected Validate error")
+	}
+	if err := (*Naming)(nil).Validate(); err != nil {
+		t.Fatalf("nil naming is the default: %v", err)
+	}
+}
+
+func TestParseStruct_Naming(t *testing.T) {
+	tb, err := ParseStruct(&UserAccount{}, nil)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if tb.Name != "user_account" || tb.GetColumn("user_u_r_l") == nil || tb.GetColumn("i_d") == nil {
+		t.Fatalf("snake naming mismatch: %s %v", tb.Name, tb.ColumnsSeq)
+	}
+
+	tb, err = ParseStruct(UserAccount{}, &Naming{Table: "prefix:t_:gonic", Column: "gonic"})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if tb.Name != "t_user_account" {
+		t.Fatalf("table name = %q", tb.Name)
+	}
+	for _, name := range []string{"id", "user_url", "nickname", "mail", "created_at"} {
+		if tb.GetColumn(name) == nil {
+			t.Fatalf("missing column %q in %v", name, tb.ColumnsSeq)
+		}
+	}
+	if idx := tb.Indexes["nick_email"]; idx == nil || strings.Join(idx.Cols, ",") != "nickname,mail" {
+		t.Fatalf("composite index mismatch: %+v", tb.Indexes)
+	}
+	if !tb.GetColumn("id").IsPrimaryKey || !tb.GetColumn("created_at").IsCreated {
+		t.Fatalf("tag flags lost")
+	}
+
+	if _, err := ParseStruct(UserAccount{}, &Naming{Table: "nope"}); err == nil {
+		t.Fatalf("expected mapper error")
+	}
+	if _, err := ParseStruct(42, nil); err == nil {
+		t.Fatalf("expected unsupported type error")
+	}
+}
+
+func TestCreateTableSQLsWithNaming_SQLite(t *testing.T) {
+	ctx := context.Background()
+	naming := &Naming{Table: "gonic", Column: "gonic", Index: "{kind}_{table}_{cols}"}
+	tb, err := ParseStruct(UserAccount{}, naming)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	eng, err := NewSQLiteEngine(BuildSQLiteDSN(filepath.Join(t.TempDir(), "naming.db")))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer eng.Close()
+	sqls, err := CreateTableSQLsWithNaming(ctx, eng, []*Table{tb}, naming)
+	if err != nil {
+		t.Fatalf("sqls: %v", err)
+	}
+	joined := strings.Join(sqls, "\n")
+	for _, want := range []string{"`idx_user_account_nickname_mail`", "`uqe_user_account_user_url`"} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("missing %s in\n%s", want, joined)
+		}
+	}
+	if err := ApplyTablesWithNaming(ctx, eng, []*Table{tb}, naming); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	var n int
+	if _, err := eng.SQL("SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = 'uqe_user_account_user_url'").Get(&n); err != nil || n != 1 {
+		t.Fatalf("index not created with the mapped name: n=%d err=%v", n, err)
+	}
+
+	// the analyzer drops by the same physical name
+	dup := NewIndex("user_url_2", IndexType)
+	dup.AddColumn("user_url")
+	tb.AddIndex(dup)
+	findings, err := AnalyzeIndexesWithNaming(tb, xs.SQLITE, naming)
+	if err != nil {
+		t.Fatalf("analyze: %v", err)
+	}
+	if len(findings) != 1 || findings[0].SQL[0] != "DROP INDEX `idx_user_account_user_url`" {
+		t.Fatalf("unexpected findings: %+v", findings)
+	}
+
+	if _, err := CreateTableSQLsWithNaming(ctx, eng, []*Table{tb}, &Naming{Index: "nope"}); err == nil {
+		t.Fatalf("expected naming error")
+	}
+	if _, err := AnalyzeIndexesWithNaming(tb, xs.SQLITE, &Naming{Index: "nope"}); err == nil {
+		t.Fatalf("expected naming error")
+	}
+}
+
+// generatedStruct parses the source of WriteGoStructs and rebuilds the named
+// struct with reflect, so the generated tags can be fed back into ParseStruct.
+func generatedStruct(t *testing.T, src []byte, name string) reflect.Type {
+	t.Helper()
+	f, err := parser.ParseFile(token.NewFileSet(), "gen.go", src, 0)
+	if err != nil {
+		t.Fatalf("generated code does not parse: %v\n%s", err, src)
+	}
+	goTypes := map[string]reflect.Type{
+		"int": reflect.TypeOf(0), "int64": reflect.TypeOf(int64(0)), "string": reflect.TypeOf(""),
+		"time.Time": reflect.TypeOf(time.Time{}), "float64": reflect.TypeOf(0.0), "bool": reflect.TypeOf(false),
+	}
+	var fields []reflect.StructField
+	ast.Inspect(f, func(n ast.Node) bool {
+		ts, ok := n.(*ast.TypeSpec)
+		if !ok || ts.Name.Name != name {
+			return true
+		}
+		for _, fd := range ts.Type.(*ast.StructType).Fields.List {
+			typ := ""
+			switch x := fd.Type.(type) {
+			case *ast.Ident:
+				typ = x.Name
+			case *ast.SelectorExpr:
+				typ = x.X.(*ast.Ident).Name + "." + x.Sel.Name
+			}
+			tag, _ := strconv.Unquote(fd.Tag.Value)
+			fields = append(fields, reflect.StructField{Name: fd.Names[0].Name, Type: goTypes[typ], Tag: reflect.StructTag(tag)})
+		}
+		return false
+	})
+	if len(fields) == 0 {
+		t.Fatalf("struct %s not generated:\n%s", name, src)
+	}
+	return reflect.StructOf(fields)
+}
+
+func TestWriteGoStructs_RoundTrip(t *testing.T) {
+	naming := &Naming{Table: "gonic", Column: "gonic"}
+	tb, err := ParseStruct(UserAccount{}, naming)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	// forget the Go field names, as for a table read from a database
+	for _, c := range tb.Columns {
+		c.FieldName = ""
+	}
+
+	path := filepath.Join(t.TempDir(), "bundle.yaml")
+	b := NewBundle("sqlite", []*Table{tb})
+	b.Naming = naming
+	if err := b.WriteFile(path); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	b, err = LoadBundle(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if *b.Naming != *naming {
+		t.Fatalf("naming not kept: %+v", b.Naming)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteGoStructs(&buf, b.Tables, GoStructOptions{Package: "crm", Naming: b.Naming}); err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	src := buf.String()
+	for _, want := range []string{"package crm", `import "time"`, "type UserAccount struct", "UserURL ", "CreatedAt time.Time", "// contact"} {
+		if !strings.Contains(src, want) {
+			t.Fatalf("missing %q in\n%s", want, src)
+		}
+	}
+	if strings.Contains(src, "TableName()") || strings.Contains(src, "'user_url'") {
+		t.Fatalf("names reproducible by the mappers must stay implicit:\n%s", src)
+	}
+	if !strings.Contains(src, "Mail ") {
+		t.Fatalf("field for column mail missing:\n%s", src)
+	}
+
+	back, err := ParseStruct(reflect.New(generatedStruct(t, buf.Bytes(), "UserAccount")).Interface(), b.Naming)
+	if err != nil {
+		t.Fatalf("reparse: %v", err)
+	}
+	if strings.Join(back.ColumnsSeq, ",") != strings.Join(tb.ColumnsSeq, ",") {
+		t.Fatalf("columns changed: %v -> %v", tb.ColumnsSeq, back.ColumnsSeq)
+	}
+	if idx := back.Indexes["nick_email"]; idx == nil || !idx.EqualOrdered(tb.Indexes["nick_email"]) {
+		t.Fatalf("index changed: %+v", back.Indexes)
+	}
+
+	// a different mapper needs an explicit TableName and column names
+	buf.Reset()
+	if err := WriteGoStructs(&buf, b.Tables, GoStructOptions{Naming: &Naming{Table: "prefix:t_:snake", Column: "same"}}); err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if !strings.Contains(buf.String(), `func (UserAccount) TableName() string { return "user_account" }`) ||
+		!strings.Contains(buf.String(), "UserUrl ") || !strings.Contains(buf.String(), "'user_url'") ||
+		!strings.Contains(buf.String(), "package models") {
+		t.Fatalf("unexpected output:\n%s", buf.String())
+	}
+
+	if err := WriteGoStructs(&buf, b.Tables, GoStructOptions{Naming: &Naming{Column: "nope"}}); err == nil {
+		t.Fatalf("expected naming error")
+	}
+	if _, err := ParseBundle([]byte(`{"naming":{"table":"nope"},"tables":[]}`)); err == nil {
+		t.Fatalf("expected bundle naming error")
+	}
+}
+
+func TestGoIdent(t *testing.T) {
+	cases := map[string]string{"": "X", "2fa": "X2fa", "user-name": "Username", "名称": "X名称", "ok": "Ok"}
+	for in, want := range cases {
+		if got := goIdent(in); got != want {
+			t.Fatalf("goIdent(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,650 @@
+package schema_orm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// BaseLayerName is the provenance recorded for elements of the base schema.
+const BaseLayerName = "base"
+
+// OverlayOp is the operation a TableOverlay performs on its table.
+type OverlayOp string
+
+// overlay operations
+const (
+	// OverlayModify edits an existing table element by element (the default).
+	OverlayModify OverlayOp = "modify"
+	// OverlayAdd creates a table that must not exist yet.
+	OverlayAdd OverlayOp = "add"
+	// OverlayOverride replaces an existing table as a whole.
+	OverlayOverride OverlayOp = "override"
+	// OverlayRemove drops an existing table.
+	OverlayRemove OverlayOp = "remove"
+)
+
+// Layer is a named set of table overlays, e.g. a region or tenant extension.
+// Layers are applied in order on top of the base schema by MergeOverlays.
+type Layer struct {
+	Name   string          `json:"name" yaml:"name"`
+	Tables []*TableOverlay `json:"tables" yaml:"tables"`
+}
+
+// TableOverlay is what one layer changes in one table.
+//
+// For OverlayAdd and OverlayOverride, Table holds the full definition. For
+// OverlayModify the changes are applied in this order:
+//
+//   - Remove: columns, indexes and foreign keys that must exist, by name.
+//     A column still used by an index or foreign key is not removed.
+//   - Override: columns, indexes and foreign keys that must exist are replaced,
+//     and non-empty Comment, Charset, Collation and StoreEngine replace the
+//     table's. Metadata is merged over the table's, the layer's values
+//     winning. A column without a SQL type only changes the comment, default
+//     and metadata.
+//   - Add: columns, indexes and foreign keys that must not exist yet.
+//
+// Name (and Schema) select the table; they default to those of Table.
+type TableOverlay struct {
+	Name     string          `json:"name,omitempty" yaml:"name,omitempty"`
+	Schema   string          `json:"schema,omitempty" yaml:"schema,omitempty"`
+	Op       OverlayOp       `json:"op,omitempty" yaml:"op,omitempty"`
+	Table    *Table          `json:"table,omitempty" yaml:"table,omitempty"`
+	Add      *Table          `json:"add,omitempty" yaml:"add,omitempty"`
+	Override *Table          `json:"override,omitempty" yaml:"override,omitempty"`
+	Remove   *OverlayRemoval `json:"remove,omitempty" yaml:"remove,omitempty"`
+}
+
+// OverlayRemoval names the elements a layer removes from a table.
+// Foreign keys are named by ForeignKey.Name.
+type OverlayRemoval struct {
+	Columns     []string `json:"columns,omitempty" yaml:"columns,omitempty"`
+	Indexes     []string `json:"indexes,omitempty" yaml:"indexes,omitempty"`
+	ForeignKeys []string `json:"foreignKeys,omitempty" yaml:"foreignKeys,omitempty"`
+}
+
+// Provenance records which layer each element of a merged table came from.
+// Maps are keyed by column, index and foreign key name; Attributes by
+// "comment", "charset", "collation" and "storeEngine". Removed keeps the layer
+// that removed an element, keyed "column:<name>", "index:<name>" or "foreignKey:<name>".
+type Provenance struct {
+	Table       string            `json:"table" yaml:"table"`
+	Attributes  map[string]string `json:"attributes,omitempty" yaml:"attributes,omitempty"`
+	Columns     map[string]string `json:"columns,omitempty" yaml:"columns,omitempty"`
+	Indexes     map[string]string `json:"indexes,omitempty" yaml:"indexes,omitempty"`
+	ForeignKeys map[string]string `json:"foreignKeys,omitempty" yaml:"foreignKeys,omitempty"`
+	Removed     map[string]string `json:"removed,omitempty" yaml:"removed,omitempty"`
+}
+
+// ConflictKind classifies a MergeConflict.
+type ConflictKind string
+
+// merge conflict kinds
+const (
+	// ConflictDuplicate: an added element already exists with the same definition.
+	ConflictDuplicate ConflictKind = "duplicate"
+	// ConflictTypeClash: an added column already exists with a different type.
+	ConflictTypeClash ConflictKind = "type-clash"
+	// ConflictDuplicateIndex: an added index uses a name that is already taken.
+	ConflictDuplicateIndex ConflictKind = "duplicate-index"
+	// ConflictMissing: an overridden or removed element does not exist.
+	ConflictMissing ConflictKind = "missing"
+	// ConflictInUse: a removed column is still used by an index or foreign key.
+	ConflictInUse ConflictKind = "in-use"
+	// ConflictUnknownColumn: an index or foreign key refers to a column the table doesn't have.
+	ConflictUnknownColumn ConflictKind = "unknown-column"
+)
+
+// MergeConflict is a change that could not be applied. The change is skipped
+// and the earlier definition (if any) stays in place. Existing is the layer
+// the conflicting element came from.
+type MergeConflict struct {
+	Kind     ConflictKind `json:"kind" yaml:"kind"`
+	Layer    string       `json:"layer" yaml:"layer"`
+	Table    string       `json:"table" yaml:"table"`
+	Element  string       `json:"element" yaml:"element"`
+	Name     string       `json:"name" yaml:"name"`
+	Existing string       `json:"existing,omitempty" yaml:"existing,omitempty"`
+	Message  string       `json:"message" yaml:"message"`
+}
+
+func (c *MergeConflict) Error() string {
+	return fmt.Sprintf("layer %s: %s", c.Layer, c.Message)
+}
+
+// MergeResult is the merged schema with every table carrying its Provenance.
+type MergeResult struct {
+	Tables    []*Table         `json:"tables" yaml:"tables"`
+	Conflicts []*MergeConflict `json:"conflicts,omitempty" yaml:"conflicts,omitempty"`
+}
+
+// Err returns the conflicts joined into one error, or nil when there are none.
+func (r *MergeResult) Err() error {
+	errs := make([]error, len(r.Conflicts))
+	for i, c := range r.Conflicts {
+		errs[i] = c
+	}
+	return errors.Join(errs...)
+}
+
+// ParseLayer decodes a layer from JSON or YAML content.
+func ParseLayer(data []byte) (*Layer, error) {
+	trimmed := bytes.TrimSpace(data)
+	l := &Layer{}
+	var err error
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		err = json.Unmarshal(trimmed, l)
+	} else {
+		err = yaml.Unmarshal(trimmed, l)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse layer: %w", err)
+	}
+	return l, nil
+}
+
+// LoadLayer reads a layer file.
+func LoadLayer(path string) (*Layer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseLayer(data)
+}
+
+// MergeOverlays applies the layers in order on top of copies of the base tables.
+// The base is not modified. Tables keep the base order; added tables follow in
+// the order they were added. Conflicting changes are reported and skipped, so
+// the result is always usable; check MergeResult.Err to treat them as fatal.
+func MergeOverlays(base []*Table, layers ...*Layer) *MergeResult {
+	m := &merger{res: &MergeResult{}}
+	for _, tb := range base {
+		if tb == nil {
+			continue
+		}
+		m.tables = append(m.tables, newMergedTable(cloneTable(tb), BaseLayerName))
+	}
+	for _, l := range layers {
+		if l == nil {
+			continue
+		}
+		m.layer = l.Name
+		for _, ov := range l.Tables {
+			if ov != nil {
+				m.apply(ov)
+			}
+		}
+	}
+	for _, mt := range m.tables {
+		mt.tb.Provenance = mt.prov
+		m.res.Tables = append(m.res.Tables, mt.tb)
+	}
+	return m.res
+}
+
+type mergedTable struct {
+	tb   *Table
+	prov *Provenance
+}
+
+func newMergedTable(tb *Table, layer string) *mergedTable {
+	prov := &Provenance{
+		Table:       layer,
+		Attributes:  map[string]string{},
+		Columns:     map[string]string{},
+		Indexes:     map[string]string{},
+		ForeignKeys: map[string]string{},
+		Removed:     map[string]string{},
+	}
+	for attr, v := range tableAttributes(tb) {
+		if *v != "" {
+			prov.Attributes[attr] = layer
+		}
+	}
+	for _, c := range tb.Columns {
+		prov.Columns[c.Name] = layer
+	}
+	for name := range tb.Indexes {
+		prov.Indexes[name] = layer
+	}
+	for _, fk := range tb.ForeignKeys {
+		prov.ForeignKeys[fk.Name] = layer
+	}
+	return &mergedTable{tb: tb, prov: prov}
+}
+
+type merger struct {
+	res    *MergeResult
+	layer  string
+	tables []*mergedTable
+}
+
+func (m *merger) conflict(kind ConflictKind, table, element, name, existing, format string, args ...any) {
+	m.res.Conflicts = append(m.res.Conflicts, &MergeConflict{
+		Kind: kind, Layer: m.layer, Table: table, Element: element, Name: name, Existing: existing,
+		Message: fmt.Sprintf("%s %s.%s: ", element, table, name) + fmt.Sprintf(format, args...),
+	})
+}
+
+// find returns the index of the table an overlay targets, or -1. An overlay
+// without schema also matches a schema-qualified table of the same name.
+func (m *merger) find(schema, name string) int {
+	full := name
+	if schema != "" {
+		full = schema + "." + name
+	}
+	for i, mt := range m.tables {
+		if mt.tb.FullName() == full {
+			return i
+		}
+	}
+	if schema == "" {
+		for i, mt := range m.tables {
+			if mt.tb.Name == name {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func (m *merger) apply(ov *TableOverlay) {
+	name, schema := ov.Name, ov.Schema
+	if name == "" && ov.Table != nil {
+		name, schema = ov.Table.Name, ov.Table.Schema
+	}
+	full := name
+	if schema != "" {
+		full = schema + "." + name
+	}
+	i := m.find(schema, name)
+
+	switch ov.Op {
+	case OverlayAdd, OverlayOverride:
+		if ov.Table == nil {
+			m.conflict(ConflictMissing, full, "table", name, "", "%s without a table definition", ov.Op)
+			return
+		}
+		if ov.Op == OverlayAdd && i >= 0 {
+			m.conflict(ConflictDuplicate, full, "table", name, m.tables[i].prov.Table, "already defined")
+			return
+		}
+		if ov.Op == OverlayOverride && i < 0 {
+			m.conflict(ConflictMissing, full, "table", name, "", "cannot override a table that does not exist")
+			return
+		}
+		tb := cloneTable(ov.Table)
+		tb.Name, tb.Schema = name, schema
+		mt := newMergedTable(tb, m.layer)
+		m.checkReferences(mt)
+		if i < 0 {
+			m.tables = append(m.tables, mt)
+			return
+		}
+		mt.prov.Removed = m.tables[i].prov.Removed
+		m.tables[i] = mt
+	case OverlayRemove:
+		if i < 0 {
+			m.conflict(ConflictMissing, full, "table", name, "", "cannot remove a table that does not exist")
+			return
+		}
+		m.tables = append(m.tables[:i], m.tables[i+1:]...)
+	case "", OverlayModify:
+		if i < 0 {
+			m.conflict(ConflictMissing, full, "table", name, "", "cannot modify a table that does not exist")
+			return
+		}
+		m.modify(m.tables[i], ov)
+	default:
+		m.conflict(ConflictMissing, full, "table", name, "", "unknown overlay op %q", ov.Op)
+	}
+}
+
+// checkReferences drops indexes and foreign keys of a replaced table that name unknown columns.
+func (m *merger) checkReferences(mt *mergedTable) {
+	tb := mt.tb
+	for name, idx := range tb.Indexes {
+		if col := missingColumn(tb, idx.Cols); col != "" {
+			m.conflict(ConflictUnknownColumn, tb.FullName(), "index", name, "", "unknown column %s", col)
+			delete(tb.Indexes, name)
+			delete(mt.prov.Indexes, name)
+		}
+	}
+	kept := tb.ForeignKeys[:0]
+	for _, fk := range tb.ForeignKeys {
+		if col := missingColumn(tb, fk.Cols); col != "" {
+			m.conflict(ConflictUnknownColumn, tb.FullName(), "foreignKey", fk.Name, "", "unknown column %s", col)
+			delete(mt.prov.ForeignKeys, fk.Name)
+			continue
+		}
+		kept = append(kept, fk)
+	}
+	tb.ForeignKeys = kept
+	syncColumnIndexes(tb)
+}
+
+func (m *merger) modify(mt *mergedTable, ov *TableOverlay) {
+	tb, prov, full := mt.tb, mt.prov, mt.tb.FullName()
+	cols := tb.Columns
+
+	if rm := ov.Remove; rm != nil {
+		for _, name := range rm.ForeignKeys {
+			i := foreignKeyIndex(tb, name)
+			if i < 0 {
+				m.conflict(ConflictMissing, full, "foreignKey", name, "", "cannot remove, not defined")
+				continue
+			}
+			tb.ForeignKeys = append(tb.ForeignKeys[:i], tb.ForeignKeys[i+1:]...)
+			delete(prov.ForeignKeys, name)
+			prov.Removed["foreignKey:"+name] = m.layer
+		}
+		for _, name := range rm.Indexes {
+			key := indexKey(tb, name)
+			if key == "" {
+				m.conflict(ConflictMissing, full, "index", name, "", "cannot remove, not defined")
+				continue
+			}
+			delete(tb.Indexes, key)
+			delete(prov.Indexes, key)
+			prov.Removed["index:"+key] = m.layer
+		}
+		for _, name := range rm.Columns {
+			i := columnIndex(cols, name)
+			if i < 0 {
+				m.conflict(ConflictMissing, full, "column", name, "", "cannot remove, not defined")
+				continue
+			}
+			if user := columnUser(tb, cols[i].Name); user != "" {
+				m.conflict(ConflictInUse, full, "column", name, prov.Columns[cols[i].Name], "still used by %s", user)
+				continue
+			}
+			delete(prov.Columns, cols[i].Name)
+			prov.Removed["column:"+cols[i].Name] = m.layer
+			cols = append(cols[:i:i], cols[i+1:]...)
+		}
+	}
+
+	if o := ov.Override; o != nil {
+		for attr, v := range tableAttributes(o) {
+			if *v != "" {
+				*tableAttributes(tb)[attr] = *v
+				prov.Attributes[attr] = m.layer
+			}
+		}
+		if !o.Metadata.IsEmpty() {
+			tb.Metadata = mergeMetadata(tb.Metadata, o.Metadata, true)
+			prov.Attributes["metadata"] = m.layer
+		}
+		for _, c := range o.Columns {
+			i := columnIndex(cols, c.Name)
+			if i < 0 {
+				m.conflict(ConflictMissing, full, "column", c.Name, "", "cannot override, not defined")
+				continue
+			}
+			next := cloneColumn(c)
+			if c.SQLType.Name == "" {
+				next = cloneColumn(cols[i])
+				if c.Comment != "" {
+					next.Comment = c.Comment
+				}
+				if c.Default != "" {
+					next.Default = c.Default
+				}
+				next.Metadata = mergeMetadata(next.Metadata, c.Metadata, true)
+			}
+			next.Name = cols[i].Name
+			cols[i] = next
+			prov.Columns[next.Name] = m.layer
+		}
+	}
+	if a := ov.Add; a != nil {
+		for _, c := range a.Columns {
+			if i := columnIndex(cols, c.Name); i >= 0 {
+				existing := cols[i]
+				if strings.EqualFold(ColumnTypeString(existing), ColumnTypeString(c)) {
+					m.conflict(ConflictDuplicate, full, "column", c.Name, prov.Columns[existing.Name], "already defined")
+				} else {
+					m.conflict(ConflictTypeClash, full, "column", c.Name, prov.Columns[existing.Name],
+						"type %s clashes with %s", ColumnTypeString(c), ColumnTypeString(existing))
+				}
+				continue
+			}
+			cols = append(cols, cloneColumn(c))
+			prov.Columns[c.Name] = m.layer
+		}
+	}
+	resetColumns(tb, cols)
+
+	// index and foreign key changes are checked against the final columns
+	if o := ov.Override; o != nil {
+		for name, idx := range o.Indexes {
+			key := indexKey(tb, name)
+			switch col := missingColumn(tb, idx.Cols); {
+			case key == "":
+				m.conflict(ConflictMissing, full, "index", name, "", "cannot override, not defined")
+			case col != "":
+				m.conflict(ConflictUnknownColumn, full, "index", name, "", "unknown column %s", col)
+			default:
+				next := cloneIndex(idx)
+				next.Name = key
+				tb.Indexes[key] = next
+				prov.Indexes[key] = m.layer
+			}
+		}
+		for _, fk := range o.ForeignKeys {
+			i := foreignKeyIndex(tb, fk.Name)
+			switch col := missingColumn(tb, fk.Cols); {
+			case i < 0:
+				m.conflict(ConflictMissing, full, "foreignKey", fk.Name, "", "cannot override, not defined")
+			case col != "":
+				m.conflict(ConflictUnknownColumn, full, "foreignKey", fk.Name, "", "unknown column %s", col)
+			default:
+				tb.ForeignKeys[i] = cloneForeignKey(fk)
+				prov.ForeignKeys[fk.Name] = m.layer
+			}
+		}
+	}
+	if a := ov.Add; a != nil {
+		for name, idx := range a.Indexes {
+			if key := indexKey(tb, name); key != "" {
+				m.conflict(ConflictDuplicateIndex, full, "index", name, prov.Indexes[key], "name already used by index on (%s)",
+					strings.Join(tb.Indexes[key].Cols, ", "))
+				continue
+			}
+			if col := missingColumn(tb, idx.Cols); col != "" {
+				m.conflict(ConflictUnknownColumn, full, "index", name, "", "unknown column %s", col)
+				continue
+			}
+			next := cloneIndex(idx)
+			next.Name = name
+			tb.Indexes[name] = next
+			prov.Indexes[name] = m.layer
+		}
+		for _, fk := range a.ForeignKeys {
+			if i := foreignKeyIndex(tb, fk.Name); i >= 0 {
+				m.conflict(ConflictDuplicate, full, "foreignKey", fk.Name, prov.ForeignKeys[tb.ForeignKeys[i].Name], "already defined")
+				continue
+			}
+			if col := missingColumn(tb, fk.Cols); col != "" {
+				m.conflict(ConflictUnknownColumn, full, "foreignKey", fk.Name, "", "unknown column %s", col)
+				continue
+			}
+			tb.ForeignKeys = append(tb.ForeignKeys, cloneForeignKey(fk))
+			prov.ForeignKeys[fk.Name] = m.layer
+		}
+	}
+	syncColumnIndexes(tb)
+}
+
+// tableAttributes exposes the plain string attributes of a table that layers can override.
+func tableAttributes(tb *Table) map[string]*string {
+	return map[string]*string{
+		"comment":     &tb.Comment,
+		"charset":     &tb.Charset,
+		"collation":   &tb.Collation,
+		"storeEngine": &tb.StoreEngine,
+	}
+}
+
+func columnIndex(cols []*Column, name string) int {
+	for i, c := range cols {
+		if strings.EqualFold(c.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// indexKey returns the key of the index with the given name (case-insensitive), or "".
+func indexKey(tb *Table, name string) string {
+	if _, ok := tb.Indexes[name]; ok {
+		return name
+	}
+	for key := range tb.Indexes {
+		if strings.EqualFold(key, name) {
+			return key
+		}
+	}
+	return ""
+}
+
+func foreignKeyIndex(tb *Table, name string) int {
+	for i, fk := range tb.ForeignKeys {
+		if strings.EqualFold(fk.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// missingColumn returns the first of cols the table doesn't have, or "".
+func missingColumn(tb *Table, cols []string) string {
+	for _, c := range cols {
+		if tb.GetColumn(c) == nil {
+			return c
+		}
+	}
+	return ""
+}
+
+// columnUser names an index or foreign key that uses the column, or "".
+func columnUser(tb *Table, col string) string {
+	for name, idx := range tb.Indexes {
+		if columnIndexOf(idx.Cols, col) >= 0 {
+			return "index " + name
+		}
+	}
+	for _, fk := range tb.ForeignKeys {
+		if columnIndexOf(fk.Cols, col) >= 0 {
+			return "foreign key " + fk.Name
+		}
+	}
+	return ""
+}
+
+func columnIndexOf(cols []string, name string) int {
+	for i, c := range cols {
+		if strings.EqualFold(c, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// resetColumns replaces the columns of a table and rebuilds everything derived
+// from them. Columns that stay in the primary key keep their key position.
+func resetColumns(tb *Table, cols []*Column) {
+	pkOrder := tb.PrimaryKeys
+	tb.ColumnsSeq = make([]string, 0, len(cols))
+	tb.Columns = make([]*Column, 0, len(cols))
+	tb.ColumnsMap = make(map[string][]*Column, len(cols))
+	tb.PrimaryKeys = make([]string, 0)
+	tb.Created = make(map[string]bool)
+	tb.AutoIncrement, tb.Updated, tb.Deleted, tb.Version = "", "", "", ""
+	for _, c := range cols {
+		tb.AddColumn(c)
+	}
+	pks := make([]string, 0, len(tb.PrimaryKeys))
+	for _, name := range pkOrder {
+		if columnIndexOf(tb.PrimaryKeys, name) >= 0 && columnIndexOf(pks, name) < 0 {
+			pks = append(pks, name)
+		}
+	}
+	for _, name := range tb.PrimaryKeys {
+		if columnIndexOf(pks, name) < 0 {
+			pks = append(pks, name)
+		}
+	}
+	tb.PrimaryKeys = pks
+}
+
+// cloneTable copies a table deeply enough that merging never touches the source.
+func cloneTable(src *Table) *Table {
+	nt := NewTable(src.Name, src.Type)
+	nt.Schema = src.Schema
+	nt.StoreEngine = src.StoreEngine
+	nt.Charset = src.Charset
+	nt.Comment = src.Comment
+	nt.Collation = src.Collation
+	nt.Profile = src.Profile
+	nt.Metadata = src.Metadata.Clone()
+	nt.PrimaryKeys = append(nt.PrimaryKeys, src.PrimaryKeys...)
+	cols := make([]*Column, len(src.Columns))
+	for i, c := range src.Columns {
+		cols[i] = cloneColumn(c)
+	}
+	resetColumns(nt, cols)
+	for name, idx := range src.Indexes {
+		nt.Indexes[name] = cloneIndex(idx)
+	}
+	for _, fk := range src.ForeignKeys {
+		nt.ForeignKeys = append(nt.ForeignKeys, cloneForeignKey(fk))
+	}
+	return nt
+}
+
+// cloneColumn copies c so that the copy shares no map with it.
+func cloneColumn(c *Column) *Column {
+	nc := *c
+	nc.FieldIndex = slices.Clone(c.FieldIndex)
+	nc.Indexes = maps.Clone(c.Indexes)
+	nc.EnumOptions = maps.Clone(c.EnumOptions)
+	nc.SetOptions = maps.Clone(c.SetOptions)
+	nc.Metadata = c.Metadata.Clone()
+	return &nc
+}
+
+// syncColumnIndexes rebuilds Column.Indexes from the indexes of the table.
+func syncColumnIndexes(tb *Table) {
+	for _, c := range tb.Columns {
+		c.Indexes = make(map[string]int)
+	}
+	for name, idx := range tb.Indexes {
+		for _, col := range idx.Cols {
+			if c := tb.GetColumn(col); c != nil {
+				c.Indexes[name] = idx.Type
+			}
+		}
+	}
+}
+
+func cloneIndex(idx *Index) *Index {
+	ni := *idx
+	ni.Cols = append([]string(nil), idx.Cols...)
+	return &ni
+}
+
+func cloneForeignKey(fk *ForeignKey) *ForeignKey {
+	nf := *fk
+	nf.Cols = append([]string(nil), fk.Cols...)
+	nf.RefCols = append([]string(nil), fk.RefCols...)
+	return &nf
+}
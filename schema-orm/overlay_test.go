@@ -0,0 +1,302 @@
+package schema_orm
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func overlayBase() []*Table {
+	customer := NewEmptyTable()
+	customer.Name = "customer"
+	customer.Comment = "Golden customer record"
+	customer.AddColumn(&Column{Name: "id", SQLType: SQLType{Name: "BIGINT"}, IsPrimaryKey: true, IsAutoIncrement: true})
+	customer.AddColumn(&Column{Name: "code", SQLType: SQLType{Name: "VARCHAR"}, Length: 32})
+	customer.AddColumn(&Column{Name: "name", SQLType: SQLType{Name: "VARCHAR"}, Length: 128, Comment: "legal name"})
+	customer.AddColumn(&Column{Name: "legacy_ref", SQLType: SQLType{Name: "VARCHAR"}, Length: 20, Nullable: true})
+	code := NewIndex("code", UniqueType)
+	code.AddColumn("code")
+	customer.AddIndex(code)
+	name := NewIndex("name", IndexType)
+	name.AddColumn("name")
+	customer.AddIndex(name)
+
+	// composite key declared in reverse column order
+	rate := NewEmptyTable()
+	rate.Name = "fx_rate"
+	rate.Schema = "ref"
+	rate.AddColumn(&Column{Name: "currency", SQLType: SQLType{Name: "CHAR"}, Length: 3, IsPrimaryKey: true})
+	rate.AddColumn(&Column{Name: "day", SQLType: SQLType{Name: "DATE"}, IsPrimaryKey: true})
+	rate.PrimaryKeys = []string{"day", "currency"}
+	return []*Table{customer, rate}
+}
+
+const regionLayerYAML = `
+name: region-eu
+tables:
+  - name: customer
+    add:
+      name: customer
+      columns:
+        - name: vat_no
+          sqlType: {name: VARCHAR}
+          length: 20
+          nullable: true
+      indexes:
+        vat_no: {name: vat_no, type: 1, cols: [vat_no], isRegular: true}
+    override:
+      name: customer
+      comment: EU customer record
+      columns:
+        - name: name
+          comment: registered legal name
+    remove:
+      indexes: [name]
+      columns: [legacy_ref]
+  - op: add
+    table:
+      name: vat_rate
+      columns:
+        - name: country
+          sqlType: {name: CHAR}
+          length: 2
+          isPrimaryKey: true
+`
+
+func tenantLayer() *Layer {
+	add := NewEmptyTable()
+	add.AddColumn(&Column{Name: "vat_no", SQLType: SQLType{Name: "INT"}})                 // type clash
+	add.AddColumn(&Column{Name: "tenant_id", SQLType: SQLType{Name: "BIGINT"}})           // new
+	add.AddColumn(&Column{Name: "VAT_NO", SQLType: SQLType{Name: "VARCHAR"}, Length: 20}) // duplicate
+	dupIdx := NewIndex("CODE", IndexType)                                                 // duplicate index name
+	dupIdx.AddColumn("tenant_id")
+	add.AddIndex(dupIdx)
+	badIdx := NewIndex("by_region", IndexType) // unknown column
+	badIdx.AddColumn("region")
+	add.AddIndex(badIdx)
+	fk := NewForeignKey("fk_customer_tenant", "tenant")
+	fk.AddColumn("tenant_id", "id")
+	add.AddForeignKey(fk)
+
+	override := NewEmptyTable()
+	override.AddColumn(&Column{Name: "missing", SQLType: SQLType{Name: "INT"}})
+	override.AddColumn(&Column{Name: "code", SQLType: SQLType{Name: "VARCHAR"}, Length: 64})
+
+	return &Layer{Name: "tenant-acme", Tables: []*TableOverlay{
+		{Name: "customer", Add: add, Override: override, Remove: &OverlayRemoval{
+			Columns: []string{"code", "ghost"}, // code is still indexed
+			Indexes: []string{"ghost"},
+		}},
+		{Name: "fx_rate", Op: OverlayRemove},
+		{Name: "nope", Op: OverlayRemove},
+		{Name: "nope"},
+		{Name: "vat_rate", Op: OverlayAdd, Table: NewTable("vat_rate", nil)},
+		{Name: "nope", Op: OverlayOverride, Table: NewTable("nope", nil)},
+		{Name: "vat_rate", Op: OverlayOverride},
+		{Name: "vat_rate", Op: "rename"},
+	}}
+}
+
+func TestMergeOverlays_Layers(t *testing.T) {
+	region, err := ParseLayer([]byte(regionLayerYAML))
+	if err != nil {
+		t.Fatalf("parse layer: %v", err)
+	}
+	base := overlayBase()
+	res := MergeOverlays(base, region, tenantLayer())
+
+	if base[0].GetColumn("legacy_ref") == nil || len(base[0].Indexes) != 2 || base[0].Comment != "Golden customer record" {
+		t.Fatalf("base must not be modified")
+	}
+	if len(res.Tables) != 2 || res.Tables[0].Name != "customer" || res.Tables[1].Name != "vat_rate" {
+		t.Fatalf("unexpected tables: %v", res.Tables)
+	}
+	cust := res.Tables[0]
+	if got := strings.Join(cust.ColumnsSeq, ","); got != "id,code,name,vat_no,tenant_id" {
+		t.Fatalf("columns = %s", got)
+	}
+	if c := cust.GetColumn("vat_no"); c.SQLType.Name != "VARCHAR" || c.Length != 20 {
+		t.Fatalf("first definition of vat_no must win: %+v", c)
+	}
+	if c := cust.GetColumn("name"); c.Comment != "registered legal name" || c.Length != 128 {
+		t.Fatalf("comment-only override should keep the type: %+v", c)
+	}
+	if c := cust.GetColumn("code"); c.Length != 64 {
+		t.Fatalf("override should replace code: %+v", c)
+	}
+	if cust.Comment != "EU customer record" || cust.Indexes["name"] != nil || cust.Indexes["vat_no"] == nil {
+		t.Fatalf("table changes not applied: %q %v", cust.Comment, cust.Indexes)
+	}
+	if len(cust.ForeignKeys) != 1 || len(cust.PrimaryKeys) != 1 || cust.AutoIncrement != "id" {
+		t.Fatalf("derived fields broken: %+v %v %q", cust.ForeignKeys, cust.PrimaryKeys, cust.AutoIncrement)
+	}
+
+	p := cust.Provenance
+	want := map[string]string{
+		"id": BaseLayerName, "code": "tenant-acme", "name": "region-eu", "vat_no": "region-eu", "tenant_id": "tenant-acme",
+	}
+	for col, layer := range want {
+		if p.Columns[col] != layer {
+			t.Fatalf("provenance of %s = %q, want %q", col, p.Columns[col], layer)
+		}
+	}
+	if p.Table != BaseLayerName || p.Attributes["comment"] != "region-eu" || p.Indexes["code"] != BaseLayerName ||
+		p.Indexes["vat_no"] != "region-eu" || p.ForeignKeys["fk_customer_tenant"] != "tenant-acme" ||
+		p.Removed["column:legacy_ref"] != "region-eu" || p.Removed["index:name"] != "region-eu" {
+		t.Fatalf("unexpected provenance: %+v", p)
+	}
+	if res.Tables[1].Provenance.Table != "region-eu" {
+		t.Fatalf("added table provenance: %+v", res.Tables[1].Provenance)
+	}
+
+	kinds := map[ConflictKind]int{}
+	for _, c := range res.Conflicts {
+		kinds[c.Kind]++
+		if c.Layer != "tenant-acme" {
+			t.Fatalf("unexpected conflict layer: %+v", c)
+		}
+	}
+	wantKinds := map[ConflictKind]int{
+		ConflictTypeClash: 1, ConflictDuplicate: 2, ConflictDuplicateIndex: 1, ConflictUnknownColumn: 1,
+		ConflictInUse: 1, ConflictMissing: 8,
+	}
+	for k, n := range wantKinds {
+		if kinds[k] != n {
+			t.Fatalf("%s conflicts = %d, want %d: %v", k, kinds[k], n, res.Err())
+		}
+	}
+	for _, c := range res.Conflicts {
+		if c.Kind == ConflictTypeClash && (c.Name != "vat_no" || c.Existing != "region-eu" || !strings.Contains(c.Message, "INT clashes with VARCHAR(20)")) {
+			t.Fatalf("unexpected type clash: %+v", c)
+		}
+	}
+	if err := res.Err(); err == nil || !strings.Contains(err.Error(), "layer tenant-acme: index customer.CODE") {
+		t.Fatalf("unexpected Err: %v", err)
+	}
+	if MergeOverlays(base, region).Err() != nil {
+		t.Fatalf("region layer alone should merge cleanly")
+	}
+}
+
+func TestMergeOverlays_ColumnIndexesAndCopies(t *testing.T) {
+	region, err := ParseLayer([]byte(regionLayerYAML))
+	if err != nil {
+		t.Fatalf("parse layer: %v", err)
+	}
+	base := overlayBase()
+	code := base[0].GetColumn("code")
+	code.Indexes = map[string]int{"code": UniqueType}
+	code.EnumOptions = map[string]int{"A": 0}
+	base[0].GetColumn("name").Indexes = map[string]int{"name": IndexType}
+	res := MergeOverlays(base, region)
+	if err := res.Err(); err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+
+	cust := res.Tables[0]
+	if got := cust.GetColumn("vat_no").Indexes; got["vat_no"] != IndexType {
+		t.Fatalf("added index not on its column: %v", got)
+	}
+	if got := cust.GetColumn("name").Indexes; len(got) != 0 {
+		t.Fatalf("removed index still on its column: %v", got)
+	}
+	c := cust.GetColumn("code")
+	c.Indexes["other"] = IndexType
+	c.EnumOptions["B"] = 1
+	if len(code.Indexes) != 1 || len(code.EnumOptions) != 1 || base[0].GetColumn("name").Indexes["name"] != IndexType {
+		t.Fatalf("base column maps changed: %v %v", code.Indexes, code.EnumOptions)
+	}
+}
+
+func TestMergeOverlays_KeyOrderAndReplace(t *testing.T) {
+	replacement := NewEmptyTable()
+	replacement.AddColumn(&Column{Name: "currency", SQLType: SQLType{Name: "CHAR"}, Length: 3, IsPrimaryKey: true})
+	badIdx := NewIndex("by_rate", IndexType)
+	badIdx.AddColumn("rate")
+	replacement.AddIndex(badIdx)
+	fk := NewForeignKey("fk_rate_day", "calendar")
+	fk.AddColumn("day", "day")
+	replacement.AddForeignKey(fk)
+
+	add := NewEmptyTable()
+	add.AddColumn(&Column{Name: "rate", SQLType: SQLType{Name: "DECIMAL"}, Length: 18, Length2: 6})
+	res := MergeOverlays(overlayBase(), &Layer{Name: "l1", Tables: []*TableOverlay{{Name: "fx_rate", Add: add}}})
+	if err := res.Err(); err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	if got := strings.Join(res.Tables[1].PrimaryKeys, ","); got != "day,currency" {
+		t.Fatalf("PK order lost: %s", got)
+	}
+
+	res = MergeOverlays(res.Tables, &Layer{Name: "l2", Tables: []*TableOverlay{
+		{Name: "fx_rate", Schema: "ref", Op: OverlayOverride, Table: replacement},
+	}})
+	tb := res.Tables[1]
+	if tb.FullName() != "ref.fx_rate" || len(tb.Columns) != 1 || len(tb.Indexes) != 0 || len(tb.ForeignKeys) != 0 {
+		t.Fatalf("override should replace the table and drop broken references: %+v", tb)
+	}
+	if len(res.Conflicts) != 2 || res.Conflicts[0].Kind != ConflictUnknownColumn || tb.Provenance.Table != "l2" {
+		t.Fatalf("unexpected result: %v %+v", res.Err(), tb.Provenance)
+	}
+}
+
+func TestMergeOverlays_Serialization(t *testing.T) {
+	region, err := ParseLayer([]byte(regionLayerYAML))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	res := MergeOverlays(overlayBase(), region)
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	var back MergeResult
+	if err := json.Unmarshal(data, &back); err != nil {
+		t.Fatalf("json back: %v", err)
+	}
+	if p := back.Tables[0].Provenance; p == nil || p.Columns["vat_no"] != "region-eu" || p.Removed["column:legacy_ref"] != "region-eu" {
+		t.Fatalf("provenance lost in JSON: %+v", p)
+	}
+
+	y, err := yaml.Marshal(res.Tables[0])
+	if err != nil {
+		t.Fatalf("yaml: %v", err)
+	}
+	var tb Table
+	if err := yaml.Unmarshal(y, &tb); err != nil {
+		t.Fatalf("yaml back: %v", err)
+	}
+	if tb.Provenance == nil || tb.Provenance.Attributes["comment"] != "region-eu" {
+		t.Fatalf("provenance lost in YAML: %+v", tb.Provenance)
+	}
+
+	// layers round trip through files in both formats
+	dir := t.TempDir()
+	lj, _ := json.Marshal(region)
+	if err := os.WriteFile(filepath.Join(dir, "region.json"), lj, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "region.yaml"), []byte(regionLayerYAML), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"region.json", "region.yaml"} {
+		l, err := LoadLayer(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if l.Name != "region-eu" || len(l.Tables) != 2 || l.Tables[0].Remove == nil {
+			t.Fatalf("%s: unexpected layer %+v", name, l)
+		}
+	}
+	if _, err := LoadLayer(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Fatalf("expected missing file error")
+	}
+	if _, err := ParseLayer([]byte("{bad")); err == nil {
+		t.Fatalf("expected parse error")
+	}
+}
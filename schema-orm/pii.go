@@ -0,0 +1,356 @@
+package schema_orm
+
+import (
+	"context"
+	"math/big"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"xorm.io/xorm"
+)
+
+// PIIKind is the kind of personal data a column holds.
+type PIIKind string
+
+const (
+	PIIEmail      PIIKind = "email"
+	PIIPhone      PIIKind = "phone"
+	PIINationalID PIIKind = "national-id"
+	PIIIBAN       PIIKind = "iban"
+	// PIINone marks a column as reviewed and free of personal data; DetectPII
+	// leaves it alone.
+	PIINone PIIKind = "none"
+)
+
+// piiKinds are checked in this order; on equal confidence the earlier kind
+// wins, so "123-45-6789" is a national ID rather than a phone number.
+var piiKinds = []PIIKind{PIIEmail, PIIIBAN, PIINationalID, PIIPhone}
+
+// PIIClassification is stored in Metadata.PII. Signals lists what the
+// detection was based on: "name" (column name heuristics) and "values"
+// (sampled values matching the kind's pattern).
+type PIIClassification struct {
+	Kind       PIIKind  `json:"kind" yaml:"kind"`
+	Confidence float64  `json:"confidence,omitempty" yaml:"confidence,omitempty"`
+	Signals    []string `json:"signals,omitempty" yaml:"signals,omitempty"`
+}
+
+// PIIOptions controls DetectPII.
+//
+// SampleSize caps the rows read per table. A kind is assigned when its
+// confidence reaches MinConfidence. MinMatchRatio is the share of non-empty
+// sampled values that must match a kind's pattern for the values to count as
+// evidence. Overwrite re-classifies columns that already carry a
+// classification. Zero values select the defaults below.
+type PIIOptions struct {
+	SampleSize    int64   `json:"sampleSize,omitempty" yaml:"sampleSize,omitempty"`
+	MinConfidence float64 `json:"minConfidence,omitempty" yaml:"minConfidence,omitempty"`
+	MinMatchRatio float64 `json:"minMatchRatio,omitempty" yaml:"minMatchRatio,omitempty"`
+	Overwrite     bool    `json:"overwrite,omitempty" yaml:"overwrite,omitempty"`
+}
+
+// PII detection defaults and the weight of each signal.
+const (
+	DefaultPIISampleSize    = 1000
+	DefaultPIIMinConfidence = 0.5
+	DefaultPIIMinMatchRatio = 0.8
+	piiNameConfidence       = 0.6
+	piiValueConfidence      = 0.9
+)
+
+func (o PIIOptions) withDefaults() PIIOptions {
+	if o.SampleSize <= 0 {
+		o.SampleSize = DefaultPIISampleSize
+	}
+	if o.MinConfidence <= 0 {
+		o.MinConfidence = DefaultPIIMinConfidence
+	}
+	if o.MinMatchRatio <= 0 {
+		o.MinMatchRatio = DefaultPIIMinMatchRatio
+	}
+	return o
+}
+
+// PIIFinding is a column classified by DetectPII.
+type PIIFinding struct {
+	Table  string `json:"table" yaml:"table"`
+	Column string `json:"column" yaml:"column"`
+	PIIClassification
+}
+
+// DetectPII classifies the columns of the tables from their names, SQL types
+// and, when engine is not nil, up to opts.SampleSize sampled rows per table.
+// Classifications are stored in Column.Metadata.PII and returned as findings.
+// Columns already classified (including PIINone) are skipped unless
+// opts.Overwrite is set.
+func DetectPII(ctx context.Context, engine *xorm.Engine, tables []*Table, opts PIIOptions) ([]PIIFinding, error) {
+	opts = opts.withDefaults()
+	var findings []PIIFinding
+	for _, tb := range tables {
+		if tb == nil {
+			continue
+		}
+		var cols []*Column
+		for _, c := range tb.Columns {
+			if c.Metadata == nil || c.Metadata.PII == nil || opts.Overwrite {
+				if piiCandidate(c.SQLType) {
+					cols = append(cols, c)
+				}
+			}
+		}
+		if len(cols) == 0 {
+			continue
+		}
+		samples := make([][]string, len(cols))
+		if engine != nil {
+			var err error
+			if samples, err = samplePIIValues(ctx, engine, tb, cols, opts.SampleSize); err != nil {
+				return nil, err
+			}
+		}
+		for i, c := range cols {
+			cl := ClassifyColumnPII(c, samples[i], opts)
+			if cl == nil {
+				continue
+			}
+			if c.Metadata == nil {
+				c.Metadata = &Metadata{}
+			}
+			c.Metadata.PII = cl
+			findings = append(findings, PIIFinding{Table: tb.FullName(), Column: c.Name, PIIClassification: *cl})
+		}
+	}
+	return findings, nil
+}
+
+// ClassifyColumnPII returns the most likely PII kind of a column given
+// sampled values (which may be empty), or nil when no kind reaches
+// opts.MinConfidence. The name signal alone gives piiNameConfidence; values
+// matching a pattern give up to piiValueConfidence; together they combine
+// like independent evidence. Samples that mostly contradict a name hint
+// scale its confidence down.
+func ClassifyColumnPII(col *Column, samples []string, opts PIIOptions) *PIIClassification {
+	opts = opts.withDefaults()
+	if !piiCandidate(col.SQLType) {
+		return nil
+	}
+	var nonEmpty []string
+	for _, s := range samples {
+		if s = strings.TrimSpace(s); s != "" {
+			nonEmpty = append(nonEmpty, s)
+		}
+	}
+	tokens := nameTokens(col.Name)
+
+	var best *PIIClassification
+	for _, kind := range piiKinds {
+		if col.SQLType.IsNumeric() && kind != PIIPhone && kind != PIINationalID {
+			continue
+		}
+		var conf float64
+		var signals []string
+		if hasPIIHint(tokens, kind) {
+			conf = piiNameConfidence
+			signals = append(signals, "name")
+		}
+		if len(nonEmpty) > 0 {
+			matched := 0
+			for _, s := range nonEmpty {
+				if piiValueMatchers[kind](s) {
+					matched++
+				}
+			}
+			ratio := float64(matched) / float64(len(nonEmpty))
+			if ratio >= opts.MinMatchRatio {
+				v := piiValueConfidence * ratio
+				conf = conf + v - conf*v
+				signals = append(signals, "values")
+			} else {
+				conf *= ratio / opts.MinMatchRatio
+			}
+		}
+		conf = float64(int(conf*100+0.5)) / 100
+		if conf >= opts.MinConfidence && (best == nil || conf > best.Confidence) {
+			best = &PIIClassification{Kind: kind, Confidence: conf, Signals: signals}
+		}
+	}
+	return best
+}
+
+// piiCandidate reports whether a column of this type can hold the PII kinds
+// we detect.
+func piiCandidate(t SQLType) bool {
+	return !t.IsBlob() && !t.IsTime() && !t.IsBool() && !t.IsJson() && !t.IsArray()
+}
+
+// samplePIIValues reads up to n rows of the given columns as text.
+func samplePIIValues(ctx context.Context, engine *xorm.Engine, tb *Table, cols []*Column, n int64) ([][]string, error) {
+	quoter := engine.Dialect().Quoter()
+	names := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = quoter.Quote(c.Name)
+	}
+	from := quoter.Quote(tb.FullName())
+	var rowCount int64
+	if tb.Profile != nil {
+		rowCount = tb.Profile.RowCount
+	} else if err := engine.DB().QueryRowContext(ctx, "SELECT COUNT(*) FROM "+from).Scan(&rowCount); err != nil {
+		return nil, err
+	}
+	query := "SELECT " + strings.Join(names, ", ") + " FROM " + from
+	if rowCount > n {
+		query += sampleClause(engine.Dialect(), tb, rowCount, n)
+	}
+	query += " LIMIT " + strconv.FormatInt(n, 10)
+	rows, err := engine.DB().QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([][]string, len(cols))
+	raw := make([]any, len(cols))
+	ptrs := make([]any, len(cols))
+	for i := range raw {
+		ptrs[i] = &raw[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		for i, v := range raw {
+			if v != nil {
+				out[i] = append(out[i], profileString(v))
+			}
+		}
+	}
+	return out, rows.Err()
+}
+
+// piiHints are the column name token sequences that suggest a kind.
+var piiHints = map[PIIKind][][]string{
+	PIIEmail: {{"email"}, {"e", "mail"}, {"mail"}},
+	PIIPhone: {{"phone"}, {"telephone"}, {"tel"}, {"mobile"}, {"fax"}, {"msisdn"}},
+	PIINationalID: {{"ssn"}, {"nin"}, {"nino"}, {"passport"}, {"national", "id"}, {"nationalid"},
+		{"id", "card"}, {"idcard"}, {"tax", "id"}, {"taxid"}, {"personal", "id"}, {"citizen", "id"}, {"resident", "id"}},
+	PIIIBAN: {{"iban"}},
+}
+
+// nameTokens splits a column name on non-alphanumerics and camelCase
+// boundaries: "customerEMail_addr" yields [customer e mail addr].
+func nameTokens(name string) []string {
+	var tokens []string
+	var cur []rune
+	flush := func() {
+		if len(cur) > 0 {
+			tokens = append(tokens, strings.ToLower(string(cur)))
+			cur = cur[:0]
+		}
+	}
+	runes := []rune(name)
+	for i, r := range runes {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			flush()
+			continue
+		case unicode.IsUpper(r) && i > 0 && (unicode.IsLower(runes[i-1]) ||
+			i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1])):
+			flush()
+		}
+		cur = append(cur, r)
+	}
+	flush()
+	return tokens
+}
+
+func hasPIIHint(tokens []string, kind PIIKind) bool {
+	for _, hint := range piiHints[kind] {
+		for i := 0; i+len(hint) <= len(tokens); i++ {
+			if slices.Equal(tokens[i:i+len(hint)], hint) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var (
+	emailPattern     = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[A-Za-z]{2,}$`)
+	phonePattern     = regexp.MustCompile(`^\+?\(?[0-9][0-9 ().-]{5,18}[0-9]$`)
+	datePattern      = regexp.MustCompile(`^[0-9]{4}-[0-9]{2}-[0-9]{2}`)
+	ssnPattern       = regexp.MustCompile(`^[0-9]{3}-[0-9]{2}-[0-9]{4}$`)
+	ninoPattern      = regexp.MustCompile(`^[A-CEGHJ-PR-TW-Z]{2}[0-9]{6}[A-D]$`)
+	cnIDPattern      = regexp.MustCompile(`^[0-9]{17}[0-9X]$`)
+	ibanPattern      = regexp.MustCompile(`^[A-Z]{2}[0-9]{2}[A-Z0-9]{11,30}$`)
+	piiValueMatchers = map[PIIKind]func(string) bool{
+		PIIEmail:      emailPattern.MatchString,
+		PIIPhone:      isPhone,
+		PIINationalID: isNationalID,
+		PIIIBAN:       isIBAN,
+	}
+)
+
+// isPhone accepts 7 to 15 digit numbers written with a leading "+" or
+// separators; bare digit strings are too ambiguous to count.
+func isPhone(s string) bool {
+	if !phonePattern.MatchString(s) || datePattern.MatchString(s) {
+		return false
+	}
+	digits := 0
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			digits++
+		}
+	}
+	return digits >= 7 && digits <= 15 && digits != len(s)
+}
+
+// isNationalID accepts US social security numbers, UK national insurance
+// numbers and Chinese resident identity numbers (with their check digit).
+func isNationalID(s string) bool {
+	s = strings.ToUpper(strings.ReplaceAll(s, " ", ""))
+	switch {
+	case ssnPattern.MatchString(s), ninoPattern.MatchString(s):
+		return true
+	case cnIDPattern.MatchString(s):
+		return cnIDCheckDigit(s[:17]) == s[17]
+	}
+	return false
+}
+
+// cnIDCheckDigit computes the ISO 7064 MOD 11-2 check character of the first
+// 17 digits of a Chinese resident identity number.
+func cnIDCheckDigit(digits string) byte {
+	weights := [17]int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	sum := 0
+	for i, w := range weights {
+		sum += int(digits[i]-'0') * w
+	}
+	return "10X98765432"[sum%11]
+}
+
+// isIBAN validates the structure and the ISO 13616 check digits.
+func isIBAN(s string) bool {
+	s = strings.ToUpper(strings.ReplaceAll(s, " ", ""))
+	return ibanPattern.MatchString(s) && ibanRemainder(s[4:]+s[:4]) == 1
+}
+
+// ibanRemainder is the value of the rearranged IBAN, letters counted as
+// 10..35, modulo 97.
+func ibanRemainder(s string) int64 {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= 'A' && r <= 'Z' {
+			b.WriteString(strconv.Itoa(int(r-'A') + 10))
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	n, ok := new(big.Int).SetString(b.String(), 10)
+	if !ok {
+		return -1
+	}
+	return new(big.Int).Mod(n, big.NewInt(97)).Int64()
+}
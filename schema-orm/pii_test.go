@@ -0,0 +1,301 @@
+package schema_orm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"xorm.io/xorm"
+)
+
+const piiDDL = `
+CREATE TABLE person (
+  id INTEGER PRIMARY KEY,
+  contact VARCHAR(128) NOT NULL,
+  mobile_no VARCHAR(32),
+  ssn VARCHAR(16),
+  account VARCHAR(34),
+  phone_type VARCHAR(16),
+  note TEXT
+);
+INSERT INTO person VALUES
+  (1, 'ada@example.org',   '+44 20 7946 0958', '123-45-6789', 'DE89370400440532013000', 'home', 'likes tea'),
+  (2, 'grace@navy.mil',    '(555) 010-4477',   '987-65-4321', 'GB82 WEST 1234 5698 7654 32', 'mobile', NULL),
+  (3, 'alan@bletchley.uk', NULL,               NULL,          NULL, 'work', 'pays by card');
+`
+
+func piiFixture(t *testing.T) (*Table, *xorm.Engine) {
+	t.Helper()
+	eng, err := NewSQLiteEngine(BuildSQLiteDSN(filepath.Join(t.TempDir(), "pii.db")))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { eng.Close() })
+	if _, err := eng.Import(strings.NewReader(piiDDL)); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	tables, err := ExportEngineSchema(context.Background(), eng, ExportOptions{})
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	return tables[0], eng
+}
+
+func TestDetectPII(t *testing.T) {
+	tb, eng := piiFixture(t)
+	tb.GetColumn("note").Metadata = &Metadata{PII: &PIIClassification{Kind: PIINone}}
+
+	findings, err := DetectPII(context.Background(), eng, []*Table{tb}, PIIOptions{})
+	if err != nil {
+		t.Fatalf("DetectPII: %v", err)
+	}
+	got := map[string]PIIKind{}
+	for _, f := range findings {
+		got[f.Column] = f.Kind
+	}
+	want := map[string]PIIKind{"contact": PIIEmail, "mobile_no": PIIPhone, "ssn": PIINationalID, "account": PIIIBAN}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("findings = %+v", findings)
+	}
+	if cl := tb.GetColumn("ssn").Metadata.PII; cl.Confidence != 0.96 || !reflect.DeepEqual(cl.Signals, []string{"name", "values"}) {
+		t.Fatalf("ssn classification = %+v", cl)
+	}
+	if cl := tb.GetColumn("contact").Metadata.PII; cl.Confidence != 0.9 || !reflect.DeepEqual(cl.Signals, []string{"values"}) {
+		t.Fatalf("contact classification = %+v", cl)
+	}
+	// the name hints "phone", but the values contradict it
+	if tb.GetColumn("phone_type").Metadata != nil {
+		t.Fatalf("phone_type classified: %+v", tb.GetColumn("phone_type").Metadata.PII)
+	}
+	if tb.GetColumn("note").Metadata.PII.Kind != PIINone {
+		t.Fatal("reviewed columns are kept")
+	}
+
+	// the classification is part of the schema
+	b, err := json.Marshal(tb)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if !strings.Contains(string(b), `"pii":{"kind":"iban","confidence":0.9,"signals":["values"]}`) {
+		t.Fatalf("json: %s", b)
+	}
+}
+
+func TestClassifyColumnPII(t *testing.T) {
+	col := func(name, typ string) *Column { return &Column{Name: name, SQLType: SQLType{Name: typ}} }
+	cases := []struct {
+		col     *Column
+		samples []string
+		want    PIIKind
+	}{
+		{col("customerEMail", "VARCHAR"), nil, PIIEmail},
+		{col("tel", "BIGINT"), nil, PIIPhone},
+		{col("citizen_id", "CHAR"), []string{"11010519491231002X", " AB123456C "}, PIINationalID},
+		{col("ref", "VARCHAR"), []string{"11010519491231002Y"}, ""}, // wrong check digit
+		{col("ref", "VARCHAR"), []string{"DE89370400440532013001"}, ""},
+		{col("ref", "VARCHAR"), []string{"2024-01-31", "2024-02-01"}, ""},
+		{col("ref", "VARCHAR"), []string{"12345678"}, ""},
+		{col("email", "BLOB"), []string{"a@b.co"}, ""},
+		{col("hotel", "VARCHAR"), nil, ""},
+	}
+	for _, c := range cases {
+		got := ClassifyColumnPII(c.col, c.samples, PIIOptions{})
+		if (got == nil) != (c.want == "") || got != nil && got.Kind != c.want {
+			t.Fatalf("%s %v: got %+v, want %q", c.col.Name, c.samples, got, c.want)
+		}
+	}
+	if got := nameTokens("customerEMail_addr"); !reflect.DeepEqual(got, []string{"customer", "e", "mail", "addr"}) {
+		t.Fatalf("tokens = %v", got)
+	}
+}
+
+func TestMaskPolicy(t *testing.T) {
+	policy, err := ParseMaskPolicy([]byte(`
+secret: s3cret
+default: hash
+kinds: {email: fake, iban: fake, national-id: tokenize}
+rules:
+  - {table: person, column: note, method: "null"}
+  - {column: ssn, method: keep}
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	tb := NewEmptyTable()
+	tb.Name = "person"
+	add := func(name string, kind PIIKind, nullable bool) {
+		c := &Column{Name: name, SQLType: SQLType{Name: "VARCHAR"}, Length: 34, Nullable: nullable}
+		if kind != "" {
+			c.Metadata = &Metadata{PII: &PIIClassification{Kind: kind}}
+		}
+		tb.AddColumn(c)
+	}
+	add("email", PIIEmail, false)
+	add("mobile", PIIPhone, true)
+	add("ssn", PIINationalID, true)
+	add("passport", PIINationalID, true)
+	add("iban", PIIIBAN, true)
+	add("note", "", true)
+	add("city", "", true)
+
+	rm, err := NewRowMasker(policy, tb)
+	if err != nil {
+		t.Fatalf("masker: %v", err)
+	}
+	row := func() []any {
+		return []any{"Ada.L@example.org", []byte("+44 20 7946 0958"), "123-45-6789", "X1234567", "GB82 WEST 1234 5698 7654 32", "secret", "London"}
+	}
+	a, b := row(), row()
+	rm.Mask(a)
+	rm.Mask(b)
+	if !reflect.DeepEqual(a, b) {
+		t.Fatalf("masking must be deterministic: %v vs %v", a, b)
+	}
+	email := a[0].(string)
+	if !strings.HasSuffix(email, "@example.com") || valuePattern(email) != "AAA.A@AAAAAAA.AAA" || email == "Ada.L@example.com" {
+		t.Fatalf("email = %q", email)
+	}
+	if s := a[1].(string); len(s) != 34 || strings.Contains(s, "7946") {
+		t.Fatalf("phone hash = %q", s) // truncated to the column length
+	}
+	if a[2] != "123-45-6789" || a[6] != "London" || a[5] != nil {
+		t.Fatalf("rules: %v", a)
+	}
+	if s := a[3].(string); !strings.HasPrefix(s, "tok_") || len(s) != 20 {
+		t.Fatalf("token = %q", s)
+	}
+	if s := a[4].(string); !isIBAN(s) || !strings.HasPrefix(s, "GB") || valuePattern(s) != "AA99 AAAA 9999 9999 9999 99" || s == "GB82 WEST 1234 5698 7654 32" {
+		t.Fatalf("iban = %q", s)
+	}
+
+	other := *policy
+	other.Secret = "other"
+	rm2, _ := NewRowMasker(&other, tb)
+	c := row()
+	rm2.Mask(c)
+	if c[0] == a[0] {
+		t.Fatal("the secret must change the output")
+	}
+
+	var none *MaskPolicy
+	if rm, _ := NewRowMasker(none, tb); rm.Masks() {
+		t.Fatal("a nil policy keeps everything")
+	}
+}
+
+func TestNewRowMasker_Errors(t *testing.T) {
+	tb := NewEmptyTable()
+	tb.Name = "t"
+	tb.AddColumn(&Column{Name: "code", SQLType: SQLType{Name: "VARCHAR"}})
+	tb.AddColumn(&Column{Name: "n", SQLType: SQLType{Name: "INTEGER"}, Nullable: true})
+	for _, p := range []*MaskPolicy{
+		{Secret: "k", Rules: []MaskRule{{Column: "code", Method: MaskNull}}},
+		{Secret: "k", Rules: []MaskRule{{Column: "n", Method: MaskHash}}},
+		{Secret: "k", Rules: []MaskRule{{Column: "n", Method: "scramble"}}},
+		{Rules: []MaskRule{{Column: "code", Method: MaskFake}}},
+	} {
+		if _, err := NewRowMasker(p, tb); err == nil {
+			t.Fatalf("expected error for %+v", p.Rules)
+		}
+	}
+	rm, err := NewRowMasker(&MaskPolicy{Secret: "k", Rules: []MaskRule{{Column: "n", Method: MaskFake}}}, tb)
+	if err != nil {
+		t.Fatalf("masker: %v", err)
+	}
+	row := []any{"x", int64(4711)}
+	rm.Mask(row)
+	if n, ok := row[1].(int64); !ok || n < 1000 || n > 9999 {
+		t.Fatalf("fake number = %#v", row[1])
+	}
+}
+
+func TestExportAndCopyTableData_Masked(t *testing.T) {
+	tb, eng := piiFixture(t)
+	ctx := context.Background()
+	if _, err := DetectPII(ctx, eng, []*Table{tb}, PIIOptions{}); err != nil {
+		t.Fatalf("DetectPII: %v", err)
+	}
+	opts := DataOptions{Mask: &MaskPolicy{Secret: "k", Default: MaskNull, Kinds: map[PIIKind]MaskMethod{PIIEmail: MaskFake}}, BatchSize: 2}
+
+	var buf bytes.Buffer
+	n, err := ExportTableData(ctx, eng, tb, &buf, opts)
+	if err != nil || n != 3 {
+		t.Fatalf("export: %d %v", n, err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[2], `{"id":3,"contact":"`) ||
+		!strings.HasSuffix(lines[2], `@example.com","mobile_no":null,"ssn":null,"account":null,"phone_type":"work","note":"pays by card"}`) {
+		t.Fatalf("ndjson:\n%s", buf.String())
+	}
+	if strings.Contains(buf.String(), "ada@") || strings.Contains(buf.String(), "123-45") {
+		t.Fatalf("unmasked data exported:\n%s", buf.String())
+	}
+
+	dst, err := NewSQLiteEngine(BuildSQLiteDSN(filepath.Join(t.TempDir(), "test.db")))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer dst.Close()
+	if err := ApplyTables(ctx, dst, []*Table{tb}); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if n, err := CopyTableData(ctx, eng, dst, tb, opts); err != nil || n != 3 {
+		t.Fatalf("copy: %d %v", n, err)
+	}
+	var copied bytes.Buffer
+	if _, err := ExportTableData(ctx, dst, tb, &copied, DataOptions{}); err != nil {
+		t.Fatalf("export copy: %v", err)
+	}
+	if copied.String() != buf.String() {
+		t.Fatalf("copy differs from masked export:\n%s\n%s", copied.String(), buf.String())
+	}
+
+	// a failing batch rolls the copy back
+	if _, err := CopyTableData(ctx, eng, dst, tb, opts); err == nil {
+		t.Fatal("expected primary key violation")
+	}
+	var count int
+	if _, err := dst.SQL("SELECT COUNT(*) FROM person").Get(&count); err != nil || count != 3 {
+		t.Fatalf("rows after failed copy: %d %v", count, err)
+	}
+}
+
+func TestCopyTableData_ParameterLimit(t *testing.T) {
+	ctx := context.Background()
+	// 500 columns x 200 rows per statement would need 100000 parameters
+	cols := make([]string, 500)
+	for i := range cols {
+		cols[i] = fmt.Sprintf("c%d INTEGER", i)
+	}
+	ddl := "CREATE TABLE wide (" + strings.Join(cols, ", ") + ")"
+	var engines [2]*xorm.Engine
+	for i := range engines {
+		eng, err := NewSQLiteEngine(BuildSQLiteDSN(filepath.Join(t.TempDir(), "wide.db")))
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		defer eng.Close()
+		if _, err := eng.Exec(ddl); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		engines[i] = eng
+	}
+	src, dst := engines[0], engines[1]
+	for i := 0; i < 100; i++ {
+		if _, err := src.Exec("INSERT INTO wide (c0) VALUES (?)", i); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+	}
+	tables, err := ExportEngineSchema(ctx, src, ExportOptions{})
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if n, err := CopyTableData(ctx, src, dst, tables[0], DataOptions{}); err != nil || n != 100 {
+		t.Fatalf("copy: %d %v", n, err)
+	}
+}
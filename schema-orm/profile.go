@@ -0,0 +1,374 @@
+package schema_orm
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"xorm.io/xorm"
+	"xorm.io/xorm/dialects"
+	xs "xorm.io/xorm/schemas"
+)
+
+// ProfileOptions controls data profiling.
+//
+// SampleSize caps the rows read per table; tables with more rows are sampled
+// without sorting them, see sampleClause and TableProfile.SampleMethod. TopN is the number of most frequent values and patterns kept per column.
+// Concurrency bounds how many tables are profiled at the same time.
+// Zero values select the defaults below.
+type ProfileOptions struct {
+	SampleSize  int64 `json:"sampleSize,omitempty" yaml:"sampleSize,omitempty"`
+	TopN        int   `json:"topN,omitempty" yaml:"topN,omitempty"`
+	Concurrency int   `json:"concurrency,omitempty" yaml:"concurrency,omitempty"`
+}
+
+// profiling defaults
+const (
+	DefaultProfileSampleSize  = 10000
+	DefaultProfileTopN        = 10
+	DefaultProfileConcurrency = 4
+	// maxPatternLength truncates value patterns so long texts don't produce unique patterns
+	maxPatternLength = 32
+)
+
+func (o ProfileOptions) withDefaults() ProfileOptions {
+	if o.SampleSize <= 0 {
+		o.SampleSize = DefaultProfileSampleSize
+	}
+	if o.TopN <= 0 {
+		o.TopN = DefaultProfileTopN
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = DefaultProfileConcurrency
+	}
+	return o
+}
+
+// ValueCount is a value (or pattern) with the number of sampled rows holding it.
+type ValueCount struct {
+	Value string `json:"value" yaml:"value"`
+	Count int64  `json:"count" yaml:"count"`
+}
+
+// ColumnProfile summarises the sampled values of one column.
+// Min and Max compare numerically for numeric columns and lexically otherwise.
+// Lengths maps the character length of non-null values to their frequency.
+// Patterns abstract values by character class: letters become "A", digits "9",
+// everything else is kept, so "ABC-123" yields "AAA-999".
+type ColumnProfile struct {
+	Name          string        `json:"name" yaml:"name"`
+	NullCount     int64         `json:"nullCount" yaml:"nullCount"`
+	NullRatio     float64       `json:"nullRatio" yaml:"nullRatio"`
+	DistinctCount int64         `json:"distinctCount" yaml:"distinctCount"`
+	Min           string        `json:"min,omitempty" yaml:"min,omitempty"`
+	Max           string        `json:"max,omitempty" yaml:"max,omitempty"`
+	MinLength     int           `json:"minLength" yaml:"minLength"`
+	MaxLength     int           `json:"maxLength" yaml:"maxLength"`
+	AvgLength     float64       `json:"avgLength" yaml:"avgLength"`
+	Lengths       map[int]int64 `json:"lengths,omitempty" yaml:"lengths,omitempty"`
+	TopValues     []ValueCount  `json:"topValues,omitempty" yaml:"topValues,omitempty"`
+	Patterns      []ValueCount  `json:"patterns,omitempty" yaml:"patterns,omitempty"`
+}
+
+// columnStats accumulates the sample of one column into its profile.
+type columnStats struct {
+	*ColumnProfile
+	numeric   bool // compare min/max as numbers
+	nonNull   int64
+	values    map[string]int64 // distinct values in the sample
+	patterns  map[string]int64
+	lengthSum int64
+	minNum    float64
+	maxNum    float64
+}
+
+// TableProfile is the profiling result of one table.
+// RowCount is the full table size, SampledRows the number of rows analysed.
+// SampleMethod tells how a sampled table was sampled, one of the Sample*
+// constants.
+type TableProfile struct {
+	RowCount     int64            `json:"rowCount" yaml:"rowCount"`
+	SampledRows  int64            `json:"sampledRows" yaml:"sampledRows"`
+	Sampled      bool             `json:"sampled,omitempty" yaml:"sampled,omitempty"`
+	SampleMethod string           `json:"sampleMethod,omitempty" yaml:"sampleMethod,omitempty"`
+	ProfiledAt   time.Time        `json:"profiledAt" yaml:"profiledAt"`
+	Columns      []*ColumnProfile `json:"columns" yaml:"columns"`
+}
+
+// Column returns the profile of the named column (case-insensitive), or nil.
+func (p *TableProfile) Column(name string) *ColumnProfile {
+	for _, c := range p.Columns {
+		if strings.EqualFold(c.Name, name) {
+			return c
+		}
+	}
+	return nil
+}
+
+// ProfileTables profiles every table with at most opts.Concurrency tables in flight
+// and stores each result on Table.Profile. The first error cancels the remaining work.
+func ProfileTables(ctx context.Context, engine *xorm.Engine, tables []*Table, opts ProfileOptions) error {
+	opts = opts.withDefaults()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+		sem      = make(chan struct{}, opts.Concurrency)
+	)
+	for _, tb := range tables {
+		if tb == nil {
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(tb *Table) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			p, err := ProfileTable(ctx, engine, tb, opts)
+			if err != nil {
+				once.Do(func() {
+					firstErr = fmt.Errorf("profile %s: %w", tb.FullName(), err)
+					cancel()
+				})
+				return
+			}
+			tb.Profile = p
+		}(tb)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// ProfileTable counts the rows of a table, reads up to opts.SampleSize of them
+// and profiles every column of the table definition.
+func ProfileTable(ctx context.Context, engine *xorm.Engine, table *Table, opts ProfileOptions) (*TableProfile, error) {
+	opts = opts.withDefaults()
+	quoter := engine.Dialect().Quoter()
+	from := quoter.Quote(table.FullName())
+
+	p := &TableProfile{ProfiledAt: time.Now().UTC()}
+	if err := engine.DB().QueryRowContext(ctx, "SELECT COUNT(*) FROM "+from).Scan(&p.RowCount); err != nil {
+		return nil, err
+	}
+	if len(table.Columns) == 0 {
+		return p, nil
+	}
+
+	cols := make([]string, len(table.Columns))
+	stats := make([]*columnStats, len(table.Columns))
+	p.Columns = make([]*ColumnProfile, len(table.Columns))
+	for i, c := range table.Columns {
+		cols[i] = quoter.Quote(c.Name)
+		p.Columns[i] = &ColumnProfile{Name: c.Name, Lengths: make(map[int]int64)}
+		stats[i] = &columnStats{
+			ColumnProfile: p.Columns[i],
+			numeric:       c.SQLType.IsNumeric(),
+			values:        make(map[string]int64),
+			patterns:      make(map[string]int64),
+		}
+	}
+	query := "SELECT " + strings.Join(cols, ", ") + " FROM " + from
+	if p.RowCount > opts.SampleSize {
+		var clause string
+		clause, p.SampleMethod = chooseSample(engine.Dialect(), table, p.RowCount, opts.SampleSize)
+		p.Sampled = true
+		query += clause
+	}
+	query += " LIMIT " + strconv.FormatInt(opts.SampleSize, 10)
+
+	rows, err := engine.DB().QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	raw := make([]any, len(cols))
+	ptrs := make([]any, len(cols))
+	for i := range raw {
+		ptrs[i] = &raw[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		p.SampledRows++
+		for i, v := range raw {
+			stats[i].observe(v)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, c := range stats {
+		c.finish(p.SampledRows, opts.TopN)
+	}
+	return p, nil
+}
+
+// Sampling methods of TableProfile.SampleMethod.
+const (
+	// SampleTableSample is PostgreSQL's TABLESAMPLE SYSTEM.
+	SampleTableSample = "tablesample"
+	// SampleKeyRange reads consecutive primary keys from a random offset.
+	SampleKeyRange = "keyRange"
+	// SampleFirstRows reads the first rows the database returns.
+	SampleFirstRows = "firstRows"
+)
+
+// sampleClause returns what follows the FROM of the sample query of a table
+// with rowCount rows so that a LIMIT of n, appended by the caller, reads a
+// sample without sorting the table; see chooseSample.
+func sampleClause(dialect dialects.Dialect, table *Table, rowCount, n int64) string {
+	clause, _ := chooseSample(dialect, table, rowCount, n)
+	return clause
+}
+
+// chooseSample returns the clause of sampleClause and the method it uses:
+// TABLESAMPLE on PostgreSQL; with a single-column primary key, the n keys
+// that follow a random offset in key order, which the key's index serves;
+// otherwise the first n rows.
+func chooseSample(dialect dialects.Dialect, table *Table, rowCount, n int64) (string, string) {
+	if dialect.URI().DBType == xs.POSTGRES {
+		// oversample so that the LIMIT, not the block sampling, decides the size
+		pct := min(100, 200*float64(n)/float64(rowCount))
+		return " TABLESAMPLE SYSTEM (" + strconv.FormatFloat(pct, 'f', -1, 64) + ")", SampleTableSample
+	}
+	pks := table.PKColumns()
+	if len(pks) != 1 || rowCount <= n {
+		return "", SampleFirstRows
+	}
+	quoter := dialect.Quoter()
+	pk := quoter.Quote(pks[0].Name)
+	offset := rand.Int64N(rowCount - n + 1)
+	return " WHERE " + pk + " >= (SELECT " + pk + " FROM " + quoter.Quote(table.FullName()) +
+		" ORDER BY " + pk + " LIMIT 1 OFFSET " + strconv.FormatInt(offset, 10) + ") ORDER BY " + pk, SampleKeyRange
+}
+
+func (c *columnStats) observe(v any) {
+	if v == nil {
+		c.NullCount++
+		return
+	}
+	s := profileString(v)
+	c.nonNull++
+	c.values[s]++
+	c.patterns[valuePattern(s)]++
+
+	l := utf8.RuneCountInString(s)
+	c.Lengths[l]++
+	c.lengthSum += int64(l)
+	first := c.nonNull == 1
+	if first || l < c.MinLength {
+		c.MinLength = l
+	}
+	if l > c.MaxLength {
+		c.MaxLength = l
+	}
+
+	if c.numeric {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			if first || f < c.minNum {
+				c.minNum, c.Min = f, s
+			}
+			if first || f > c.maxNum {
+				c.maxNum, c.Max = f, s
+			}
+			return
+		}
+	}
+	if first || s < c.Min {
+		c.Min = s
+	}
+	if first || s > c.Max {
+		c.Max = s
+	}
+}
+
+func (c *columnStats) finish(rows int64, topN int) {
+	if rows > 0 {
+		c.NullRatio = float64(c.NullCount) / float64(rows)
+	}
+	if c.nonNull > 0 {
+		c.AvgLength = float64(c.lengthSum) / float64(c.nonNull)
+	}
+	c.DistinctCount = int64(len(c.values))
+	c.TopValues = topValueCounts(c.values, topN)
+	c.Patterns = topValueCounts(c.patterns, topN)
+}
+
+// topValueCounts returns the n most frequent entries, ties broken by value.
+func topValueCounts(m map[string]int64, n int) []ValueCount {
+	out := make([]ValueCount, 0, len(m))
+	for v, cnt := range m {
+		out = append(out, ValueCount{Value: v, Count: cnt})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Value < out[j].Value
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+// profileString renders a scanned driver value as text.
+func profileString(v any) string {
+	switch x := v.(type) {
+	case []byte:
+		return string(x)
+	case string:
+		return x
+	case time.Time:
+		return x.Format(time.RFC3339Nano)
+	case bool:
+		return strconv.FormatBool(x)
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// valuePattern maps letters to "A" and digits to "9", keeping other characters.
+func valuePattern(s string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range s {
+		if n == maxPatternLength {
+			b.WriteString("…")
+			break
+		}
+		switch {
+		case unicode.IsLetter(r):
+			b.WriteByte('A')
+		case unicode.IsDigit(r):
+			b.WriteByte('9')
+		default:
+			b.WriteRune(r)
+		}
+		n++
+	}
+	return b.String()
+}
@@ -0,0 +1,233 @@
+package schema_orm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"xorm.io/xorm/dialects"
+)
+
+func newProfileFixture(t *testing.T) string {
+	t.Helper()
+	dsn := newSQLiteFixture(t, filepath.Join(t.TempDir(), "profile.db"))
+	eng, err := NewSQLiteEngine(dsn)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer eng.Close()
+	rows := []struct {
+		code  string
+		name  any
+		score float64
+	}{
+		{"ABC-001", "Acme", 10},
+		{"ABC-002", "Acme", 2.5},
+		{"XY-9", nil, 7},
+		{"ABC-003", "Globex Corp", 100},
+	}
+	for _, r := range rows {
+		if _, err := eng.Exec("INSERT INTO customer (code, name, score) VALUES (?, ?, ?)", r.code, r.name, r.score); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+	}
+	return dsn
+}
+
+func TestProfileTable_SQLite(t *testing.T) {
+	dsn := newProfileFixture(t)
+	eng, err := NewSQLiteEngine(dsn)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer eng.Close()
+	tables, err := ExportEngineSchema(context.Background(), eng, ExportOptions{Include: []string{"customer"}})
+	if err != nil || len(tables) != 1 {
+		t.Fatalf("export: %v %v", err, tables)
+	}
+	p, err := ProfileTable(context.Background(), eng, tables[0], ProfileOptions{TopN: 2})
+	if err != nil {
+		t.Fatalf("profile: %v", err)
+	}
+	if p.RowCount != 4 || p.SampledRows != 4 || p.Sampled {
+		t.Fatalf("unexpected counts: %+v", p)
+	}
+
+	code := p.Column("CODE")
+	if code == nil || code.DistinctCount != 4 || code.NullCount != 0 {
+		t.Fatalf("code profile: %+v", code)
+	}
+	if len(code.Patterns) != 2 || code.Patterns[0] != (ValueCount{Value: "AAA-999", Count: 3}) || code.Patterns[1].Value != "AA-9" {
+		t.Fatalf("code patterns: %+v", code.Patterns)
+	}
+	if code.MinLength != 4 || code.MaxLength != 7 || code.Lengths[7] != 3 || code.Min != "ABC-001" || code.Max != "XY-9" {
+		t.Fatalf("code lengths/minmax: %+v", code)
+	}
+
+	name := p.Column("name")
+	if name.NullCount != 1 || name.NullRatio != 0.25 || name.DistinctCount != 2 {
+		t.Fatalf("name profile: %+v", name)
+	}
+	if len(name.TopValues) != 2 || name.TopValues[0] != (ValueCount{Value: "Acme", Count: 2}) {
+		t.Fatalf("name top values: %+v", name.TopValues)
+	}
+
+	score := p.Column("score")
+	if score.Min != "2.5" || score.Max != "100" {
+		t.Fatalf("score min/max should compare numerically: %+v", score)
+	}
+	if p.Column("missing") != nil {
+		t.Fatalf("unknown column should be nil")
+	}
+}
+
+func TestProfileTable_Sampling(t *testing.T) {
+	eng, err := NewSQLiteEngine("")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer eng.Close()
+	if _, err := eng.Exec("CREATE TABLE big (n INTEGER)"); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	for i := 0; i < 50; i++ {
+		if _, err := eng.Exec("INSERT INTO big (n) VALUES (?)", i); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+	}
+	tb := NewTable("big", nil)
+	tb.AddColumn(NewColumn("n", "", SQLType{Name: "INTEGER"}, 0, 0, true))
+	p, err := ProfileTable(context.Background(), eng, tb, ProfileOptions{SampleSize: 10})
+	if err != nil {
+		t.Fatalf("profile: %v", err)
+	}
+	if p.RowCount != 50 || p.SampledRows != 10 || !p.Sampled {
+		t.Fatalf("expected a 10 row sample of 50: %+v", p)
+	}
+}
+
+func TestProfileTable_SamplingByKey(t *testing.T) {
+	eng, err := NewSQLiteEngine("")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer eng.Close()
+	// sparse integer keys, text keys and no key at all
+	if _, err := eng.Import(strings.NewReader(`
+		CREATE TABLE big (id INTEGER PRIMARY KEY, n INTEGER);
+		CREATE TABLE named (code TEXT PRIMARY KEY, n INTEGER);
+		CREATE TABLE heap (n INTEGER);
+	`)); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	for i := 1; i <= 50; i++ {
+		for _, q := range []string{
+			"INSERT INTO big (id, n) VALUES (?, ?)",
+			"INSERT INTO named (code, n) VALUES ('k' || ?, ?)",
+			"INSERT INTO heap (n) VALUES (? + ?)",
+		} {
+			if _, err := eng.Exec(q, i*i*7, i); err != nil {
+				t.Fatalf("insert: %v", err)
+			}
+		}
+	}
+	tables, err := ExportEngineSchema(context.Background(), eng, ExportOptions{})
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	want := map[string]string{"big": SampleKeyRange, "named": SampleKeyRange, "heap": SampleFirstRows}
+	for _, tb := range tables {
+		p, err := ProfileTable(context.Background(), eng, tb, ProfileOptions{SampleSize: 10})
+		if err != nil {
+			t.Fatalf("profile %s: %v", tb.Name, err)
+		}
+		if !p.Sampled || p.SampledRows != 10 || p.SampleMethod != want[tb.Name] {
+			t.Fatalf("%s: %+v", tb.Name, p)
+		}
+	}
+
+	big := tables[0]
+	pg, _ := dialects.OpenDialect("postgres", "postgres://u@localhost/db")
+	if got, method := chooseSample(pg, big, 1000, 10); got != " TABLESAMPLE SYSTEM (2)" || method != SampleTableSample {
+		t.Fatalf("postgres: %q %s", got, method)
+	}
+	if got := sampleClause(pg, big, 10, 10); got != " TABLESAMPLE SYSTEM (100)" {
+		t.Fatalf("postgres small: %q", got)
+	}
+}
+
+func TestProfileTables_ConcurrencyAndExport(t *testing.T) {
+	dsn := newProfileFixture(t)
+	tables, err := ExportSchema(context.Background(), SQLiteDriver, dsn, ExportOptions{
+		Profile: &ProfileOptions{Concurrency: 1},
+	})
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	for _, tb := range tables {
+		if tb.Profile == nil {
+			t.Fatalf("table %s has no profile", tb.Name)
+		}
+	}
+	b, err := json.Marshal(tables)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	back, err := ImportTablesFromJSON(string(b))
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	for _, tb := range back {
+		if tb.Name == "customer" && (tb.Profile == nil || tb.Profile.RowCount != 4) {
+			t.Fatalf("profile lost in JSON round trip: %+v", tb.Profile)
+		}
+	}
+
+	// without the option no profile section is exported
+	plain, err := ExportSchemaToJSON(context.Background(), SQLiteDriver, dsn, ExportOptions{})
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	var raw []map[string]any
+	if err := json.Unmarshal([]byte(plain), &raw); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	for _, m := range raw {
+		if _, ok := m["profile"]; ok {
+			t.Fatalf("unexpected profile section: %v", m)
+		}
+	}
+}
+
+func TestProfileTables_Error(t *testing.T) {
+	eng, err := NewSQLiteEngine("")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer eng.Close()
+	tables := []*Table{nil}
+	for i := 0; i < 5; i++ {
+		tables = append(tables, NewTable(fmt.Sprintf("missing_%d", i), nil))
+	}
+	if err := ProfileTables(context.Background(), eng, tables, ProfileOptions{Concurrency: 2}); err == nil {
+		t.Fatalf("expected error for missing tables")
+	}
+}
+
+func TestValuePattern(t *testing.T) {
+	cases := map[string]string{
+		"ABC-123":  "AAA-999",
+		"a.b@c.io": "A.A@A.AA",
+		"":         "",
+		"北京 100":   "AA 999",
+		"0123456789012345678901234567890123456789": "99999999999999999999999999999999…",
+	}
+	for in, want := range cases {
+		if got := valuePattern(in); got != want {
+			t.Fatalf("valuePattern(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package schema_orm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	xs "xorm.io/xorm/schemas"
+)
+
+// ProtoOptions controls WriteProto. Package defaults to "mdm". Message names
+// come from Table2Obj of the Naming table mapper (xorm defaults when nil);
+// tables with a Schema get the schema as a name prefix.
+type ProtoOptions struct {
+	Package   string
+	GoPackage string
+	Naming    *Naming
+}
+
+// messageName returns the record/message name of a table.
+func messageName(tb *Table, naming *Naming) (string, error) {
+	tableMapper, _, err := naming.Mappers()
+	if err != nil {
+		return "", err
+	}
+	name := tb.Name
+	if tb.Schema != "" {
+		name = tb.Schema + "_" + tb.Name
+	}
+	return goName(tableMapper, name), nil
+}
+
+// schemaIdent turns a column name into a protobuf/Avro field name:
+// letters, digits and underscores, not starting with a digit.
+func schemaIdent(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	s := b.String()
+	if s == "" || !unicode.IsLetter(rune(s[0])) && s[0] != '_' {
+		s = "f_" + s
+	}
+	return s
+}
+
+// fieldIdents returns the schemaIdent of each column; two columns of the
+// table that map to the same field name are an error.
+func fieldIdents(tb *Table, cols []*Column) ([]string, error) {
+	idents := make([]string, len(cols))
+	seen := make(map[string]string, len(cols))
+	for i, col := range cols {
+		idents[i] = schemaIdent(col.Name)
+		if other, ok := seen[idents[i]]; ok {
+			return nil, fmt.Errorf("table %s: columns %s and %s both map to field %s", tb.FullName(), other, col.Name, idents[i])
+		}
+		seen[idents[i]] = col.Name
+	}
+	return idents, nil
+}
+
+// protoType maps a column to a protobuf scalar or well-known type.
+// DECIMAL/NUMERIC travel as strings to keep their precision; DATE and TIME as
+// strings in ISO 8601 form; date-times as google.protobuf.Timestamp.
+func protoType(col *Column) string {
+	switch strings.TrimSuffix(strings.ToUpper(col.SQLType.Name), "[]") {
+	case xs.Bool, "BOOLEAN":
+		return "bool"
+	case xs.Bit:
+		if col.Length <= 1 {
+			return "bool"
+		}
+		return "uint64"
+	case xs.TinyInt, xs.SmallInt, xs.MediumInt, xs.Int, xs.Integer, xs.Serial, xs.Year:
+		return "int32"
+	case xs.BigInt, xs.BigSerial:
+		return "int64"
+	case xs.UnsignedBit, xs.UnsignedTinyInt, xs.UnsignedSmallInt, xs.UnsignedMediumInt, xs.UnsignedInt:
+		return "uint32"
+	case xs.UnsignedBigInt:
+		return "uint64"
+	case xs.Float, xs.Real:
+		return "float"
+	case xs.Double, "DOUBLE PRECISION":
+		return "double"
+	case xs.DateTime, xs.TimeStamp, xs.TimeStampz, xs.SmallDateTime:
+		return "google.protobuf.Timestamp"
+	case xs.TinyBlob, xs.Blob, xs.MediumBlob, xs.LongBlob, xs.Bytea, xs.Binary, xs.VarBinary, "IMAGE":
+		return "bytes"
+	}
+	return "string"
+}
+
+// WriteProto renders a proto3 file with one message per table, in name order.
+// Field numbers come from numbering (see FieldNumbering.Assign) and fields are
+// listed by number; every column must have one. Nullable columns are
+// "optional", array columns "repeated", and numbers and names of dropped
+// columns are declared reserved.
+func WriteProto(w io.Writer, tables []*Table, numbering FieldNumbering, opts ProtoOptions) error {
+	pkg := opts.Package
+	if pkg == "" {
+		pkg = "mdm"
+	}
+	sorted := make([]*Table, 0, len(tables))
+	for _, tb := range tables {
+		if tb != nil {
+			sorted = append(sorted, tb)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].FullName() < sorted[j].FullName() })
+
+	var body bytes.Buffer
+	usesTimestamp := false
+	for _, tb := range sorted {
+		name, err := messageName(tb, opts.Naming)
+		if err != nil {
+			return err
+		}
+		fn := numbering[tb.FullName()]
+		cols, nums, missing := numberedColumns(tb, fn)
+		if len(missing) > 0 {
+			return fmt.Errorf("table %s: no field number for %s", tb.FullName(), strings.Join(missing, ", "))
+		}
+		idents, err := fieldIdents(tb, cols)
+		if err != nil {
+			return err
+		}
+
+		body.WriteByte('\n')
+		if tb.Comment != "" {
+			fmt.Fprintf(&body, "// %s\n", oneLine(tb.Comment))
+		}
+		fmt.Fprintf(&body, "message %s {\n", name)
+		if fn != nil && len(fn.Reserved) > 0 {
+			reserved := append([]int(nil), fn.Reserved...)
+			sort.Ints(reserved)
+			parts := make([]string, len(reserved))
+			for i, n := range reserved {
+				parts[i] = strconv.Itoa(n)
+			}
+			fmt.Fprintf(&body, "  reserved %s;\n", strings.Join(parts, ", "))
+		}
+		if fn != nil && len(fn.ReservedNames) > 0 {
+			quoted := make([]string, len(fn.ReservedNames))
+			for i, n := range fn.ReservedNames {
+				quoted[i] = strconv.Quote(schemaIdent(n))
+			}
+			fmt.Fprintf(&body, "  reserved %s;\n", strings.Join(quoted, ", "))
+		}
+		for i, col := range cols {
+			typ := protoType(col)
+			if typ == "google.protobuf.Timestamp" {
+				usesTimestamp = true
+			}
+			label := ""
+			switch {
+			case col.SQLType.IsArray():
+				label = "repeated "
+			case col.Nullable:
+				label = "optional "
+			}
+			if col.Comment != "" {
+				fmt.Fprintf(&body, "  // %s\n", oneLine(col.Comment))
+			}
+			fmt.Fprintf(&body, "  %s%s %s = %d;\n", label, typ, idents[i], nums[i])
+		}
+		body.WriteString("}\n")
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by schema-orm. DO NOT EDIT.\n\nsyntax = \"proto3\";\n\npackage %s;\n", pkg)
+	if usesTimestamp {
+		out.WriteString("\nimport \"google/protobuf/timestamp.proto\";\n")
+	}
+	if opts.GoPackage != "" {
+		fmt.Fprintf(&out, "\noption go_package = %q;\n", opts.GoPackage)
+	}
+	out.Write(body.Bytes())
+	_, err := w.Write(out.Bytes())
+	return err
+}
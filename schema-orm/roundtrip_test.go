@@ -0,0 +1,308 @@
+package schema_orm
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// roundTripIterations is the number of random tables each property checks.
+const roundTripIterations = 300
+
+type roundTripBean struct {
+	ID   int64
+	Code string
+}
+
+func init() { RegisterTableType(&roundTripBean{}) }
+
+func pick[T any](r *rand.Rand, xs ...T) T { return xs[r.IntN(len(xs))] }
+
+func randomWord(r *rand.Rand) string {
+	return pick(r, "", "id", "Code", "amount", "note", "客户", "a b", `q"t`)
+}
+
+func randomMetadata(r *rand.Rand) *Metadata {
+	if r.IntN(3) > 0 {
+		return nil
+	}
+	md := &Metadata{Owner: randomWord(r), Sensitivity: pick(r, Sensitivity(""), SensitivityInternal, SensitivityRestricted), Unit: randomWord(r)}
+	if r.IntN(2) == 0 {
+		md.Labels = map[string]string{"": randomWord(r), "zh-CN": randomWord(r)}
+	}
+	if r.IntN(2) == 0 {
+		md.Tags = []string{randomWord(r), "golden"}
+	}
+	if r.IntN(2) == 0 {
+		// numbers would decode as float64 from JSON and int from YAML
+		md.Extra = map[string]any{"source": randomWord(r)}
+	}
+	return md
+}
+
+func randomColumn(r *rand.Rand, name string) *Column {
+	shanghai, _ := time.LoadLocation("Asia/Shanghai")
+	c := &Column{
+		Name:            name,
+		TableName:       pick(r, "", "t"),
+		FieldName:       pick(r, "", strings.ToUpper(name)),
+		SQLType:         SQLType{Name: pick(r, "INT", "BIGINT", "VARCHAR", "BIT", "DECIMAL", "TIMESTAMP", "BOOL", "TEXT"), DefaultLength: r.Int64N(3), DefaultLength2: r.Int64N(2)},
+		IsJSON:          r.IntN(5) == 0,
+		IsJSONB:         r.IntN(5) == 0,
+		Length:          r.Int64N(300),
+		Length2:         r.Int64N(10),
+		Nullable:        r.IntN(2) == 0,
+		Default:         pick(r, "", "0", "'x'", "CURRENT_TIMESTAMP"),
+		IsPrimaryKey:    r.IntN(3) == 0,
+		IsAutoIncrement: r.IntN(6) == 0,
+		MapType:         pick(r, 0, TWOSIDES, ONLYTODB, ONLYFROMDB),
+		IsCreated:       r.IntN(6) == 0,
+		IsUpdated:       r.IntN(6) == 0,
+		IsDeleted:       r.IntN(6) == 0,
+		IsCascade:       r.IntN(6) == 0,
+		IsVersion:       r.IntN(6) == 0,
+		DefaultIsEmpty:  r.IntN(2) == 0,
+		DisableTimeZone: r.IntN(4) == 0,
+		TimeZone:        pick(r, nil, time.UTC, time.Local, shanghai),
+		Comment:         randomWord(r),
+		Collation:       pick(r, "", "utf8mb4_bin"),
+		Metadata:        randomMetadata(r),
+	}
+	if r.IntN(2) == 0 {
+		c.FieldIndex = []int{r.IntN(4), r.IntN(4)}
+	}
+	if r.IntN(2) == 0 {
+		c.Indexes = map[string]int{"idx_" + name: pick(r, IndexType, UniqueType)}
+	}
+	if r.IntN(4) == 0 {
+		c.EnumOptions = map[string]int{"a": 0, "b": 1}
+		c.SetOptions = map[string]int{"x": 0}
+	}
+	return c
+}
+
+// randomTable builds a table the way the rest of the package does, through
+// AddColumn, then overrides the derived fields so the table's own values
+// have to survive.
+func randomTable(r *rand.Rand) *Table {
+	tb := NewTable(pick(r, "customer", "Order", "订单"), pick(r, nil, reflect.TypeOf(roundTripBean{})))
+	tb.Schema = pick(r, "", "public", "sales")
+	names := r.Perm(6)[:1+r.IntN(6)]
+	for _, n := range names {
+		tb.AddColumn(randomColumn(r, pick(r, "c", "C")+fmt.Sprint(n)))
+	}
+	r.Shuffle(len(tb.PrimaryKeys), func(i, j int) { tb.PrimaryKeys[i], tb.PrimaryKeys[j] = tb.PrimaryKeys[j], tb.PrimaryKeys[i] })
+	if r.IntN(3) == 0 {
+		tb.AutoIncrement = pick(r, "", tb.ColumnsSeq[0])
+		tb.Version = ""
+		tb.Created = map[string]bool{tb.ColumnsSeq[0]: r.IntN(2) == 0}
+	}
+	for i := range r.IntN(3) {
+		idx := NewIndex(fmt.Sprintf("idx%d", i), pick(r, IndexType, UniqueType))
+		idx.IsRegular = r.IntN(2) == 0
+		for _, c := range tb.ColumnsSeq[:1+r.IntN(len(tb.ColumnsSeq))] {
+			idx.AddColumn(c)
+		}
+		tb.AddIndex(idx)
+	}
+	for i := range r.IntN(3) {
+		fk := NewForeignKey(fmt.Sprintf("fk%d", i), "parent")
+		fk.RefSchema = pick(r, "", "crm")
+		fk.OnDelete = pick(r, "", "CASCADE")
+		fk.AddColumn(tb.ColumnsSeq[0], "id")
+		tb.ForeignKeys = append(tb.ForeignKeys, fk)
+	}
+	tb.StoreEngine = pick(r, "", "InnoDB")
+	tb.Charset = pick(r, "", "utf8mb4")
+	tb.Comment = randomWord(r)
+	tb.Collation = pick(r, "", "utf8mb4_bin")
+	if r.IntN(3) == 0 {
+		tb.Profile = &TableProfile{
+			RowCount: r.Int64N(1000), SampledRows: 10, Sampled: true,
+			ProfiledAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+			Columns: []*ColumnProfile{{
+				Name: tb.ColumnsSeq[0], NullCount: 1, NullRatio: 0.1, DistinctCount: 9, Min: "1", Max: "9",
+				MinLength: 1, MaxLength: 1, AvgLength: 1, Lengths: map[int]int64{1: 9},
+				TopValues: []ValueCount{{Value: "1", Count: 2}},
+			}},
+		}
+	}
+	if r.IntN(3) == 0 {
+		tb.Provenance = &Provenance{Table: "base", Columns: map[string]string{tb.ColumnsSeq[0]: "overlay"}}
+	}
+	tb.Metadata = randomMetadata(r)
+	return tb
+}
+
+// assertSameTable fails unless got equals want up to the documented
+// exceptions: empty and nil maps and slices are not told apart, and time
+// zones compare by name. It normalizes both tables in place.
+func assertSameTable(t *testing.T, label string, want, got *Table) {
+	t.Helper()
+	zones := func(tb *Table) []string {
+		var out []string
+		for _, c := range tb.Columns {
+			if c.TimeZone != nil {
+				out = append(out, c.Name+"="+c.TimeZone.String())
+				c.TimeZone = nil
+			}
+		}
+		return out
+	}
+	if w, g := zones(want), zones(got); !reflect.DeepEqual(w, g) {
+		t.Fatalf("%s: time zones %v, want %v", label, g, w)
+	}
+	normalizeEmpty(reflect.ValueOf(want))
+	normalizeEmpty(reflect.ValueOf(got))
+	if !reflect.DeepEqual(want, got) {
+		a, _ := json.Marshal(want)
+		b, _ := json.Marshal(got)
+		t.Fatalf("%s: tables differ\n got %s\nwant %s", label, b, a)
+	}
+}
+
+// normalizeEmpty sets the empty maps and slices reachable from v to nil.
+func normalizeEmpty(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			normalizeEmpty(v.Elem())
+		}
+	case reflect.Struct:
+		for i := range v.NumField() {
+			if v.Field(i).CanSet() {
+				normalizeEmpty(v.Field(i))
+			}
+		}
+	case reflect.Slice, reflect.Map:
+		if v.Len() == 0 {
+			if v.CanSet() {
+				v.SetZero()
+			}
+			return
+		}
+		if v.Kind() == reflect.Slice {
+			for i := range v.Len() {
+				normalizeEmpty(v.Index(i))
+			}
+			return
+		}
+		for it := v.MapRange(); it.Next(); {
+			normalizeEmpty(it.Value())
+		}
+	}
+}
+
+func TestRoundTrip_Xorm(t *testing.T) {
+	for seed := range uint64(roundTripIterations) {
+		r := rand.New(rand.NewPCG(seed, 41))
+		want := randomTable(r)
+		got := FromXormTable(ToXormTable(want))
+		assertSameTable(t, fmt.Sprintf("seed %d", seed), want, got)
+	}
+}
+
+func TestRoundTrip_JSONAndYAML(t *testing.T) {
+	for seed := range uint64(roundTripIterations) {
+		// assertSameTable normalizes its arguments, so each check gets a fresh copy
+		gen := func() *Table { return randomTable(rand.New(rand.NewPCG(seed, 41))) }
+		want := gen()
+
+		data, err := json.Marshal(want)
+		if err != nil {
+			t.Fatalf("seed %d: marshal json: %v", seed, err)
+		}
+		fromJSON := &Table{}
+		if err := json.Unmarshal(data, fromJSON); err != nil {
+			t.Fatalf("seed %d: unmarshal json: %v", seed, err)
+		}
+		data, err = yaml.Marshal(want)
+		if err != nil {
+			t.Fatalf("seed %d: marshal yaml: %v", seed, err)
+		}
+		fromYAML := &Table{}
+		if err := yaml.Unmarshal(data, fromYAML); err != nil {
+			t.Fatalf("seed %d: unmarshal yaml: %v\n%s", seed, err, data)
+		}
+
+		assertSameTable(t, fmt.Sprintf("seed %d json", seed), want, fromJSON)
+		assertSameTable(t, fmt.Sprintf("seed %d yaml", seed), gen(), fromYAML)
+	}
+}
+
+func TestRoundTrip_Exceptions(t *testing.T) {
+	// BIT becomes BOOL only when asked for
+	tb := NewTable("flags", nil)
+	tb.AddColumn(&Column{Name: "on", SQLType: SQLType{Name: "BIT"}, Default: "0"})
+	if c := FromXormTable(ToXormTableWith(tb, ConvertOptions{BitAsBool: true})).GetColumn("on"); c.SQLType.Name != "BOOL" || c.Default != "true" {
+		t.Fatalf("BitAsBool: %+v", c)
+	}
+	if c := FromXormTable(ToXormTable(tb)).GetColumn("on"); c.SQLType.Name != "BIT" || c.Default != "0" {
+		t.Fatalf("lossless: %+v", c)
+	}
+
+	// a fixed zone has no loadable name
+	tb.Columns[0].TimeZone = time.FixedZone("UTC+8", 8*3600)
+	if _, err := json.Marshal(tb); err == nil || !strings.Contains(err.Error(), "UTC+8") {
+		t.Fatalf("fixed zone json: %v", err)
+	}
+	if _, err := yaml.Marshal(tb); err == nil {
+		t.Fatal("fixed zone yaml: expected error")
+	}
+	if err := json.Unmarshal([]byte(`{"name":"x","columns":[{"name":"a","timeZone":"Mars/Olympus"}]}`), &Table{}); err == nil {
+		t.Fatal("unknown zone: expected error")
+	}
+	// documents written before zones were encoded by name hold an empty object
+	legacy := &Table{}
+	if err := json.Unmarshal([]byte(`{"name":"x","columns":[{"name":"a","timeZone":{}}]}`), legacy); err != nil || legacy.Columns[0].TimeZone != nil {
+		t.Fatalf("legacy json zone: %v", err)
+	}
+	if err := yaml.Unmarshal([]byte("name: x\ncolumns:\n  - name: a\n    timeZone: {}\n"), legacy); err != nil || legacy.Columns[0].TimeZone != nil {
+		t.Fatalf("legacy yaml zone: %v", err)
+	}
+	if err := yaml.Unmarshal([]byte("name: x\ncolumns:\n  - name: a\n    timeZone: UTC\n"), legacy); err != nil || legacy.Columns[0].TimeZone != time.UTC {
+		t.Fatalf("yaml zone: %v %v", err, legacy.Columns[0].TimeZone)
+	}
+
+	// an unregistered struct type decodes to a nil Type
+	type unregistered struct{ ID int64 }
+	data, _ := json.Marshal(NewTable("u", reflect.TypeOf(unregistered{})))
+	back := &Table{}
+	if err := json.Unmarshal(data, back); err != nil || back.Type != nil || !strings.Contains(string(data), `"goType"`) {
+		t.Fatalf("unregistered type: %v %v %s", err, back.Type, data)
+	}
+	data, _ = yaml.Marshal(NewTable("r", reflect.TypeOf(&roundTripBean{}).Elem()))
+	if err := yaml.Unmarshal(data, back); err != nil || back.Type != reflect.TypeOf(roundTripBean{}) {
+		t.Fatalf("registered type: %v %v", err, back.Type)
+	}
+}
+
+func TestTableDecoders_ListsOnce(t *testing.T) {
+	tb := NewTable("orders", nil)
+	tb.AddColumn(&Column{Name: "id", SQLType: SQLType{Name: "BIGINT"}, IsPrimaryKey: true})
+	tb.AddColumn(&Column{Name: "line", SQLType: SQLType{Name: "INT"}, IsPrimaryKey: true})
+	tb.AddColumn(&Column{Name: "qty", SQLType: SQLType{Name: "INT"}})
+	tb.PrimaryKeys = []string{"line", "id"}
+
+	data, _ := json.Marshal(tb)
+	fromJSON := &Table{}
+	if err := json.Unmarshal(data, fromJSON); err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	data, _ = yaml.Marshal(tb)
+	fromYAML := &Table{}
+	if err := yaml.Unmarshal(data, fromYAML); err != nil {
+		t.Fatalf("yaml: %v", err)
+	}
+	for name, got := range map[string]*Table{"json": fromJSON, "yaml": fromYAML} {
+		if strings.Join(got.ColumnsSeq, ",") != "id,line,qty" || strings.Join(got.PrimaryKeys, ",") != "line,id" {
+			t.Fatalf("%s: columnsSeq %v, primaryKeys %v", name, got.ColumnsSeq, got.PrimaryKeys)
+		}
+	}
+}
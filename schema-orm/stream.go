@@ -0,0 +1,308 @@
+package schema_orm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+	"xorm.io/xorm"
+)
+
+// DefaultExportWorkers is the number of tables introspected at the same time
+// when ExportOptions.Workers is zero.
+const DefaultExportWorkers = 4
+
+// ExportProgress reports an exported table. Done counts the tables exported
+// so far, this one included, out of Total selected tables.
+type ExportProgress struct {
+	Table string
+	Done  int
+	Total int
+}
+
+// StreamEngineSchema introspects the database like ExportEngineSchema but
+// hands every table to fn as soon as it and all tables before it are read,
+// instead of collecting them. Up to opts.Workers tables are introspected in
+// parallel; fn sees them in the same order ExportEngineSchema returns them
+// and is never called concurrently. With opts.Profile set each table is
+// profiled by the worker that read it. An error from fn stops the export and
+// is returned.
+func StreamEngineSchema(ctx context.Context, engine *xorm.Engine, opts ExportOptions, fn func(*Table) error) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	if err := engine.PingContext(ctx); err != nil {
+		return err
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = DefaultExportWorkers
+	}
+
+	groups, err := listExportTables(ctx, engine, opts)
+	if err != nil {
+		return err
+	}
+	total, done := 0, 0
+	for _, g := range groups {
+		total += len(g.tables)
+	}
+	for _, g := range groups {
+		load := func(ctx context.Context, t exportTable) (*Table, error) {
+			tb, err := t.load(ctx)
+			if err != nil || opts.Profile == nil {
+				return tb, err
+			}
+			if tb.Profile, err = ProfileTable(ctx, engine, tb, *opts.Profile); err != nil {
+				return nil, fmt.Errorf("profile %s: %w", tb.FullName(), err)
+			}
+			return tb, nil
+		}
+		emit := func(tb *Table) error {
+			done++
+			if opts.Progress != nil {
+				opts.Progress(ExportProgress{Table: tb.FullName(), Done: done, Total: total})
+			}
+			return fn(tb)
+		}
+		if err := runOrdered(ctx, g.tables, workers, load, emit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runOrdered runs load for every task on up to workers goroutines and passes
+// the results to emit in task order, on the calling goroutine. At most
+// 2*workers tasks are started ahead of the last emitted one, which bounds the
+// results held back waiting for a slow predecessor. The first error stops
+// the remaining tasks.
+func runOrdered[T, R any](ctx context.Context, tasks []T, workers int, load func(context.Context, T) (R, error), emit func(R) error) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		i   int
+		r   R
+		err error
+	}
+	var (
+		work    = make(chan int)
+		results = make(chan result)
+		window  = make(chan struct{}, 2*workers)
+		wg      sync.WaitGroup
+	)
+	go func() {
+		defer close(work)
+		for i := range tasks {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case work <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	for range min(workers, len(tasks)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				r, err := load(ctx, tasks[i])
+				select {
+				case results <- result{i, r, err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var (
+		firstErr error
+		next     int
+		pending  = map[int]R{}
+	)
+	for res := range results {
+		if firstErr != nil {
+			continue
+		}
+		if res.err != nil {
+			firstErr = res.err
+			cancel()
+			continue
+		}
+		pending[res.i] = res.r
+		for firstErr == nil {
+			r, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			if err := emit(r); err != nil {
+				firstErr = err
+				cancel()
+			}
+			next++
+			<-window
+		}
+	}
+	if firstErr == nil && next < len(tasks) {
+		return ctx.Err()
+	}
+	return firstErr
+}
+
+// BundleFormat selects the encoding of a streamed bundle.
+type BundleFormat string
+
+const (
+	BundleJSON BundleFormat = "json"
+	BundleYAML BundleFormat = "yaml"
+)
+
+// BundleEncoder writes a bundle one table at a time, so a large schema never
+// has to be encoded in one piece. The output is the same as Bundle.WriteFile
+// produces for the format: indented JSON, or YAML.
+type BundleEncoder struct {
+	w      io.Writer
+	format BundleFormat
+	tables int
+	closed bool
+}
+
+// bundleHeader is a Bundle without its tables; the field order matches Bundle.
+type bundleHeader struct {
+	Version string  `json:"version" yaml:"version"`
+	Dialect string  `json:"dialect,omitempty" yaml:"dialect,omitempty"`
+	Naming  *Naming `json:"naming,omitempty" yaml:"naming,omitempty"`
+}
+
+// NewBundleEncoder writes the version, dialect and naming of header (its
+// tables are ignored) and returns an encoder for the tables.
+func NewBundleEncoder(w io.Writer, format BundleFormat, header *Bundle) (*BundleEncoder, error) {
+	h := bundleHeader{Version: header.Version, Dialect: header.Dialect, Naming: header.Naming}
+	if h.Version == "" {
+		h.Version = BundleVersion
+	}
+	var (
+		out []byte
+		err error
+	)
+	switch format {
+	case BundleJSON:
+		if out, err = json.MarshalIndent(h, "", "  "); err == nil {
+			// reopen the object for the tables member
+			out = append(bytes.TrimSuffix(out, []byte("\n}")), ",\n  \"tables\": ["...)
+		}
+	case BundleYAML:
+		if out, err = yaml.Marshal(h); err == nil {
+			out = append(out, "tables:"...)
+		}
+	default:
+		return nil, fmt.Errorf("unknown bundle format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(out); err != nil {
+		return nil, err
+	}
+	return &BundleEncoder{w: w, format: format}, nil
+}
+
+// Encode appends a table to the bundle.
+func (e *BundleEncoder) Encode(tb *Table) error {
+	if e.closed {
+		return errors.New("bundle encoder is closed")
+	}
+	var (
+		out []byte
+		err error
+	)
+	switch e.format {
+	case BundleJSON:
+		sep := ",\n    "
+		if e.tables == 0 {
+			sep = "\n    "
+		}
+		if out, err = json.MarshalIndent(tb, "    ", "  "); err == nil {
+			out = append([]byte(sep), out...)
+		}
+	default:
+		// a one-element sequence, indented as yaml.Marshal indents the tables member
+		var seq []byte
+		if seq, err = yaml.Marshal([]*Table{tb}); err == nil {
+			if e.tables == 0 {
+				out = append(out, '\n')
+			}
+			for _, line := range bytes.SplitAfter(seq, []byte("\n")) {
+				if len(line) > 0 {
+					out = append(append(out, "    "...), line...)
+				}
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("encode table %s: %w", tb.FullName(), err)
+	}
+	if _, err := e.w.Write(out); err != nil {
+		return err
+	}
+	e.tables++
+	return nil
+}
+
+// Close terminates the bundle. It does not close the underlying writer.
+func (e *BundleEncoder) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	var end string
+	switch {
+	case e.format == BundleJSON && e.tables == 0:
+		end = "]\n}"
+	case e.format == BundleJSON:
+		end = "\n  ]\n}"
+	case e.tables == 0:
+		end = " []\n"
+	}
+	_, err := io.WriteString(e.w, end)
+	return err
+}
+
+// WriteEngineSchema streams the tables of the database to w as a bundle for
+// the engine's dialect, holding at most a few tables in memory at a time.
+// See StreamEngineSchema for the options.
+func WriteEngineSchema(ctx context.Context, engine *xorm.Engine, w io.Writer, format BundleFormat, opts ExportOptions) error {
+	enc, err := NewBundleEncoder(w, format, &Bundle{Dialect: string(engine.Dialect().URI().DBType)})
+	if err != nil {
+		return err
+	}
+	if err := StreamEngineSchema(ctx, engine, opts, enc.Encode); err != nil {
+		return err
+	}
+	return enc.Close()
+}
@@ -0,0 +1,223 @@
+package schema_orm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"xorm.io/xorm"
+)
+
+// wideFixture creates a SQLite file database with n tables of a few columns and an index each.
+func wideFixture(tb testing.TB, n int) *xorm.Engine {
+	tb.Helper()
+	eng, err := NewSQLiteEngine(BuildSQLiteDSN(filepath.Join(tb.TempDir(), "wide.db")))
+	if err != nil {
+		tb.Fatalf("open: %v", err)
+	}
+	tb.Cleanup(func() { eng.Close() })
+	var ddl strings.Builder
+	for i := range n {
+		fmt.Fprintf(&ddl, "CREATE TABLE t%04d (id INTEGER PRIMARY KEY, code VARCHAR(20) NOT NULL, amount DECIMAL(10,2), note TEXT);\n", i)
+		fmt.Fprintf(&ddl, "CREATE INDEX IDX_t%04d_code ON t%04d (code);\n", i, i)
+	}
+	if _, err := eng.Import(strings.NewReader(ddl.String())); err != nil {
+		tb.Fatalf("import: %v", err)
+	}
+	return eng
+}
+
+func TestBundleEncoder_MatchesMarshal(t *testing.T) {
+	eng := wideFixture(t, 2)
+	tables, err := ExportEngineSchema(context.Background(), eng, ExportOptions{})
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	for _, b := range []*Bundle{
+		{Version: BundleVersion, Dialect: "sqlite", Naming: &Naming{Table: "snake"}, Tables: tables},
+		{Version: BundleVersion, Tables: []*Table{}},
+	} {
+		wantJSON, _ := json.MarshalIndent(b, "", "  ")
+		wantYAML, _ := yaml.Marshal(b)
+		for format, want := range map[BundleFormat][]byte{BundleJSON: wantJSON, BundleYAML: wantYAML} {
+			var buf bytes.Buffer
+			enc, err := NewBundleEncoder(&buf, format, b)
+			if err != nil {
+				t.Fatalf("%s: %v", format, err)
+			}
+			for _, tb := range b.Tables {
+				if err := enc.Encode(tb); err != nil {
+					t.Fatalf("%s encode: %v", format, err)
+				}
+			}
+			if err := enc.Close(); err != nil {
+				t.Fatalf("%s close: %v", format, err)
+			}
+			if buf.String() != string(want) {
+				t.Fatalf("%s with %d tables:\n got %s\nwant %s", format, len(b.Tables), buf.String(), want)
+			}
+			if err := enc.Encode(tables[0]); err == nil {
+				t.Fatalf("%s: encode after close", format)
+			}
+		}
+	}
+	if _, err := NewBundleEncoder(io.Discard, "xml", &Bundle{}); err == nil {
+		t.Fatal("expected error for unknown format")
+	}
+}
+
+func TestStreamEngineSchema_OrderAndProgress(t *testing.T) {
+	ctx := context.Background()
+	eng := wideFixture(t, 40)
+	serial, err := ExportEngineSchema(ctx, eng, ExportOptions{Workers: 1, Exclude: []string{"t003*"}})
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	var (
+		got      []*Table
+		progress []ExportProgress
+	)
+	opts := ExportOptions{Workers: 8, Exclude: []string{"t003*"}, Progress: func(p ExportProgress) { progress = append(progress, p) }}
+	if err := StreamEngineSchema(ctx, eng, opts, func(tb *Table) error {
+		got = append(got, tb)
+		return nil
+	}); err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	a, _ := json.Marshal(serial)
+	b, _ := json.Marshal(got)
+	if len(got) != 30 || !bytes.Equal(a, b) {
+		t.Fatalf("parallel export differs: %d tables", len(got))
+	}
+	for i, p := range progress {
+		if p.Done != i+1 || p.Total != 30 || p.Table != got[i].Name {
+			t.Fatalf("progress %d: %+v", i, p)
+		}
+	}
+
+	// an error from fn stops the export
+	stop := errors.New("stop")
+	n := 0
+	err = StreamEngineSchema(ctx, eng, opts, func(*Table) error {
+		if n++; n == 3 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) || n != 3 {
+		t.Fatalf("stop: %v after %d", err, n)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteEngineSchema(ctx, eng, &buf, BundleYAML, ExportOptions{Include: []string{"t000?"}}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	bundle, err := ParseBundle(buf.Bytes())
+	if err != nil || bundle.Dialect != "sqlite3" || len(bundle.Tables) != 10 || bundle.Tables[9].Name != "t0009" {
+		t.Fatalf("bundle: %v %+v", err, bundle)
+	}
+}
+
+func TestRunOrdered(t *testing.T) {
+	tasks := make([]int, 50)
+	for i := range tasks {
+		tasks[i] = i
+	}
+	// later tasks finish first
+	load := func(_ context.Context, i int) (int, error) {
+		time.Sleep(time.Duration(50-i) * 20 * time.Microsecond)
+		return i * i, nil
+	}
+	var got []int
+	if err := runOrdered(context.Background(), tasks, 6, load, func(r int) error {
+		got = append(got, r)
+		return nil
+	}); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	for i, r := range got {
+		if r != i*i {
+			t.Fatalf("result %d: %d", i, r)
+		}
+	}
+	if len(got) != 50 {
+		t.Fatalf("results: %d", len(got))
+	}
+
+	boom := errors.New("boom")
+	emitted := 0
+	err := runOrdered(context.Background(), tasks, 4, func(_ context.Context, i int) (int, error) {
+		if i == 10 {
+			return 0, boom
+		}
+		return i, nil
+	}, func(int) error { emitted++; return nil })
+	if !errors.Is(err, boom) || emitted > 10 {
+		t.Fatalf("error: %v after %d", err, emitted)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := runOrdered(ctx, tasks, 4, load, func(int) error { return nil }); !errors.Is(err, context.Canceled) {
+		t.Fatalf("canceled: %v", err)
+	}
+}
+
+// BenchmarkExport compares collecting the whole schema and marshalling it in
+// one piece, the path before streaming, with streaming it to the writer.
+// Run with -benchmem: the streamed variants allocate per table, not per
+// schema. SQLite answers without network round trips, so workers gain little
+// here; BenchmarkRunOrdered shows them against a server's latency.
+func BenchmarkExport(b *testing.B) {
+	eng := wideFixture(b, 300)
+	ctx := context.Background()
+	b.Run("collect-marshal", func(b *testing.B) {
+		for b.Loop() {
+			tables, err := ExportEngineSchema(ctx, eng, ExportOptions{Workers: 1})
+			if err != nil {
+				b.Fatal(err)
+			}
+			data, err := json.MarshalIndent(NewBundle("sqlite", tables), "", "  ")
+			if err != nil {
+				b.Fatal(err)
+			}
+			_, _ = io.Discard.Write(data)
+		}
+	})
+	for _, workers := range []int{1, 4, 8} {
+		b.Run(fmt.Sprintf("stream-workers-%d", workers), func(b *testing.B) {
+			for b.Loop() {
+				if err := WriteEngineSchema(ctx, eng, io.Discard, BundleJSON, ExportOptions{Workers: workers}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkRunOrdered introspects 200 tables that take 1ms each, about the
+// round trips of one table on a remote server.
+func BenchmarkRunOrdered(b *testing.B) {
+	tasks := make([]int, 200)
+	load := func(_ context.Context, i int) (int, error) {
+		time.Sleep(time.Millisecond)
+		return i, nil
+	}
+	for _, workers := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("workers-%d", workers), func(b *testing.B) {
+			for b.Loop() {
+				if err := runOrdered(context.Background(), tasks, workers, load, func(int) error { return nil }); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
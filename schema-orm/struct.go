@@ -0,0 +1,31 @@
+package schema_orm
+
+import (
+	"reflect"
+
+	"xorm.io/xorm/caches"
+	xs "xorm.io/xorm/schemas"
+	"xorm.io/xorm/tags"
+)
+
+// ParseStruct builds a Table from a struct (or pointer to struct) with xorm
+// tags, mapping the struct and field names through the naming strategy exactly
+// like an xorm engine configured with the same mappers. A nil naming uses the
+// xorm defaults. The returned Table keeps the struct type in Type.
+func ParseStruct(bean any, naming *Naming) (*Table, error) {
+	tableMapper, columnMapper, err := naming.Mappers()
+	if err != nil {
+		return nil, err
+	}
+	// the dialect is only consulted for type names, any registered one will do
+	dialect, err := offlineDialect(xs.SQLITE, "")
+	if err != nil {
+		return nil, err
+	}
+	parser := tags.NewParser("xorm", dialect, tableMapper, columnMapper, caches.NewManager())
+	xtb, err := parser.Parse(reflect.ValueOf(bean))
+	if err != nil {
+		return nil, err
+	}
+	return FromXormTable(&XormTable{Table: xtb}), nil
+}
@@ -7,15 +7,22 @@ import (
 )
 
 // Table mirrors xorm.io/xorm/schemas.Table with JSON/YAML tags
-// Note: Type is excluded from serialization because reflect.Type isn't portable.
+// Type isn't portable: it is serialized as the struct's name (goType) and only
+// restored for types registered with RegisterTableType.
+// Schema is the database namespace (e.g. PostgreSQL schema) the table was read from;
+// xorm has no equivalent field. Profile is the optional data profile attached by
+// ProfileTables or ExportOptions.Profile. Provenance is set by MergeOverlays.
+// Metadata is business metadata, see MergeMetadata.
 type Table struct {
 	Name          string               `json:"name" yaml:"name"`
+	Schema        string               `json:"schema,omitempty" yaml:"schema,omitempty"`
 	Type          reflect.Type         `json:"-" yaml:"-"`
 	ColumnsSeq    []string             `json:"ColumnsSeq" yaml:"ColumnsSeq"`
 	ColumnsMap    map[string][]*Column `json:"columnsMap" yaml:"columnsMap"`
 	Columns       []*Column            `json:"columns" yaml:"columns"`
 	Indexes       map[string]*Index    `json:"indexes,omitempty" yaml:"indexes,omitempty"`
 	PrimaryKeys   []string             `json:"primaryKeys,omitempty" yaml:"primaryKeys,omitempty"`
+	ForeignKeys   []*ForeignKey        `json:"foreignKeys,omitempty" yaml:"foreignKeys,omitempty"`
 	AutoIncrement string               `json:"autoIncrement,omitempty" yaml:"autoIncrement,omitempty"`
 	Created       map[string]bool      `json:"created,omitempty" yaml:"created,omitempty"`
 	Updated       string               `json:"updated,omitempty" yaml:"updated,omitempty"`
@@ -25,6 +32,9 @@ type Table struct {
 	Charset       string               `json:"charset,omitempty" yaml:"charset,omitempty"`
 	Comment       string               `json:"comment,omitempty" yaml:"comment,omitempty"`
 	Collation     string               `json:"collation,omitempty" yaml:"collation,omitempty"`
+	Profile       *TableProfile        `json:"profile,omitempty" yaml:"profile,omitempty"`
+	Provenance    *Provenance          `json:"provenance,omitempty" yaml:"provenance,omitempty"`
+	Metadata      *Metadata            `json:"metadata,omitempty" yaml:"metadata,omitempty"`
 }
 
 func NewEmptyTable() *Table { return NewTable("", nil) }
@@ -42,6 +52,14 @@ func NewTable(name string, t reflect.Type) *Table {
 	}
 }
 
+// FullName returns the schema-qualified table name, or Name when Schema is empty.
+func (table *Table) FullName() string {
+	if table.Schema == "" {
+		return table.Name
+	}
+	return table.Schema + "." + table.Name
+}
+
 func (table *Table) columnsByName(name string) []*Column {
 	return table.ColumnsMap[strings.ToLower(name)]
 }
@@ -0,0 +1,104 @@
+package schema_orm
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// ValidationIssue is one structural problem of a table definition. Column is
+// empty for problems of the table itself.
+type ValidationIssue struct {
+	Table   string `json:"table" yaml:"table"`
+	Column  string `json:"column,omitempty" yaml:"column,omitempty"`
+	Message string `json:"message" yaml:"message"`
+}
+
+func (i ValidationIssue) String() string {
+	if i.Column == "" {
+		return i.Table + ": " + i.Message
+	}
+	return i.Table + "." + i.Column + ": " + i.Message
+}
+
+// ValidateTables checks that the tables can be turned into DDL: names are set
+// and unique, columns have a type, and primary keys, indexes and foreign keys
+// refer to columns of their table. Names compare ignoring case. References to
+// other tables are not checked, so a subset of a schema validates on its own.
+func ValidateTables(tables []*Table) []ValidationIssue {
+	var out []ValidationIssue
+	seen := map[string]bool{}
+	for i, tb := range tables {
+		if tb == nil || tb.Name == "" {
+			out = append(out, ValidationIssue{Table: fmt.Sprintf("#%d", i), Message: "table without name"})
+			continue
+		}
+		key := strings.ToLower(tb.FullName())
+		if seen[key] {
+			out = append(out, ValidationIssue{Table: tb.FullName(), Message: "duplicate table"})
+		}
+		seen[key] = true
+		out = append(out, validateTable(tb)...)
+	}
+	return out
+}
+
+func validateTable(tb *Table) []ValidationIssue {
+	var out []ValidationIssue
+	name := tb.FullName()
+	issue := func(col, format string, args ...any) {
+		out = append(out, ValidationIssue{Table: name, Column: col, Message: fmt.Sprintf(format, args...)})
+	}
+	if len(tb.Columns) == 0 {
+		issue("", "table without columns")
+	}
+	seen := map[string]bool{}
+	for _, c := range tb.Columns {
+		if c == nil || c.Name == "" {
+			issue("", "column without name")
+			continue
+		}
+		if seen[strings.ToLower(c.Name)] {
+			issue(c.Name, "duplicate column")
+		}
+		seen[strings.ToLower(c.Name)] = true
+		if c.SQLType.Name == "" {
+			issue(c.Name, "column without type")
+		}
+		if c.Length2 > 0 && c.Length > 0 && c.Length2 > c.Length {
+			issue(c.Name, "scale %d exceeds precision %d", c.Length2, c.Length)
+		}
+	}
+	for _, pk := range tb.PrimaryKeys {
+		i := columnIndex(tb.Columns, pk)
+		switch {
+		case i < 0:
+			issue(pk, "primary key column does not exist")
+		case tb.Columns[i].Nullable:
+			issue(pk, "primary key column is nullable")
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(tb.Indexes)) {
+		idx := tb.Indexes[key]
+		if len(idx.Cols) == 0 {
+			issue("", "index %s without columns", idx.Name)
+		}
+		for _, c := range idx.Cols {
+			if columnIndex(tb.Columns, c) < 0 {
+				issue(c, "index %s refers to a missing column", idx.Name)
+			}
+		}
+	}
+	for _, fk := range tb.ForeignKeys {
+		if fk.RefTable == "" || len(fk.Cols) == 0 || len(fk.Cols) != len(fk.RefCols) {
+			issue("", "foreign key %s needs a referenced table and as many referenced columns as columns", fk.Name)
+		}
+		for _, c := range fk.Cols {
+			if columnIndex(tb.Columns, c) < 0 {
+				issue(c, "foreign key %s refers to a missing column", fk.Name)
+			}
+		}
+	}
+	return out
+}
@@ -2,10 +2,13 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/dop251/goja"
+	"github.com/everpan/go-mdm/utils"
 )
 
 // Engine processes HTTP-like requests via a goja JavaScript script.
@@ -15,6 +18,8 @@ type Engine struct {
 	// Script is the JavaScript code that will be executed for each request.
 	// It should define a global function named `handle(req, res)`.
 	Script string
+	// Timeout, when positive, bounds each evaluation; see EvalContext.
+	Timeout time.Duration
 }
 
 // Request is a minimal HTTP request abstraction exposed to JS.
@@ -51,6 +56,14 @@ type Response struct {
 
 // Eval executes the engine's script and invokes handle(req, res).
 func (e *Engine) Eval(req *Request) (*Response, error) {
+	return e.EvalContext(context.Background(), req)
+}
+
+// EvalContext is Eval bounded by ctx and the engine's Timeout: when either
+// ends, the script's database calls throw a catchable TimeoutError and a
+// script still running utils.InterruptGrace later is interrupted (see
+// utils.RunWithContext); the error then wraps the context's error.
+func (e *Engine) EvalContext(ctx context.Context, req *Request) (*Response, error) {
 	if e.Script == "" {
 		return nil, fmt.Errorf("no script provided: Engine.Script is empty")
 	}
@@ -116,20 +129,30 @@ func (e *Engine) Eval(req *Request) (*Response, error) {
 		return nil, fmt.Errorf("bind res: %w", err)
 	}
 
-	// Load script and ensure a handle exists
-	if _, err := rt.RunString(e.Script); err != nil {
-		return nil, fmt.Errorf("evaluate script: %w", err)
+	if e.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.Timeout)
+		defer cancel()
 	}
+	err = utils.RunWithContext(ctx, rt, func() error {
+		// Load script and ensure a handle exists
+		if _, err := rt.RunString(e.Script); err != nil {
+			return fmt.Errorf("evaluate script: %w", err)
+		}
 
-	fn := rt.Get("handle")
-	callable, ok := goja.AssertFunction(fn)
-	if !ok {
-		return nil, fmt.Errorf("script must define function handle(req, res)")
-	}
+		fn := rt.Get("handle")
+		callable, ok := goja.AssertFunction(fn)
+		if !ok {
+			return fmt.Errorf("script must define function handle(req, res)")
+		}
 
-	if _, err := callable(goja.Undefined(), rt.Get("req"), rt.Get("res")); err != nil {
-		return nil, fmt.Errorf("invoke handle: %w", err)
+		if _, err := callable(goja.Undefined(), rt.Get("req"), rt.Get("res")); err != nil {
+			return fmt.Errorf("invoke handle: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-
 	return resp, nil
 }
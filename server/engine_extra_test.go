@@ -1,8 +1,11 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestEngineEval_ScriptSyntaxError(t *testing.T) {
@@ -78,3 +81,20 @@ func TestEngineEval_RequestFieldMappings_Minimal(t *testing.T) {
 		t.Fatalf("unexpected body mapping: %q", resp.Body.String())
 	}
 }
+
+func TestEngineEvalContext_Timeout(t *testing.T) {
+	e := &Engine{Script: `function handle(req, res){ res.write('start'); for (;;) {} }`, Timeout: 50 * time.Millisecond}
+	if _, err := e.Eval(&Request{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("timeout: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	e = &Engine{Script: `function handle(req, res){ res.end('x'); }`}
+	if _, err := e.EvalContext(ctx, &Request{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("canceled: %v", err)
+	}
+	if resp, err := e.EvalContext(context.Background(), &Request{}); err != nil || resp.Body.String() != "x" {
+		t.Fatalf("eval: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/app/server"
+
+	so "github.com/everpan/go-mdm/schema-orm"
+)
+
+// RegisterGraphQL serves the executor on path next to the script routes of
+// NewHertz. POST takes a JSON body {query, operationName, variables}; GET takes
+// the same as query parameters (variables JSON encoded) and, without a query,
+// returns the schema as SDL.
+func RegisterGraphQL(hs *server.Hertz, path string, exec *so.GraphQLExecutor) {
+	handler := GraphQLHandler(exec)
+	hs.GET(path, handler)
+	hs.POST(path, handler)
+}
+
+// GraphQLHandler returns the Hertz handler used by RegisterGraphQL.
+func GraphQLHandler(exec *so.GraphQLExecutor) app.HandlerFunc {
+	return func(c context.Context, ctx *app.RequestContext) {
+		var req so.GraphQLRequest
+		if string(ctx.Method()) == "GET" {
+			req.Query = string(ctx.Query("query"))
+			if req.Query == "" {
+				ctx.Response.Header.Set("Content-Type", "text/plain; charset=utf-8")
+				ctx.Response.SetBodyString(exec.SDL())
+				return
+			}
+			req.OperationName = string(ctx.Query("operationName"))
+			if v := ctx.Query("variables"); v != "" {
+				if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+					writeGraphQLError(ctx, "invalid variables: "+err.Error())
+					return
+				}
+			}
+		} else if err := json.Unmarshal(ctx.Request.BodyBytes(), &req); err != nil {
+			writeGraphQLError(ctx, "invalid request body: "+err.Error())
+			return
+		}
+
+		b, err := json.Marshal(exec.Execute(c, req))
+		if err != nil {
+			writeGraphQLError(ctx, err.Error())
+			return
+		}
+		ctx.Response.Header.Set("Content-Type", "application/json")
+		ctx.Response.SetBody(b)
+	}
+}
+
+// writeGraphQLError answers a request that could not be parsed with status 400
+// and a GraphQL style error list.
+func writeGraphQLError(ctx *app.RequestContext, msg string) {
+	b, _ := json.Marshal(map[string]any{"errors": []map[string]string{{"message": msg}}})
+	ctx.SetStatusCode(400)
+	ctx.Response.Header.Set("Content-Type", "application/json")
+	ctx.Response.SetBody(b)
+}
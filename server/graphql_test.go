@@ -0,0 +1,84 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/common/ut"
+
+	so "github.com/everpan/go-mdm/schema-orm"
+)
+
+func newGraphQLExecutor(t *testing.T) *so.GraphQLExecutor {
+	t.Helper()
+	eng, err := so.NewSQLiteEngine(so.BuildSQLiteDSN(filepath.Join(t.TempDir(), "gql.db")))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { eng.Close() })
+	ddl := `CREATE TABLE customer (id INTEGER PRIMARY KEY, name VARCHAR(64) NOT NULL);
+INSERT INTO customer (id, name) VALUES (1, 'Ada'), (2, 'Grace');`
+	if _, err := eng.Import(strings.NewReader(ddl)); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	tables, err := so.ExportEngineSchema(context.Background(), eng, so.ExportOptions{})
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	exec, err := so.NewGraphQLExecutor(eng, tables, so.GraphQLOptions{})
+	if err != nil {
+		t.Fatalf("executor: %v", err)
+	}
+	return exec
+}
+
+func TestRegisterGraphQL(t *testing.T) {
+	hs := NewHertz(`function handle(req,res){ res.end('js ' + req.path); }`)
+	RegisterGraphQL(hs, "/graphql", newGraphQLExecutor(t))
+
+	body := `{"query":"query($id: Int!) { customer(id: $id) { name } }","variables":{"id":2}}`
+	w := ut.PerformRequest(hs.Engine, "POST", "/graphql", &ut.Body{Body: bytes.NewBufferString(body), Len: len(body)},
+		ut.Header{Key: "Content-Type", Value: "application/json"})
+	if got := string(w.Result().Body()); w.Code != 200 || got != `{"data":{"customer":{"name":"Grace"}}}` {
+		t.Fatalf("POST: %d %s", w.Code, got)
+	}
+
+	w = ut.PerformRequest(hs.Engine, "GET", "/graphql?query="+url.QueryEscape("{ customerList { totalCount } }"), nil)
+	if got := string(w.Result().Body()); got != `{"data":{"customerList":{"totalCount":2}}}` {
+		t.Fatalf("GET: %s", got)
+	}
+
+	w = ut.PerformRequest(hs.Engine, "GET", "/graphql", nil)
+	if got := string(w.Result().Body()); !strings.Contains(got, "type Customer {") {
+		t.Fatalf("SDL: %s", got)
+	}
+
+	// other paths still reach the script
+	w = ut.PerformRequest(hs.Engine, "GET", "/other", nil)
+	if got := string(w.Result().Body()); got != "js /other" {
+		t.Fatalf("script route: %s", got)
+	}
+}
+
+func TestGraphQLHandler_BadRequests(t *testing.T) {
+	hs := NewHertz(`function handle(req,res){ res.end('ok'); }`)
+	RegisterGraphQL(hs, "/graphql", newGraphQLExecutor(t))
+
+	w := ut.PerformRequest(hs.Engine, "POST", "/graphql", &ut.Body{Body: bytes.NewBufferString("{"), Len: 1})
+	if w.Code != 400 || !strings.Contains(string(w.Result().Body()), "invalid request body") {
+		t.Fatalf("bad body: %d %s", w.Code, w.Result().Body())
+	}
+	w = ut.PerformRequest(hs.Engine, "GET", "/graphql?query=%7Bx%7D&variables=nope", nil)
+	if w.Code != 400 {
+		t.Fatalf("bad variables: %d", w.Code)
+	}
+	// query errors are GraphQL errors with status 200
+	w = ut.PerformRequest(hs.Engine, "GET", "/graphql?query="+url.QueryEscape("{ nope }"), nil)
+	if w.Code != 200 || !strings.Contains(string(w.Result().Body()), `"errors"`) {
+		t.Fatalf("query error: %d %s", w.Code, w.Result().Body())
+	}
+}
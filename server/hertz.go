@@ -59,7 +59,7 @@ func NewHertz(script string) *server.Hertz {
 			req.URL = u
 		}
 
-		resp, err := eng.Eval(req)
+		resp, err := eng.EvalContext(c, req)
 		if err != nil {
 			ctx.SetStatusCode(500)
 			ctx.Response.Header.Set("Content-Type", "text/plain; charset=utf-8")
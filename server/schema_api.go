@@ -0,0 +1,552 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/app/server"
+	"xorm.io/xorm"
+
+	so "github.com/everpan/go-mdm/schema-orm"
+)
+
+// MigrationStatus is the state of a migration request.
+type MigrationStatus string
+
+const (
+	MigrationPending  MigrationStatus = "pending"
+	MigrationApproved MigrationStatus = "approved"
+	MigrationApplying MigrationStatus = "applying"
+	MigrationRejected MigrationStatus = "rejected"
+	MigrationApplied  MigrationStatus = "applied"
+	MigrationFailed   MigrationStatus = "failed"
+)
+
+// MigrationRequest asks for the live database to be migrated to a stored
+// schema version. It is applied only after someone other than the requester
+// approved it, and only while the plan still matches the database.
+type MigrationRequest struct {
+	ID          int               `json:"id"`
+	Version     int               `json:"version"`
+	Status      MigrationStatus   `json:"status"`
+	RequestedBy string            `json:"requestedBy"`
+	ReviewedBy  string            `json:"reviewedBy,omitempty"`
+	Comment     string            `json:"comment,omitempty"`
+	Error       string            `json:"error,omitempty"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	UpdatedAt   time.Time         `json:"updatedAt"`
+	Plan        *so.MigrationPlan `json:"plan"`
+}
+
+// SchemaAPI serves a SchemaStore over HTTP and migrates the database behind
+// Engine to its versions. Changes and reviews need a caller named by
+// Authenticate. Policy classifies diffs; nil uses the backward mode for every
+// table.
+type SchemaAPI struct {
+	Store  *SchemaStore
+	Engine *xorm.Engine
+	Policy *so.CompatibilityPolicy
+	// Authenticate returns the name of the caller of a request, or an error
+	// when the request does not prove one. It has to rely on something the
+	// client cannot choose, such as a verified token or session: the rule
+	// that requesters do not approve their own migrations depends on it.
+	// While it is nil every change is refused.
+	Authenticate func(c context.Context, ctx *app.RequestContext) (string, error)
+
+	// mu serializes the status changes of migration requests
+	mu sync.Mutex
+	// applyMu serializes migrations of the database
+	applyMu sync.Mutex
+}
+
+// NewSchemaAPI returns an API for the store and the live database.
+func NewSchemaAPI(store *SchemaStore, engine *xorm.Engine) *SchemaAPI {
+	return &SchemaAPI{Store: store, Engine: engine}
+}
+
+// RegisterSchemaAPI serves the API under prefix next to the script routes of
+// NewHertz:
+//
+//	GET    {prefix}/tables                      tables of a version (?version=, default current)
+//	GET    {prefix}/tables/:name                one table
+//	PATCH  {prefix}/tables/:name                JSON Merge Patch (RFC 7386); creates missing tables
+//	DELETE {prefix}/tables/:name                remove a table
+//	POST   {prefix}/validate                    validate a posted bundle, or the current version
+//	GET    {prefix}/diff                        live database against a version
+//	GET    {prefix}/migration                   preview the migration to a version
+//	POST   {prefix}/migrations                  request a migration ({"version": n})
+//	GET    {prefix}/migrations/:id              migration request
+//	POST   {prefix}/migrations/:id/approve      approve (not by the requester)
+//	POST   {prefix}/migrations/:id/reject       reject
+//	POST   {prefix}/migrations/:id/apply        apply an approved migration
+//	GET    {prefix}/versions                    version history
+//	GET    {prefix}/versions/:n                 one version with its bundle
+//
+// Every edit commits a new version and answers with its number in the ETag
+// header; sending it back in If-Match makes the edit fail with 412 when
+// someone else committed in between. Edits take the author from
+// Authenticate and the version message from ?message=.
+func RegisterSchemaAPI(hs *server.Hertz, prefix string, api *SchemaAPI) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	hs.GET(prefix+"/tables", api.listTables)
+	hs.GET(prefix+"/tables/:name", api.getTable)
+	hs.PATCH(prefix+"/tables/:name", api.patchTable)
+	hs.DELETE(prefix+"/tables/:name", api.deleteTable)
+	hs.POST(prefix+"/validate", api.validate)
+	hs.GET(prefix+"/diff", api.diff)
+	hs.GET(prefix+"/migration", api.previewMigration)
+	hs.POST(prefix+"/migrations", api.requestMigration)
+	hs.GET(prefix+"/migrations/:id", api.getMigration)
+	hs.POST(prefix+"/migrations/:id/:action", api.reviewMigration)
+	hs.GET(prefix+"/versions", api.listVersions)
+	hs.GET(prefix+"/versions/:n", api.getVersion)
+}
+
+// version resolves the ?version= parameter, defaulting to the current version.
+func (a *SchemaAPI) version(ctx *app.RequestContext) (*SchemaVersion, bool) {
+	var v *SchemaVersion
+	if s := string(ctx.Query("version")); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			writeAPIError(ctx, 400, "invalid version "+strconv.Quote(s))
+			return nil, false
+		}
+		v = a.Store.Get(n)
+	} else {
+		v = a.Store.Current()
+	}
+	if v == nil {
+		writeAPIError(ctx, 404, "schema version not found")
+		return nil, false
+	}
+	return v, true
+}
+
+func (a *SchemaAPI) listTables(c context.Context, ctx *app.RequestContext) {
+	if v, ok := a.version(ctx); ok {
+		writeVersioned(ctx, 200, v.Version, v.Bundle.Tables)
+	}
+}
+
+func (a *SchemaAPI) getTable(c context.Context, ctx *app.RequestContext) {
+	v, ok := a.version(ctx)
+	if !ok {
+		return
+	}
+	tb := v.Bundle.Table(ctx.Param("name"))
+	if tb == nil {
+		writeAPIError(ctx, 404, "table "+ctx.Param("name")+" not found")
+		return
+	}
+	writeVersioned(ctx, 200, v.Version, tb)
+}
+
+func (a *SchemaAPI) patchTable(c context.Context, ctx *app.RequestContext) {
+	if ct, _, _ := mime.ParseMediaType(string(ctx.ContentType())); ct != "application/merge-patch+json" && ct != "application/json" {
+		writeAPIError(ctx, 415, "expected application/merge-patch+json")
+		return
+	}
+	var patch any
+	if err := decodeJSON(ctx.Request.BodyBytes(), &patch); err != nil {
+		writeAPIError(ctx, 400, "invalid merge patch: "+err.Error())
+		return
+	}
+	a.edit(c, ctx, func(b *so.Bundle) (int, error) {
+		name := ctx.Param("name")
+		i := slices.IndexFunc(b.Tables, func(tb *so.Table) bool { return tb.Name == name || tb.FullName() == name })
+		doc := []byte(`{}`)
+		if i >= 0 {
+			var err error
+			if doc, err = json.Marshal(b.Tables[i]); err != nil {
+				return 500, err
+			}
+		}
+		var target any
+		if err := decodeJSON(doc, &target); err != nil {
+			return 500, err
+		}
+		if m, ok := target.(map[string]any); ok && i < 0 {
+			m["name"] = name
+		}
+		merged, err := json.Marshal(mergePatch(target, patch))
+		if err != nil {
+			return 500, err
+		}
+		tb := so.NewEmptyTable()
+		if err := json.Unmarshal(merged, tb); err != nil {
+			return 422, fmt.Errorf("patched table: %w", err)
+		}
+		for _, c := range tb.Columns {
+			// a column patched without a default has none, not DEFAULT ''
+			c.DefaultIsEmpty = c.Default == ""
+		}
+		if i >= 0 {
+			b.Tables[i] = tb
+		} else {
+			b.Tables = append(b.Tables, tb)
+		}
+		return 200, nil
+	})
+}
+
+func (a *SchemaAPI) deleteTable(c context.Context, ctx *app.RequestContext) {
+	a.edit(c, ctx, func(b *so.Bundle) (int, error) {
+		name := ctx.Param("name")
+		i := slices.IndexFunc(b.Tables, func(tb *so.Table) bool { return tb.Name == name || tb.FullName() == name })
+		if i < 0 {
+			return 404, errors.New("table " + name + " not found")
+		}
+		b.Tables = slices.Delete(b.Tables, i, i+1)
+		return 200, nil
+	})
+}
+
+// edit applies change to a copy of the current bundle, validates the result
+// and commits it as a new version. change returns the status to answer with
+// when it fails.
+func (a *SchemaAPI) edit(c context.Context, ctx *app.RequestContext, change func(b *so.Bundle) (int, error)) {
+	author, ok := a.requireUser(c, ctx)
+	if !ok {
+		return
+	}
+	cur := a.Store.Current()
+	if cur == nil {
+		writeAPIError(ctx, 404, "schema version not found")
+		return
+	}
+	if m := strings.Trim(string(ctx.GetHeader("If-Match")), `"`); m != "" && m != strconv.Itoa(cur.Version) {
+		writeAPIError(ctx, 412, fmt.Sprintf("If-Match %s does not match version %d", m, cur.Version))
+		return
+	}
+	if status, err := change(cur.Bundle); err != nil {
+		writeAPIError(ctx, status, err.Error())
+		return
+	}
+	if issues := so.ValidateTables(cur.Bundle.Tables); len(issues) > 0 {
+		writeJSON(ctx, 422, map[string]any{"error": "schema is invalid", "issues": issues})
+		return
+	}
+	// edits racing on the same version: the later one is refused, not merged
+	v, err := a.Store.Commit(cur.Bundle, author, string(ctx.Query("message")), cur.Version)
+	switch {
+	case errors.Is(err, ErrVersionConflict):
+		writeAPIError(ctx, 409, err.Error())
+	case err != nil:
+		writeAPIError(ctx, 500, err.Error())
+	default:
+		writeVersioned(ctx, 200, v.Version, map[string]any{"version": v.Version})
+	}
+}
+
+func (a *SchemaAPI) validate(c context.Context, ctx *app.RequestContext) {
+	var tables []*so.Table
+	if body := bytes.TrimSpace(ctx.Request.BodyBytes()); len(body) > 0 {
+		b, err := so.ParseBundle(body)
+		if err != nil {
+			writeAPIError(ctx, 400, err.Error())
+			return
+		}
+		tables = b.Tables
+	} else if v, ok := a.version(ctx); ok {
+		tables = v.Bundle.Tables
+	} else {
+		return
+	}
+	issues := so.ValidateTables(tables)
+	if issues == nil {
+		issues = []so.ValidationIssue{}
+	}
+	writeJSON(ctx, 200, map[string]any{"valid": len(issues) == 0, "issues": issues})
+}
+
+// live exports the managed tables of the database.
+func (a *SchemaAPI) live(c context.Context) ([]*so.Table, error) {
+	tables, err := so.ExportEngineSchema(c, a.Engine, so.ExportOptions{})
+	if err != nil {
+		return nil, err
+	}
+	managed := a.Store.managed()
+	return slices.DeleteFunc(tables, func(tb *so.Table) bool { return !managed[strings.ToLower(tb.FullName())] }), nil
+}
+
+// plan plans the migration of the live database to version v.
+func (a *SchemaAPI) plan(c context.Context, v *SchemaVersion) (*so.MigrationPlan, error) {
+	live, err := a.live(c)
+	if err != nil {
+		return nil, err
+	}
+	return so.PlanMigration(c, a.Engine, live, v.Bundle.Tables, v.Bundle.Naming)
+}
+
+func (a *SchemaAPI) diff(c context.Context, ctx *app.RequestContext) {
+	v, ok := a.version(ctx)
+	if !ok {
+		return
+	}
+	live, err := a.live(c)
+	if err != nil {
+		writeAPIError(ctx, 500, err.Error())
+		return
+	}
+	changes := so.DiffSchemas(live, v.Bundle.Tables)
+	if changes == nil {
+		changes = []so.SchemaChange{}
+	}
+	writeVersioned(ctx, 200, v.Version, map[string]any{
+		"version":       v.Version,
+		"changes":       changes,
+		"compatibility": so.CheckCompatibility(live, v.Bundle.Tables, a.Policy),
+	})
+}
+
+func (a *SchemaAPI) previewMigration(c context.Context, ctx *app.RequestContext) {
+	v, ok := a.version(ctx)
+	if !ok {
+		return
+	}
+	plan, err := a.plan(c, v)
+	if err != nil {
+		writeAPIError(ctx, 500, err.Error())
+		return
+	}
+	writeVersioned(ctx, 200, v.Version, plan)
+}
+
+func (a *SchemaAPI) requestMigration(c context.Context, ctx *app.RequestContext) {
+	user, ok := a.requireUser(c, ctx)
+	if !ok {
+		return
+	}
+	var body struct {
+		Version int    `json:"version"`
+		Comment string `json:"comment"`
+	}
+	if b := bytes.TrimSpace(ctx.Request.BodyBytes()); len(b) > 0 {
+		if err := json.Unmarshal(b, &body); err != nil {
+			writeAPIError(ctx, 400, "invalid request body: "+err.Error())
+			return
+		}
+	}
+	v := a.Store.Current()
+	if body.Version != 0 {
+		v = a.Store.Get(body.Version)
+	}
+	if v == nil {
+		writeAPIError(ctx, 404, "schema version not found")
+		return
+	}
+	plan, err := a.plan(c, v)
+	if err != nil {
+		writeAPIError(ctx, 500, err.Error())
+		return
+	}
+	now := time.Now().UTC()
+	m, err := a.Store.AddMigration(&MigrationRequest{Version: v.Version, Status: MigrationPending, RequestedBy: user,
+		Comment: body.Comment, CreatedAt: now, UpdatedAt: now, Plan: plan})
+	if err != nil {
+		writeAPIError(ctx, 500, err.Error())
+		return
+	}
+	writeJSON(ctx, 201, m)
+}
+
+// migration finds the request named by the :id parameter.
+func (a *SchemaAPI) migration(ctx *app.RequestContext) *MigrationRequest {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	var m *MigrationRequest
+	if err == nil {
+		m = a.Store.Migration(id)
+	}
+	if m == nil {
+		writeAPIError(ctx, 404, "migration "+ctx.Param("id")+" not found")
+	}
+	return m
+}
+
+func (a *SchemaAPI) getMigration(c context.Context, ctx *app.RequestContext) {
+	if m := a.migration(ctx); m != nil {
+		writeJSON(ctx, 200, m)
+	}
+}
+
+func (a *SchemaAPI) reviewMigration(c context.Context, ctx *app.RequestContext) {
+	user, ok := a.requireUser(c, ctx)
+	if !ok {
+		return
+	}
+	action := ctx.Param("action")
+	if action != "approve" && action != "reject" && action != "apply" {
+		writeAPIError(ctx, 404, "unknown action "+strconv.Quote(action))
+		return
+	}
+	a.mu.Lock()
+	m := a.migration(ctx)
+	if m == nil {
+		a.mu.Unlock()
+		return
+	}
+	switch action {
+	case "approve", "reject":
+		if m.Status != MigrationPending {
+			a.mu.Unlock()
+			writeAPIError(ctx, 409, "migration is "+string(m.Status))
+			return
+		}
+		if action == "approve" && user == m.RequestedBy {
+			a.mu.Unlock()
+			writeAPIError(ctx, 403, "a migration cannot be approved by its requester")
+			return
+		}
+		m.Status, m.ReviewedBy = MigrationApproved, user
+		if action == "reject" {
+			m.Status = MigrationRejected
+		}
+	case "apply":
+		if m.Status != MigrationApproved {
+			a.mu.Unlock()
+			writeAPIError(ctx, 409, "migration is "+string(m.Status)+", not approved")
+			return
+		}
+		// claimed, so that nobody else applies or reviews it meanwhile
+		m.Status = MigrationApplying
+	}
+	m.UpdatedAt = time.Now().UTC()
+	err := a.Store.UpdateMigration(m)
+	a.mu.Unlock()
+	if err != nil {
+		writeAPIError(ctx, 500, err.Error())
+		return
+	}
+	if action != "apply" {
+		writeJSON(ctx, 200, m)
+		return
+	}
+
+	status, msg := a.apply(c, m)
+	m.UpdatedAt = time.Now().UTC()
+	a.mu.Lock()
+	err = a.Store.UpdateMigration(m)
+	a.mu.Unlock()
+	switch {
+	case err != nil:
+		writeAPIError(ctx, 500, err.Error())
+	case msg != "":
+		writeAPIError(ctx, status, msg)
+	default:
+		writeJSON(ctx, status, m)
+	}
+}
+
+// apply plans m again and applies it when the plan is still the approved
+// one, setting m's outcome. m is claimed as applying, so no lock is held:
+// the export and the DDL block no other request. It returns the status to
+// answer with and, when m was not applied, the error message.
+func (a *SchemaAPI) apply(c context.Context, m *MigrationRequest) (int, string) {
+	a.applyMu.Lock()
+	defer a.applyMu.Unlock()
+	// back to approved unless it runs
+	m.Status = MigrationApproved
+	plan, err := a.plan(c, a.Store.Get(m.Version))
+	if err != nil {
+		return 500, err.Error()
+	}
+	if !slices.Equal(plan.SQL(), m.Plan.SQL()) || !slices.Equal(plan.Manual, m.Plan.Manual) {
+		return 409, "the database changed since the migration was approved; request it again"
+	}
+	m.Status = MigrationApplied
+	if err := so.ApplyMigration(c, a.Engine, plan); err != nil {
+		m.Status, m.Error = MigrationFailed, err.Error()
+		return 500, ""
+	}
+	return 200, ""
+}
+
+func (a *SchemaAPI) listVersions(c context.Context, ctx *app.RequestContext) {
+	writeJSON(ctx, 200, a.Store.Versions())
+}
+
+func (a *SchemaAPI) getVersion(c context.Context, ctx *app.RequestContext) {
+	n, err := strconv.Atoi(ctx.Param("n"))
+	v := a.Store.Get(n)
+	if err != nil || v == nil {
+		writeAPIError(ctx, 404, "schema version "+ctx.Param("n")+" not found")
+		return
+	}
+	writeVersioned(ctx, 200, v.Version, v)
+}
+
+// requireUser returns the caller named by Authenticate, answering 401 when
+// there is none.
+func (a *SchemaAPI) requireUser(c context.Context, ctx *app.RequestContext) (string, bool) {
+	if a.Authenticate == nil {
+		writeAPIError(ctx, 401, "schema API has no authenticator")
+		return "", false
+	}
+	user, err := a.Authenticate(c, ctx)
+	switch {
+	case err != nil:
+		writeAPIError(ctx, 401, err.Error())
+		return "", false
+	case user == "":
+		writeAPIError(ctx, 401, "authentication required")
+		return "", false
+	}
+	return user, true
+}
+
+// mergePatch applies an RFC 7386 merge patch: objects merge recursively,
+// null removes a member and everything else, arrays included, replaces.
+func mergePatch(target, patch any) any {
+	pm, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	tm, ok := target.(map[string]any)
+	if !ok {
+		tm = map[string]any{}
+	}
+	for k, v := range pm {
+		if v == nil {
+			delete(tm, k)
+		} else {
+			tm[k] = mergePatch(tm[k], v)
+		}
+	}
+	return tm
+}
+
+// decodeJSON decodes keeping numbers as written.
+func decodeJSON(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func writeVersioned(ctx *app.RequestContext, status, version int, v any) {
+	ctx.Response.Header.Set("ETag", strconv.Quote(strconv.Itoa(version)))
+	writeJSON(ctx, status, v)
+}
+
+func writeJSON(ctx *app.RequestContext, status int, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		status, b = 500, []byte(`{"error":`+strconv.Quote(err.Error())+`}`)
+	}
+	ctx.SetStatusCode(status)
+	ctx.Response.Header.Set("Content-Type", "application/json")
+	ctx.Response.SetBody(b)
+}
+
+func writeAPIError(ctx *app.RequestContext, status int, msg string) {
+	writeJSON(ctx, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,276 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/app/server"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"xorm.io/xorm"
+
+	so "github.com/everpan/go-mdm/schema-orm"
+)
+
+func newSchemaAPI(t *testing.T, dir string) (*server.Hertz, *SchemaAPI, *xorm.Engine) {
+	t.Helper()
+	eng, err := so.NewSQLiteEngine(so.BuildSQLiteDSN(filepath.Join(t.TempDir(), "live.db")))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { eng.Close() })
+	ddl := `CREATE TABLE customer (id INTEGER PRIMARY KEY, name VARCHAR(64) NOT NULL);
+CREATE TABLE scratch (x INTEGER);
+INSERT INTO customer (id, name) VALUES (1, 'Ada');`
+	if _, err := eng.Import(strings.NewReader(ddl)); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	tables, err := so.ExportEngineSchema(context.Background(), eng, so.ExportOptions{Include: []string{"customer"}})
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	store, err := NewSchemaStore(dir, so.NewBundle("sqlite", tables))
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	hs := NewHertz(`function handle(req,res){ res.end('js'); }`)
+	api := NewSchemaAPI(store, eng)
+	// stands in for verifying a token: "Bearer <user>"
+	api.Authenticate = func(c context.Context, ctx *app.RequestContext) (string, error) {
+		user, ok := strings.CutPrefix(string(ctx.GetHeader("Authorization")), "Bearer ")
+		if !ok {
+			return "", errors.New("bearer token required")
+		}
+		return user, nil
+	}
+	RegisterSchemaAPI(hs, "/schema", api)
+	return hs, api, eng
+}
+
+// call performs a request as user and decodes the JSON answer into out.
+func call(t *testing.T, hs *server.Hertz, method, path, user, body string, out any, headers ...ut.Header) int {
+	t.Helper()
+	if user != "" {
+		headers = append(headers, ut.Header{Key: "Authorization", Value: "Bearer " + user})
+	}
+	var b *ut.Body
+	if body != "" {
+		b = &ut.Body{Body: bytes.NewBufferString(body), Len: len(body)}
+	}
+	w := ut.PerformRequest(hs.Engine, method, path, b, headers...)
+	if out != nil {
+		if err := json.Unmarshal(w.Result().Body(), out); err != nil {
+			t.Fatalf("%s %s: %v: %s", method, path, err, w.Result().Body())
+		}
+	}
+	return w.Code
+}
+
+var mergePatchJSON = ut.Header{Key: "Content-Type", Value: "application/merge-patch+json"}
+
+func TestSchemaAPI_EditAndVersions(t *testing.T) {
+	dir := t.TempDir()
+	hs, _, _ := newSchemaAPI(t, dir)
+
+	var tables []*so.Table
+	if code := call(t, hs, "GET", "/schema/tables", "", "", &tables); code != 200 || len(tables) != 1 || tables[0].Name != "customer" {
+		t.Fatalf("list: %d %v", code, tables)
+	}
+
+	// add a column and a comment; columns is an array, so it is replaced whole
+	cols, _ := json.Marshal(tables[0].Columns)
+	patch := `{"comment": "buyers", "columns": ` + strings.TrimSuffix(string(cols), "]") +
+		`, {"name": "email", "sqlType": {"name": "VARCHAR"}, "length": 128, "nullable": true}]}`
+	var res map[string]int
+	if code := call(t, hs, "PATCH", "/schema/tables/customer?message=add+email", "alice", patch, &res, mergePatchJSON,
+		ut.Header{Key: "If-Match", Value: `"1"`}); code != 200 || res["version"] != 2 {
+		t.Fatalf("patch: %d %v", code, res)
+	}
+	var tb so.Table
+	call(t, hs, "GET", "/schema/tables/customer", "", "", &tb)
+	if tb.Comment != "buyers" || tb.GetColumn("email") == nil || len(tb.ColumnsSeq) != 3 || len(tb.PrimaryKeys) != 1 {
+		t.Fatalf("patched table: %+v", tb)
+	}
+
+	// stale If-Match, missing user, invalid result, wrong media type
+	var e map[string]any
+	if code := call(t, hs, "PATCH", "/schema/tables/customer", "alice", `{"comment": "x"}`, &e, mergePatchJSON,
+		ut.Header{Key: "If-Match", Value: `"1"`}); code != 412 {
+		t.Fatalf("stale If-Match: %d %v", code, e)
+	}
+	if code := call(t, hs, "PATCH", "/schema/tables/customer", "", `{"comment": "x"}`, nil, mergePatchJSON); code != 401 {
+		t.Fatalf("anonymous patch: %d", code)
+	}
+	// a name the client picks itself is no identity
+	if code := call(t, hs, "PATCH", "/schema/tables/customer", "", `{"comment": "x"}`, nil, mergePatchJSON,
+		ut.Header{Key: "X-User", Value: "alice"}); code != 401 {
+		t.Fatalf("X-User patch: %d", code)
+	}
+	if code := call(t, hs, "PATCH", "/schema/tables/customer", "alice", `{"primaryKeys": ["nope"]}`, &e, mergePatchJSON); code != 422 ||
+		!strings.Contains(e["issues"].([]any)[0].(map[string]any)["message"].(string), "does not exist") {
+		t.Fatalf("invalid patch: %d %v", code, e)
+	}
+	if code := call(t, hs, "PATCH", "/schema/tables/customer", "alice", `{}`, nil, ut.Header{Key: "Content-Type", Value: "text/plain"}); code != 415 {
+		t.Fatalf("media type: %d", code)
+	}
+
+	// create and delete a table
+	create := `{"columns": [{"name": "id", "sqlType": {"name": "INTEGER"}, "isPrimaryKey": true}]}`
+	if code := call(t, hs, "PATCH", "/schema/tables/tag", "bob", create, &res, mergePatchJSON); code != 200 || res["version"] != 3 {
+		t.Fatalf("create: %d %v", code, res)
+	}
+	if code := call(t, hs, "DELETE", "/schema/tables/tag", "bob", "", &res); code != 200 || res["version"] != 4 {
+		t.Fatalf("delete: %d %v", code, res)
+	}
+	if code := call(t, hs, "GET", "/schema/tables/tag?version=3", "", "", &tb); code != 200 || tb.Name != "tag" {
+		t.Fatalf("old version: %d %+v", code, tb)
+	}
+	if code := call(t, hs, "GET", "/schema/tables/tag", "", "", nil); code != 404 {
+		t.Fatalf("deleted table: %d", code)
+	}
+
+	var versions []SchemaVersion
+	call(t, hs, "GET", "/schema/versions", "", "", &versions)
+	if len(versions) != 4 || versions[1].Author != "alice" || versions[1].Message != "add email" || versions[1].Bundle != nil {
+		t.Fatalf("versions: %+v", versions)
+	}
+
+	// the history survives a restart
+	store, err := NewSchemaStore(dir, nil)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	v := store.Get(2)
+	if store.Current().Version != 4 || v == nil || len(v.Bundle.Tables[0].ColumnsSeq) != 3 || len(v.Bundle.Tables[0].PrimaryKeys) != 1 {
+		t.Fatalf("reloaded: %+v", v)
+	}
+
+	var valid struct {
+		Valid  bool                 `json:"valid"`
+		Issues []so.ValidationIssue `json:"issues"`
+	}
+	if call(t, hs, "POST", "/schema/validate", "", "", &valid); !valid.Valid {
+		t.Fatalf("current version: %+v", valid)
+	}
+	if call(t, hs, "POST", "/schema/validate", "", `[{"name": "t", "columns": []}]`, &valid); valid.Valid || len(valid.Issues) != 1 {
+		t.Fatalf("posted bundle: %+v", valid)
+	}
+}
+
+func TestSchemaAPI_DiffAndMigration(t *testing.T) {
+	dir := t.TempDir()
+	hs, _, eng := newSchemaAPI(t, dir)
+
+	var diff struct {
+		Changes []so.SchemaChange `json:"changes"`
+	}
+	if code := call(t, hs, "GET", "/schema/diff", "", "", &diff); code != 200 || len(diff.Changes) != 0 {
+		t.Fatalf("initial diff: %d %+v", code, diff)
+	}
+
+	patch := `{"indexes": {"name": {"isRegular": true, "name": "name", "type": 1, "cols": ["name"]}},
+"columns": [{"name": "id", "sqlType": {"name": "INTEGER"}, "isPrimaryKey": true},
+ {"name": "name", "sqlType": {"name": "VARCHAR"}, "length": 64},
+ {"name": "email", "sqlType": {"name": "TEXT"}, "nullable": true}]}`
+	if code := call(t, hs, "PATCH", "/schema/tables/customer", "alice", patch, nil, mergePatchJSON); code != 200 {
+		t.Fatalf("patch: %d", code)
+	}
+	// scratch is not managed by the store, so it is neither diffed nor dropped
+	if call(t, hs, "GET", "/schema/diff", "", "", &diff); len(diff.Changes) != 1 || diff.Changes[0].Kind != so.ChangeColumnAdded {
+		t.Fatalf("diff: %+v", diff)
+	}
+	var plan so.MigrationPlan
+	call(t, hs, "GET", "/schema/migration", "", "", &plan)
+	want := []string{"ALTER TABLE `customer` ADD `email` TEXT NULL", "CREATE INDEX `IDX_customer_name` ON `customer` (`name`)"}
+	if got := plan.SQL(); strings.Join(got, ";") != strings.Join(want, ";") {
+		t.Fatalf("preview: %q", got)
+	}
+
+	var m MigrationRequest
+	if code := call(t, hs, "POST", "/schema/migrations", "alice", `{"comment": "add email"}`, &m); code != 201 || m.Status != MigrationPending || m.Version != 2 {
+		t.Fatalf("request: %d %+v", code, m)
+	}
+	if code := call(t, hs, "POST", "/schema/migrations/1/apply", "alice", "", nil); code != 409 {
+		t.Fatalf("apply before approval: %d", code)
+	}
+	if code := call(t, hs, "POST", "/schema/migrations/1/approve", "alice", "", nil); code != 403 {
+		t.Fatalf("self approval: %d", code)
+	}
+	if code := call(t, hs, "POST", "/schema/migrations/1/approve", "bob", "", &m); code != 200 || m.Status != MigrationApproved || m.ReviewedBy != "bob" {
+		t.Fatalf("approve: %d %+v", code, m)
+	}
+	if code := call(t, hs, "POST", "/schema/migrations/1/apply", "bob", "", &m); code != 200 || m.Status != MigrationApplied {
+		t.Fatalf("apply: %d %+v", code, m)
+	}
+	if call(t, hs, "GET", "/schema/diff", "", "", &diff); len(diff.Changes) != 0 {
+		t.Fatalf("diff after apply: %+v", diff)
+	}
+	if has, _ := eng.IsTableExist("scratch"); !has {
+		t.Fatal("unmanaged table dropped")
+	}
+
+	// a plan approved before the database changed is not applied
+	call(t, hs, "PATCH", "/schema/tables/customer", "alice", `{"comment": "x", "columns": null}`, nil, mergePatchJSON)
+	call(t, hs, "POST", "/schema/migrations", "alice", "", &m)
+	call(t, hs, "POST", "/schema/migrations/2/reject", "bob", "", &m)
+	if m.Status != MigrationRejected {
+		t.Fatalf("reject: %+v", m)
+	}
+	call(t, hs, "POST", "/schema/migrations", "alice", `{"version": 1}`, &m)
+	call(t, hs, "POST", "/schema/migrations/3/approve", "bob", "", nil)
+	if _, err := eng.Exec("ALTER TABLE customer ADD note TEXT"); err != nil {
+		t.Fatalf("alter: %v", err)
+	}
+	if code := call(t, hs, "POST", "/schema/migrations/3/apply", "bob", "", nil); code != 409 {
+		t.Fatalf("stale plan: %d", code)
+	}
+	if code := call(t, hs, "GET", "/schema/migrations/9", "", "", nil); code != 404 {
+		t.Fatalf("unknown migration: %d", code)
+	}
+	if code := call(t, hs, "GET", "/schema/migrations/3", "", "", &m); code != 200 || m.Status != MigrationApproved {
+		t.Fatalf("stale plan stays approved: %d %+v", code, m)
+	}
+
+	// requests survive a restart; one caught applying is reported failed
+	stuck := m
+	stuck.Status = MigrationApplying
+	data, _ := json.Marshal(&stuck)
+	if err := os.WriteFile(filepath.Join(dir, "m3.json"), data, 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	store, err := NewSchemaStore(dir, nil)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if got := store.Migration(1); got == nil || got.Status != MigrationApplied || got.ReviewedBy != "bob" || len(got.Plan.SQL()) != 2 {
+		t.Fatalf("reloaded: %+v", got)
+	}
+	if got := store.Migration(3); got.Status != MigrationFailed || got.Error == "" {
+		t.Fatalf("interrupted: %+v", got)
+	}
+	if m, err := store.AddMigration(&MigrationRequest{Version: 1}); err != nil || m.ID != 4 {
+		t.Fatalf("add after reload: %+v %v", m, err)
+	}
+
+	// other paths still reach the script
+	w := ut.PerformRequest(hs.Engine, "GET", "/other", nil)
+	if got := string(w.Result().Body()); got != "js" {
+		t.Fatalf("script route: %s", got)
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	var target, patch any
+	_ = json.Unmarshal([]byte(`{"a": "b", "c": {"d": "e", "f": "g"}, "l": [1]}`), &target)
+	_ = json.Unmarshal([]byte(`{"a": "z", "c": {"f": null}, "l": [2, 3], "n": {"x": 1}}`), &patch)
+	got, _ := json.Marshal(mergePatch(target, patch))
+	if string(got) != `{"a":"z","c":{"d":"e"},"l":[2,3],"n":{"x":1}}` {
+		t.Fatalf("merge: %s", got)
+	}
+}
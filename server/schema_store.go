@@ -0,0 +1,288 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	so "github.com/everpan/go-mdm/schema-orm"
+)
+
+// ErrVersionConflict is returned by SchemaStore.Commit when the change was
+// made against a version that is no longer current.
+var ErrVersionConflict = errors.New("schema version conflict")
+
+// SchemaVersion is one committed state of the stored schema bundle.
+type SchemaVersion struct {
+	Version   int        `json:"version"`
+	Author    string     `json:"author,omitempty"`
+	Message   string     `json:"message,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	Bundle    *so.Bundle `json:"bundle"`
+}
+
+// SchemaStore keeps every version of a schema bundle and the migration
+// requests made against them. With a directory each version is written to
+// v<N>.json there, each migration request to m<N>.json, and both are read
+// back by NewSchemaStore; without one they live in memory. Bundles and
+// requests handed out are copies, so callers may change them freely.
+type SchemaStore struct {
+	mu         sync.RWMutex
+	dir        string
+	versions   []*SchemaVersion
+	migrations []*MigrationRequest
+}
+
+// NewSchemaStore opens the store in dir ("" keeps it in memory). When the
+// store is empty and initial is not nil, initial becomes version 1.
+func NewSchemaStore(dir string, initial *so.Bundle) (*SchemaStore, error) {
+	s := &SchemaStore{dir: dir}
+	if dir != "" {
+		if err := s.load(); err != nil {
+			return nil, err
+		}
+	}
+	if len(s.versions) == 0 && initial != nil {
+		if _, err := s.Commit(initial, "", "initial version", 0); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *SchemaStore) load() error {
+	if err := loadNumbered(s.dir, "v", func(p string, data []byte) error {
+		v := &SchemaVersion{}
+		if err := json.Unmarshal(data, v); err != nil {
+			return fmt.Errorf("schema version %s: %w", p, err)
+		}
+		if v.Bundle == nil {
+			return fmt.Errorf("schema version %s: no bundle", p)
+		}
+		s.versions = append(s.versions, v)
+		return nil
+	}); err != nil {
+		return err
+	}
+	slices.SortFunc(s.versions, func(a, b *SchemaVersion) int { return a.Version - b.Version })
+	for i, v := range s.versions {
+		if v.Version != i+1 {
+			return fmt.Errorf("schema store %s: version %d missing", s.dir, i+1)
+		}
+	}
+
+	if err := loadNumbered(s.dir, "m", func(p string, data []byte) error {
+		m := &MigrationRequest{}
+		if err := json.Unmarshal(data, m); err != nil {
+			return fmt.Errorf("migration request %s: %w", p, err)
+		}
+		s.migrations = append(s.migrations, m)
+		return nil
+	}); err != nil {
+		return err
+	}
+	slices.SortFunc(s.migrations, func(a, b *MigrationRequest) int { return a.ID - b.ID })
+	for i, m := range s.migrations {
+		if m.ID != i+1 {
+			return fmt.Errorf("schema store %s: migration %d missing", s.dir, i+1)
+		}
+		if m.Status == MigrationApplying {
+			// the process stopped while applying it; the database may be
+			// partly migrated
+			m.Status, m.Error = MigrationFailed, "interrupted while applying"
+			if err := s.write(fmt.Sprintf("m%d.json", m.ID), m); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// loadNumbered calls read with the content of every <prefix><N>.json file in
+// dir.
+func loadNumbered(dir, prefix string, read func(path string, data []byte) error) error {
+	paths, err := filepath.Glob(filepath.Join(dir, prefix+"*.json"))
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		if _, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(p), prefix), ".json")); err != nil {
+			continue
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if err := read(p, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write stores v as JSON in the file name of the store's directory, through
+// a temporary file so that a crash leaves the old content. It does nothing
+// for a store in memory.
+func (s *SchemaStore) write(name string, v any) error {
+	if s.dir == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(s.dir, "."+name+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), filepath.Join(s.dir, name)); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// Current returns a copy of the latest version, or nil for an empty store.
+func (s *SchemaStore) Current() *SchemaVersion {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.versions) == 0 {
+		return nil
+	}
+	return copyVersion(s.versions[len(s.versions)-1])
+}
+
+// Get returns a copy of version n, or nil when it does not exist.
+func (s *SchemaStore) Get(n int) *SchemaVersion {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if n < 1 || n > len(s.versions) {
+		return nil
+	}
+	return copyVersion(s.versions[n-1])
+}
+
+// Versions lists all versions without their bundles, oldest first.
+func (s *SchemaStore) Versions() []*SchemaVersion {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]*SchemaVersion, len(s.versions))
+	for i, v := range s.versions {
+		vv := *v
+		vv.Bundle = nil
+		out[i] = &vv
+	}
+	return out
+}
+
+// Commit stores b as the next version. A non-zero base must be the current
+// version, otherwise ErrVersionConflict is returned and nothing is stored.
+func (s *SchemaStore) Commit(b *so.Bundle, author, message string, base int) (*SchemaVersion, error) {
+	b, err := copyBundle(b)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if base != 0 && base != len(s.versions) {
+		return nil, fmt.Errorf("%w: change is based on version %d, current is %d", ErrVersionConflict, base, len(s.versions))
+	}
+	v := &SchemaVersion{Version: len(s.versions) + 1, Author: author, Message: message, CreatedAt: time.Now().UTC(), Bundle: b}
+	if err := s.write(fmt.Sprintf("v%d.json", v.Version), v); err != nil {
+		return nil, err
+	}
+	s.versions = append(s.versions, v)
+	return copyVersion(v), nil
+}
+
+// AddMigration stores m as a new migration request, numbering it, and
+// returns the stored copy.
+func (s *SchemaStore) AddMigration(m *MigrationRequest) (*MigrationRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mm := *m
+	mm.ID = len(s.migrations) + 1
+	if err := s.write(fmt.Sprintf("m%d.json", mm.ID), &mm); err != nil {
+		return nil, err
+	}
+	s.migrations = append(s.migrations, &mm)
+	out := mm
+	return &out, nil
+}
+
+// Migration returns a copy of migration request id, or nil when it does not
+// exist.
+func (s *SchemaStore) Migration(id int) *MigrationRequest {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if id < 1 || id > len(s.migrations) {
+		return nil
+	}
+	m := *s.migrations[id-1]
+	return &m
+}
+
+// UpdateMigration replaces the stored migration request with m's ID.
+func (s *SchemaStore) UpdateMigration(m *MigrationRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m.ID < 1 || m.ID > len(s.migrations) {
+		return fmt.Errorf("migration %d not found", m.ID)
+	}
+	mm := *m
+	if err := s.write(fmt.Sprintf("m%d.json", mm.ID), &mm); err != nil {
+		return err
+	}
+	s.migrations[mm.ID-1] = &mm
+	return nil
+}
+
+// managed reports the lower-cased full names of the tables found in any
+// version; only those are compared with and migrated on a live database.
+func (s *SchemaStore) managed() map[string]bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := map[string]bool{}
+	for _, v := range s.versions {
+		for _, tb := range v.Bundle.Tables {
+			out[strings.ToLower(tb.FullName())] = true
+		}
+	}
+	return out
+}
+
+func copyVersion(v *SchemaVersion) *SchemaVersion {
+	vv := *v
+	// stored bundles already round-tripped through JSON once, so this cannot fail
+	vv.Bundle, _ = copyBundle(v.Bundle)
+	return &vv
+}
+
+// copyBundle deep-copies a bundle through its JSON form.
+func copyBundle(b *so.Bundle) (*so.Bundle, error) {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+	return so.ParseBundle(data)
+}
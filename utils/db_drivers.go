@@ -1,7 +1,9 @@
 package utils
 
 // Ensure SQL drivers are registered when utils is imported.
+// modernc.org/sqlite is a pure-Go SQLite driver registered as "sqlite".
 import (
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
 )
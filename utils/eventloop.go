@@ -0,0 +1,232 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// DefaultMaxConcurrency is the number of async operations an EventLoop runs
+// at once unless LoopOptions says otherwise.
+const DefaultMaxConcurrency = 4
+
+// LoopOptions configures an EventLoop.
+type LoopOptions struct {
+	// MaxConcurrency bounds the async operations running at once; the others
+	// wait for a free slot, so a script can hand any number of queries to
+	// Promise.all. Zero means DefaultMaxConcurrency.
+	MaxConcurrency int
+}
+
+// EventLoop runs a goja runtime on the goroutine that calls Run and lets
+// bound functions do their work on other goroutines. That work never touches
+// the runtime: its results come back to the loop, which settles the promises
+// handed to the script. A loop runs one Run at a time.
+type EventLoop struct {
+	rt  *goja.Runtime
+	sem chan struct{}
+
+	mu   sync.Mutex
+	jobs []loopJob
+	wake chan struct{}
+
+	// used on the loop goroutine only
+	running  bool
+	gen      uint64
+	pending  int
+	rejected map[*goja.Promise]bool
+	awaited  *goja.Promise
+}
+
+// loopJob settles a promise of the Run numbered gen.
+type loopJob struct {
+	gen    uint64
+	settle func() error
+}
+
+// runtimeLoops holds the loop of each runtime while it runs.
+var runtimeLoops sync.Map // *goja.Runtime -> *EventLoop
+
+// NewEventLoop returns a loop for rt.
+func NewEventLoop(rt *goja.Runtime, opts LoopOptions) *EventLoop {
+	if opts.MaxConcurrency <= 0 {
+		opts.MaxConcurrency = DefaultMaxConcurrency
+	}
+	return &EventLoop{rt: rt, sem: make(chan struct{}, opts.MaxConcurrency), wake: make(chan struct{}, 1)}
+}
+
+// runningLoop returns the loop running rt, or nil.
+func runningLoop(rt *goja.Runtime) *EventLoop {
+	if l, ok := runtimeLoops.Load(rt); ok {
+		return l.(*EventLoop)
+	}
+	return nil
+}
+
+// Run calls run, which runs JS on the runtime, under ctx (see RunWithContext)
+// and then settles promises until no async operation is pending. When ctx
+// ends, pending operations reject with TimeoutError and the script has
+// InterruptGrace to handle them. It returns the error of run, the context's
+// error when the script is still waiting after that, or an error for a
+// promise rejection that no handler took. Operations still running when Run
+// returns are cancelled and settle nothing.
+func (l *EventLoop) Run(ctx context.Context, run func() error) error {
+	if l.running {
+		return errors.New("event loop: already running")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	l.running, l.rejected = true, map[*goja.Promise]bool{}
+	runtimeLoops.Store(l.rt, l)
+	l.rt.SetPromiseRejectionTracker(func(p *goja.Promise, op goja.PromiseRejectionOperation) {
+		if op == goja.PromiseRejectionReject {
+			l.rejected[p] = true
+		} else {
+			delete(l.rejected, p)
+		}
+	})
+	defer func() {
+		l.rt.SetPromiseRejectionTracker(nil)
+		runtimeLoops.Delete(l.rt)
+		l.running, l.rejected, l.pending = false, nil, 0
+		l.gen++
+	}()
+
+	return RunWithContext(ctx, l.rt, func() error {
+		if err := run(); err != nil {
+			return err
+		}
+		done := ctx.Done()
+		var grace <-chan time.Time
+		for l.pending > 0 {
+			select {
+			case <-l.wake:
+			case <-done:
+				// pending operations reject with TimeoutError, which the
+				// script may handle within the grace period
+				done, grace = nil, time.After(InterruptGrace)
+			case <-grace:
+				return scriptInterrupted(ctx)
+			}
+			l.mu.Lock()
+			jobs := l.jobs
+			l.jobs = nil
+			l.mu.Unlock()
+			for _, job := range jobs {
+				if job.gen != l.gen {
+					continue
+				}
+				l.pending--
+				if err := job.settle(); err != nil {
+					return err
+				}
+			}
+		}
+		for p := range l.rejected {
+			if p != l.awaited {
+				return fmt.Errorf("event loop: unhandled promise rejection: %s", p.Result())
+			}
+		}
+		return nil
+	})
+}
+
+// RunScript runs src on the loop. When the script evaluates to a promise, as
+// the call of an async function does, the result is the promise's value and
+// its rejection is returned as an error.
+func (l *EventLoop) RunScript(ctx context.Context, src string) (goja.Value, error) {
+	var v goja.Value
+	err := l.Run(ctx, func() (err error) {
+		v, err = l.rt.RunString(src)
+		if p, ok := exportPromise(v); ok {
+			l.awaited = p
+		}
+		return err
+	})
+	p, ok := exportPromise(v)
+	l.awaited = nil
+	if err != nil || !ok {
+		return v, err
+	}
+	switch p.State() {
+	case goja.PromiseStateFulfilled:
+		return p.Result(), nil
+	case goja.PromiseStateRejected:
+		if o, ok := p.Result().(*goja.Object); ok {
+			// the Go error of a bound call, such as a TimeoutError, stays
+			// visible to errors.Is
+			if v := o.Get("value"); v != nil {
+				if err, ok := v.Export().(error); ok {
+					return nil, fmt.Errorf("event loop: script rejected: %w", err)
+				}
+			}
+		}
+		return nil, fmt.Errorf("event loop: script rejected: %s", p.Result())
+	}
+	return nil, errors.New("event loop: script promise never settled")
+}
+
+func exportPromise(v goja.Value) (*goja.Promise, bool) {
+	if v == nil {
+		return nil, false
+	}
+	p, ok := v.Export().(*goja.Promise)
+	return p, ok
+}
+
+// Async starts work on another goroutine once one of the loop's slots is
+// free and returns a promise that the loop resolves with convert(result) or
+// rejects with the error, as bound calls throw it. It must be called on the
+// loop, that is from JS during Run. work gets the script's context and must
+// not touch the runtime; convert runs on the loop.
+func (l *EventLoop) Async(work func(ctx context.Context) (any, error), convert func(any) goja.Value) *goja.Promise {
+	p, resolve, reject := l.rt.NewPromise()
+	ctx := ScriptContext(l.rt)
+	gen := l.gen
+	l.pending++
+	go func() {
+		var (
+			res any
+			err error
+		)
+		select {
+		case l.sem <- struct{}{}:
+			res, err = runWork(ctx, work)
+			<-l.sem
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		l.post(loopJob{gen: gen, settle: func() error {
+			if err != nil {
+				return reject(callError(l.rt, err))
+			}
+			return resolve(convert(res))
+		}})
+	}()
+	return p
+}
+
+// runWork calls work and turns a panic into an error, the goroutine would
+// otherwise take the process down.
+func runWork(ctx context.Context, work func(context.Context) (any, error)) (res any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("async operation panicked: %v", r)
+		}
+	}()
+	return work(ctx)
+}
+
+func (l *EventLoop) post(job loopJob) {
+	l.mu.Lock()
+	l.jobs = append(l.jobs, job)
+	l.mu.Unlock()
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
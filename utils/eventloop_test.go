@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+func TestEventLoop_ConcurrencyLimit(t *testing.T) {
+	rt := goja.New()
+	loop := NewEventLoop(rt, LoopOptions{MaxConcurrency: 3})
+	var running, peak atomic.Int32
+	_ = rt.Set("work", func(n int) *goja.Promise {
+		return loop.Async(func(context.Context) (any, error) {
+			now := running.Add(1)
+			for p := peak.Load(); now > p && !peak.CompareAndSwap(p, now); p = peak.Load() {
+			}
+			time.Sleep(10 * time.Millisecond)
+			running.Add(-1)
+			return n * n, nil
+		}, func(v any) goja.Value { return rt.ToValue(v) })
+	})
+	v, err := loop.RunScript(context.Background(), `
+		(async function () {
+			var xs = [];
+			for (var i = 0; i < 12; i++) xs.push(work(i));
+			return (await Promise.all(xs)).join(',');
+		})()
+	`)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if v.String() != "0,1,4,9,16,25,36,49,64,81,100,121" || peak.Load() != 3 {
+		t.Fatalf("got %s with %d at once", v, peak.Load())
+	}
+}
+
+func TestEventLoop_AsyncQueries(t *testing.T) {
+	rt, eng := newTxRuntime(t)
+	loop := NewEventLoop(rt, LoopOptions{})
+	v, err := loop.RunScript(context.Background(), `
+		(async function () {
+			await db.ExecAsync('INSERT INTO item (id, name) VALUES (?, ?), (?, ?)', 1, 'a', 2, 'b');
+			var rs = await Promise.all([
+				db.QueryStringAsync('SELECT name FROM item WHERE id = ?', 1),
+				db.queryTypedAsync('SELECT id FROM item ORDER BY id'),
+				db.QueryInterfaceAsync('SELECT count(*) AS n FROM item'),
+			]);
+			var failed;
+			try { await db.queryTypedAsync('SELECT * FROM missing'); } catch (e) { failed = e.name; }
+			return [rs[0][0].name, rs[1].map(function (r) { return typeof r.id + r.id; }).join(' '), rs[2][0].n, failed].join('|');
+		})()
+	`)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if v.String() != "a|number1 number2|2|GoError" {
+		t.Fatalf("got %s", v)
+	}
+	if n, _ := eng.Table("item").Count(); n != 2 {
+		t.Fatalf("rows: %d", n)
+	}
+
+	// without a loop the async methods throw
+	if _, err := rt.RunString(`db.QueryStringAsync('SELECT 1')`); err == nil || !strings.Contains(err.Error(), "needs a running EventLoop") {
+		t.Fatalf("no loop: %v", err)
+	}
+	// the read-only profile keeps ExecAsync out
+	_ = rt.Set("ro", BindAllMethodsWith(rt, eng, BindOptions{ReadOnly: true}))
+	v, err = loop.RunScript(context.Background(), `typeof ro.ExecAsync + ',' + typeof ro.QueryStringAsync`)
+	if err != nil || v.String() != "undefined,function" {
+		t.Fatalf("read-only: %v %v", v, err)
+	}
+}
+
+func TestEventLoop_Errors(t *testing.T) {
+	rt, _ := newTxRuntime(t)
+	loop := NewEventLoop(rt, LoopOptions{})
+	if _, err := loop.RunScript(context.Background(), `db.queryTypedAsync('SELECT * FROM missing'); 1`); err == nil || !strings.Contains(err.Error(), "unhandled promise rejection") {
+		t.Fatalf("unhandled: %v", err)
+	}
+	if _, err := loop.RunScript(context.Background(), `(async function () { throw new Error('boom'); })()`); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("rejected: %v", err)
+	}
+	if _, err := loop.RunScript(context.Background(), `new Promise(function () {})`); err == nil || !strings.Contains(err.Error(), "never settled") {
+		t.Fatalf("pending: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := loop.RunScript(ctx, `db.queryTypedAsync(`+"`"+slowQuery+"`"+`)`)
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > 5*time.Second {
+		t.Fatalf("deadline: %v after %v", err, time.Since(start))
+	}
+
+	// the loop runs again afterwards
+	v, err := loop.RunScript(context.Background(), `db.QueryStringAsync('SELECT 3 AS x').then(function (r) { return r[0].x; })`)
+	if err != nil || v.String() != "3" {
+		t.Fatalf("rerun: %v %v", v, err)
+	}
+}
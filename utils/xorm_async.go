@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/dop251/goja"
+	"xorm.io/xorm"
+)
+
+// AsyncMethods are the *xorm.Engine methods that get an <name>Async variant
+// returning a Promise. Sessions get none: a session is one connection and
+// cannot serve concurrent calls.
+var AsyncMethods = []string{"Exec", "Query", "QueryInterface", "QueryString"}
+
+// bindAsync adds the async variants of AsyncMethods and queryTyped to obj,
+// calling the engine that engine returns for the method and its SQL, which
+// is released once the operation finished or the script ended. They need a
+// running EventLoop and count as their synchronous method for policy.
+func bindAsync(rt *goja.Runtime, obj *goja.Object, engine func(name, query string) (*xorm.Engine, func()), policy *bindPolicy) {
+	typ := reflect.TypeOf((*xorm.Engine)(nil))
+	for _, name := range AsyncMethods {
+		meth, ok := typ.MethodByName(name)
+		if !ok || !policy.exposes(name) {
+			continue
+		}
+		_ = obj.Set(name+"Async", func(call goja.FunctionCall) goja.Value {
+			loop := asyncLoop(rt, name+"Async")
+			mt := meth.Type
+			fixedParams := mt.NumIn() - 1
+			if mt.IsVariadic() {
+				fixedParams--
+			}
+			if len(call.Arguments) < fixedParams {
+				panic(rt.NewTypeError("method %sAsync requires %d arguments, got %d", name, fixedParams, len(call.Arguments)))
+			}
+			// a call that throws here must not hold an engine, see asyncEngine
+			args := append([]reflect.Value{{}}, buildFixedArgs(rt, call, mt, fixedParams, name)...)
+			variadic := reflect.Value{}
+			if mt.IsVariadic() {
+				sliceT := mt.In(mt.NumIn() - 1)
+				variadic = buildVariadicSlice(rt, call, fixedParams, sliceT, sliceT.Elem(), name)
+				args = append(args, variadic)
+			}
+			policy.checkReflected(rt, name, args[1:1+fixedParams], variadic)
+			query, _ := call.Argument(0).Export().(string)
+			eng, release := asyncEngine(rt, engine, name, query)
+			args[0] = reflect.ValueOf(eng)
+
+			p := loop.Async(func(ctx context.Context) (any, error) {
+				defer release()
+				ctx, cancel := policy.timeout(ctx)
+				defer cancel()
+				var results []reflect.Value
+				recv, fn, restore := withContext(args[0], meth, ctx)
+				defer restore()
+				args[0] = recv
+				if mt.IsVariadic() {
+					results = fn.Func.CallSlice(args)
+				} else {
+					results = fn.Func.Call(args)
+				}
+				if n := len(results); n > 0 {
+					if err, _ := results[n-1].Interface().(error); err != nil {
+						return nil, err
+					}
+					results = results[:n-1]
+				}
+				out := make([]any, len(results))
+				for i, r := range results {
+					out[i] = r.Interface()
+				}
+				return out, nil
+			}, func(res any) goja.Value {
+				out := res.([]any)
+				switch len(out) {
+				case 0:
+					return goja.Undefined()
+				case 1:
+					return rt.ToValue(out[0])
+				}
+				return rt.ToValue(out)
+			})
+			return rt.ToValue(p)
+		})
+	}
+
+	if !policy.exposes("queryTyped") {
+		return
+	}
+	_ = obj.Set("queryTypedAsync", func(call goja.FunctionCall) goja.Value {
+		loop := asyncLoop(rt, "queryTypedAsync")
+		opts, query, params := queryTypedArgs(rt, call, "queryTypedAsync", policy)
+		eng, release := asyncEngine(rt, engine, "queryTyped", query)
+		p := loop.Async(func(ctx context.Context) (any, error) {
+			defer release()
+			ctx, cancel := policy.timeout(ctx)
+			defer cancel()
+			scanned, _, err := queryRows(ctx, eng, query, params...)
+			return scanned, err
+		}, func(res any) goja.Value {
+			return res.(*scannedRows).toJS(rt, opts, eng.DatabaseTZ)
+		})
+		return rt.ToValue(p)
+	})
+}
+
+// asyncEngine returns the engine for an async operation and a release that
+// may be called more than once: the operation calls it when it finished and
+// the end of the script when the operation never started. Callers check
+// their arguments first, so that a call that throws holds no engine.
+func asyncEngine(rt *goja.Runtime, engine func(name, query string) (*xorm.Engine, func()), name, query string) (*xorm.Engine, func()) {
+	eng, release := engine(name, query)
+	if eng == nil {
+		release()
+		panic(rt.NewTypeError("xorm engine not set for proxy"))
+	}
+	once := sync.OnceFunc(release)
+	context.AfterFunc(ScriptContext(rt), once)
+	return eng, once
+}
+
+// asyncLoop returns the loop running rt and throws when there is none.
+func asyncLoop(rt *goja.Runtime, name string) *EventLoop {
+	loop := runningLoop(rt)
+	if loop == nil {
+		panic(rt.NewTypeError("%s needs a running EventLoop", name))
+	}
+	return loop
+}
@@ -17,97 +17,147 @@ import (
 //   - If the last return value is an error, and it's non-nil, a JS Error is thrown.
 //   - If there is a single non-error return value, it is returned directly.
 //   - If there are multiple return values (excluding an error), an Array is returned.
+//   - An *xorm.Engine also gets transaction([options,] fn), see bindTransaction.
+//   - Engines and sessions get queryTyped([options,] sql, ...args), see QueryJS.
+//   - Engines get Promise-returning variants of a few query methods, see
+//     AsyncMethods and EventLoop.
 func BindAllMethods(rt *goja.Runtime, target any) *goja.Object {
+	return bindAllMethods(rt, target, nil)
+}
+
+// BindAllMethodsWith is BindAllMethods restricted by opts: methods that are
+// not allowed are left out and arguments are validated before each call.
+func BindAllMethodsWith(rt *goja.Runtime, target any, opts BindOptions) *goja.Object {
+	return bindAllMethods(rt, target, newBindPolicy(opts))
+}
+
+func bindAllMethods(rt *goja.Runtime, target any, policy *bindPolicy) *goja.Object {
 	obj := rt.NewObject()
 	if target == nil {
 		return obj
 	}
+	if g, ok := target.(*xorm.EngineGroup); ok {
+		return bindGroup(rt, func() (*xorm.EngineGroup, func()) { return g, noRelease }, policy)
+	}
 	val := reflect.ValueOf(target)
 	typ := val.Type()
 
 	for i := 0; i < typ.NumMethod(); i++ {
 		m := typ.Method(i)
 		// Skip unexported
-		if m.PkgPath != "" {
+		if m.PkgPath != "" || !policy.exposes(m.Name) {
 			continue
 		}
 
-		name := m.Name // capture
-		meth := m      // capture
-		_ = obj.Set(name, func(call goja.FunctionCall) goja.Value {
-			// Prepare arguments
-			mt := meth.Type
-			inTotal := mt.NumIn() // includes receiver
-			isVar := mt.IsVariadic()
-			// Exclude receiver for argument expectations
-			fixedParams := inTotal - 1
-			if isVar {
-				fixedParams = inTotal - 2 // last is the variadic slice type
-			}
-			if (!isVar && len(call.Arguments) != fixedParams) || (isVar && len(call.Arguments) < fixedParams) {
-				err := fmt.Errorf("method %s requires %d arguments%v, got %d", name, fixedParams, ternary(isVar, "+variadic", ""), len(call.Arguments))
-				panic(rt.NewTypeError(err.Error()))
-			}
-			args := make([]reflect.Value, 0, inTotal)
-			args = append(args, val)
-			// Fixed params
-			fixed := buildFixedArgs(rt, call, mt, fixedParams, name)
-			args = append(args, fixed...)
+		meth := m // capture
+		_ = obj.Set(meth.Name, func(call goja.FunctionCall) goja.Value {
+			return callMethod(rt, call, meth, func() (reflect.Value, reflect.Method) { return val, meth }, policy)
+		})
+	}
+	switch v := target.(type) {
+	case *xorm.Engine:
+		bindTransaction(rt, obj, func() (*xorm.Engine, func()) { return v, noRelease }, policy)
+		bindQueryTyped(rt, obj, func(string) (any, func()) { return v, noRelease }, policy)
+		bindAsync(rt, obj, func(string, string) (*xorm.Engine, func()) { return v, noRelease }, policy)
+	case *xorm.Session:
+		bindQueryTyped(rt, obj, func(string) (any, func()) { return v, noRelease }, policy)
+	}
+	return obj
+}
 
-			// Call
-			var results []reflect.Value
-			if isVar {
-				sliceT := mt.In(inTotal - 1)
-				elemT := sliceT.Elem()
-				slice := buildVariadicSlice(rt, call, fixedParams, sliceT, elemT, name)
-				args = append(args, slice)
-				results = meth.Func.CallSlice(args)
-			} else {
-				results = meth.Func.Call(args)
-			}
+// callMethod calls meth with the arguments of call and converts its results
+// as BindAllMethods describes. Once the arguments are counted, target
+// returns the receiver and the method to call on it, which has meth's name
+// and signature.
+func callMethod(rt *goja.Runtime, call goja.FunctionCall, meth reflect.Method, target func() (reflect.Value, reflect.Method), policy *bindPolicy) goja.Value {
+	name := meth.Name
+	// Prepare arguments
+	mt := meth.Type
+	inTotal := mt.NumIn() // includes receiver
+	isVar := mt.IsVariadic()
+	// Exclude receiver for argument expectations
+	fixedParams := inTotal - 1
+	if isVar {
+		fixedParams = inTotal - 2 // last is the variadic slice type
+	}
+	if (!isVar && len(call.Arguments) != fixedParams) || (isVar && len(call.Arguments) < fixedParams) {
+		err := fmt.Errorf("method %s requires %d arguments%v, got %d", name, fixedParams, ternary(isVar, "+variadic", ""), len(call.Arguments))
+		panic(rt.NewTypeError(err.Error()))
+	}
+	recv, meth := target()
+	args := make([]reflect.Value, 0, inTotal)
+	args = append(args, recv)
+	// Fixed params
+	fixed := buildFixedArgs(rt, call, mt, fixedParams, name)
+	args = append(args, fixed...)
 
-			n := len(results)
-			if n == 0 {
-				return goja.Undefined()
-			}
+	// Call under the script's context, see RunWithContext
+	ctx, cancel := policy.callContext(rt)
+	keep := false
+	defer func() {
+		if !keep {
+			cancel()
+		}
+	}()
+	var (
+		results []reflect.Value
+		fn      reflect.Method
+	)
+	if isVar {
+		sliceT := mt.In(inTotal - 1)
+		elemT := sliceT.Elem()
+		slice := buildVariadicSlice(rt, call, fixedParams, sliceT, elemT, name)
+		policy.checkReflected(rt, name, fixed, slice)
+		args = append(args, slice)
+		var restore func()
+		args[0], fn, restore = withContext(recv, meth, ctx)
+		defer restore()
+		results = fn.Func.CallSlice(args)
+	} else {
+		policy.checkReflected(rt, name, fixed, reflect.Value{})
+		var restore func()
+		args[0], fn, restore = withContext(recv, meth, ctx)
+		defer restore()
+		results = fn.Func.Call(args)
+	}
+	keep = keepsContext(results)
 
-			// Handle trailing error
-			if _, hasErr := trailingErrorType(meth.Type); hasErr {
-				errVal := results[n-1]
-				if !errVal.IsZero() && !errVal.IsNil() {
-					err := errVal.Interface().(error)
-					panic(rt.NewGoError(err))
-				}
-				results = results[:n-1]
-			}
+	n := len(results)
+	if n == 0 {
+		return goja.Undefined()
+	}
 
-			// Convert results to JS
-			sz := len(results)
-			if sz == 0 {
-				return goja.Undefined()
-			}
-			wrap := func(iv any) goja.Value {
-				switch v := iv.(type) {
-				case *xorm.Engine:
-					return BindAllMethods(rt, v)
-				case *xorm.Session:
-					return BindAllMethods(rt, v)
-				default:
-					return rt.ToValue(iv)
-				}
-			}
-			if sz == 1 {
-				return wrap(results[0].Interface())
-			}
-			vals := make([]goja.Value, sz)
-			for i := 0; i < sz; i++ {
-				vals[i] = wrap(results[i].Interface())
-			}
-			return rt.ToValue(vals)
-		})
+	// Handle trailing error
+	if _, hasErr := trailingErrorType(meth.Type); hasErr {
+		errVal := results[n-1]
+		if !errVal.IsZero() && !errVal.IsNil() {
+			err := errVal.Interface().(error)
+			panic(callError(rt, err))
+		}
+		results = results[:n-1]
 	}
 
-	return obj
+	// Convert results to JS
+	sz := len(results)
+	if sz == 0 {
+		return goja.Undefined()
+	}
+	wrap := func(iv any) goja.Value {
+		switch v := iv.(type) {
+		case *xorm.Engine, *xorm.EngineGroup, *xorm.Session:
+			return bindAllMethods(rt, v, policy)
+		default:
+			return rt.ToValue(iv)
+		}
+	}
+	if sz == 1 {
+		return wrap(results[0].Interface())
+	}
+	vals := make([]goja.Value, sz)
+	for i := 0; i < sz; i++ {
+		vals[i] = wrap(results[i].Interface())
+	}
+	return rt.ToValue(vals)
 }
 
 // BindXORM binds an existing *xorm.Engine into a JS object exposing all its methods.
@@ -257,86 +307,18 @@ func tryConvert(v any, t reflect.Type) (reflect.Value, bool) {
 // BindXORMProxy creates a JS object that exposes all exported methods of *xorm.Engine
 // but dispatches each call to whatever current engine instance is installed via the returned setter.
 // This allows swapping the underlying engine without re-binding the JS object.
+// It is BindProxy over a Proxy[*xorm.Engine]; the setter is its Set, use
+// Swap on a Proxy of your own to close the old engine once it is drained.
 func BindXORMProxy(rt *goja.Runtime) (*goja.Object, func(*xorm.Engine)) {
-	var current *xorm.Engine
-	setter := func(e *xorm.Engine) { current = e }
+	return bindXORMProxy(rt, nil)
+}
 
-	obj := rt.NewObject()
-	// We iterate methods from the type to avoid capturing a specific instance.
-	typ := reflect.TypeOf((*xorm.Engine)(nil)) // *xorm.Engine
-	for i := 0; i < typ.NumMethod(); i++ {
-		m := typ.Method(i)
-		if m.PkgPath != "" { // unexported
-			continue
-		}
-		name := m.Name
-		meth := m
-		_ = obj.Set(name, func(call goja.FunctionCall) goja.Value {
-			mt := meth.Type
-			inTotal := mt.NumIn() // includes receiver
-			isVar := mt.IsVariadic()
-			fixedParams := inTotal - 1
-			if isVar {
-				fixedParams = inTotal - 2
-			}
-			if (!isVar && len(call.Arguments) != fixedParams) || (isVar && len(call.Arguments) < fixedParams) {
-				err := fmt.Errorf("method %s requires %d arguments%v, got %d", name, fixedParams, ternary(isVar, "+variadic", ""), len(call.Arguments))
-				panic(rt.NewTypeError(err.Error()))
-			}
-			if current == nil {
-				panic(rt.NewTypeError("xorm engine not set for proxy"))
-			}
-			rev := reflect.ValueOf(current)
-			args := make([]reflect.Value, 0, inTotal)
-			args = append(args, rev)
-			// Fixed params via shared helper
-			fixed := buildFixedArgs(rt, call, mt, fixedParams, name)
-			args = append(args, fixed...)
+// BindXORMProxyWith is BindXORMProxy restricted by opts, see BindAllMethodsWith.
+func BindXORMProxyWith(rt *goja.Runtime, opts BindOptions) (*goja.Object, func(*xorm.Engine)) {
+	return bindXORMProxy(rt, newBindPolicy(opts))
+}
 
-			var results []reflect.Value
-			if isVar {
-				sliceT := mt.In(inTotal - 1)
-				elemT := sliceT.Elem()
-				slice := buildVariadicSlice(rt, call, fixedParams, sliceT, elemT, name)
-				args = append(args, slice)
-				results = meth.Func.CallSlice(args)
-			} else {
-				results = meth.Func.Call(args)
-			}
-			n := len(results)
-			if n == 0 {
-				return goja.Undefined()
-			}
-			if _, hasErr := trailingErrorType(meth.Type); hasErr {
-				errVal := results[n-1]
-				if !errVal.IsZero() && !errVal.IsNil() {
-					panic(rt.NewGoError(errVal.Interface().(error)))
-				}
-				results = results[:n-1]
-			}
-			sz := len(results)
-			if sz == 0 {
-				return goja.Undefined()
-			}
-			wrap := func(iv any) goja.Value {
-				switch v := iv.(type) {
-				case *xorm.Engine:
-					return BindAllMethods(rt, v)
-				case *xorm.Session:
-					return BindAllMethods(rt, v)
-				default:
-					return rt.ToValue(iv)
-				}
-			}
-			if sz == 1 {
-				return wrap(results[0].Interface())
-			}
-			vals := make([]goja.Value, sz)
-			for i := 0; i < sz; i++ {
-				vals[i] = wrap(results[i].Interface())
-			}
-			return rt.ToValue(vals)
-		})
-	}
-	return obj, setter
+func bindXORMProxy(rt *goja.Runtime, policy *bindPolicy) (*goja.Object, func(*xorm.Engine)) {
+	p := NewProxy[*xorm.Engine](nil)
+	return bindProxy(rt, p, policy), func(e *xorm.Engine) { p.Set(e) }
 }
@@ -0,0 +1,239 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/dop251/goja"
+)
+
+// ArgValidator checks the arguments of a bound method before it runs. args
+// are the converted Go arguments, variadic ones spread out. A non-nil error
+// is thrown to the script as a TypeError and the method is not called.
+type ArgValidator func(args []any) error
+
+// BindOptions restricts what BindAllMethodsWith and BindXORMProxyWith expose.
+// Method names cover the reflected methods as well as transaction and
+// queryTyped, and apply to every engine and session the binding returns.
+type BindOptions struct {
+	// Allow, when not empty, lists the only methods exposed.
+	Allow []string
+	// Deny lists methods that are never exposed, even when allowed.
+	Deny []string
+	// ReadOnly exposes ReadOnlyMethods only, and the raw SQL methods among
+	// them (ReadOnlySQLMethods) only accept statements that read. The SQL
+	// check is a guard against mistakes, not a replacement for a database
+	// user without write privileges.
+	ReadOnly bool
+	// Validators check the arguments of the named methods.
+	Validators map[string]ArgValidator
+	// CallTimeout, when positive, limits every database call, within the
+	// script's own deadline (see RunWithContext). A call that runs out of
+	// time throws a TimeoutError.
+	CallTimeout time.Duration
+}
+
+// ReadOnlyMethods are the methods of the read-only profile: queries, the
+// builders that shape them and informational getters. Nothing here writes,
+// changes the schema or reconfigures the shared engine.
+var ReadOnlyMethods = []string{
+	"Alias", "AllCols", "And", "Asc", "Cols", "Conds", "Context", "Desc", "Distinct",
+	"GroupBy", "Having", "ID", "In", "IndexHint", "Join", "Limit", "MustCols",
+	"NoAutoCondition", "NoCache", "NotIn", "Omit", "Or", "OrderBy", "Select", "SQL",
+	"Table", "Unscoped", "Where",
+	"Count", "Exist", "Find", "FindAndCount", "Get", "Iterate", "Rows",
+	"Sum", "SumInt", "Sums", "SumsInt",
+	"Query", "QueryInterface", "QuerySliceString", "QueryString", "queryTyped",
+	"DBMetas", "DBVersion", "DriverName", "GetTZDatabase", "GetTZLocation",
+	"IsInTx", "IsTableEmpty", "IsTableExist", "LastSQL", "Ping", "PingContext",
+	"Quote", "TableInfo", "TableName",
+	"transaction", "primary",
+}
+
+// ReadOnlySQLMethods take raw SQL as their first argument; the read-only
+// profile checks it with ReadOnlySQL.
+var ReadOnlySQLMethods = []string{"Query", "QueryInterface", "QuerySliceString", "QueryString", "SQL", "queryTyped"}
+
+// bindPolicy is BindOptions prepared for lookups. A nil policy exposes all.
+type bindPolicy struct {
+	opts   BindOptions
+	allow  map[string]bool
+	deny   map[string]bool
+	sqlArg map[string]bool
+}
+
+func newBindPolicy(opts BindOptions) *bindPolicy {
+	set := func(names []string) map[string]bool {
+		if len(names) == 0 {
+			return nil
+		}
+		m := make(map[string]bool, len(names))
+		for _, n := range names {
+			m[n] = true
+		}
+		return m
+	}
+	return &bindPolicy{opts: opts, allow: set(opts.Allow), deny: set(opts.Deny), sqlArg: set(ReadOnlySQLMethods)}
+}
+
+// exposes reports whether name is bound.
+func (p *bindPolicy) exposes(name string) bool {
+	if p == nil {
+		return true
+	}
+	if p.deny[name] || (p.allow != nil && !p.allow[name]) {
+		return false
+	}
+	if p.opts.ReadOnly {
+		for _, n := range ReadOnlyMethods {
+			if n == name {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// check runs the read-only SQL check and the validator of name on args and
+// throws a TypeError when one fails.
+func (p *bindPolicy) check(rt *goja.Runtime, name string, args []any) {
+	if p == nil {
+		return
+	}
+	if p.opts.ReadOnly && p.sqlArg[name] {
+		var err error
+		if len(args) == 0 {
+			err = errors.New("sql required")
+		} else if query, ok := args[0].(string); !ok {
+			err = fmt.Errorf("sql must be a string, got %T", args[0])
+		} else {
+			err = ReadOnlySQL(query)
+		}
+		if err != nil {
+			panic(rt.NewTypeError("%s: %v", name, err))
+		}
+	}
+	if v := p.opts.Validators[name]; v != nil {
+		if err := v(args); err != nil {
+			panic(rt.NewTypeError("%s: %v", name, err))
+		}
+	}
+}
+
+// checkReflected is check for the converted arguments of a reflected call;
+// variadic is the invalid Value when the method has none.
+func (p *bindPolicy) checkReflected(rt *goja.Runtime, name string, fixed []reflect.Value, variadic reflect.Value) {
+	if p == nil {
+		return
+	}
+	args := make([]any, 0, len(fixed))
+	for _, v := range fixed {
+		args = append(args, v.Interface())
+	}
+	if variadic.IsValid() {
+		for i := range variadic.Len() {
+			args = append(args, variadic.Index(i).Interface())
+		}
+	}
+	p.check(rt, name, args)
+}
+
+// readKeywords may start a statement that only reads.
+var readKeywords = map[string]bool{"SELECT": true, "WITH": true, "SHOW": true, "EXPLAIN": true, "DESCRIBE": true, "DESC": true, "VALUES": true}
+
+// writeKeywords may not appear anywhere in a statement that only reads.
+var writeKeywords = map[string]bool{
+	"INSERT": true, "UPDATE": true, "DELETE": true, "MERGE": true, "UPSERT": true, "REPLACE": true,
+	"CREATE": true, "ALTER": true, "DROP": true, "TRUNCATE": true, "RENAME": true, "COMMENT": true,
+	"GRANT": true, "REVOKE": true, "ATTACH": true, "DETACH": true, "VACUUM": true, "REINDEX": true,
+	"COPY": true, "CALL": true, "EXEC": true, "EXECUTE": true, "DO": true, "LOCK": true, "SET": true,
+	"INTO": true, "PRAGMA": true, "LOAD": true, "HANDLER": true,
+}
+
+// ReadOnlySQL returns an error unless query is a single statement that reads:
+// it has to start with SELECT, WITH, SHOW, EXPLAIN, DESCRIBE or VALUES and
+// contain no keyword that writes, locks or changes settings (SELECT ... INTO
+// and FOR UPDATE included). Literals, quoted identifiers and comments are
+// skipped; a backslash in them escapes the next character.
+func ReadOnlySQL(query string) error {
+	var words []string
+	ended := false
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := quoteEnd(query, i)
+			if end < 0 {
+				return errors.New("unterminated quote")
+			}
+			i = end + 1
+		case c == '[':
+			end := strings.IndexByte(query[i:], ']')
+			if end < 0 {
+				return errors.New("unterminated identifier")
+			}
+			i += end + 1
+		case strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query) - i
+			}
+			i += end
+		case strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i:], "*/")
+			if end < 0 {
+				return errors.New("unterminated comment")
+			}
+			i += end + 2
+		case c == ';':
+			ended = true
+			i++
+		case isWordByte(c):
+			j := i
+			for j < len(query) && isWordByte(query[j]) {
+				j++
+			}
+			if ended {
+				return errors.New("only one statement is allowed")
+			}
+			words = append(words, strings.ToUpper(query[i:j]))
+			i = j
+		default:
+			i++
+		}
+	}
+	if len(words) == 0 || !readKeywords[words[0]] {
+		return errors.New("only statements that read are allowed")
+	}
+	for _, w := range words {
+		if writeKeywords[w] {
+			return fmt.Errorf("%s is not allowed in a read-only statement", w)
+		}
+	}
+	return nil
+}
+
+// quoteEnd returns the index of the quote that closes the one at start, or
+// -1. A backslash escapes the next byte, as in MySQL; where it does not, a
+// literal that ends in one is taken as unterminated and rejected.
+func quoteEnd(query string, start int) int {
+	q := query[start]
+	for i := start + 1; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			i++
+		case q:
+			return i
+		}
+	}
+	return -1
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= 0x80 || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))
+}
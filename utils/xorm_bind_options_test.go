@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/dop251/goja"
+)
+
+func TestBindAllMethodsWith_AllowDeny(t *testing.T) {
+	rt, eng := newTxRuntime(t)
+	_ = rt.Set("limited", BindAllMethodsWith(rt, eng, BindOptions{
+		Allow: []string{"Exec", "Query", "Table", "Count", "NewSession", "Close", "transaction", "queryTyped"},
+		Deny:  []string{"Close", "queryTyped"},
+	}))
+	v, err := rt.RunString(`
+		limited.Exec('INSERT INTO item (id, name) VALUES (1, ?)', 'a');
+		var s = limited.NewSession();
+		[typeof limited.DropTables, typeof limited.SetMaxOpenConns, typeof limited.Close, typeof limited.queryTyped,
+		 typeof limited.transaction, typeof s.Exec, typeof s.Close, typeof s.Where,
+		 limited.transaction(function (tx) { return typeof tx.Query + typeof tx.Insert; }),
+		 limited.Table('item').Count()].join(',')
+	`)
+	if err != nil {
+		t.Fatalf("script: %v", err)
+	}
+	if got := v.String(); got != "undefined,undefined,undefined,undefined,function,function,undefined,undefined,functionundefined,1" {
+		t.Fatalf("got %s", got)
+	}
+}
+
+func TestBindAllMethodsWith_ReadOnly(t *testing.T) {
+	rt, eng := newTxRuntime(t)
+	if _, err := eng.Exec("INSERT INTO item (id, name) VALUES (1, 'a'), (2, 'b')"); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	_ = rt.Set("ro", BindAllMethodsWith(rt, eng, BindOptions{ReadOnly: true}))
+	v, err := rt.RunString(`
+		[typeof ro.Exec, typeof ro.Import, typeof ro.DropTables, typeof ro.SetMaxOpenConns, typeof ro.Close,
+		 typeof ro.NewSession, ro.QueryString('SELECT name FROM item WHERE id = ?', 2)[0].name,
+		 ro.queryTyped('select count(*) AS n from item -- delete')[0].n,
+		 ro.Table('item').Where('id > ?', 1).Count(),
+		 ro.transaction(function (tx) { return typeof tx.Exec + ':' + tx.QueryString('SELECT 1 AS x')[0].x; })].join(',')
+	`)
+	if err != nil {
+		t.Fatalf("script: %v", err)
+	}
+	if got := v.String(); got != "undefined,undefined,undefined,undefined,undefined,undefined,b,2,1,undefined:1" {
+		t.Fatalf("got %s", got)
+	}
+	for _, script := range []string{
+		`ro.Query('DELETE FROM item')`,
+		`ro.QueryString('SELECT 1; DROP TABLE item')`,
+		`ro.queryTyped('WITH d AS (DELETE FROM item RETURNING *) SELECT * FROM d')`,
+		`ro.SQL('UPDATE item SET name = 1').Count()`,
+		`ro.transaction(function (tx) { tx.Query('INSERT INTO item VALUES (3, 3)'); })`,
+	} {
+		if _, err := rt.RunString(script); err == nil || !strings.Contains(err.Error(), "TypeError") {
+			t.Errorf("%s: %v", script, err)
+		}
+	}
+	if n, err := eng.Table("item").Count(); err != nil || n != 2 {
+		t.Fatalf("rows: %d %v", n, err)
+	}
+}
+
+func TestBindXORMProxyWith_Validators(t *testing.T) {
+	rt, eng := newTxRuntime(t)
+	var seen []any
+	obj, set := BindXORMProxyWith(rt, BindOptions{
+		Deny: []string{"Close"},
+		Validators: map[string]ArgValidator{
+			"Exec": func(args []any) error {
+				seen = args
+				if q, _ := args[0].(string); !strings.HasPrefix(q, "INSERT") {
+					return errors.New("only inserts")
+				}
+				return nil
+			},
+			"queryTyped": func(args []any) error {
+				if len(args) > 1 {
+					return errors.New("no parameters")
+				}
+				return nil
+			},
+		},
+	})
+	set(eng)
+	_ = rt.Set("p", obj)
+	v, err := rt.RunString(`
+		p.Exec('INSERT INTO item (id, name) VALUES (?, ?)', 7, 'x');
+		typeof p.Close + ':' + p.queryTyped('SELECT name FROM item')[0].name
+	`)
+	if err != nil {
+		t.Fatalf("script: %v", err)
+	}
+	if v.String() != "undefined:x" || len(seen) != 3 || seen[1] != int64(7) {
+		t.Fatalf("got %s, args %v", v, seen)
+	}
+	for _, script := range []string{`p.Exec('DELETE FROM item')`, `p.queryTyped('SELECT ?', 1)`} {
+		_, err := rt.RunString(script)
+		var ex *goja.Exception
+		if !errors.As(err, &ex) || !strings.Contains(err.Error(), "TypeError") {
+			t.Errorf("%s: %v", script, err)
+		}
+	}
+}
+
+func TestReadOnlySQL(t *testing.T) {
+	for query, ok := range map[string]bool{
+		"SELECT * FROM t":                            true,
+		"  with x as (select 1) select * from x":     true,
+		"SELECT 'drop table t' AS \"update\"":        true,
+		"SELECT 1 /* delete */; ":                    true,
+		"EXPLAIN SELECT 1":                           true,
+		"DELETE FROM t":                              false,
+		"SELECT 1; SELECT 2":                         false,
+		"SELECT * INTO t2 FROM t":                    false,
+		"SELECT * FROM t FOR UPDATE":                 false,
+		"PRAGMA journal_mode = WAL":                  false,
+		"SELECT 'unterminated":                       false,
+		`SELECT 'it''s', 'a\'b'`:                     true,
+		`SELECT '\'' , 1 INTO OUTFILE '/tmp/x' -- '`: false,
+		`SELECT '\'', id FROM t FOR UPDATE -- '`:     false,
+		"":                                           false,
+	} {
+		if err := ReadOnlySQL(query); (err == nil) != ok {
+			t.Errorf("%q: %v", query, err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/dop251/goja"
+)
+
+func TestRegisterXORM_SQLiteMemory(t *testing.T) {
+	rt := goja.New()
+	if err := RegisterXORM(rt); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	_, err := rt.RunString(`
+		var db = xorm('sqlite', ':memory:');
+		db.Ping();
+		db.Exec('CREATE TABLE item (id INTEGER PRIMARY KEY, name TEXT)');
+		db.Exec('INSERT INTO item (id, name) VALUES (?, ?)', 1, 'a');
+		db.Exec('INSERT INTO item (id, name) VALUES (?, ?)', 2, 'b');
+	`)
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	v, err := rt.RunString(`var rows = db.QueryString('SELECT name FROM item ORDER BY id'); rows.length + ':' + rows[1].name`)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if got := v.String(); got != "2:b" {
+		t.Fatalf("unexpected query result %q", got)
+	}
+	v, err = rt.RunString(`db.DriverName()`)
+	if err != nil || v.String() != "sqlite" {
+		t.Fatalf("DriverName: %v %v", v, err)
+	}
+	if _, err := rt.RunString(`db.Exec('INSERT INTO missing VALUES (1)')`); err == nil {
+		t.Fatalf("expected error for unknown table")
+	}
+}
+
+func TestRegisterXORMWrap_SQLiteFile(t *testing.T) {
+	rt := goja.New()
+	if err := RegisterXORMWrap(rt); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	_ = rt.Set("dsn", "file:"+t.TempDir()+"/wrap.db")
+	v, err := rt.RunString(`
+		var w = xormWrap('sqlite', dsn);
+		w.Exec('CREATE TABLE kv (k TEXT PRIMARY KEY, v INTEGER)');
+		w.Exec('INSERT INTO kv (k, v) VALUES (?, ?)', 'x', 41);
+		w.QueryInterface('SELECT v + 1 AS n FROM kv WHERE k = ?', 'x')[0].n
+	`)
+	if err != nil {
+		t.Fatalf("script: %v", err)
+	}
+	if got := v.ToInteger(); got != 42 {
+		t.Fatalf("unexpected value %v", v.Export())
+	}
+}
+
+func TestIsSQLiteMemory(t *testing.T) {
+	cases := map[[2]string]bool{
+		{"sqlite", ":memory:"}: true,
+		{"sqlite3", ""}:        true,
+		{"sqlite", "file:x?mode=memory&cache=shared"}: true,
+		{"sqlite", "file:/tmp/x.db"}:                  false,
+		{"mysql", ":memory:"}:                         false,
+	}
+	for in, want := range cases {
+		if got := isSQLiteMemory(in[0], in[1]); got != want {
+			t.Fatalf("isSQLiteMemory(%q, %q) = %v", in[0], in[1], got)
+		}
+	}
+}
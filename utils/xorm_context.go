@@ -0,0 +1,199 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/dop251/goja"
+	"xorm.io/xorm"
+)
+
+// runtimeContexts holds the context of the script each runtime is running,
+// set by RunWithContext.
+var runtimeContexts sync.Map // *goja.Runtime -> context.Context
+
+// ScriptContext returns the context of the script running on rt, or
+// context.Background() outside RunWithContext. Bound database calls run
+// under it.
+func ScriptContext(rt *goja.Runtime) context.Context {
+	if ctx, ok := runtimeContexts.Load(rt); ok {
+		return ctx.(context.Context)
+	}
+	return context.Background()
+}
+
+// InterruptGrace is how long a script may keep running after its context
+// ended before RunWithContext interrupts it.
+const InterruptGrace = 500 * time.Millisecond
+
+// RunWithContext calls run, which runs JS on rt, under ctx. Database calls
+// made by the bindings use ctx: when it ends, the call in flight and every
+// later one throw an error named TimeoutError, which the script can catch to
+// clean up or report. A script that does not finish within InterruptGrace
+// after that, such as one stuck in plain JS, is interrupted: run returns a
+// *goja.InterruptedError that unwraps to the context's error
+// (context.DeadlineExceeded for a deadline) and the script cannot catch it.
+// run is not called when ctx is already done. The runtime is usable again
+// afterwards.
+func RunWithContext(ctx context.Context, rt *goja.Runtime, run func() error) error {
+	if ctx.Err() != nil {
+		return scriptInterrupted(ctx)
+	}
+	prev, hadPrev := runtimeContexts.Load(rt)
+	runtimeContexts.Store(rt, ctx)
+	defer func() {
+		if hadPrev {
+			runtimeContexts.Store(rt, prev)
+		} else {
+			runtimeContexts.Delete(rt)
+		}
+	}()
+
+	fired, finished := make(chan struct{}), make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		defer close(fired)
+		grace := time.NewTimer(InterruptGrace)
+		defer grace.Stop()
+		select {
+		case <-grace.C:
+			rt.Interrupt(scriptInterrupted(ctx))
+		case <-finished:
+		}
+	})
+	defer func() {
+		close(finished)
+		if !stop() {
+			<-fired
+			rt.ClearInterrupt()
+		}
+	}()
+	return run()
+}
+
+func scriptInterrupted(ctx context.Context) error {
+	return fmt.Errorf("script interrupted: %w", context.Cause(ctx))
+}
+
+// RunScript runs src on rt under ctx, see RunWithContext.
+func RunScript(ctx context.Context, rt *goja.Runtime, src string) (goja.Value, error) {
+	var v goja.Value
+	err := RunWithContext(ctx, rt, func() (err error) {
+		v, err = rt.RunString(src)
+		return err
+	})
+	return v, err
+}
+
+// callContext returns the context of one bound database call: the script's
+// context, limited to the policy's CallTimeout when it has one.
+func (p *bindPolicy) callContext(rt *goja.Runtime) (context.Context, context.CancelFunc) {
+	return p.timeout(ScriptContext(rt))
+}
+
+// timeout limits ctx to the policy's CallTimeout when it has one.
+func (p *bindPolicy) timeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p != nil && p.opts.CallTimeout > 0 {
+		return context.WithTimeout(ctx, p.opts.CallTimeout)
+	}
+	return ctx, func() {}
+}
+
+// contextMethods are the *xorm.Engine methods that *xorm.Session has with
+// the same signature, by name. Called on an engine they run on
+// engine.Context(ctx) instead, a session that closes itself after the
+// operation, so that the call carries a context.
+var contextMethods = func() map[string]reflect.Method {
+	out := map[string]reflect.Method{}
+	engT, sessT := reflect.TypeOf(&xorm.Engine{}), reflect.TypeOf(&xorm.Session{})
+	for i := range engT.NumMethod() {
+		em := engT.Method(i)
+		switch em.Name {
+		case "Close", "Context", "DB":
+			// these are about the engine itself
+			continue
+		}
+		sm, ok := sessT.MethodByName(em.Name)
+		if ok && sameSignature(em.Type, sm.Type) {
+			out[em.Name] = sm
+		}
+	}
+	return out
+}()
+
+// sameSignature compares two method types without their receivers.
+func sameSignature(a, b reflect.Type) bool {
+	if a.NumIn() != b.NumIn() || a.NumOut() != b.NumOut() || a.IsVariadic() != b.IsVariadic() {
+		return false
+	}
+	for i := 1; i < a.NumIn(); i++ {
+		if a.In(i) != b.In(i) {
+			return false
+		}
+	}
+	for i := range a.NumOut() {
+		if a.Out(i) != b.Out(i) {
+			return false
+		}
+	}
+	return true
+}
+
+// withContext returns the receiver and method that run meth on recv under
+// ctx, and the function that undoes the change to recv once the call is over.
+func withContext(recv reflect.Value, meth reflect.Method, ctx context.Context) (reflect.Value, reflect.Method, func()) {
+	switch x := recv.Interface().(type) {
+	case *xorm.Engine:
+		if sm, ok := contextMethods[meth.Name]; ok && x != nil {
+			return reflect.ValueOf(x.Context(ctx)), sm, func() {}
+		}
+	case *xorm.Session:
+		if x != nil {
+			return recv, meth, swapSessionContext(x, ctx)
+		}
+	}
+	return recv, meth, func() {}
+}
+
+// swapSessionContext sets ctx on s and returns the function that gives s its
+// previous context back. The session may belong to Go code that keeps using
+// it after the call, when ctx is already cancelled. xorm has no getter for a
+// session's context, so the unexported field is read directly; should xorm
+// rename it, s keeps ctx as before.
+func swapSessionContext(s *xorm.Session, ctx context.Context) func() {
+	f := reflect.ValueOf(s).Elem().FieldByName("ctx")
+	if !f.IsValid() || f.Type() != reflect.TypeFor[context.Context]() {
+		s.Context(ctx)
+		return func() {}
+	}
+	field := (*context.Context)(unsafe.Pointer(f.UnsafeAddr()))
+	prev := *field
+	s.Context(ctx)
+	return func() { *field = prev }
+}
+
+// keepsContext reports whether a call result still uses the call's context
+// after it returned: a session being built, or rows being iterated.
+func keepsContext(results []reflect.Value) bool {
+	for _, r := range results {
+		switch r.Interface().(type) {
+		case *xorm.Session, *xorm.Rows:
+			return true
+		}
+	}
+	return false
+}
+
+// callError is the JS error thrown for err. Cancellations and deadlines
+// become errors named TimeoutError, which scripts can catch and tell apart.
+func callError(rt *goja.Runtime, err error) *goja.Object {
+	obj := rt.NewGoError(err)
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		_ = obj.Set("name", "TimeoutError")
+	}
+	return obj
+}
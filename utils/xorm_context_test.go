@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// slowQuery keeps SQLite busy for far longer than the tests wait.
+const slowQuery = `WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c WHERE x < 1000000000) SELECT count(*) AS n FROM c`
+
+func TestCallTimeout_Catchable(t *testing.T) {
+	rt, eng := newTxRuntime(t)
+	_ = rt.Set("limited", BindAllMethodsWith(rt, eng, BindOptions{CallTimeout: 50 * time.Millisecond}))
+	_ = rt.Set("sleep", func(ms int) { time.Sleep(time.Duration(ms) * time.Millisecond) })
+	start := time.Now()
+	v, err := RunScript(context.Background(), rt, `
+		var names = [];
+		try { limited.QueryString(`+"`"+slowQuery+"`"+`); } catch (e) { names.push(e.name); }
+		try { limited.queryTyped(`+"`"+slowQuery+"`"+`); } catch (e) { names.push(e.name); }
+		// a chain built before the deadline gets a fresh one for its terminal call
+		var chain = limited.Table('item').Where('1 = 1');
+		sleep(80);
+		names.push(chain.Count());
+		names.push(limited.QueryString('SELECT 1 AS x')[0].x);
+		names.join(',')
+	`)
+	if err != nil {
+		t.Fatalf("script: %v", err)
+	}
+	if got := v.String(); got != "TimeoutError,TimeoutError,0,1" {
+		t.Fatalf("got %s", got)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("calls were not cancelled: %v", d)
+	}
+}
+
+func TestRunWithContext_TimeoutCatchable(t *testing.T) {
+	rt, _ := newTxRuntime(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	// the call in flight and the calls after it throw, the script goes on
+	v, err := RunScript(ctx, rt, `
+		var names = [];
+		try { db.QueryString(`+"`"+slowQuery+"`"+`); } catch (e) { names.push(e.name); }
+		try { db.QueryString('SELECT 1 AS x'); } catch (e) { names.push(e.name); }
+		names.join(',')
+	`)
+	if err != nil || v.String() != "TimeoutError,TimeoutError" {
+		t.Fatalf("sync: %v %v", v, err)
+	}
+
+	loop := NewEventLoop(rt, LoopOptions{})
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	v, err = loop.RunScript(ctx, `
+		(async function () {
+			try { await db.queryTypedAsync(`+"`"+slowQuery+"`"+`); } catch (e) { return e.name; }
+		})()
+	`)
+	if err != nil || v.String() != "TimeoutError" {
+		t.Fatalf("async: %v %v", v, err)
+	}
+}
+
+func TestRunWithContext_InterruptsScript(t *testing.T) {
+	rt, _ := newTxRuntime(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	// a script still running InterruptGrace after its context ended is
+	// interrupted and cannot catch that
+	_, err := RunScript(ctx, rt, `
+		try { db.QueryString(`+"`"+slowQuery+"`"+`); } catch (e) {}
+		for (;;) {}
+	`)
+	var interrupted *goja.InterruptedError
+	if !errors.As(err, &interrupted) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err: %v", err)
+	}
+	if ScriptContext(rt) != context.Background() {
+		t.Fatal("script context left behind")
+	}
+
+	// the runtime runs again, and transactions see the script's context
+	v, err := RunScript(context.Background(), rt, `db.transaction(function (tx) { return tx.QueryString('SELECT 2 AS x')[0].x; })`)
+	if err != nil || v.String() != "2" {
+		t.Fatalf("rerun: %v %v", v, err)
+	}
+	canceled, stop := context.WithCancel(context.Background())
+	stop()
+	if _, err := RunScript(canceled, rt, `db.transaction(function (tx) { return 1; })`); !errors.Is(err, context.Canceled) {
+		t.Fatalf("canceled: %v", err)
+	}
+}
+
+func TestCallContext_RestoresSession(t *testing.T) {
+	rt, eng := newModelsRuntime(t)
+	sess := eng.NewSession()
+	defer sess.Close()
+	opts := BindOptions{CallTimeout: time.Second}
+	_ = rt.Set("s", BindAllMethodsWith(rt, sess, opts))
+	models, err := BindModelsWith(rt, sess, modelTables(), opts)
+	if err != nil {
+		t.Fatalf("models: %v", err)
+	}
+	_ = rt.Set("m", models)
+	if _, err := RunScript(context.Background(), rt, `
+		s.Exec('INSERT INTO order_line (order_id, no, qty) VALUES (1, 1, 2)');
+		m.customer.insert({name: 'ann'});
+	`); err != nil {
+		t.Fatalf("script: %v", err)
+	}
+	// the calls' contexts are cancelled now; the Go owner keeps using the session
+	if n, err := sess.Table("customer").Count(); err != nil || n != 1 {
+		t.Fatalf("count: %d %v", n, err)
+	}
+	if _, err := sess.Exec("DELETE FROM order_line"); err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+}
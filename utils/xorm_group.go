@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/dop251/goja"
+	"xorm.io/xorm"
+)
+
+// Names of the replica policies of GroupPolicyByName.
+const (
+	PolicyRoundRobin       = "roundRobin"
+	PolicyWeightRoundRobin = "weightRoundRobin"
+	PolicyRandom           = "random"
+	PolicyWeightRandom     = "weightRandom"
+	PolicyLeastConn        = "leastConn"
+)
+
+// GroupPolicyByName returns the xorm policy that picks the replica for a
+// read. An empty name is round robin. The weighted policies take one weight
+// per replica, in the order of the replicas.
+func GroupPolicyByName(name string, weights []int) (xorm.GroupPolicy, error) {
+	switch name {
+	case "", PolicyRoundRobin:
+		return xorm.RoundRobinPolicy(), nil
+	case PolicyRandom:
+		return xorm.RandomPolicy(), nil
+	case PolicyLeastConn:
+		return xorm.LeastConnPolicy(), nil
+	case PolicyWeightRoundRobin, PolicyWeightRandom:
+		total := 0
+		for _, w := range weights {
+			if w < 0 {
+				return nil, fmt.Errorf("policy %s: negative weight %d", name, w)
+			}
+			total += w
+		}
+		if total == 0 {
+			return nil, fmt.Errorf("policy %s: weights required", name)
+		}
+		if name == PolicyWeightRandom {
+			return xorm.WeightRandomPolicy(weights), nil
+		}
+		return xorm.WeightRoundRobinPolicy(weights), nil
+	}
+	return nil, fmt.Errorf("unknown replica policy %q", name)
+}
+
+// NewXORMGroup opens an engine group: writes go to primary, reads to one of
+// replicas picked by policy (round robin when nil). Engines are opened with
+// NewXORM; when one fails, those already opened are closed again.
+func NewXORMGroup(driver, primary string, replicas []string, policy xorm.GroupPolicy) (*xorm.EngineGroup, error) {
+	engines := make([]*xorm.Engine, 0, 1+len(replicas))
+	for _, dsn := range append([]string{primary}, replicas...) {
+		eng, err := NewXORM(driver, dsn)
+		if err != nil {
+			for _, e := range engines {
+				_ = e.Close()
+			}
+			return nil, err
+		}
+		engines = append(engines, eng)
+	}
+	if policy == nil {
+		policy = xorm.RoundRobinPolicy()
+	}
+	return xorm.NewEngineGroup(engines[0], engines[1:], policy)
+}
+
+// replicaMethods are the engine methods that only read and may run on a
+// replica. The SQL methods among them do so only for statements that pass
+// ReadOnlySQL.
+var replicaMethods = map[string]bool{
+	"Count": true, "Exist": true, "Find": true, "FindAndCount": true, "Get": true, "IsTableEmpty": true,
+	"Iterate": true, "Rows": true, "Sum": true, "SumInt": true, "Sums": true, "SumsInt": true,
+	"Query": true, "QueryInterface": true, "QuerySliceString": true, "QueryString": true, "queryTyped": true,
+}
+
+// routeGroup returns the engine of g that runs the named method with query,
+// its SQL if it takes any: a replica picked by g's policy for reads, the
+// primary for everything else.
+func routeGroup(g *xorm.EngineGroup, name, query string) *xorm.Engine {
+	if !replicaMethods[name] {
+		return g.Master()
+	}
+	for _, n := range ReadOnlySQLMethods {
+		if n == name && ReadOnlySQL(query) != nil {
+			return g.Master()
+		}
+	}
+	return g.Slave()
+}
+
+// bindGroup is BindAllMethods for an engine group. Reads that need no
+// session (see replicaMethods) run on a replica; writes, the builders that
+// start a session, sessions and transactions stay on the primary. A
+// script that has to read its own writes calls primary(), which returns the
+// primary engine bound with the same policy. Every call runs on the group
+// that acquire returns, released as in bindAcquired.
+func bindGroup(rt *goja.Runtime, acquire func() (*xorm.EngineGroup, func()), policy *bindPolicy) *goja.Object {
+	obj := rt.NewObject()
+	engT := reflect.TypeFor[*xorm.Engine]()
+	typ := reflect.TypeFor[*xorm.EngineGroup]()
+	for i := 0; i < typ.NumMethod(); i++ {
+		m := typ.Method(i)
+		if m.PkgPath != "" || !policy.exposes(m.Name) {
+			continue
+		}
+		meth := m
+		// the engine's own method, for calls routed to one of the engines
+		em, onEngine := engT.MethodByName(meth.Name)
+		_ = obj.Set(meth.Name, func(call goja.FunctionCall) goja.Value {
+			g, release := acquireGroup(rt, acquire)
+			defer release()
+			return callMethod(rt, call, meth, func() (reflect.Value, reflect.Method) {
+				switch {
+				case !onEngine:
+					return reflect.ValueOf(g), meth
+				case meth.Name == "NewSession" || meth.Name == "Context":
+					// group sessions would send their reads to replicas
+					return reflect.ValueOf(g.Master()), em
+				case replicaMethods[meth.Name]:
+					query, _ := call.Argument(0).Export().(string)
+					return reflect.ValueOf(routeGroup(g, meth.Name, query)), em
+				}
+				return reflect.ValueOf(g), meth
+			}, policy)
+		})
+	}
+	primary := func() (*xorm.Engine, func()) {
+		g, release := acquireGroup(rt, acquire)
+		return g.Master(), release
+	}
+	if policy.exposes("primary") {
+		_ = obj.Set("primary", func() *goja.Object { return bindAcquired(rt, primary, policy) })
+	}
+	bindTransaction(rt, obj, primary, policy)
+	bindQueryTyped(rt, obj, func(query string) (any, func()) {
+		g, release := acquireGroup(rt, acquire)
+		return routeGroup(g, "queryTyped", query), release
+	}, policy)
+	bindAsync(rt, obj, func(name, query string) (*xorm.Engine, func()) {
+		g, release := acquireGroup(rt, acquire)
+		return routeGroup(g, name, query), release
+	}, policy)
+	return obj
+}
+
+// acquireGroup calls acquire and throws a TypeError when it has no group.
+func acquireGroup(rt *goja.Runtime, acquire func() (*xorm.EngineGroup, func())) (*xorm.EngineGroup, func()) {
+	g, release := acquire()
+	if g == nil {
+		release()
+		panic(rt.NewTypeError("xorm engine group not set"))
+	}
+	return g, release
+}
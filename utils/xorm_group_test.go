@@ -0,0 +1,185 @@
+package utils
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dop251/goja"
+	"xorm.io/xorm"
+)
+
+// newGroupDBs creates a primary and two replicas whose table who holds the
+// name of the database, so that results tell where a query ran.
+func newGroupDBs(t *testing.T, dir string) (primary string, replicas []string) {
+	t.Helper()
+	for _, name := range []string{"primary", "r1", "r2"} {
+		dsn := "file:" + filepath.Join(dir, name+".db")
+		eng, err := NewXORM("sqlite", dsn)
+		if err != nil {
+			t.Fatalf("engine: %v", err)
+		}
+		if _, err := eng.Exec("CREATE TABLE who (name TEXT)"); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		if _, err := eng.Exec("INSERT INTO who (name) VALUES (?)", name); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+		_ = eng.Close()
+		if name == "primary" {
+			primary = dsn
+		} else {
+			replicas = append(replicas, dsn)
+		}
+	}
+	return primary, replicas
+}
+
+func newGroupRuntime(t *testing.T, policy xorm.GroupPolicy) (*goja.Runtime, *xorm.EngineGroup) {
+	t.Helper()
+	primary, replicas := newGroupDBs(t, t.TempDir())
+	g, err := NewXORMGroup("sqlite", primary, replicas, policy)
+	if err != nil {
+		t.Fatalf("group: %v", err)
+	}
+	t.Cleanup(func() { g.Close() })
+	rt := goja.New()
+	_ = rt.Set("db", BindAllMethods(rt, g))
+	return rt, g
+}
+
+func TestGroup_Routing(t *testing.T) {
+	rt, g := newGroupRuntime(t, nil)
+	v, err := rt.RunString(`
+		function who(rows) { return rows.map(function (r) { return r.name; }).join('+'); }
+		var out = [];
+		// reads alternate between the replicas
+		out.push(who(db.QueryString('SELECT name FROM who')), who(db.queryTyped('SELECT name FROM who')), who(db.QueryInterface('SELECT name FROM who')));
+		// writes, builders, sessions and transactions use the primary
+		db.Exec("INSERT INTO who (name) VALUES ('x')");
+		out.push(who(db.queryTyped("INSERT INTO who (name) VALUES ('y') RETURNING name")));
+		out.push(db.Table('who').Count());
+		out.push(db.transaction(function (tx) { return tx.QueryString('SELECT count(*) AS n FROM who')[0].n; }));
+		var s = db.NewSession();
+		out.push(who(s.QueryString('SELECT name FROM who ORDER BY name')));
+		s.Close();
+		// primary() reads what was just written
+		out.push(who(db.primary().QueryString("SELECT name FROM who WHERE name = 'x'")));
+		out.push(db.Master().QueryString('SELECT count(*) AS n FROM who')[0].n);
+		db.Ping();
+		out.join('|');
+	`)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if v.String() != "r1|r2|r1|y|3|3|primary+x+y|x|3" {
+		t.Fatalf("got %s", v)
+	}
+	if n, _ := g.Slaves()[0].Table("who").Count(); n != 1 {
+		t.Fatalf("replica written: %d rows", n)
+	}
+
+	// the read-only profile keeps primary() and drops the writes
+	_ = rt.Set("ro", BindAllMethodsWith(rt, g, BindOptions{ReadOnly: true}))
+	v, err = rt.RunString(`[typeof ro.Exec, typeof ro.Master, ro.primary().QueryString('SELECT count(*) AS n FROM who')[0].n].join(',')`)
+	if err != nil || v.String() != "undefined,undefined,3" {
+		t.Fatalf("read-only: %v %v", v, err)
+	}
+}
+
+func TestGroup_Async(t *testing.T) {
+	rt, _ := newGroupRuntime(t, nil)
+	loop := NewEventLoop(rt, LoopOptions{})
+	v, err := loop.RunScript(context.Background(), `
+		(async function () {
+			await db.ExecAsync("INSERT INTO who (name) VALUES ('x')");
+			var rs = await Promise.all([
+				db.QueryStringAsync('SELECT count(*) AS n FROM who'),
+				db.queryTypedAsync('SELECT count(*) AS n FROM who'),
+			]);
+			return rs[0][0].n + ',' + rs[1][0].n + ',' + db.primary().QueryString('SELECT count(*) AS n FROM who')[0].n;
+		})()
+	`)
+	if err != nil || v.String() != "1,1,2" {
+		t.Fatalf("async: %v %v", v, err)
+	}
+}
+
+func TestGroupPolicyByName(t *testing.T) {
+	for _, name := range []string{"", PolicyRoundRobin, PolicyRandom, PolicyLeastConn} {
+		if _, err := GroupPolicyByName(name, nil); err != nil {
+			t.Errorf("%q: %v", name, err)
+		}
+	}
+	for _, c := range []struct {
+		name    string
+		weights []int
+		want    string
+	}{
+		{"fastest", nil, "unknown replica policy"},
+		{PolicyWeightRoundRobin, nil, "weights required"},
+		{PolicyWeightRandom, []int{1, -1}, "negative weight"},
+	} {
+		if _, err := GroupPolicyByName(c.name, c.weights); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s %v: %v, want %q", c.name, c.weights, err, c.want)
+		}
+	}
+
+	// all the weight on the second replica
+	p, _ := GroupPolicyByName(PolicyWeightRoundRobin, []int{0, 1})
+	rt, _ := newGroupRuntime(t, p)
+	v, err := rt.RunString(`db.QueryString('SELECT name FROM who')[0].name + db.QueryString('SELECT name FROM who')[0].name`)
+	if err != nil || v.String() != "r2r2" {
+		t.Fatalf("weighted: %v %v", v, err)
+	}
+}
+
+func TestDBRegistry_Replicas(t *testing.T) {
+	dir := t.TempDir()
+	newGroupDBs(t, dir)
+	t.Setenv("REGISTRY_TEST_DIR", dir)
+	cfg, err := ParseRegistryConfig([]byte(`
+databases:
+  crm:
+    driver: sqlite
+    dsn: file:${REGISTRY_TEST_DIR}/primary.db
+    replicas:
+      - file:${REGISTRY_TEST_DIR}/r1.db
+      - file:${REGISTRY_TEST_DIR}/r2.db
+    policy: weightRandom
+    weights: [1, 0]
+    maxOpenConns: 2
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	reg, err := NewDBRegistry(cfg, RegistryOptions{})
+	if err != nil {
+		t.Fatalf("registry: %v", err)
+	}
+	defer reg.Close()
+	g, err := reg.Group("crm")
+	if err != nil || g == nil || g.Slaves()[1].DB().Stats().MaxOpenConnections != 2 {
+		t.Fatalf("group: %v", err)
+	}
+	if eng, _ := reg.Engine("crm"); eng != g.Master() {
+		t.Fatal("Engine is not the primary")
+	}
+
+	rt := goja.New()
+	_ = RegisterDBRegistry(rt, reg, BindOptions{})
+	v, err := rt.RunString(`db('crm').QueryString('SELECT name FROM who')[0].name + ',' + db('crm').primary().QueryString('SELECT name FROM who')[0].name`)
+	if err != nil || v.String() != "r1,primary" {
+		t.Fatalf("script: %v %v", v, err)
+	}
+
+	for content, want := range map[string]string{
+		"databases:\n  a:\n    driver: x\n    replicas: [y]\n    weights: [1, 2]\n": "2 weights for 1 replicas",
+		"databases:\n  a:\n    driver: x\n    replicas: [y]\n    policy: fastest\n": "unknown replica policy",
+	} {
+		if _, err := ParseRegistryConfig([]byte(content)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: %v, want %q", content, err, want)
+		}
+	}
+}
@@ -0,0 +1,638 @@
+package utils
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dop251/goja"
+	so "github.com/everpan/go-mdm/schema-orm"
+	"xorm.io/xorm"
+	"xorm.io/xorm/schemas"
+)
+
+// ErrVersionConflict is thrown by update when the version given in the patch
+// is no longer the row's version.
+var ErrVersionConflict = errors.New("optimistic lock: version changed")
+
+// BindModels returns an object with one model per table, keyed by table
+// name. db is an *xorm.Engine, or an *xorm.Session to run the models inside
+// its transaction. Every model offers
+//
+//	find(where, {orderBy, limit, offset})  rows matching where
+//	get(pk)                                the row or null
+//	insert(obj | array)                    the inserted row(s), read back
+//	update(pk, patch)                      the number of updated rows
+//	delete(pk)                             the number of deleted rows
+//	count(where)                           the number of matching rows
+//
+// where maps columns to a value, null (IS NULL) or an array (IN). pk is the
+// key value, or an array or object for a composite key. Values are checked
+// and coerced against the column types; rows come back typed by QueryJS.
+// Created, updated, deleted and version columns behave as in xorm: created
+// and updated are set on insert, updated on update, version starts at 1 and
+// is incremented (a version in the patch must match, else ErrVersionConflict
+// is thrown), delete sets deleted instead of removing the row and every read
+// skips rows with deleted set.
+func BindModels(rt *goja.Runtime, db any, tables []*so.Table) (*goja.Object, error) {
+	return bindModels(rt, db, tables, nil)
+}
+
+// BindModelsWith is BindModels restricted by opts: Allow, Deny and
+// Validators name the model methods (find, get, ...), ReadOnly leaves out
+// insert, update and delete, and CallTimeout limits every statement.
+func BindModelsWith(rt *goja.Runtime, db any, tables []*so.Table, opts BindOptions) (*goja.Object, error) {
+	return bindModels(rt, db, tables, newBindPolicy(opts))
+}
+
+func bindModels(rt *goja.Runtime, db any, tables []*so.Table, policy *bindPolicy) (*goja.Object, error) {
+	var eng *xorm.Engine
+	switch x := db.(type) {
+	case *xorm.Engine:
+		eng = x
+	case *xorm.Session:
+		eng = x.Engine()
+	default:
+		return nil, fmt.Errorf("models: unsupported database %T", db)
+	}
+	obj := rt.NewObject()
+	for _, tb := range tables {
+		if tb == nil || tb.Name == "" {
+			return nil, errors.New("models: table without name")
+		}
+		if obj.Get(tb.Name) != nil {
+			return nil, fmt.Errorf("models: duplicate table %s", tb.Name)
+		}
+		m := &model{rt: rt, db: db, eng: eng, table: tb, policy: policy}
+		_ = obj.Set(tb.Name, m.object())
+	}
+	return obj, nil
+}
+
+// RegisterModels sets the global `models` to BindModels(rt, db, tables).
+func RegisterModels(rt *goja.Runtime, db any, tables []*so.Table) error {
+	obj, err := BindModels(rt, db, tables)
+	if err != nil {
+		return err
+	}
+	return rt.Set("models", obj)
+}
+
+// RegisterModelsWith sets the global `models` to BindModelsWith(rt, db,
+// tables, opts).
+func RegisterModelsWith(rt *goja.Runtime, db any, tables []*so.Table, opts BindOptions) error {
+	obj, err := BindModelsWith(rt, db, tables, opts)
+	if err != nil {
+		return err
+	}
+	return rt.Set("models", obj)
+}
+
+// modelWrites are the model methods that the read-only profile leaves out.
+var modelWrites = map[string]bool{"insert": true, "update": true, "delete": true}
+
+type model struct {
+	rt     *goja.Runtime
+	db     any
+	eng    *xorm.Engine
+	table  *so.Table
+	policy *bindPolicy
+}
+
+func (m *model) object() *goja.Object {
+	o := m.rt.NewObject()
+	for _, f := range []struct {
+		name string
+		fn   func(goja.FunctionCall) goja.Value
+	}{
+		{"find", m.find}, {"get", m.get}, {"insert", m.insert},
+		{"update", m.update}, {"delete", m.delete}, {"count", m.count},
+	} {
+		if !m.exposes(f.name) {
+			continue
+		}
+		name, fn := f.name, f.fn
+		_ = o.Set(name, func(call goja.FunctionCall) goja.Value {
+			if m.policy != nil {
+				args := make([]any, len(call.Arguments))
+				for i, a := range call.Arguments {
+					args[i] = a.Export()
+				}
+				m.policy.check(m.rt, name, args)
+			}
+			return fn(call)
+		})
+	}
+	return o
+}
+
+// exposes reports whether the model method name is bound under the policy.
+func (m *model) exposes(name string) bool {
+	p := m.policy
+	if p == nil {
+		return true
+	}
+	if p.opts.ReadOnly && modelWrites[name] {
+		return false
+	}
+	return !p.deny[name] && (p.allow == nil || p.allow[name])
+}
+
+func (m *model) quote(name string) string { return m.eng.Dialect().Quoter().Quote(name) }
+
+func (m *model) throw(err error) {
+	panic(m.rt.NewTypeError(fmt.Sprintf("%s: %v", m.table.Name, err)))
+}
+
+func (m *model) column(name string) *so.Column {
+	col := m.table.GetColumn(name)
+	if col == nil {
+		m.throw(fmt.Errorf("unknown column %q", name))
+	}
+	return col
+}
+
+// exec and query run under the script's context, see RunWithContext, and
+// the policy's CallTimeout.
+func (m *model) exec(query string, args ...any) sql.Result {
+	var (
+		res sql.Result
+		err error
+	)
+	ctx, cancel := m.policy.callContext(m.rt)
+	defer cancel()
+	params := append([]any{query}, args...)
+	switch x := m.db.(type) {
+	case *xorm.Engine:
+		res, err = x.Context(ctx).Exec(params...)
+	case *xorm.Session:
+		defer swapSessionContext(x, ctx)()
+		res, err = x.Exec(params...)
+	}
+	if err != nil {
+		panic(callError(m.rt, err))
+	}
+	return res
+}
+
+func (m *model) query(query string, args ...any) *goja.Object {
+	ctx, cancel := m.policy.callContext(m.rt)
+	defer cancel()
+	v, err := QueryJSContext(ctx, m.rt, m.db, RowOptions{Table: m.table}, query, args...)
+	if err != nil {
+		panic(callError(m.rt, err))
+	}
+	return v.ToObject(m.rt)
+}
+
+// where renders the conditions of obj, plus the soft-delete filter, as a
+// WHERE clause ("" when there is none).
+func (m *model) where(obj goja.Value) (string, []any) {
+	var (
+		conds []string
+		args  []any
+	)
+	if obj != nil && !goja.IsUndefined(obj) && !goja.IsNull(obj) {
+		o, ok := obj.(*goja.Object)
+		if !ok {
+			m.throw(errors.New("where must be an object"))
+		}
+		for _, key := range o.Keys() {
+			col := m.column(key)
+			v := o.Get(key)
+			switch {
+			case goja.IsNull(v) || goja.IsUndefined(v):
+				conds = append(conds, m.quote(col.Name)+" IS NULL")
+			case isArray(v):
+				items := v.ToObject(m.rt)
+				n := int(items.Get("length").ToInteger())
+				if n == 0 {
+					conds = append(conds, "1 = 0")
+					continue
+				}
+				for i := range n {
+					args = append(args, m.coerce(col, items.Get(strconv.Itoa(i))))
+				}
+				conds = append(conds, m.quote(col.Name)+" IN ("+strings.TrimSuffix(strings.Repeat("?, ", n), ", ")+")")
+			default:
+				conds = append(conds, m.quote(col.Name)+" = ?")
+				args = append(args, m.coerce(col, v))
+			}
+		}
+	}
+	if col := m.table.DeletedColumn(); col != nil {
+		conds = append(conds, m.quote(col.Name)+" IS NULL")
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// pkWhere turns a key value into a where object.
+func (m *model) pkWhere(pk goja.Value) *goja.Object {
+	keys := m.table.PrimaryKeys
+	if len(keys) == 0 {
+		m.throw(errors.New("table has no primary key"))
+	}
+	where := m.rt.NewObject()
+	switch {
+	case pk == nil || goja.IsUndefined(pk) || goja.IsNull(pk):
+		m.throw(errors.New("primary key value required"))
+	case isArray(pk):
+		items := pk.ToObject(m.rt)
+		if int(items.Get("length").ToInteger()) != len(keys) {
+			m.throw(fmt.Errorf("primary key has %d columns", len(keys)))
+		}
+		for i, k := range keys {
+			_ = where.Set(k, items.Get(strconv.Itoa(i)))
+		}
+	case len(keys) > 1:
+		o, ok := pk.(*goja.Object)
+		if !ok {
+			m.throw(fmt.Errorf("primary key has %d columns", len(keys)))
+		}
+		for _, k := range keys {
+			v := o.Get(k)
+			if v == nil || goja.IsUndefined(v) {
+				m.throw(fmt.Errorf("primary key column %s missing", k))
+			}
+			_ = where.Set(k, v)
+		}
+	default:
+		_ = where.Set(keys[0], pk)
+	}
+	return where
+}
+
+func (m *model) find(call goja.FunctionCall) goja.Value {
+	where, args := m.where(call.Argument(0))
+	q := "SELECT * FROM " + m.quote(m.table.FullName()) + where
+	var (
+		orderBy       []string
+		limit, offset int64 = -1, 0
+	)
+	if o, ok := call.Argument(1).(*goja.Object); ok {
+		if v := o.Get("orderBy"); v != nil && !goja.IsUndefined(v) {
+			specs := []goja.Value{v}
+			if isArray(v) {
+				specs = specs[:0]
+				items := v.ToObject(m.rt)
+				for i := range int(items.Get("length").ToInteger()) {
+					specs = append(specs, items.Get(strconv.Itoa(i)))
+				}
+			}
+			for _, s := range specs {
+				orderBy = append(orderBy, m.orderTerm(s.String()))
+			}
+		}
+		limit = m.count64(o, "limit", -1)
+		offset = m.count64(o, "offset", 0)
+	}
+	if len(orderBy) > 0 {
+		q += " ORDER BY " + strings.Join(orderBy, ", ")
+	}
+	if limit >= 0 || offset > 0 {
+		if m.eng.Dialect().URI().DBType == schemas.MSSQL {
+			if len(orderBy) == 0 {
+				q += " ORDER BY (SELECT NULL)"
+			}
+			q += fmt.Sprintf(" OFFSET %d ROWS", offset)
+			if limit >= 0 {
+				q += fmt.Sprintf(" FETCH NEXT %d ROWS ONLY", limit)
+			}
+		} else {
+			// LIMIT -1 is not portable; a huge limit stands for none
+			if limit < 0 {
+				limit = math.MaxInt32
+			}
+			q += fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
+		}
+	}
+	return m.query(q, args...)
+}
+
+// orderTerm renders "name", "-name" or "name desc".
+func (m *model) orderTerm(spec string) string {
+	spec = strings.TrimSpace(spec)
+	dir := ""
+	if strings.HasPrefix(spec, "-") {
+		spec, dir = strings.TrimSpace(spec[1:]), " DESC"
+	} else if f := strings.Fields(spec); len(f) == 2 {
+		switch strings.ToUpper(f[1]) {
+		case "ASC":
+			spec = f[0]
+		case "DESC":
+			spec, dir = f[0], " DESC"
+		}
+	}
+	return m.quote(m.column(spec).Name) + dir
+}
+
+func (m *model) count64(o *goja.Object, name string, def int64) int64 {
+	v := o.Get(name)
+	if v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+		return def
+	}
+	n, ok := v.Export().(int64)
+	if !ok || n < 0 {
+		m.throw(fmt.Errorf("%s must be a non-negative integer", name))
+	}
+	return n
+}
+
+func (m *model) get(call goja.FunctionCall) goja.Value {
+	where, args := m.where(m.pkWhere(call.Argument(0)))
+	rows := m.query("SELECT * FROM "+m.quote(m.table.FullName())+where, args...)
+	if rows.Get("length").ToInteger() == 0 {
+		return goja.Null()
+	}
+	return rows.Get("0")
+}
+
+func (m *model) count(call goja.FunctionCall) goja.Value {
+	where, args := m.where(call.Argument(0))
+	rows := m.query("SELECT count(*) AS n FROM "+m.quote(m.table.FullName())+where, args...)
+	return rows.Get("0").ToObject(m.rt).Get("n")
+}
+
+func (m *model) insert(call goja.FunctionCall) goja.Value {
+	arg := call.Argument(0)
+	if isArray(arg) {
+		items := arg.ToObject(m.rt)
+		out := make([]any, 0)
+		for i := range int(items.Get("length").ToInteger()) {
+			out = append(out, m.insertOne(items.Get(strconv.Itoa(i))))
+		}
+		return m.rt.NewArray(out...)
+	}
+	return m.insertOne(arg)
+}
+
+func (m *model) insertOne(v goja.Value) goja.Value {
+	obj, ok := v.(*goja.Object)
+	if !ok || goja.IsNull(v) {
+		m.throw(errors.New("insert expects an object or an array of objects"))
+	}
+	for _, key := range obj.Keys() {
+		m.column(key)
+	}
+	var (
+		cols []string
+		args []any
+	)
+	pk := m.rt.NewObject()
+	now := time.Now()
+	for _, col := range m.table.Columns {
+		val := obj.Get(col.Name)
+		given := val != nil && !goja.IsUndefined(val)
+		switch {
+		case col.Name == m.table.Deleted:
+			continue
+		case m.table.Created[col.Name] || col.Name == m.table.Updated:
+			args = append(args, m.timestamp(col, now))
+		case col.Name == m.table.Version:
+			args = append(args, 1)
+		case given:
+			args = append(args, m.coerce(col, val))
+		case col.IsAutoIncrement || col.Nullable || col.Default != "":
+			continue
+		default:
+			m.throw(fmt.Errorf("column %s is required", col.Name))
+		}
+		cols = append(cols, m.quote(col.Name))
+		if col.IsPrimaryKey {
+			_ = pk.Set(col.Name, m.rt.ToValue(args[len(args)-1]))
+		}
+	}
+	q := "INSERT INTO " + m.quote(m.table.FullName()) + " (" + strings.Join(cols, ", ") +
+		") VALUES (" + strings.TrimSuffix(strings.Repeat("?, ", len(cols)), ", ") + ")"
+	if len(cols) == 0 {
+		q = "INSERT INTO " + m.quote(m.table.FullName()) + " DEFAULT VALUES"
+	}
+
+	auto := m.table.AutoIncrColumn()
+	if auto != nil && pk.Get(auto.Name) == nil {
+		if m.eng.Dialect().URI().DBType == schemas.POSTGRES {
+			// lib/pq has no LastInsertId
+			rows := m.query(q+" RETURNING "+m.quote(auto.Name), args...)
+			_ = pk.Set(auto.Name, rows.Get("0").ToObject(m.rt).Get(auto.Name))
+		} else {
+			id, err := m.exec(q, args...).LastInsertId()
+			if err != nil {
+				panic(m.rt.NewGoError(err))
+			}
+			_ = pk.Set(auto.Name, id)
+		}
+	} else {
+		m.exec(q, args...)
+	}
+	if len(m.table.PrimaryKeys) == 0 || len(pk.Keys()) < len(m.table.PrimaryKeys) {
+		// no key to read the row back by
+		return obj
+	}
+	where, wargs := m.where(pk)
+	return m.query("SELECT * FROM "+m.quote(m.table.FullName())+where, wargs...).Get("0")
+}
+
+func (m *model) update(call goja.FunctionCall) goja.Value {
+	where, wargs := m.where(m.pkWhere(call.Argument(0)))
+	patch, ok := call.Argument(1).(*goja.Object)
+	if !ok {
+		m.throw(errors.New("update expects a patch object"))
+	}
+	var (
+		sets    []string
+		args    []any
+		version goja.Value
+	)
+	for _, key := range patch.Keys() {
+		col := m.column(key)
+		switch {
+		case col.Name == m.table.Version:
+			version = patch.Get(key)
+		case m.table.Created[col.Name] || col.Name == m.table.Updated || col.Name == m.table.Deleted:
+			// maintained here, as xorm does
+		default:
+			sets = append(sets, m.quote(col.Name)+" = ?")
+			args = append(args, m.coerce(col, patch.Get(key)))
+		}
+	}
+	if col := m.table.UpdatedColumn(); col != nil {
+		sets = append(sets, m.quote(col.Name)+" = ?")
+		args = append(args, m.timestamp(col, time.Now()))
+	}
+	vcol := m.table.VersionColumn()
+	if vcol != nil {
+		sets = append(sets, m.quote(vcol.Name)+" = "+m.quote(vcol.Name)+" + 1")
+		if version != nil && !goja.IsUndefined(version) {
+			where += " AND " + m.quote(vcol.Name) + " = ?"
+			wargs = append(wargs, m.coerce(vcol, version))
+		}
+	}
+	if len(sets) == 0 {
+		return m.rt.ToValue(0)
+	}
+	res := m.exec("UPDATE "+m.quote(m.table.FullName())+" SET "+strings.Join(sets, ", ")+where, append(args, wargs...)...)
+	n, err := res.RowsAffected()
+	if err != nil {
+		panic(m.rt.NewGoError(err))
+	}
+	if n == 0 && version != nil && !goja.IsUndefined(version) {
+		panic(m.rt.NewGoError(fmt.Errorf("%s: %w", m.table.Name, ErrVersionConflict)))
+	}
+	return m.rt.ToValue(n)
+}
+
+func (m *model) delete(call goja.FunctionCall) goja.Value {
+	where, args := m.where(m.pkWhere(call.Argument(0)))
+	var res sql.Result
+	if col := m.table.DeletedColumn(); col != nil {
+		res = m.exec("UPDATE "+m.quote(m.table.FullName())+" SET "+m.quote(col.Name)+" = ?"+where,
+			append([]any{m.timestamp(col, time.Now())}, args...)...)
+	} else {
+		res = m.exec("DELETE FROM "+m.quote(m.table.FullName())+where, args...)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		panic(m.rt.NewGoError(err))
+	}
+	return m.rt.ToValue(n)
+}
+
+// timestamp is the value of a created, updated or deleted column at t:
+// unix seconds for integer columns, as xorm stores them, else the time.
+func (m *model) timestamp(col *so.Column, t time.Time) any {
+	if kindOfType(col.SQLType.Name) == kindInt {
+		return t.Unix()
+	}
+	if m.eng.TZLocation != nil {
+		t = t.In(m.eng.TZLocation)
+	}
+	return t
+}
+
+// coerce checks v against the column and converts it to the value bound for it.
+func (m *model) coerce(col *so.Column, v goja.Value) any {
+	if v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+		if !col.Nullable {
+			m.throw(fmt.Errorf("column %s is not nullable", col.Name))
+		}
+		return nil
+	}
+	out, err := coerceValue(col, v.Export())
+	if err != nil {
+		m.throw(fmt.Errorf("column %s: %w", col.Name, err))
+	}
+	return out
+}
+
+func coerceValue(col *so.Column, x any) (any, error) {
+	kind := kindOfType(col.SQLType.Name)
+	if col.IsJSON || col.IsJSONB {
+		kind = kindJSON
+	}
+	switch kind {
+	case kindInt:
+		switch n := x.(type) {
+		case int64:
+			return n, nil
+		case float64:
+			if n == math.Trunc(n) && math.Abs(n) <= maxSafeInteger {
+				return int64(n), nil
+			}
+		case string:
+			if i, err := strconv.ParseInt(strings.TrimSpace(n), 10, 64); err == nil {
+				return i, nil
+			}
+		}
+		return nil, fmt.Errorf("%v is not an integer", x)
+	case kindDecimal, kindFloat:
+		switch n := x.(type) {
+		case int64, float64:
+			return n, nil
+		case string:
+			if _, err := strconv.ParseFloat(strings.TrimSpace(n), 64); err == nil {
+				// decimals stay text so no precision is lost on the way in
+				if kind == kindDecimal {
+					return strings.TrimSpace(n), nil
+				}
+				f, _ := strconv.ParseFloat(strings.TrimSpace(n), 64)
+				return f, nil
+			}
+		}
+		return nil, fmt.Errorf("%v is not a number", x)
+	case kindBool:
+		switch b := x.(type) {
+		case bool:
+			return b, nil
+		case int64:
+			if b == 0 || b == 1 {
+				return b == 1, nil
+			}
+		case string:
+			if v, err := strconv.ParseBool(b); err == nil {
+				return v, nil
+			}
+		}
+		return nil, fmt.Errorf("%v is not a boolean", x)
+	case kindDate:
+		switch t := x.(type) {
+		case time.Time:
+			return t, nil
+		case int64:
+			return time.UnixMilli(t), nil
+		case string:
+			if v, ok := parseDate(t, time.UTC); ok {
+				return v, nil
+			}
+		}
+		return nil, fmt.Errorf("%v is not a date", x)
+	case kindJSON:
+		if s, ok := x.(string); ok {
+			if !json.Valid([]byte(s)) {
+				return nil, errors.New("invalid JSON text")
+			}
+			return s, nil
+		}
+		b, err := json.Marshal(x)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case kindBlob:
+		switch b := x.(type) {
+		case goja.ArrayBuffer:
+			return b.Bytes(), nil
+		case []byte:
+			return b, nil
+		case string:
+			return []byte(b), nil
+		}
+		return nil, fmt.Errorf("%T is not binary", x)
+	}
+	var s string
+	switch t := x.(type) {
+	case string:
+		s = t
+	case int64, float64, bool:
+		s = fmt.Sprint(t)
+	default:
+		return nil, fmt.Errorf("%T is not text", x)
+	}
+	if col.Length > 0 && int64(utf8.RuneCountInString(s)) > col.Length {
+		return nil, fmt.Errorf("%q is longer than %d characters", s, col.Length)
+	}
+	return s, nil
+}
+
+func isArray(v goja.Value) bool {
+	o, ok := v.(*goja.Object)
+	return ok && o.ClassName() == "Array"
+}
@@ -0,0 +1,210 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/dop251/goja"
+	so "github.com/everpan/go-mdm/schema-orm"
+	"xorm.io/xorm"
+)
+
+func modelTables() []*so.Table {
+	customer := so.NewTable("customer", nil)
+	for _, c := range []*so.Column{
+		{Name: "id", SQLType: so.SQLType{Name: "INTEGER"}, IsPrimaryKey: true, IsAutoIncrement: true},
+		{Name: "name", SQLType: so.SQLType{Name: "VARCHAR"}, Length: 10},
+		{Name: "credit", SQLType: so.SQLType{Name: "DECIMAL"}, Nullable: true},
+		{Name: "vip", SQLType: so.SQLType{Name: "BOOL"}, Default: "0"},
+		{Name: "tags", SQLType: so.SQLType{Name: "TEXT"}, IsJSON: true, Nullable: true},
+		{Name: "created", SQLType: so.SQLType{Name: "DATETIME"}, IsCreated: true, Nullable: true},
+		{Name: "updated", SQLType: so.SQLType{Name: "BIGINT"}, IsUpdated: true, Nullable: true},
+		{Name: "deleted", SQLType: so.SQLType{Name: "DATETIME"}, IsDeleted: true, Nullable: true},
+		{Name: "version", SQLType: so.SQLType{Name: "INTEGER"}, IsVersion: true, Nullable: true},
+	} {
+		customer.AddColumn(c)
+	}
+	line := so.NewTable("order_line", nil)
+	for _, c := range []*so.Column{
+		{Name: "order_id", SQLType: so.SQLType{Name: "INTEGER"}, IsPrimaryKey: true},
+		{Name: "no", SQLType: so.SQLType{Name: "INTEGER"}, IsPrimaryKey: true},
+		{Name: "qty", SQLType: so.SQLType{Name: "INTEGER"}},
+	} {
+		line.AddColumn(c)
+	}
+	return []*so.Table{customer, line}
+}
+
+func newModelsRuntime(t *testing.T) (*goja.Runtime, *xorm.Engine) {
+	t.Helper()
+	eng, err := NewXORM("sqlite", "file:"+t.TempDir()+"/models.db")
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	t.Cleanup(func() { eng.Close() })
+	if _, err := eng.Import(strings.NewReader(`
+		CREATE TABLE customer (id INTEGER PRIMARY KEY AUTOINCREMENT, name VARCHAR(10) NOT NULL, credit DECIMAL(10,2),
+			vip BOOLEAN NOT NULL DEFAULT 0, tags TEXT, created DATETIME, updated BIGINT, deleted DATETIME, version INTEGER);
+		CREATE TABLE order_line (order_id INTEGER, no INTEGER, qty INTEGER NOT NULL, PRIMARY KEY (order_id, no));
+	`)); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	rt := goja.New()
+	if err := RegisterModels(rt, eng, modelTables()); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	return rt, eng
+}
+
+func TestModels_CRUD(t *testing.T) {
+	rt, eng := newModelsRuntime(t)
+	v, err := rt.RunString(`
+		var c = models.customer;
+		var a = c.insert({name: 'ann', credit: '10.50', vip: true, tags: ['x', 'y']});
+		var more = c.insert([{name: 'bob', vip: 1}, {name: 'cy'}]);
+		var got = c.get(a.id);
+		[a.id, a.version, a.created instanceof Date, typeof a.updated, a.deleted, a.tags[1], a.vip,
+		 more.length, more[1].id, more[1].vip, got.name, c.get(99)].join('|')
+	`)
+	if err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	if got := v.String(); got != "1|1|true|number||y|true|2|3|false|ann|" {
+		t.Fatalf("insert: %s", got)
+	}
+
+	v, err = rt.RunString(`
+		[c.find({vip: true}, {orderBy: '-name'}).map(function (r) { return r.name; }).join(','),
+		 c.find(null, {orderBy: ['vip desc', 'id'], limit: 2, offset: 1}).map(function (r) { return r.id; }).join(','),
+		 c.find({id: [1, 3], credit: null}).length,
+		 c.count(), c.count({name: 'cy'}),
+		 c.update(1, {credit: 20, name: 'anne'}), c.get(1).version, c.get(1).credit, c.get(1).name,
+		 c.update(2, {version: 1, vip: false}), c.get(2).version
+		].join('|')
+	`)
+	if err != nil {
+		t.Fatalf("find/update: %v", err)
+	}
+	if got := v.String(); got != "bob,ann|2,3|1|3|1|1|2|20|anne|1|2" {
+		t.Fatalf("find/update: %s", got)
+	}
+
+	// a stale version is rejected
+	if _, err := rt.RunString(`c.update(2, {version: 1, name: 'x'})`); err == nil || !strings.Contains(err.Error(), "version changed") {
+		t.Fatalf("stale version: %v", err)
+	}
+
+	// delete is soft: the row stays but reads skip it
+	v, err = rt.RunString(`[c.delete(3), c.delete(3), c.get(3), c.count(), c.update(3, {name: 'z'})].join('|')`)
+	if err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if got := v.String(); got != "1|0||2|0" {
+		t.Fatalf("delete: %s", got)
+	}
+	if n, err := eng.Table("customer").Count(); err != nil || n != 3 {
+		t.Fatalf("rows: %d %v", n, err)
+	}
+}
+
+func TestModels_CompositeKeyAndHardDelete(t *testing.T) {
+	rt, _ := newModelsRuntime(t)
+	v, err := rt.RunString(`
+		var l = models.order_line;
+		l.insert([{order_id: 1, no: 1, qty: 2}, {order_id: 1, no: 2, qty: '3'}]);
+		[l.get([1, 2]).qty, l.get({order_id: 1, no: 1}).qty, l.update([1, 1], {qty: 5}),
+		 l.delete({order_id: 1, no: 2}), l.count({order_id: 1})].join('|')
+	`)
+	if err != nil {
+		t.Fatalf("script: %v", err)
+	}
+	if got := v.String(); got != "3|2|1|1|1" {
+		t.Fatalf("got %s", got)
+	}
+}
+
+func TestModels_Validation(t *testing.T) {
+	rt, _ := newModelsRuntime(t)
+	for script, want := range map[string]string{
+		`models.customer.insert({name: 'a', nope: 1})`:       `unknown column "nope"`,
+		`models.customer.insert({vip: true})`:                "column name is required",
+		`models.customer.insert({name: null})`:               "column name is not nullable",
+		`models.customer.insert({name: 'a very long name'})`: "longer than 10",
+		`models.customer.insert({name: 'a', credit: 'ten'})`: "is not a number",
+		`models.customer.insert({name: 'a', vip: 'maybe'})`:  "is not a boolean",
+		`models.customer.insert({name: 'a', tags: '{bad'})`:  "invalid JSON",
+		`models.customer.find({id: 1.5})`:                    "is not an integer",
+		`models.customer.find({}, {orderBy: 'secret'})`:      `unknown column "secret"`,
+		`models.customer.find({}, {limit: -1})`:              "limit must be",
+		`models.order_line.get(1)`:                           "primary key has 2 columns",
+		`models.order_line.get({order_id: 1})`:               "primary key column no missing",
+		`models.customer.update(1)`:                          "update expects a patch object",
+		`models.customer.insert(5)`:                          "insert expects an object",
+		`models.customer.get(null)`:                          "primary key value required",
+	} {
+		_, err := rt.RunString(script)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: %v, want %q", script, err, want)
+		}
+	}
+
+	if _, err := BindModels(rt, "db", nil); err == nil {
+		t.Fatal("expected error for unsupported database")
+	}
+	tables := modelTables()
+	if _, err := BindModels(rt, &xorm.Engine{}, append(tables, tables[0])); err == nil {
+		t.Fatal("expected error for duplicate table")
+	}
+}
+
+func TestModels_Session(t *testing.T) {
+	rt, eng := newModelsRuntime(t)
+	sess := eng.NewSession()
+	defer sess.Close()
+	if err := sess.Begin(); err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	models, err := BindModels(rt, sess, modelTables())
+	if err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+	_ = rt.Set("txModels", models)
+	if _, err := rt.RunString(`txModels.customer.insert({name: 'tx'})`); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	if err := sess.Rollback(); err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	if v, err := rt.RunString(`models.customer.count()`); err != nil || v.ToInteger() != 0 {
+		t.Fatalf("count after rollback: %v %v", v, err)
+	}
+}
+
+func TestModels_Options(t *testing.T) {
+	rt, eng := newModelsRuntime(t)
+	if _, err := rt.RunString(`models.customer.insert({name: 'ann'})`); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	ro, err := BindModelsWith(rt, eng, modelTables(), BindOptions{
+		ReadOnly: true,
+		Deny:     []string{"count"},
+		Validators: map[string]ArgValidator{"get": func(args []any) error {
+			if len(args) == 0 || args[0] == nil {
+				return errors.New("key required")
+			}
+			return nil
+		}},
+	})
+	if err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+	_ = rt.Set("ro", ro)
+	v, err := rt.RunString(`var c = ro.customer; [typeof c.insert, typeof c.update, typeof c.delete, typeof c.count, c.find().length, c.get(1).name].join(',')`)
+	if err != nil || v.String() != "undefined,undefined,undefined,undefined,1,ann" {
+		t.Fatalf("read-only: %v %v", v, err)
+	}
+	if _, err := rt.RunString(`ro.customer.get()`); err == nil || !strings.Contains(err.Error(), "get: key required") {
+		t.Fatalf("validator: %v", err)
+	}
+}
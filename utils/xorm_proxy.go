@@ -0,0 +1,191 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dop251/goja"
+	"xorm.io/xorm"
+)
+
+// Proxy holds the instance of T that a proxy binding (see BindProxy) calls.
+// The instance can be replaced at any time, while scripts call it too: each
+// call runs on the instance that was current when it started. It is safe for
+// concurrent use.
+type Proxy[T any] struct {
+	cur atomic.Pointer[proxySlot[T]]
+}
+
+// proxySlot is one instance of a Proxy and the calls running on it.
+type proxySlot[T any] struct {
+	v T
+
+	mu      sync.Mutex
+	calls   int
+	retired bool
+	drained chan struct{} // closed once retired with no call left
+}
+
+func newProxySlot[T any](v T) *proxySlot[T] {
+	return &proxySlot[T]{v: v, drained: make(chan struct{})}
+}
+
+// NewProxy returns a proxy holding v, which may be the zero value until Set.
+func NewProxy[T any](v T) *Proxy[T] {
+	p := &Proxy[T]{}
+	p.cur.Store(newProxySlot(v))
+	return p
+}
+
+// Load returns the current instance.
+func (p *Proxy[T]) Load() T {
+	return p.cur.Load().v
+}
+
+// Set makes v the current instance and returns the previous one at once,
+// calls may still be running on it.
+func (p *Proxy[T]) Set(v T) T {
+	return p.replace(v).v
+}
+
+// Swap makes v the current instance, waits until the calls running on the
+// previous one have returned and then closes it if it is an io.Closer. New
+// calls go to v while Swap waits. When ctx ends first Swap returns its error
+// and leaves the previous instance open.
+//
+// Only calls through the binding are counted: a transaction for its whole
+// callback and an async query until it finished. Sessions and rows that a
+// script keeps from a call use the old instance after the call returned.
+func (p *Proxy[T]) Swap(ctx context.Context, v T) error {
+	old := p.replace(v)
+	select {
+	case <-old.drained:
+	case <-ctx.Done():
+		return fmt.Errorf("proxy: drain: %w", ctx.Err())
+	}
+	if c, ok := any(old.v).(io.Closer); ok && !isNilValue(old.v) {
+		return c.Close()
+	}
+	return nil
+}
+
+// replace makes v the current instance and returns the previous slot, whose
+// drained is closed once the calls running on it have returned.
+func (p *Proxy[T]) replace(v T) *proxySlot[T] {
+	old := p.cur.Swap(newProxySlot(v))
+	old.retire()
+	return old
+}
+
+// acquire returns the current instance and counts a call on it until the
+// returned release is called, once.
+func (p *Proxy[T]) acquire() (T, func()) {
+	for {
+		s := p.cur.Load()
+		s.mu.Lock()
+		if !s.retired {
+			s.calls++
+			s.mu.Unlock()
+			return s.v, s.release
+		}
+		// replaced meanwhile, the new slot is stored already
+		s.mu.Unlock()
+	}
+}
+
+func (s *proxySlot[T]) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls--
+	if s.retired && s.calls == 0 {
+		close(s.drained)
+	}
+}
+
+func (s *proxySlot[T]) retire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retired = true
+	if s.calls == 0 {
+		close(s.drained)
+	}
+}
+
+// isNilValue reports whether v is nil or a nil pointer, map, slice, func,
+// channel or interface.
+func isNilValue(v any) bool {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// noRelease is the release of an instance that is not counted.
+func noRelease() {}
+
+// BindProxy exposes the methods of T as BindAllMethods does, calling the
+// instance that p holds when each call starts; T may be an interface type.
+// A call while p holds nil throws a TypeError. A Proxy[*xorm.Engine] also
+// gets transaction, queryTyped and the async methods.
+func BindProxy[T any](rt *goja.Runtime, p *Proxy[T]) *goja.Object {
+	return bindProxy(rt, p, nil)
+}
+
+// BindProxyWith is BindProxy restricted by opts, see BindAllMethodsWith.
+func BindProxyWith[T any](rt *goja.Runtime, p *Proxy[T], opts BindOptions) *goja.Object {
+	return bindProxy(rt, p, newBindPolicy(opts))
+}
+
+func bindProxy[T any](rt *goja.Runtime, p *Proxy[T], policy *bindPolicy) *goja.Object {
+	return bindAcquired(rt, p.acquire, policy)
+}
+
+// bindAcquired binds the methods of T, running each call on the instance
+// that acquire returns and releasing it when the call is done; transactions
+// for their whole callback and async queries until they finished.
+func bindAcquired[T any](rt *goja.Runtime, acquire func() (T, func()), policy *bindPolicy) *goja.Object {
+	obj := rt.NewObject()
+	// We iterate methods from the type to avoid capturing a specific instance.
+	typ := reflect.TypeFor[T]()
+	iface := typ.Kind() == reflect.Interface
+	for i := 0; i < typ.NumMethod(); i++ {
+		m := typ.Method(i)
+		if m.PkgPath != "" || !policy.exposes(m.Name) {
+			continue
+		}
+		meth := m
+		_ = obj.Set(meth.Name, func(call goja.FunctionCall) goja.Value {
+			v, release := acquire()
+			defer release()
+			if isNilValue(v) {
+				panic(rt.NewTypeError("%s not set for proxy", typ))
+			}
+			recv, meth := reflect.ValueOf(v), meth
+			if iface {
+				// interface methods carry no receiver, call the dynamic type's
+				meth, _ = recv.Type().MethodByName(meth.Name)
+			}
+			return callMethod(rt, call, meth, func() (reflect.Value, reflect.Method) { return recv, meth }, policy)
+		})
+	}
+	if acquireEngine, ok := any(acquire).(func() (*xorm.Engine, func())); ok {
+		bindTransaction(rt, obj, acquireEngine, policy)
+		bindQueryTyped(rt, obj, func(string) (any, func()) {
+			eng, release := acquireEngine()
+			if eng == nil {
+				return nil, release
+			}
+			return eng, release
+		}, policy)
+		bindAsync(rt, obj, func(string, string) (*xorm.Engine, func()) { return acquireEngine() }, policy)
+	}
+	return obj
+}
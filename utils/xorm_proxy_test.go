@@ -0,0 +1,222 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+	"xorm.io/xorm"
+)
+
+type proxyTarget struct {
+	name    string
+	block   chan struct{}
+	entered chan struct{}
+	closed  atomic.Bool
+}
+
+func newProxyTarget(name string) *proxyTarget {
+	return &proxyTarget{name: name, block: make(chan struct{}), entered: make(chan struct{}, 1)}
+}
+
+func (p *proxyTarget) Name() string { return p.name }
+
+// Wait blocks until block is closed.
+func (p *proxyTarget) Wait() string {
+	p.entered <- struct{}{}
+	<-p.block
+	return p.name
+}
+
+func (p *proxyTarget) Close() error {
+	if p.closed.Swap(true) {
+		return errors.New("closed twice")
+	}
+	return nil
+}
+
+func TestProxy_SwapDrains(t *testing.T) {
+	oldT, newT := newProxyTarget("old"), newProxyTarget("new")
+	p := NewProxy(oldT)
+	// two runtimes share the proxy, as concurrent scripts do
+	busy, other := goja.New(), goja.New()
+	_ = busy.Set("t", BindProxy(busy, p))
+	_ = other.Set("t", BindProxy(other, p))
+
+	waited := make(chan string)
+	go func() {
+		v, err := busy.RunString(`t.Wait()`)
+		if err != nil {
+			waited <- err.Error()
+			return
+		}
+		waited <- v.String()
+	}()
+	<-oldT.entered
+
+	swapped := make(chan error)
+	go func() { swapped <- p.Swap(context.Background(), newT) }()
+	// new calls reach the new instance while the old one drains
+	for p.Load() != newT {
+		time.Sleep(time.Millisecond)
+	}
+	if v, err := other.RunString(`t.Name()`); err != nil || v.String() != "new" {
+		t.Fatalf("during drain: %v %v", v, err)
+	}
+	select {
+	case err := <-swapped:
+		t.Fatalf("swap returned before the call finished: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	if oldT.closed.Load() {
+		t.Fatal("old instance closed during a call")
+	}
+
+	close(oldT.block)
+	if got := <-waited; got != "old" {
+		t.Fatalf("in-flight call: %s", got)
+	}
+	if err := <-swapped; err != nil || !oldT.closed.Load() {
+		t.Fatalf("swap: %v, closed %v", err, oldT.closed.Load())
+	}
+	if newT.closed.Load() {
+		t.Fatal("new instance closed")
+	}
+}
+
+func TestProxy_SwapTimeout(t *testing.T) {
+	oldT := newProxyTarget("old")
+	p := NewProxy(oldT)
+	rt := goja.New()
+	_ = rt.Set("t", BindProxy(rt, p))
+	done := make(chan struct{})
+	go func() {
+		_, _ = rt.RunString(`t.Wait()`)
+		close(done)
+	}()
+	<-oldT.entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Swap(ctx, newProxyTarget("new")); !errors.Is(err, context.DeadlineExceeded) || oldT.closed.Load() {
+		t.Fatalf("swap: %v, closed %v", err, oldT.closed.Load())
+	}
+	close(oldT.block)
+	<-done
+
+	// Set replaces without closing; a nil instance throws
+	if old := p.Set(nil); old.Name() != "new" {
+		t.Fatalf("set returned %s", old.Name())
+	}
+	if _, err := rt.RunString(`t.Name()`); err == nil || !strings.Contains(err.Error(), "not set for proxy") {
+		t.Fatalf("nil: %v", err)
+	}
+	if err := p.Swap(context.Background(), oldT); err != nil {
+		t.Fatalf("swap from nil: %v", err)
+	}
+}
+
+func TestProxy_Interface(t *testing.T) {
+	p := NewProxy[fmt.Stringer](time.Second)
+	rt := goja.New()
+	_ = rt.Set("s", BindProxy(rt, p))
+	v, err := rt.RunString(`s.String()`)
+	if err != nil || v.String() != "1s" {
+		t.Fatalf("first: %v %v", v, err)
+	}
+	p.Set(time.Minute)
+	if v, err = rt.RunString(`s.String()`); err != nil || v.String() != "1m0s" {
+		t.Fatalf("second: %v %v", v, err)
+	}
+	p.Set(nil)
+	if _, err := rt.RunString(`s.String()`); err == nil {
+		t.Fatal("expected error for nil instance")
+	}
+}
+
+func TestProxy_EngineTransactionDrains(t *testing.T) {
+	rt, oldEng := newTxRuntime(t)
+	newEng, err := NewXORM("sqlite", "file:"+t.TempDir()+"/new.db")
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	defer newEng.Close()
+	if _, err := newEng.Exec("CREATE TABLE item (id INTEGER PRIMARY KEY, name TEXT)"); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	p := NewProxy[*xorm.Engine](oldEng)
+	_ = rt.Set("db", BindProxy(rt, p))
+	swapped := make(chan error, 1)
+	_ = rt.Set("swap", func() { go func() { swapped <- p.Swap(context.Background(), newEng) }() })
+	_ = rt.Set("swappedYet", func() bool {
+		time.Sleep(20 * time.Millisecond)
+		return len(swapped) > 0
+	})
+	v, err := rt.RunString(`
+		var during = db.transaction(function (tx) {
+			tx.Exec('INSERT INTO item (id, name) VALUES (1, ?)', 'old');
+			swap();
+			return swappedYet();
+		});
+		during + ',' + db.queryTyped('SELECT count(*) AS n FROM item')[0].n
+	`)
+	if err != nil || v.String() != "false,0" {
+		t.Fatalf("run: %v %v", v, err)
+	}
+	if err := <-swapped; err != nil {
+		t.Fatalf("swap: %v", err)
+	}
+	if err := oldEng.Ping(); err == nil {
+		t.Fatal("old engine still open")
+	}
+
+	// async queries release the engine when they finished
+	loop := NewEventLoop(rt, LoopOptions{})
+	v, err = loop.RunScript(context.Background(), `db.QueryStringAsync('SELECT count(*) AS n FROM item').then(function (r) { return r[0].n; })`)
+	if err != nil || v.String() != "0" {
+		t.Fatalf("async: %v %v", v, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := p.Swap(ctx, nil); err != nil {
+		t.Fatalf("swap after async: %v", err)
+	}
+	if err := newEng.Ping(); err == nil {
+		t.Fatal("new engine still open")
+	}
+}
+
+func TestProxy_RejectedAsyncHoldsNoEngine(t *testing.T) {
+	rt, eng := newTxRuntime(t)
+	p := NewProxy[*xorm.Engine](eng)
+	_ = rt.Set("ro", BindProxyWith(rt, p, BindOptions{ReadOnly: true}))
+	// swap runs while the script, whose end would release a held slot, still runs
+	_ = rt.Set("swap", func() string {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := p.Swap(ctx, nil); err != nil {
+			return err.Error()
+		}
+		return "swapped"
+	})
+	loop := NewEventLoop(rt, LoopOptions{})
+	v, err := loop.RunScript(context.Background(), `
+		var names = [];
+		try { ro.QueryStringAsync('DELETE FROM item'); } catch (e) { names.push(e.name); }
+		try { ro.queryTypedAsync('DELETE FROM item'); } catch (e) { names.push(e.name); }
+		names.push(swap());
+		names.join(',')
+	`)
+	if err != nil || v.String() != "TypeError,TypeError,swapped" {
+		t.Fatalf("run: %v %v", v, err)
+	}
+	if err := eng.Ping(); err == nil {
+		t.Fatal("engine still open")
+	}
+}
@@ -0,0 +1,465 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+	"gopkg.in/yaml.v3"
+	"xorm.io/xorm"
+)
+
+// DefaultDrainTimeout is how long a DBRegistry waits at most for the calls
+// still running on an engine that a reload replaced or removed, unless
+// RegistryOptions says otherwise.
+const DefaultDrainTimeout = 30 * time.Second
+
+// DatabaseConfig describes one named engine of a DBRegistry.
+type DatabaseConfig struct {
+	Driver string `yaml:"driver" json:"driver"`
+	// DSN may refer to environment variables as $VAR or ${VAR}, so that
+	// credentials stay out of the file.
+	DSN             string        `yaml:"dsn" json:"dsn"`
+	MaxOpenConns    int           `yaml:"maxOpenConns,omitempty" json:"maxOpenConns,omitempty"`
+	MaxIdleConns    int           `yaml:"maxIdleConns,omitempty" json:"maxIdleConns,omitempty"`
+	ConnMaxLifetime time.Duration `yaml:"connMaxLifetime,omitempty" json:"connMaxLifetime,omitempty"`
+	ConnMaxIdleTime time.Duration `yaml:"connMaxIdleTime,omitempty" json:"connMaxIdleTime,omitempty"`
+	Tags            []string      `yaml:"tags,omitempty" json:"tags,omitempty"`
+	// Replicas are the DSNs of read replicas of DSN. With replicas the
+	// database is an engine group: reads go to a replica picked by Policy
+	// (see GroupPolicyByName), the rest to the primary. The pool settings
+	// apply to every engine of the group.
+	Replicas []string `yaml:"replicas,omitempty" json:"replicas,omitempty"`
+	Policy   string   `yaml:"policy,omitempty" json:"policy,omitempty"`
+	// Weights, one per replica, weigh the replicas for the weighted policies.
+	Weights []int `yaml:"weights,omitempty" json:"weights,omitempty"`
+}
+
+// RegistryConfig is the content of a registry file:
+//
+//	databases:
+//	  crm:
+//	    driver: postgres
+//	    dsn: ${CRM_DSN}
+//	    maxOpenConns: 20
+//	    connMaxLifetime: 30m
+//	    tags: [primary]
+//	    replicas: [${CRM_REPLICA_DSN}]
+//	    policy: leastConn
+type RegistryConfig struct {
+	Databases map[string]DatabaseConfig `yaml:"databases" json:"databases"`
+}
+
+// ParseRegistryConfig decodes and validates a registry file.
+func ParseRegistryConfig(data []byte) (*RegistryConfig, error) {
+	cfg := &RegistryConfig{}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("registry config: %w", err)
+	}
+	for name, db := range cfg.Databases {
+		switch {
+		case name == "":
+			return nil, errors.New("registry config: database without name")
+		case db.Driver == "":
+			return nil, fmt.Errorf("registry config: database %s: driver required", name)
+		case db.MaxOpenConns < 0 || db.MaxIdleConns < 0 || db.ConnMaxLifetime < 0 || db.ConnMaxIdleTime < 0:
+			return nil, fmt.Errorf("registry config: database %s: negative pool setting", name)
+		case len(db.Weights) > 0 && len(db.Weights) != len(db.Replicas):
+			return nil, fmt.Errorf("registry config: database %s: %d weights for %d replicas", name, len(db.Weights), len(db.Replicas))
+		}
+		if len(db.Replicas) > 0 {
+			if _, err := GroupPolicyByName(db.Policy, db.Weights); err != nil {
+				return nil, fmt.Errorf("registry config: database %s: %w", name, err)
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// LoadRegistryConfig reads and parses the registry file at path.
+func LoadRegistryConfig(path string) (*RegistryConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("registry config: %w", err)
+	}
+	return ParseRegistryConfig(data)
+}
+
+// RegistryOptions configures a DBRegistry.
+type RegistryOptions struct {
+	// DrainTimeout is how long an engine that a reload replaced or removed
+	// stays open at most for the script calls still running on it; it is
+	// closed as soon as they returned. Zero means DefaultDrainTimeout;
+	// closing then also waits for queries in flight.
+	DrainTimeout time.Duration
+}
+
+// DBRegistry holds named engines opened from a RegistryConfig. Scripts reach
+// them by name instead of opening their own pools from DSNs in code. It is
+// safe for concurrent use.
+type DBRegistry struct {
+	opts RegistryOptions
+	path string
+	// applyMu serializes Apply
+	applyMu sync.Mutex
+
+	mu sync.RWMutex
+	// entries holds each database behind a proxy, so that a reload can wait
+	// for the script calls running on the engine it replaces
+	entries map[string]*Proxy[*registryEntry]
+	retired []io.Closer
+	closed  bool
+}
+
+type registryEntry struct {
+	cfg DatabaseConfig
+	// resolved is cfg with the environment variables expanded
+	resolved DatabaseConfig
+	engine   *xorm.Engine
+	// group is set when the database has replicas; engine is its primary
+	group *xorm.EngineGroup
+	// routing is group, or a group of engine alone for a database without
+	// replicas, whose reads then stay on engine. Bindings call through it,
+	// so that they work whichever kind the database has at the call.
+	routing *xorm.EngineGroup
+}
+
+// resolveConfig expands the environment variables in the DSNs of cfg.
+func resolveConfig(cfg DatabaseConfig) DatabaseConfig {
+	cfg.DSN = os.ExpandEnv(cfg.DSN)
+	if cfg.Replicas != nil {
+		replicas := make([]string, len(cfg.Replicas))
+		for i, dsn := range cfg.Replicas {
+			replicas[i] = os.ExpandEnv(dsn)
+		}
+		cfg.Replicas = replicas
+	}
+	return cfg
+}
+
+// closer is what closes the entry's engines.
+func (e *registryEntry) closer() io.Closer {
+	if e.group != nil {
+		return e.group
+	}
+	return e.engine
+}
+
+// NewDBRegistry opens the engines of cfg. When one fails to open, those
+// already opened are closed again.
+func NewDBRegistry(cfg *RegistryConfig, opts RegistryOptions) (*DBRegistry, error) {
+	if opts.DrainTimeout <= 0 {
+		opts.DrainTimeout = DefaultDrainTimeout
+	}
+	r := &DBRegistry{opts: opts, entries: map[string]*Proxy[*registryEntry]{}}
+	if err := r.Apply(cfg); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// LoadDBRegistry opens the engines of the registry file at path; Reload
+// reads it again.
+func LoadDBRegistry(path string, opts RegistryOptions) (*DBRegistry, error) {
+	cfg, err := LoadRegistryConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := NewDBRegistry(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+	r.path = path
+	return r, nil
+}
+
+// openEntry opens the engine, or the engine group, for cfg, whose resolved
+// form is resolved, and applies its pool settings.
+func openEntry(cfg, resolved DatabaseConfig) (*registryEntry, error) {
+	if len(resolved.Replicas) == 0 {
+		eng, err := NewXORM(resolved.Driver, resolved.DSN)
+		if err != nil {
+			return nil, err
+		}
+		setPool(eng, resolved)
+		routing, err := xorm.NewEngineGroup(eng, []*xorm.Engine(nil))
+		if err != nil {
+			_ = eng.Close()
+			return nil, err
+		}
+		return &registryEntry{cfg: cfg, resolved: resolved, engine: eng, routing: routing}, nil
+	}
+	policy, err := GroupPolicyByName(resolved.Policy, resolved.Weights)
+	if err != nil {
+		return nil, err
+	}
+	g, err := NewXORMGroup(resolved.Driver, resolved.DSN, resolved.Replicas, policy)
+	if err != nil {
+		return nil, err
+	}
+	setPool(g.Master(), resolved)
+	for _, eng := range g.Slaves() {
+		setPool(eng, resolved)
+	}
+	return &registryEntry{cfg: cfg, resolved: resolved, engine: g.Master(), group: g, routing: g}, nil
+}
+
+// setPool applies the pool settings of cfg to eng.
+func setPool(eng *xorm.Engine, cfg DatabaseConfig) {
+	if cfg.MaxOpenConns > 0 {
+		eng.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+	if cfg.MaxIdleConns > 0 {
+		eng.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	if cfg.ConnMaxLifetime > 0 {
+		eng.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	}
+	if cfg.ConnMaxIdleTime > 0 {
+		eng.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	}
+}
+
+// Apply makes cfg the registry's configuration. Engines whose configuration
+// did not change, after expanding environment variables, are kept; the
+// others are opened anew. An engine that was replaced or removed is closed
+// once the script calls running on it returned, or after the drain timeout.
+// When an engine fails to open nothing changes.
+func (r *DBRegistry) Apply(cfg *RegistryConfig) error {
+	if cfg == nil {
+		cfg = &RegistryConfig{}
+	}
+	r.applyMu.Lock()
+	defer r.applyMu.Unlock()
+	r.mu.RLock()
+	closed := r.closed
+	current := r.entries
+	r.mu.RUnlock()
+	if closed {
+		return errors.New("registry: closed")
+	}
+
+	changed := make(map[string]*registryEntry, len(cfg.Databases))
+	var opened []io.Closer
+	for name, db := range cfg.Databases {
+		resolved := resolveConfig(db)
+		if p, ok := current[name]; ok && reflect.DeepEqual(p.Load().resolved, resolved) {
+			continue
+		}
+		e, err := openEntry(db, resolved)
+		if err != nil {
+			for _, c := range opened {
+				_ = c.Close()
+			}
+			return fmt.Errorf("registry: open %s: %w", name, err)
+		}
+		opened = append(opened, e.closer())
+		changed[name] = e
+	}
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		for _, c := range opened {
+			_ = c.Close()
+		}
+		return errors.New("registry: closed")
+	}
+	next := make(map[string]*Proxy[*registryEntry], len(cfg.Databases))
+	var retire []*proxySlot[*registryEntry]
+	for name := range cfg.Databases {
+		p, ok := r.entries[name]
+		e, isChanged := changed[name]
+		switch {
+		case !ok:
+			p = NewProxy(e)
+		case isChanged:
+			retire = append(retire, p.replace(e))
+		}
+		next[name] = p
+	}
+	for name, p := range r.entries {
+		if _, ok := next[name]; !ok {
+			retire = append(retire, p.replace(nil))
+		}
+	}
+	r.entries = next
+	for _, s := range retire {
+		r.retired = append(r.retired, s.v.closer())
+	}
+	r.mu.Unlock()
+	for _, s := range retire {
+		go r.drain(s)
+	}
+	return nil
+}
+
+// drain closes the engine of a replaced entry once the calls running on it
+// have returned, or after the drain timeout.
+func (r *DBRegistry) drain(s *proxySlot[*registryEntry]) {
+	timer := time.NewTimer(r.opts.DrainTimeout)
+	defer timer.Stop()
+	select {
+	case <-s.drained:
+	case <-timer.C:
+	}
+	r.closeRetired(s.v.closer())
+}
+
+// Reload applies the registry file again; see Apply.
+func (r *DBRegistry) Reload() error {
+	if r.path == "" {
+		return errors.New("registry: not loaded from a file")
+	}
+	cfg, err := LoadRegistryConfig(r.path)
+	if err != nil {
+		return err
+	}
+	return r.Apply(cfg)
+}
+
+// closeRetired closes c unless Close did already.
+func (r *DBRegistry) closeRetired(c io.Closer) {
+	r.mu.Lock()
+	i := slices.Index(r.retired, c)
+	if i >= 0 {
+		r.retired = slices.Delete(r.retired, i, i+1)
+	}
+	r.mu.Unlock()
+	if i >= 0 {
+		_ = c.Close()
+	}
+}
+
+// proxy returns the proxy of the database named name.
+func (r *DBRegistry) proxy(name string) (*Proxy[*registryEntry], error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if p, ok := r.entries[name]; ok {
+		return p, nil
+	}
+	return nil, fmt.Errorf("registry: unknown database %q", name)
+}
+
+func (r *DBRegistry) entry(name string) (*registryEntry, error) {
+	p, err := r.proxy(name)
+	if err != nil {
+		return nil, err
+	}
+	if e := p.Load(); e != nil {
+		return e, nil
+	}
+	return nil, fmt.Errorf("registry: unknown database %q", name)
+}
+
+// Engine returns the engine named name, the primary for a database with
+// replicas. Calls on it are not counted: a reload that replaces it closes it
+// after the drain timeout at the latest, even while they run.
+func (r *DBRegistry) Engine(name string) (*xorm.Engine, error) {
+	e, err := r.entry(name)
+	if err != nil {
+		return nil, err
+	}
+	return e.engine, nil
+}
+
+// Group returns the engine group named name, or nil when the database has
+// no replicas.
+func (r *DBRegistry) Group(name string) (*xorm.EngineGroup, error) {
+	e, err := r.entry(name)
+	if err != nil {
+		return nil, err
+	}
+	return e.group, nil
+}
+
+// Config returns the configuration of the engine named name.
+func (r *DBRegistry) Config(name string) (DatabaseConfig, bool) {
+	e, err := r.entry(name)
+	if err != nil {
+		return DatabaseConfig{}, false
+	}
+	return e.cfg, true
+}
+
+// Names returns the names of the engines, sorted.
+func (r *DBRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.entries))
+	for name := range r.entries {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Tagged returns the sorted names of the engines tagged tag.
+func (r *DBRegistry) Tagged(tag string) []string {
+	var names []string
+	for _, name := range r.Names() {
+		if cfg, ok := r.Config(name); ok && slices.Contains(cfg.Tags, tag) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Close closes every engine, the retired ones included, and returns the
+// first error.
+func (r *DBRegistry) Close() error {
+	r.mu.Lock()
+	closers := r.retired
+	for _, p := range r.entries {
+		closers = append(closers, p.Load().closer())
+	}
+	r.entries, r.retired, r.closed = map[string]*Proxy[*registryEntry]{}, nil, true
+	r.mu.Unlock()
+	var first error
+	for _, c := range closers {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// RegisterDBRegistry sets the global `db(name)` in rt, which returns the
+// registry's database named name bound with BindAllMethodsWith and opts as
+// an engine group: reads go to a replica when it has any.
+// db.names() and db.tagged(tag) list the databases. The binding calls the
+// database that name has when each call starts, and a reload waits for the
+// calls running on the engine it replaces, transactions for their whole
+// callback, before it closes that engine.
+func RegisterDBRegistry(rt *goja.Runtime, reg *DBRegistry, opts BindOptions) error {
+	policy := newBindPolicy(opts)
+	fn := rt.ToValue(func(call goja.FunctionCall) goja.Value {
+		name, ok := call.Argument(0).Export().(string)
+		if !ok || name == "" {
+			panic(rt.NewTypeError("db(name) requires a database name"))
+		}
+		p, err := reg.proxy(name)
+		if err != nil {
+			panic(rt.NewGoError(err))
+		}
+		// a reload may give the database replicas or take them away, so
+		// every call routes through the entry it acquired
+		return bindGroup(rt, func() (*xorm.EngineGroup, func()) {
+			e, release := p.acquire()
+			if e == nil {
+				release()
+				panic(rt.NewGoError(fmt.Errorf("registry: database %q was removed", name)))
+			}
+			return e.routing, release
+		}, policy)
+	}).(*goja.Object)
+	_ = fn.Set("names", func() []string { return reg.Names() })
+	_ = fn.Set("tagged", func(tag string) []string { return reg.Tagged(tag) })
+	return rt.Set("db", fn)
+}
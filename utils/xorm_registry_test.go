@@ -0,0 +1,254 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+	"xorm.io/xorm"
+)
+
+func writeRegistryFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+func TestDBRegistry_LoadAndScripts(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("REGISTRY_TEST_DIR", dir)
+	path := filepath.Join(dir, "databases.yaml")
+	writeRegistryFile(t, path, `
+databases:
+  crm:
+    driver: sqlite
+    dsn: file:${REGISTRY_TEST_DIR}/crm.db
+    maxOpenConns: 3
+    maxIdleConns: 2
+    connMaxLifetime: 30m
+    tags: [primary, sales]
+  erp:
+    driver: sqlite
+    dsn: file:${REGISTRY_TEST_DIR}/erp.db
+    tags: [primary]
+`)
+	reg, err := LoadDBRegistry(path, RegistryOptions{DrainTimeout: time.Minute})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	defer reg.Close()
+
+	crm, err := reg.Engine("crm")
+	if err != nil || crm.DB().Stats().MaxOpenConnections != 3 {
+		t.Fatalf("crm: %v", err)
+	}
+	if cfg, ok := reg.Config("crm"); !ok || cfg.ConnMaxLifetime != 30*time.Minute {
+		t.Fatalf("config: %+v", cfg)
+	}
+
+	rt := goja.New()
+	if err := RegisterDBRegistry(rt, reg, BindOptions{ReadOnly: true}); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	v, err := rt.RunString(`
+		[db.names().join(','), db.tagged('sales').join(','), db('erp').QueryString('SELECT 1 AS x')[0].x, typeof db('crm').Exec].join('|')
+	`)
+	if err != nil || v.String() != "crm,erp|crm|1|undefined" {
+		t.Fatalf("script: %v %v", v, err)
+	}
+	for _, script := range []string{`db('nope')`, `db()`} {
+		if _, err := rt.RunString(script); err == nil {
+			t.Errorf("%s: expected error", script)
+		}
+	}
+
+	// crm is removed, erp changes, sales is new
+	erp, _ := reg.Engine("erp")
+	writeRegistryFile(t, path, `
+databases:
+  erp:
+    driver: sqlite
+    dsn: file:${REGISTRY_TEST_DIR}/erp.db
+    maxOpenConns: 5
+    tags: [primary]
+  sales:
+    driver: sqlite
+    dsn: file:${REGISTRY_TEST_DIR}/sales.db
+`)
+	if err := reg.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	erp2, _ := reg.Engine("erp")
+	if strings.Join(reg.Names(), ",") != "erp,sales" || erp2 == erp || erp2.DB().Stats().MaxOpenConnections != 5 {
+		t.Fatalf("after reload: %v", reg.Names())
+	}
+	// a retired pool without script calls closes without waiting for the
+	// drain timeout
+	waitClosed(t, crm)
+
+	// a reload that cannot open an engine changes nothing
+	sales, _ := reg.Engine("sales")
+	writeRegistryFile(t, path, `
+databases:
+  sales:
+    driver: sqlite
+    dsn: file:${REGISTRY_TEST_DIR}/sales.db
+  broken:
+    driver: nosuchdriver
+    dsn: x
+`)
+	if err := reg.Reload(); err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Fatalf("broken reload: %v", err)
+	}
+	if got, _ := reg.Engine("sales"); got != sales || len(reg.Names()) != 2 {
+		t.Fatalf("registry changed: %v", reg.Names())
+	}
+
+	if err := reg.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if err := sales.Ping(); err == nil {
+		t.Fatal("sales still open after close")
+	}
+	if err := reg.Apply(&RegistryConfig{}); err == nil {
+		t.Fatal("apply after close")
+	}
+}
+
+// waitClosed fails unless eng is closed within a second.
+func waitClosed(t *testing.T, eng *xorm.Engine) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); eng.Ping() == nil; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("engine still open")
+		}
+	}
+}
+
+func TestDBRegistry_DrainAndRotation(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("REGISTRY_TEST_DIR", dir)
+	t.Setenv("REGISTRY_TEST_DB", "a")
+	path := filepath.Join(dir, "databases.yaml")
+	writeRegistryFile(t, path, `
+databases:
+  crm:
+    driver: sqlite
+    dsn: file:${REGISTRY_TEST_DIR}/${REGISTRY_TEST_DB}.db
+`)
+	reg, err := LoadDBRegistry(path, RegistryOptions{DrainTimeout: time.Minute})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	defer reg.Close()
+	old, _ := reg.Engine("crm")
+
+	// a reload during a transaction waits for its callback, and the
+	// rotated variable opens the new database although the file is the same
+	rt := goja.New()
+	_ = RegisterDBRegistry(rt, reg, BindOptions{})
+	_ = rt.Set("rotate", func() {
+		t.Setenv("REGISTRY_TEST_DB", "b")
+		if err := reg.Reload(); err != nil {
+			panic(rt.NewGoError(err))
+		}
+	})
+	_ = rt.Set("oldOpen", func() bool { return old.Ping() == nil })
+	v, err := rt.RunString(`
+		var crm = db('crm');
+		var open = crm.transaction(function (tx) {
+			tx.Exec('CREATE TABLE item (id INTEGER)');
+			rotate();
+			tx.Exec('INSERT INTO item (id) VALUES (1)');
+			return oldOpen();
+		});
+		// the binding follows the reload
+		[open, crm.QueryString("SELECT count(*) AS n FROM sqlite_master WHERE name = 'item'")[0].n].join(',')
+	`)
+	if err != nil || v.String() != "true,0" {
+		t.Fatalf("script: %v %v", v, err)
+	}
+	if eng, _ := reg.Engine("crm"); eng == old || eng.DataSourceName() != "file:"+dir+"/b.db" {
+		t.Fatalf("not reopened: %v", eng.DataSourceName())
+	}
+	waitClosed(t, old)
+
+	// removed databases throw
+	writeRegistryFile(t, path, "databases: {}\n")
+	if err := reg.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if _, err := rt.RunString(`crm.QueryString('SELECT 1')`); err == nil || !strings.Contains(err.Error(), "was removed") {
+		t.Fatalf("removed: %v", err)
+	}
+}
+
+func TestParseRegistryConfig_Errors(t *testing.T) {
+	for content, want := range map[string]string{
+		"databases: [":                   "registry config",
+		"databases:\n  a:\n    dsn: x\n": "driver required",
+		"databases:\n  a:\n    driver: x\n    maxOpenConns: -1\n":      "negative pool setting",
+		"databases:\n  a:\n    driver: x\n    connMaxLifetime: soon\n": "registry config",
+	} {
+		if _, err := ParseRegistryConfig([]byte(content)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: %v, want %q", content, err, want)
+		}
+	}
+	if _, err := LoadRegistryConfig(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Fatal("expected error for missing file")
+	}
+	reg, err := NewDBRegistry(nil, RegistryOptions{})
+	if err != nil || len(reg.Names()) != 0 {
+		t.Fatalf("empty: %v", err)
+	}
+	if err := reg.Reload(); err == nil {
+		t.Fatal("expected error reloading without a file")
+	}
+}
+
+func TestDBRegistry_ReplicasFollowReload(t *testing.T) {
+	dir := t.TempDir()
+	primary, replicas := newGroupDBs(t, dir)
+	path := filepath.Join(dir, "databases.yaml")
+	plain := "databases:\n  crm:\n    driver: sqlite\n    dsn: " + primary + "\n"
+	grouped := plain + "    replicas: [" + strings.Join(replicas, ", ") + "]\n"
+	writeRegistryFile(t, path, plain)
+	reg, err := LoadDBRegistry(path, RegistryOptions{DrainTimeout: time.Minute})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	defer reg.Close()
+
+	rt := goja.New()
+	_ = RegisterDBRegistry(rt, reg, BindOptions{})
+	_ = rt.Set("reload", func(content string) {
+		writeRegistryFile(t, path, content)
+		if err := reg.Reload(); err != nil {
+			panic(rt.NewGoError(err))
+		}
+	})
+	_ = rt.Set("plain", plain)
+	_ = rt.Set("grouped", grouped)
+	v, err := rt.RunString(`
+		var crm = db('crm');
+		function who() { return crm.QueryString('SELECT name FROM who')[0].name; }
+		var out = [who(), crm.queryTyped('SELECT name FROM who')[0].name];
+		// the binding taken for a single engine reads from the replicas it gains
+		reload(grouped);
+		out.push(who(), crm.primary().QueryString('SELECT name FROM who')[0].name);
+		// and from the primary again once they are gone
+		reload(plain);
+		out.push(who(), crm.queryTyped('SELECT name FROM who')[0].name);
+		out.join(',')
+	`)
+	if err != nil {
+		t.Fatalf("script: %v", err)
+	}
+	if got := v.String(); got != "primary,primary,r1,primary,primary,primary" && got != "primary,primary,r2,primary,primary,primary" {
+		t.Fatalf("got %s", got)
+	}
+}
@@ -0,0 +1,433 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+	so "github.com/everpan/go-mdm/schema-orm"
+	"xorm.io/xorm"
+	"xorm.io/xorm/core"
+)
+
+// RowOptions controls how QueryJS turns query results into JS values.
+type RowOptions struct {
+	// BigNumbersAsStrings returns DECIMAL and NUMERIC values, and integers
+	// beyond ±(2^53-1), as strings instead of numbers that would lose
+	// precision.
+	BigNumbersAsStrings bool
+	// Table, when set, types the result columns found in it by their
+	// schema-orm definition; other columns use the driver's column types.
+	Table *so.Table
+}
+
+// valueKind is how the values of a result column are converted.
+type valueKind int
+
+const (
+	kindAuto valueKind = iota // by the Go type the driver returned
+	kindBool
+	kindInt
+	kindDecimal
+	kindFloat
+	kindDate
+	kindJSON
+	kindBlob
+	kindText
+)
+
+// kindOfType maps a database type name, as reported by the driver or
+// declared in a schema, to a valueKind. Unknown names convert by value.
+func kindOfType(name string) valueKind {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if i := strings.IndexByte(name, '('); i >= 0 {
+		name = strings.TrimSpace(name[:i])
+	}
+	name = strings.TrimPrefix(strings.TrimSuffix(name, " UNSIGNED"), "UNSIGNED ")
+	switch name {
+	case "BOOL", "BOOLEAN", "BIT":
+		return kindBool
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "INTEGER", "BIGINT",
+		"INT2", "INT4", "INT8", "SMALLSERIAL", "SERIAL", "BIGSERIAL":
+		return kindInt
+	case "DECIMAL", "NUMERIC", "NUMBER", "MONEY":
+		return kindDecimal
+	case "FLOAT", "FLOAT4", "FLOAT8", "REAL", "DOUBLE", "DOUBLE PRECISION":
+		return kindFloat
+	case "DATE", "DATETIME", "DATETIME2", "SMALLDATETIME", "TIMESTAMP", "TIMESTAMPTZ",
+		"TIMESTAMP WITH TIME ZONE", "TIMESTAMP WITHOUT TIME ZONE", "DATETIMEOFFSET":
+		return kindDate
+	case "JSON", "JSONB":
+		return kindJSON
+	case "BLOB", "TINYBLOB", "MEDIUMBLOB", "LONGBLOB", "BYTEA", "BINARY", "VARBINARY", "IMAGE":
+		return kindBlob
+	case "":
+		return kindAuto
+	}
+	return kindText
+}
+
+// columnKinds types every result column, preferring the definition in table.
+func columnKinds(types []*sql.ColumnType, table *so.Table) []valueKind {
+	kinds := make([]valueKind, len(types))
+	for i, ct := range types {
+		if table != nil {
+			if col := table.GetColumn(ct.Name()); col != nil {
+				if col.IsJSON || col.IsJSONB {
+					kinds[i] = kindJSON
+				} else {
+					kinds[i] = kindOfType(col.SQLType.Name)
+				}
+				continue
+			}
+		}
+		kinds[i] = kindOfType(ct.DatabaseTypeName())
+	}
+	return kinds
+}
+
+// maxSafeInteger is the largest integer a JS number holds exactly.
+const maxSafeInteger = 1<<53 - 1
+
+// rowConverter turns scanned values into JS values.
+type rowConverter struct {
+	rt   *goja.Runtime
+	opts RowOptions
+	// loc is the zone of date strings without an offset
+	loc *time.Location
+}
+
+func (c *rowConverter) value(v any, kind valueKind) goja.Value {
+	if v == nil {
+		return goja.Null()
+	}
+	if kind == kindAuto {
+		switch v.(type) {
+		case int64, uint64:
+			kind = kindInt
+		case time.Time:
+			kind = kindDate
+		case bool:
+			kind = kindBool
+		case float64, float32:
+			kind = kindFloat
+		default:
+			kind = kindText
+		}
+	}
+	if b, ok := v.([]byte); ok && kind != kindBlob {
+		v = string(b)
+	}
+	switch kind {
+	case kindBool:
+		switch x := v.(type) {
+		case bool:
+			return c.rt.ToValue(x)
+		case int64:
+			return c.rt.ToValue(x != 0)
+		case string:
+			// MySQL returns BIT(1) as one raw byte
+			if len(x) == 1 && x[0] <= 1 {
+				return c.rt.ToValue(x[0] == 1)
+			}
+			if b, err := strconv.ParseBool(x); err == nil {
+				return c.rt.ToValue(b)
+			}
+		}
+	case kindInt:
+		switch x := v.(type) {
+		case int64:
+			return c.integer(x, strconv.FormatInt(x, 10))
+		case uint64:
+			if x > maxSafeInteger && c.opts.BigNumbersAsStrings {
+				return c.rt.ToValue(strconv.FormatUint(x, 10))
+			}
+			return c.rt.ToValue(x)
+		case string:
+			if n, err := strconv.ParseInt(x, 10, 64); err == nil {
+				return c.integer(n, x)
+			}
+			return c.number(x)
+		}
+	case kindDecimal:
+		if c.opts.BigNumbersAsStrings {
+			switch x := v.(type) {
+			case string:
+				return c.rt.ToValue(x)
+			case float64:
+				return c.rt.ToValue(strconv.FormatFloat(x, 'f', -1, 64))
+			case int64:
+				return c.rt.ToValue(strconv.FormatInt(x, 10))
+			}
+		}
+		if s, ok := v.(string); ok {
+			return c.number(s)
+		}
+	case kindFloat:
+		if s, ok := v.(string); ok {
+			return c.number(s)
+		}
+	case kindDate:
+		switch x := v.(type) {
+		case time.Time:
+			return c.date(x)
+		case string:
+			if t, ok := parseDate(x, c.loc); ok {
+				return c.date(t)
+			}
+		}
+	case kindJSON:
+		if s, ok := v.(string); ok {
+			dec := json.NewDecoder(strings.NewReader(s))
+			dec.UseNumber()
+			var doc any
+			if err := dec.Decode(&doc); err == nil {
+				return c.rt.ToValue(c.jsonNumbers(doc))
+			}
+		}
+	case kindBlob:
+		if b, ok := v.([]byte); ok {
+			return c.rt.ToValue(c.rt.NewArrayBuffer(bytes.Clone(b)))
+		}
+	}
+	return c.rt.ToValue(v)
+}
+
+func (c *rowConverter) integer(n int64, text string) goja.Value {
+	if (n > maxSafeInteger || n < -maxSafeInteger) && c.opts.BigNumbersAsStrings {
+		return c.rt.ToValue(text)
+	}
+	return c.rt.ToValue(n)
+}
+
+// number parses s as a float, or keeps it as a string when it is not one.
+func (c *rowConverter) number(s string) goja.Value {
+	if f, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+		return c.rt.ToValue(f)
+	}
+	return c.rt.ToValue(s)
+}
+
+func (c *rowConverter) date(t time.Time) goja.Value {
+	d, err := c.rt.New(c.rt.Get("Date"), c.rt.ToValue(t.UnixMilli()))
+	if err != nil {
+		return c.rt.ToValue(t)
+	}
+	return d
+}
+
+// jsonNumbers replaces the json.Numbers in a decoded document with int64 or
+// float64, or with their text for big integers when asked to.
+func (c *rowConverter) jsonNumbers(doc any) any {
+	switch x := doc.(type) {
+	case map[string]any:
+		for k, v := range x {
+			x[k] = c.jsonNumbers(v)
+		}
+	case []any:
+		for i, v := range x {
+			x[i] = c.jsonNumbers(v)
+		}
+	case json.Number:
+		text := x.String()
+		if n, err := x.Int64(); err == nil {
+			if (n > maxSafeInteger || n < -maxSafeInteger) && c.opts.BigNumbersAsStrings {
+				return text
+			}
+			return n
+		}
+		if c.opts.BigNumbersAsStrings && !strings.ContainsAny(text, ".eE") {
+			// an integer beyond int64
+			return text
+		}
+		f, _ := x.Float64()
+		return f
+	}
+	return doc
+}
+
+// dateLayouts are the textual date formats drivers return when they do not
+// parse dates themselves.
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999-07",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+}
+
+func parseDate(s string, loc *time.Location) (time.Time, bool) {
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// RowsToJS reads all rows into a JS array of objects whose properties follow
+// the column order. Values are typed by column: numbers, strings, booleans,
+// Date objects, null, parsed JSON documents and ArrayBuffers for binary
+// columns. Date strings without an offset are read in loc (UTC when nil).
+func RowsToJS(rt *goja.Runtime, rows *sql.Rows, opts RowOptions, loc *time.Location) (goja.Value, error) {
+	scanned, err := scanRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	return scanned.toJS(rt, opts, loc), nil
+}
+
+// scannedRows is a result read into Go values, so that reading it does not
+// need the runtime, which may be busy on another goroutine.
+type scannedRows struct {
+	types []*sql.ColumnType
+	rows  [][]any
+}
+
+func scanRows(rows *sql.Rows) (*scannedRows, error) {
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	out := &scannedRows{types: types}
+	for rows.Next() {
+		vals := make([]any, len(types))
+		dest := make([]any, len(types))
+		for i := range vals {
+			dest[i] = &vals[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		out.rows = append(out.rows, vals)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// toJS converts the rows as RowsToJS describes.
+func (s *scannedRows) toJS(rt *goja.Runtime, opts RowOptions, loc *time.Location) goja.Value {
+	if loc == nil {
+		loc = time.UTC
+	}
+	kinds := columnKinds(s.types, opts.Table)
+	conv := &rowConverter{rt: rt, opts: opts, loc: loc}
+	out := make([]any, 0, len(s.rows))
+	for _, vals := range s.rows {
+		obj := rt.NewObject()
+		for i, ct := range s.types {
+			_ = obj.Set(ct.Name(), conv.value(vals[i], kinds[i]))
+		}
+		out = append(out, obj)
+	}
+	return rt.NewArray(out...)
+}
+
+// QueryJS runs a raw query on db, an *xorm.Engine or an *xorm.Session (inside
+// its transaction when one is open), and converts the result with RowsToJS.
+// Date strings without an offset are read in the engine's DatabaseTZ.
+func QueryJS(rt *goja.Runtime, db any, opts RowOptions, query string, args ...any) (goja.Value, error) {
+	return QueryJSContext(context.Background(), rt, db, opts, query, args...)
+}
+
+// QueryJSContext is QueryJS running the query under ctx.
+func QueryJSContext(ctx context.Context, rt *goja.Runtime, db any, opts RowOptions, query string, args ...any) (goja.Value, error) {
+	scanned, loc, err := queryRows(ctx, db, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanned.toJS(rt, opts, loc), nil
+}
+
+// queryRows runs the query of QueryJSContext and returns its rows with the
+// engine's DatabaseTZ.
+func queryRows(ctx context.Context, db any, query string, args ...any) (*scannedRows, *time.Location, error) {
+	var (
+		eng *xorm.Engine
+		tx  *core.Tx
+	)
+	switch x := db.(type) {
+	case *xorm.Engine:
+		eng = x
+	case *xorm.Session:
+		eng = x.Engine()
+		if x.IsInTx() {
+			tx = x.Tx()
+		}
+	default:
+		return nil, nil, fmt.Errorf("query: unsupported database %T", db)
+	}
+	// the dialect's filters rewrite ? placeholders, as xorm does for its own queries
+	for _, f := range eng.Dialect().Filters() {
+		query = f.Do(ctx, query)
+	}
+	var (
+		rows *core.Rows
+		err  error
+	)
+	if tx != nil {
+		rows, err = tx.QueryContext(ctx, query, args...)
+	} else {
+		rows, err = eng.DB().QueryContext(ctx, query, args...)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	scanned, err := scanRows(rows.Rows)
+	return scanned, eng.DatabaseTZ, err
+}
+
+// bindQueryTyped adds queryTyped([options,] sql, ...args) to obj, running
+// QueryJS on the value db returns. options is {bigNumbersAsStrings}.
+// policy decides whether it is added and checks its arguments.
+func bindQueryTyped(rt *goja.Runtime, obj *goja.Object, db func(query string) (any, func()), policy *bindPolicy) {
+	if !policy.exposes("queryTyped") {
+		return
+	}
+	_ = obj.Set("queryTyped", func(call goja.FunctionCall) goja.Value {
+		opts, query, params := queryTypedArgs(rt, call, "queryTyped", policy)
+		target, release := db(query)
+		defer release()
+		if target == nil {
+			panic(rt.NewTypeError("xorm engine not set for proxy"))
+		}
+		ctx, cancel := policy.callContext(rt)
+		defer cancel()
+		v, err := QueryJSContext(ctx, rt, target, opts, query, params...)
+		if err != nil {
+			panic(callError(rt, err))
+		}
+		return v
+	})
+}
+
+// queryTypedArgs reads ([options,] sql, ...args) and checks them with policy.
+func queryTypedArgs(rt *goja.Runtime, call goja.FunctionCall, name string, policy *bindPolicy) (RowOptions, string, []any) {
+	var opts RowOptions
+	args := call.Arguments
+	if len(args) > 0 {
+		if o, ok := args[0].(*goja.Object); ok && o.ClassName() == "Object" {
+			opts.BigNumbersAsStrings = o.Get("bigNumbersAsStrings") != nil && o.Get("bigNumbersAsStrings").ToBoolean()
+			args = args[1:]
+		}
+	}
+	if len(args) == 0 {
+		panic(rt.NewTypeError("%s([options,] sql, ...args) requires sql", name))
+	}
+	params := make([]any, len(args)-1)
+	for i, a := range args[1:] {
+		params[i] = a.Export()
+	}
+	policy.check(rt, "queryTyped", append([]any{args[0].Export()}, params...))
+	return opts, args[0].String(), params
+}
@@ -0,0 +1,159 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+	so "github.com/everpan/go-mdm/schema-orm"
+	"xorm.io/xorm"
+)
+
+func newRowsRuntime(t *testing.T) (*goja.Runtime, *xorm.Engine) {
+	t.Helper()
+	eng, err := NewXORM("sqlite", "file:"+t.TempDir()+"/rows.db")
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	t.Cleanup(func() { eng.Close() })
+	if _, err := eng.Import(strings.NewReader(`
+		CREATE TABLE item (id INTEGER PRIMARY KEY, big BIGINT, price DECIMAL(10,2), ratio REAL, flag BOOLEAN,
+			created DATETIME, doc JSON, data BLOB, name TEXT, raw TEXT);
+		INSERT INTO item VALUES (1, 9007199254740993, 12.5, 0.25, 1, '2026-03-04 05:06:07', '{"n": 9007199254740993, "xs": [1, 2.5], "ok": true}', x'0102ff', 'a', '{"k":1}');
+		INSERT INTO item (id) VALUES (2);
+	`)); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	rt := goja.New()
+	_ = rt.Set("db", BindXORM(rt, eng))
+	return rt, eng
+}
+
+func TestQueryTyped_SQLite(t *testing.T) {
+	rt, _ := newRowsRuntime(t)
+	v, err := rt.RunString(`
+		var r = db.queryTyped('SELECT * FROM item WHERE id = ?', 1)[0];
+		[Object.keys(r).join(','), typeof r.id, r.big, r.price, r.ratio, r.flag === true,
+		 r.created instanceof Date, r.created.toISOString(), r.doc.xs[1], r.doc.ok === true,
+		 r.data instanceof ArrayBuffer, new Uint8Array(r.data)[2], r.name, typeof r.raw,
+		 db.queryTyped('SELECT count(*) AS n FROM item')[0].n === 2].join('|')
+	`)
+	if err != nil {
+		t.Fatalf("script: %v", err)
+	}
+	want := "id,big,price,ratio,flag,created,doc,data,name,raw|number|9007199254740992|12.5|0.25|true|true|2026-03-04T05:06:07.000Z|2.5|true|true|255|a|string|true"
+	if got := v.String(); got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+
+	v, err = rt.RunString(`
+		var r = db.queryTyped({bigNumbersAsStrings: true}, 'SELECT big, price, doc FROM item WHERE id = 1')[0];
+		var n = db.queryTyped('SELECT * FROM item WHERE id = 2')[0];
+		[typeof r.big, r.big, typeof r.price, r.price, r.doc.n, n.big === null, n.created === null, n.doc === null].join('|')
+	`)
+	if err != nil {
+		t.Fatalf("script: %v", err)
+	}
+	if got := v.String(); got != "string|9007199254740993|string|12.5|9007199254740993|true|true|true" {
+		t.Fatalf("big numbers: %s", got)
+	}
+
+	v, err = rt.RunString(`db.transaction(function (tx) {
+		tx.Exec('INSERT INTO item (id, name) VALUES (3, ?)', 'c');
+		return tx.queryTyped('SELECT name FROM item WHERE id = 3')[0].name;
+	})`)
+	if err != nil || v.String() != "c" {
+		t.Fatalf("in transaction: %v %v", v, err)
+	}
+	if _, err := rt.RunString(`db.queryTyped({})`); err == nil || !strings.Contains(err.Error(), "requires sql") {
+		t.Fatalf("missing sql: %v", err)
+	}
+}
+
+func TestQueryJS_SchemaTable(t *testing.T) {
+	rt, eng := newRowsRuntime(t)
+	tb := so.NewTable("item", nil)
+	tb.AddColumn(&so.Column{Name: "raw", SQLType: so.SQLType{Name: "TEXT"}, IsJSON: true})
+	tb.AddColumn(&so.Column{Name: "ratio", SQLType: so.SQLType{Name: "DECIMAL"}})
+	v, err := QueryJS(rt, eng, RowOptions{Table: tb, BigNumbersAsStrings: true}, "SELECT raw, ratio, name FROM item WHERE id = ?", 1)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	_ = rt.Set("rows", v)
+	got, err := rt.RunString(`[rows[0].raw.k, rows[0].ratio, rows[0].name].join('|')`)
+	if err != nil || got.String() != "1|0.25|a" {
+		t.Fatalf("typed by table: %v %v", got, err)
+	}
+	if _, err := QueryJS(rt, "db", RowOptions{}, "SELECT 1"); err == nil {
+		t.Fatal("expected error for unsupported database")
+	}
+}
+
+func TestRowConverter_Values(t *testing.T) {
+	rt := goja.New()
+	plain := &rowConverter{rt: rt, loc: time.UTC}
+	big := &rowConverter{rt: rt, opts: RowOptions{BigNumbersAsStrings: true}, loc: time.UTC}
+	for _, c := range []struct {
+		conv *rowConverter
+		v    any
+		kind valueKind
+		want any
+	}{
+		{plain, []byte("12345678901234567.1234"), kindDecimal, 12345678901234567.1234},
+		{big, []byte("12345678901234567.1234"), kindDecimal, "12345678901234567.1234"},
+		{big, uint64(1 << 60), kindInt, "1152921504606846976"},
+		{big, int64(-1 << 60), kindAuto, "-1152921504606846976"},
+		{big, int64(42), kindInt, int64(42)},
+		{plain, []byte{1}, kindBool, true},
+		{plain, "f", kindBool, false},
+		{plain, int64(0), kindBool, false},
+		{plain, "1.5", kindFloat, 1.5},
+		{plain, "not json", kindJSON, "not json"},
+		{plain, "n/a", kindDate, "n/a"},
+	} {
+		if got := c.conv.value(c.v, c.kind).Export(); got != c.want {
+			t.Fatalf("%v as %d: %#v, want %#v", c.v, c.kind, got, c.want)
+		}
+	}
+	d := plain.value("2026-01-02T03:04:05+08:00", kindDate).ToObject(rt)
+	if d.ClassName() != "Date" || d.Export().(time.Time).UTC().Hour() != 19 {
+		t.Fatalf("date %v", d)
+	}
+	if doc := big.value(`{"n": 123456789012345678901234}`, kindJSON).Export().(map[string]any); doc["n"] != "123456789012345678901234" {
+		t.Fatalf("json %v", doc)
+	}
+	for name, want := range map[string]valueKind{
+		"int4": kindInt, "BIGINT UNSIGNED": kindInt, "numeric(10,2)": kindDecimal, "timestamptz": kindDate,
+		"float8": kindFloat, "bytea": kindBlob, "jsonb": kindJSON, "varchar": kindText, "bit": kindBool, "": kindAuto,
+	} {
+		if got := kindOfType(name); got != want {
+			t.Fatalf("kindOfType(%q) = %d, want %d", name, got, want)
+		}
+	}
+}
+
+func TestQueryTyped_WrapAndProxy(t *testing.T) {
+	rt := goja.New()
+	if err := RegisterXORMWrap(rt); err != nil {
+		t.Fatal(err)
+	}
+	proxy, set := BindXORMProxy(rt)
+	_ = rt.Set("proxy", proxy)
+	if _, err := rt.RunString(`proxy.queryTyped('SELECT 1')`); err == nil || !strings.Contains(err.Error(), "engine not set") {
+		t.Fatalf("unset proxy: %v", err)
+	}
+	eng, err := NewXORM("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eng.Close()
+	set(eng)
+	v, err := rt.RunString(`
+		var w = xormWrap('sqlite', ':memory:');
+		typeof w.queryTyped('SELECT 41 + 1 AS n')[0].n + ':' + proxy.queryTyped('SELECT ? AS s', 'x')[0].s
+	`)
+	if err != nil || v.String() != "number:x" {
+		t.Fatalf("wrap/proxy: %v %v", v, err)
+	}
+}
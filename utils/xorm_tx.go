@@ -0,0 +1,207 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dop251/goja"
+	"xorm.io/xorm"
+	"xorm.io/xorm/schemas"
+)
+
+// TxOptions are the options a script passes as the first argument of
+// transaction(options, fn), as {isolation, readOnly}. Isolation is one of
+// "read uncommitted", "read committed", "repeatable read" and "serializable";
+// case, '_' and '-' are ignored. Empty keeps the database default. MySQL and
+// MariaDB accept no options, see setTransactionSQL.
+type TxOptions struct {
+	Isolation string
+	ReadOnly  bool
+}
+
+var isolationLevels = map[string]string{
+	"read uncommitted": "READ UNCOMMITTED",
+	"read committed":   "READ COMMITTED",
+	"repeatable read":  "REPEATABLE READ",
+	"serializable":     "SERIALIZABLE",
+}
+
+// setTransactionSQL returns the statement that applies opts to a transaction
+// that has just begun, or "" when there is nothing to apply. xorm begins
+// transactions without sql.TxOptions, so the options are set with SQL, which
+// not every database allows once the transaction is open.
+//
+// MySQL and MariaDB only take SET TRANSACTION before BEGIN, on the connection
+// that then runs the transaction. xorm neither pins a connection before Begin
+// nor passes options to it, so any option is rejected for them rather than
+// applied to whichever pooled connection happens to run the SET.
+func setTransactionSQL(dbType schemas.DBType, opts TxOptions) (string, error) {
+	level := ""
+	if opts.Isolation != "" {
+		key := strings.ToLower(strings.NewReplacer("_", " ", "-", " ").Replace(opts.Isolation))
+		if level = isolationLevels[key]; level == "" {
+			return "", fmt.Errorf("unknown isolation level %q", opts.Isolation)
+		}
+	}
+	if level == "" && !opts.ReadOnly {
+		return "", nil
+	}
+	switch dbType {
+	case schemas.POSTGRES:
+		var parts []string
+		if level != "" {
+			parts = append(parts, "ISOLATION LEVEL "+level)
+		}
+		if opts.ReadOnly {
+			parts = append(parts, "READ ONLY")
+		}
+		return "SET TRANSACTION " + strings.Join(parts, ", "), nil
+	case schemas.MSSQL:
+		if opts.ReadOnly {
+			return "", fmt.Errorf("read-only transactions are not supported for %s", dbType)
+		}
+		return "SET TRANSACTION ISOLATION LEVEL " + level, nil
+	case schemas.MYSQL:
+		return "", fmt.Errorf("transaction options %+v are not supported for %s: SET TRANSACTION must precede BEGIN on the same connection, which xorm sessions do not allow", opts, dbType)
+	case schemas.SQLITE:
+		// SQLite transactions are always serializable
+		if level == "SERIALIZABLE" && !opts.ReadOnly {
+			return "", nil
+		}
+	}
+	return "", fmt.Errorf("transaction options %+v are not supported for %s", opts, dbType)
+}
+
+// savepointSQL returns the statements that set, release and roll back to the
+// savepoint name. SQL Server has no release; its savepoints end with the
+// transaction.
+func savepointSQL(dbType schemas.DBType, name string) (set, release, rollback string) {
+	if dbType == schemas.MSSQL {
+		return "SAVE TRANSACTION " + name, "", "ROLLBACK TRANSACTION " + name
+	}
+	return "SAVEPOINT " + name, "RELEASE SAVEPOINT " + name, "ROLLBACK TO SAVEPOINT " + name
+}
+
+// bindTransaction adds transaction([options,] fn) to obj. It begins a
+// transaction on a new session of the engine returned by engine, which is
+// released when transaction returns, calls fn
+// with the bound session and commits when fn returns, or rolls back and
+// rethrows when it throws. The session is closed in every case, a Go panic
+// included. transaction returns what fn returned. The session is bound with
+// policy; nothing is added when the policy does not expose transaction.
+func bindTransaction(rt *goja.Runtime, obj *goja.Object, engine func() (*xorm.Engine, func()), policy *bindPolicy) {
+	if !policy.exposes("transaction") {
+		return
+	}
+	_ = obj.Set("transaction", func(call goja.FunctionCall) goja.Value {
+		opts, fn := txArguments(rt, call, "transaction")
+		eng, release := engine()
+		defer release()
+		if eng == nil {
+			panic(rt.NewTypeError("xorm engine not set for proxy"))
+		}
+		dbType := eng.Dialect().URI().DBType
+		setSQL, err := setTransactionSQL(dbType, opts)
+		if err != nil {
+			panic(rt.NewTypeError(err.Error()))
+		}
+
+		// the transaction lives as long as the script may, see RunWithContext
+		sess := eng.NewSession().Context(ScriptContext(rt))
+		defer sess.Close()
+		if err := sess.Begin(); err != nil {
+			panic(rt.NewGoError(err))
+		}
+		done := false
+		defer func() {
+			if !done {
+				_ = sess.Rollback()
+			}
+		}()
+		if setSQL != "" {
+			if _, err := sess.Exec(setSQL); err != nil {
+				panic(rt.NewGoError(err))
+			}
+		}
+
+		tx := bindTxSession(rt, sess, dbType, policy)
+		ret, err := fn(goja.Undefined(), tx)
+		if err != nil {
+			// a thrown JS value is rethrown as is; interrupts stay uncatchable
+			panic(err)
+		}
+		done = true
+		if err := sess.Commit(); err != nil {
+			panic(rt.NewGoError(err))
+		}
+		return ret
+	})
+}
+
+// bindTxSession binds sess for a transaction callback. Begin, Commit,
+// Rollback and Close are left out, transaction() owns them; transaction(fn)
+// on the session runs fn inside a savepoint.
+func bindTxSession(rt *goja.Runtime, sess *xorm.Session, dbType schemas.DBType, policy *bindPolicy) *goja.Object {
+	tx := bindAllMethods(rt, sess, policy)
+	for _, name := range []string{"Begin", "Commit", "Rollback", "Close"} {
+		_ = tx.Delete(name)
+	}
+	depth := 0
+	_ = tx.Set("transaction", func(call goja.FunctionCall) goja.Value {
+		opts, fn := txArguments(rt, call, "nested transaction")
+		if opts != (TxOptions{}) {
+			panic(rt.NewTypeError("nested transactions take no options"))
+		}
+		depth++
+		defer func() { depth-- }()
+		setSP, releaseSP, rollbackSP := savepointSQL(dbType, fmt.Sprintf("sp_%d", depth))
+		if _, err := sess.Context(ScriptContext(rt)).Exec(setSP); err != nil {
+			panic(callError(rt, err))
+		}
+		done := false
+		defer func() {
+			if !done {
+				_, _ = sess.Context(ScriptContext(rt)).Exec(rollbackSP)
+			}
+		}()
+		ret, err := fn(goja.Undefined(), tx)
+		if err != nil {
+			panic(err)
+		}
+		done = true
+		if releaseSP != "" {
+			if _, err := sess.Context(ScriptContext(rt)).Exec(releaseSP); err != nil {
+				panic(rt.NewGoError(err))
+			}
+		}
+		return ret
+	})
+	return tx
+}
+
+// txArguments reads ([options,] fn) and panics with a TypeError when they do not fit.
+func txArguments(rt *goja.Runtime, call goja.FunctionCall, name string) (TxOptions, goja.Callable) {
+	var opts TxOptions
+	args := call.Arguments
+	if len(args) == 2 {
+		o, ok := args[0].(*goja.Object)
+		if !ok {
+			panic(rt.NewTypeError("%s options must be an object", name))
+		}
+		if v := o.Get("isolation"); v != nil && !goja.IsUndefined(v) {
+			opts.Isolation = v.String()
+		}
+		if v := o.Get("readOnly"); v != nil {
+			opts.ReadOnly = v.ToBoolean()
+		}
+		args = args[1:]
+	}
+	if len(args) != 1 {
+		panic(rt.NewTypeError("%s([options,] fn) requires a function", name))
+	}
+	fn, ok := goja.AssertFunction(args[0])
+	if !ok {
+		panic(rt.NewTypeError("%s([options,] fn) requires a function", name))
+	}
+	return opts, fn
+}
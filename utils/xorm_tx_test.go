@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dop251/goja"
+	"xorm.io/xorm"
+	"xorm.io/xorm/schemas"
+)
+
+func newTxRuntime(t *testing.T) (*goja.Runtime, *xorm.Engine) {
+	t.Helper()
+	rt := goja.New()
+	eng, err := NewXORM("sqlite", "file:"+t.TempDir()+"/tx.db")
+	if err != nil {
+		t.Fatalf("engine: %v", err)
+	}
+	t.Cleanup(func() { eng.Close() })
+	if _, err := eng.Exec("CREATE TABLE item (id INTEGER PRIMARY KEY, name TEXT)"); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	_ = rt.Set("db", BindXORM(rt, eng))
+	_ = rt.Set("inUse", func() int { return eng.DB().Stats().InUse })
+	_ = rt.Set("goPanic", func() { panic("go panic") })
+	return rt, eng
+}
+
+func TestTransaction_CommitAndRollback(t *testing.T) {
+	rt, _ := newTxRuntime(t)
+	v, err := rt.RunString(`
+		var r = db.transaction(function (tx) {
+			tx.Exec('INSERT INTO item (id, name) VALUES (?, ?)', 1, 'a');
+			return typeof tx.Commit + ':' + typeof tx.Close + ':' + tx.QueryString('SELECT count(*) AS n FROM item')[0].n;
+		});
+		var caught;
+		try {
+			db.transaction(function (tx) {
+				tx.Exec('INSERT INTO item (id, name) VALUES (?, ?)', 2, 'b');
+				throw new RangeError('boom');
+			});
+		} catch (e) {
+			caught = e;
+		}
+		r + '|' + (caught instanceof RangeError) + ':' + caught.message + '|' +
+			db.QueryString('SELECT count(*) AS n FROM item')[0].n + '|' + inUse();
+	`)
+	if err != nil {
+		t.Fatalf("script: %v", err)
+	}
+	if got := v.String(); got != "undefined:undefined:1|true:boom|1|0" {
+		t.Fatalf("unexpected %q", got)
+	}
+}
+
+func TestTransaction_NestedSavepoints(t *testing.T) {
+	rt, _ := newTxRuntime(t)
+	v, err := rt.RunString(`
+		db.transaction(function (tx) {
+			tx.Exec('INSERT INTO item (id, name) VALUES (1, ?)', 'outer');
+			try {
+				tx.transaction(function (sp) {
+					sp.Exec('INSERT INTO item (id, name) VALUES (2, ?)', 'inner');
+					throw 'undo';
+				});
+			} catch (e) {
+				if (e !== 'undo') throw e;
+			}
+			tx.transaction(function (sp) {
+				sp.Exec('INSERT INTO item (id, name) VALUES (3, ?)', 'kept');
+				sp.transaction(function (sp2) { sp2.Exec('UPDATE item SET name = ? WHERE id = 3', 'deep'); });
+			});
+		});
+		db.QueryString('SELECT name FROM item ORDER BY id').map(function (r) { return r.name; }).join(',');
+	`)
+	if err != nil {
+		t.Fatalf("script: %v", err)
+	}
+	if got := v.String(); got != "outer,deep" {
+		t.Fatalf("unexpected %q", got)
+	}
+	if _, err := rt.RunString(`db.transaction(function (tx) { tx.transaction({isolation: 'serializable'}, function () {}); })`); err == nil || !strings.Contains(err.Error(), "no options") {
+		t.Fatalf("nested options: %v", err)
+	}
+}
+
+func TestTransaction_OptionsAndArguments(t *testing.T) {
+	rt, _ := newTxRuntime(t)
+	if v, err := rt.RunString(`db.transaction({isolation: 'SERIALIZABLE'}, function () { return 7; })`); err != nil || v.ToInteger() != 7 {
+		t.Fatalf("serializable: %v %v", v, err)
+	}
+	for script, want := range map[string]string{
+		`db.transaction({isolation: 'read_committed'}, function () {})`: "not supported for sqlite3",
+		`db.transaction({isolation: 'snapshot'}, function () {})`:       "unknown isolation level",
+		`db.transaction('x', function () {})`:                           "options must be an object",
+		`db.transaction()`:                                              "requires a function",
+		`db.transaction({}, 1)`:                                         "requires a function",
+	} {
+		if _, err := rt.RunString(script); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: %v, want %q", script, err, want)
+		}
+	}
+
+	for _, c := range []struct {
+		db   schemas.DBType
+		opts TxOptions
+		want string
+	}{
+		{schemas.POSTGRES, TxOptions{Isolation: "repeatable-read", ReadOnly: true}, "SET TRANSACTION ISOLATION LEVEL REPEATABLE READ, READ ONLY"},
+		{schemas.POSTGRES, TxOptions{ReadOnly: true}, "SET TRANSACTION READ ONLY"},
+		{schemas.MSSQL, TxOptions{Isolation: "Read Uncommitted"}, "SET TRANSACTION ISOLATION LEVEL READ UNCOMMITTED"},
+		{schemas.MYSQL, TxOptions{}, ""},
+	} {
+		if got, err := setTransactionSQL(c.db, c.opts); err != nil || got != c.want {
+			t.Fatalf("%s %+v: %q %v", c.db, c.opts, got, err)
+		}
+	}
+	// MySQL and MariaDB (both schemas.MYSQL) take options only before BEGIN
+	for _, opts := range []TxOptions{{Isolation: "serializable"}, {ReadOnly: true}, {Isolation: "read committed", ReadOnly: true}} {
+		if _, err := setTransactionSQL(schemas.MYSQL, opts); err == nil || !strings.Contains(err.Error(), "precede BEGIN") {
+			t.Fatalf("mysql %+v: %v", opts, err)
+		}
+	}
+	if set, release, rollback := savepointSQL(schemas.MSSQL, "sp_1"); set != "SAVE TRANSACTION sp_1" || release != "" || rollback != "ROLLBACK TRANSACTION sp_1" {
+		t.Fatalf("mssql savepoint: %q %q %q", set, release, rollback)
+	}
+}
+
+func TestTransaction_GoPanicClosesSession(t *testing.T) {
+	rt, eng := newTxRuntime(t)
+	func() {
+		defer func() {
+			if r := recover(); r != "go panic" {
+				t.Fatalf("recovered %v", r)
+			}
+		}()
+		_, _ = rt.RunString(`db.transaction(function (tx) { tx.Exec('INSERT INTO item (id, name) VALUES (1, ?)', 'x'); goPanic(); })`)
+	}()
+	rows, err := eng.QueryString("SELECT count(*) AS n FROM item")
+	if err != nil || rows[0]["n"] != "0" {
+		t.Fatalf("rolled back: %v %v", rows, err)
+	}
+	if inUse := eng.DB().Stats().InUse; inUse != 0 {
+		t.Fatalf("%d connections still in use", inUse)
+	}
+}
+
+func TestTransaction_Proxy(t *testing.T) {
+	rt := goja.New()
+	proxy, set := BindXORMProxy(rt)
+	_ = rt.Set("db", proxy)
+	if _, err := rt.RunString(`db.transaction(function () {})`); err == nil || !strings.Contains(err.Error(), "engine not set") {
+		t.Fatalf("unset proxy: %v", err)
+	}
+	eng, err := NewXORM("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eng.Close()
+	set(eng)
+	v, err := rt.RunString(`db.transaction(function (tx) { tx.Exec('CREATE TABLE t (a INTEGER)'); return tx.QueryString('SELECT 1 AS one')[0].one; })`)
+	if err != nil || v.String() != "1" {
+		t.Fatalf("proxy transaction: %v %v", v, err)
+	}
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	"database/sql"
 
+	so "github.com/everpan/go-mdm/schema-orm"
 	"xorm.io/xorm"
 )
 
@@ -16,8 +17,24 @@ func (wrap *XormWrap) SetEngine(engine *xorm.Engine) {
 
 // NewXORM creates a new xorm Engine using the given driver and DSN.
 // It is a light wrapper that keeps the utils package self-contained for tests.
+// In-memory SQLite databases live per connection, so their pool is pinned to one connection.
 func NewXORM(driver, dsn string) (*xorm.Engine, error) {
-	return xorm.NewEngine(driver, dsn)
+	eng, err := xorm.NewEngine(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if isSQLiteMemory(driver, dsn) {
+		eng.SetMaxOpenConns(1)
+		eng.SetMaxIdleConns(1)
+	}
+	return eng, nil
+}
+
+func isSQLiteMemory(driver, dsn string) bool {
+	if driver != so.SQLiteDriver && driver != "sqlite3" {
+		return false
+	}
+	return so.IsSQLiteMemoryDSN(dsn)
 }
 
 // NewXORMWrap creates a new XormWrap Engine using the given driver and DSN.
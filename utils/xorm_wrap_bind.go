@@ -11,8 +11,17 @@ import (
 //   - variadic handling
 //   - trailing error propagation
 //   - wrapping of returned Go values when applicable
+//
+// queryTyped([options,] sql, ...args) returns typed rows, see QueryJS.
 func BindXORMWrap(rt *goja.Runtime, wrap *XormWrap) *goja.Object {
-	return BindAllMethods(rt, wrap)
+	obj := BindAllMethods(rt, wrap)
+	bindQueryTyped(rt, obj, func(string) (any, func()) {
+		if wrap == nil || wrap.engine == nil {
+			return nil, noRelease
+		}
+		return wrap.engine, noRelease
+	}, nil)
+	return obj
 }
 
 // RegisterXORMWrap registers a global constructor function `xormWrap(driver, dsn)`